@@ -0,0 +1,450 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/avito-test/internal/dto"
+	"github.com/avito-test/internal/model"
+	"github.com/avito-test/internal/service"
+	"github.com/google/uuid"
+)
+
+type command struct {
+	description string
+	run         func(ctx context.Context, e *env, args []string) error
+}
+
+var commands = map[string]command{
+	"balance":            {"баланс и последние транзакции пользователя", runBalance},
+	"credit":             {"предложение корректировки-зачисления, проводится после одобрения другим оператором", runCredit},
+	"debit":              {"предложение корректировки-списания, проводится после одобрения другим оператором", runDebit},
+	"cancel-reservation": {"принудительная отмена зависшей резервации", runCancelReservation},
+	"report":             {"повторное формирование отчета за месяц", runReport},
+	"reconcile":          {"сверка балансов с суммой транзакций", runReconcile},
+	"audit-verify":       {"проверка цепочки хешей журнала аудита", runAuditVerify},
+	"account-status":     {"статус счета, заморозка и закрытие с обязательной причиной", runAccountStatus},
+}
+
+func runBalance(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("balance", flag.ContinueOnError)
+	userId := fs.String("user", "", "id пользователя")
+	limit := fs.Int("limit", 20, "количество последних транзакций (1-100)")
+
+	err := parse(fs, args, func() error {
+		if *limit < 1 || *limit > 100 {
+			return errors.New("-limit must be between 1 and 100")
+		}
+
+		return checkUuid("user", *userId)
+	})
+	if err != nil {
+		return err
+	}
+
+	s, err := e.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	balance, err := s.Balance.GetBalanceByUserID(ctx, *userId)
+	if err != nil {
+		return err
+	}
+
+	page, err := s.Transaction.GetTransactions(ctx, model.GetTransactionsRequest{
+		UserId:   *userId,
+		Limit:    *limit,
+		SortBy:   "date",
+		SortType: "desc",
+	})
+	if err != nil {
+		return err
+	}
+
+	output := balanceOutput{
+		UserId:       *userId,
+		Balance:      balance,
+		Total:        page.Total,
+		Transactions: make([]dto.Transaction, 0, len(page.Transactions)),
+	}
+
+	for _, tr := range page.Transactions {
+		output.Transactions = append(output.Transactions, transactionOutput(tr))
+	}
+
+	return e.out.print(output, func(w io.Writer) {
+		fmt.Fprintf(w, "user\t%s\n", output.UserId)
+		fmt.Fprintf(w, "balance\t%s\n", formatSum(output.Balance))
+		fmt.Fprintf(w, "transactions\t%d of %d\n\n", len(output.Transactions), output.Total)
+
+		fmt.Fprintln(w, "DATE\tID\tTYPE\tSUM\tORDER\tSERVICE\tCOMMENT")
+
+		for _, tr := range output.Transactions {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", tr.UpdTime.Format(time.RFC3339), tr.Id, tr.TransactionType,
+				formatSum(tr.Sum), optional(tr.OrderId), optional(tr.ServiceId), optional(tr.Comment))
+		}
+	})
+}
+
+func runCredit(ctx context.Context, e *env, args []string) error {
+	return proposeAdjustment(ctx, e, model.AdjustmentCredit, args)
+}
+
+func runDebit(ctx context.Context, e *env, args []string) error {
+	return proposeAdjustment(ctx, e, model.AdjustmentDebit, args)
+}
+
+// proposeAdjustment разбирает аргументы зачисления или списания и предлагает корректировку: баланс меняется только
+// после одобрения другим оператором (POST /adjustments/{id}/approve), как у корректировок через API
+func proposeAdjustment(ctx context.Context, e *env, direction string, args []string) error {
+	fs := flag.NewFlagSet(direction, flag.ContinueOnError)
+	userId := fs.String("user", "", "id пользователя")
+	sum := fs.Float64("sum", 0, "сумма, больше 0")
+	reason := fs.String("reason", "", "причина, сохраняется в комментарии транзакции корректировки")
+	ticket := fs.String("ticket", "", "номер тикета")
+
+	err := parse(fs, args, func() error {
+		if *sum <= 0 {
+			return errors.New("-sum must be greater than 0")
+		}
+
+		if *reason == "" {
+			return errors.New("-reason is required")
+		}
+
+		if *ticket == "" {
+			return errors.New("-ticket is required")
+		}
+
+		return checkUuid("user", *userId)
+	})
+	if err != nil {
+		return err
+	}
+
+	s, err := e.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	adjustment, err := s.Adjustment.Propose(ctx, model.Adjustment{
+		UserId:    *userId,
+		Direction: direction,
+		Sum:       *sum,
+		Reason:    *reason,
+		Ticket:    *ticket,
+	})
+	if err != nil {
+		return err
+	}
+
+	output := adjustmentOutput(adjustment)
+
+	return e.out.print(output, func(w io.Writer) {
+		fmt.Fprintf(w, "id\t%s\n", output.Id)
+		fmt.Fprintf(w, "user\t%s\n", output.UserId)
+		fmt.Fprintf(w, "direction\t%s\n", output.Direction)
+		fmt.Fprintf(w, "sum\t%s\n", formatSum(output.Sum))
+		fmt.Fprintf(w, "status\t%s\n", output.Status)
+		fmt.Fprintf(w, "proposed by\t%s\n", output.ProposedBy)
+	})
+}
+
+func runCancelReservation(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("cancel-reservation", flag.ContinueOnError)
+	id := fs.String("id", "", "id резервации (транзакции)")
+	reason := fs.String("reason", "", "причина, сохраняется в комментарии транзакции")
+
+	err := parse(fs, args, func() error {
+		if *reason == "" {
+			return errors.New("-reason is required")
+		}
+
+		return checkUuid("id", *id)
+	})
+	if err != nil {
+		return err
+	}
+
+	s, err := e.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	tr, err := s.Transaction.CancelReservation(ctx, *id, reason)
+	if err != nil {
+		return err
+	}
+
+	output := reservationOutput(tr)
+
+	return e.out.print(output, func(w io.Writer) {
+		fmt.Fprintf(w, "id\t%s\n", output.Id)
+		fmt.Fprintf(w, "user\t%s\n", output.UserId)
+		fmt.Fprintf(w, "order\t%s\n", output.OrderId)
+		fmt.Fprintf(w, "service\t%s\n", output.ServiceId)
+		fmt.Fprintf(w, "sum\t%s\n", formatSum(output.Sum))
+		fmt.Fprintf(w, "status\t%s\n", output.Status)
+	})
+}
+
+func runReport(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	month := fs.String("month", "", "месяц отчета в формате YYYY-MM")
+
+	var date time.Time
+
+	err := parse(fs, args, func() error {
+		var err error
+
+		date, err = time.Parse("2006-01", *month)
+		if err != nil {
+			return errors.New("-month must be in YYYY-MM format")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s, err := e.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	id, err := s.Report.CreateReport(ctx, service.MonthReportDate(date.Year(), date.Month()))
+	if err != nil {
+		return err
+	}
+
+	output := reportOutput{File: s.Report.FilePath(id)}
+
+	return e.out.print(output, func(w io.Writer) {
+		fmt.Fprintf(w, "file\t%s\n", output.File)
+	})
+}
+
+// runReconcile выводит расхождения балансов с транзакциями, если они есть - завершается с ошибкой
+func runReconcile(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+
+	if err := parse(fs, args, func() error { return nil }); err != nil {
+		return err
+	}
+
+	s, err := e.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	mismatches, err := s.Balance.Reconcile(ctx)
+	if err != nil {
+		return err
+	}
+
+	output := make([]mismatchOutput, 0, len(mismatches))
+
+	for _, mismatch := range mismatches {
+		output = append(output, mismatchOutput{
+			UserId:     mismatch.UserId,
+			Balance:    mismatch.Balance,
+			Expected:   mismatch.Expected,
+			Difference: mismatch.Balance - mismatch.Expected,
+		})
+	}
+
+	err = e.out.print(output, func(w io.Writer) {
+		if len(output) == 0 {
+			fmt.Fprintln(w, "all balances match transactions")
+			return
+		}
+
+		fmt.Fprintln(w, "USER\tBALANCE\tEXPECTED\tDIFFERENCE")
+
+		for _, mismatch := range output {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", mismatch.UserId, formatSum(mismatch.Balance),
+				formatSum(mismatch.Expected), formatSum(mismatch.Difference))
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(output) > 0 {
+		return fmt.Errorf("%d balances do not match transactions", len(output))
+	}
+
+	return nil
+}
+
+// runAuditVerify проверяет запечатанные записи журнала аудита ключом AUDIT_HMAC_KEY и выводит последнюю запись
+// (ее стоит сохранить для -anchor следующей проверки), если найдены нарушения - завершается с ошибкой
+func runAuditVerify(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("audit-verify", flag.ContinueOnError)
+	anchorFlag := fs.String("anchor", "", "последняя запись прошлой проверки в формате <sequence>:<hash>")
+
+	var anchor *model.AuditAnchor
+
+	err := parse(fs, args, func() error {
+		if *anchorFlag == "" {
+			return nil
+		}
+
+		sequence, hash, ok := strings.Cut(*anchorFlag, ":")
+		number, err := strconv.ParseInt(sequence, 10, 64)
+		if !ok || err != nil || number < 1 || hash == "" {
+			return errors.New("-anchor must be in <sequence>:<hash> format")
+		}
+
+		anchor = &model.AuditAnchor{Sequence: number, Hash: hash}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s, err := e.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	verification, err := s.Audit.Verify(ctx, anchor)
+	if err != nil {
+		return err
+	}
+
+	output := auditVerificationOutput{
+		Entries:      verification.Entries,
+		LastSequence: verification.LastSequence,
+		LastHash:     verification.LastHash,
+		Unsealed:     verification.Unsealed,
+		Problems:     make([]auditProblemOutput, 0, len(verification.Problems)),
+	}
+
+	for _, problem := range verification.Problems {
+		output.Problems = append(output.Problems, auditProblemOutput(problem))
+	}
+
+	err = e.out.print(output, func(w io.Writer) {
+		fmt.Fprintf(w, "entries\t%d\n", output.Entries)
+		fmt.Fprintf(w, "anchor\t%d:%s\n", output.LastSequence, output.LastHash)
+		fmt.Fprintf(w, "unsealed\t%d\n", output.Unsealed)
+
+		if len(output.Problems) == 0 {
+			fmt.Fprintln(w, "\naudit log is intact")
+			return
+		}
+
+		fmt.Fprintln(w, "\nSEQUENCE\tPROBLEM")
+
+		for _, problem := range output.Problems {
+			fmt.Fprintf(w, "%d\t%s\n", problem.Sequence, problem.Problem)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(output.Problems) > 0 {
+		return fmt.Errorf("audit log verification found %d problems", len(output.Problems))
+	}
+
+	return nil
+}
+
+// runAccountStatus выводит статус счета, с -status - сначала задает его
+func runAccountStatus(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("account-status", flag.ContinueOnError)
+	userId := fs.String("user", "", "id пользователя")
+	status := fs.String("status", "", "новый статус: active, frozen-debit, frozen-all или closed, без флага статус только выводится")
+	reason := fs.String("reason", "", "причина изменения статуса")
+
+	err := parse(fs, args, func() error {
+		switch model.AccountStatus(*status) {
+		case "":
+		case model.AccountActive, model.AccountFrozenDebit, model.AccountFrozenAll, model.AccountClosed:
+			if *reason == "" {
+				return errors.New("-reason is required")
+			}
+		default:
+			return errors.New("-status must be active, frozen-debit, frozen-all or closed")
+		}
+
+		return checkUuid("user", *userId)
+	})
+	if err != nil {
+		return err
+	}
+
+	s, err := e.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	var account model.Account
+
+	if *status != "" {
+		account, err = s.Account.SetStatus(ctx, *userId, model.AccountStatus(*status), *reason)
+	} else {
+		account, err = s.Account.GetAccount(ctx, *userId)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	output := accountOutput(account)
+
+	return e.out.print(output, func(w io.Writer) {
+		fmt.Fprintf(w, "user\t%s\n", output.UserId)
+		fmt.Fprintf(w, "status\t%s\n", output.Status)
+
+		if output.UpdateTime != nil {
+			fmt.Fprintf(w, "reason\t%s\n", optional(output.Reason))
+			fmt.Fprintf(w, "updated by\t%s\n", optional(output.UpdatedBy))
+			fmt.Fprintf(w, "updated at\t%s\n", output.UpdateTime.Format(time.RFC3339))
+		}
+	})
+}
+
+// parse разбирает флаги команды и проверяет их в check, при ошибке выводит использование команды
+func parse(fs *flag.FlagSet, args []string, check func() error) error {
+	if err := fs.Parse(args); err != nil {
+		return usageErr
+	}
+
+	err := check()
+	if err == nil && fs.NArg() > 0 {
+		err = fmt.Errorf("unexpected arguments %v", fs.Args())
+	}
+
+	if err != nil {
+		fmt.Fprintf(fs.Output(), "%s\n", err)
+		fs.Usage()
+
+		return usageErr
+	}
+
+	return nil
+}
+
+func checkUuid(name string, value string) error {
+	if value == "" {
+		return fmt.Errorf("-%s is required", name)
+	}
+
+	if _, err := uuid.Parse(value); err != nil {
+		return fmt.Errorf("-%s must be uuid", name)
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"os/user"
+	"sort"
+	"syscall"
+
+	"github.com/avito-test/internal/config/auth"
+	"github.com/avito-test/internal/config/clock"
+	"github.com/avito-test/internal/config/idgen"
+	"github.com/avito-test/internal/config/logger"
+	"github.com/avito-test/internal/config/requestid"
+	"github.com/avito-test/internal/server"
+	"github.com/sirupsen/logrus"
+)
+
+// balancectl - утилита операторов вместо ручных правок в psql. Работает через те же сервисы, что и API
+// (подключение к бд из тех же переменных окружения), изменения баланса пишутся в audit лог с пользователем ОС
+// в principal_id и способом аутентификации cli. Оператор не задается флагом: имя, которое можно указать любым,
+// не подтверждает, кто выполнил действие. Журнал аудита дополнительно хранит пользователя бд (session_user)
+
+// usageErr - неверные аргументы команды, выводится с подсказкой по использованию
+var usageErr = errors.New("invalid arguments")
+
+func main() {
+	global := flag.NewFlagSet("balancectl", flag.ExitOnError)
+	output := global.String("output", outputTable, "формат вывода: table или json")
+
+	global.Usage = func() {
+		fmt.Fprintln(global.Output(), "usage: balancectl [-output table|json] <command> [flags]")
+		fmt.Fprintln(global.Output(), "\nflags:")
+		global.PrintDefaults()
+		fmt.Fprintln(global.Output(), "\ncommands:")
+
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		for _, name := range names {
+			fmt.Fprintf(global.Output(), "  %-20s %s\n", name, commands[name].description)
+		}
+	}
+
+	_ = global.Parse(os.Args[1:])
+
+	cmd, ok := commands[global.Arg(0)]
+	if !ok {
+		global.Usage()
+		os.Exit(2)
+	}
+
+	if *output != outputTable && *output != outputJson {
+		fmt.Fprintf(os.Stderr, "balancectl: unknown output format %q\n", *output)
+		os.Exit(2)
+	}
+
+	// пользователь ОС по uid процесса, а не из переменной USER, которую можно задать любой
+	operator, err := user.Current()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "balancectl: operator: %s\n", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	env := &env{
+		out: printer{format: *output, w: os.Stdout},
+	}
+
+	err = cmd.run(operatorContext(ctx, operator.Username, global.Arg(0)), env, global.Args()[1:])
+
+	switch {
+	case errors.Is(err, usageErr):
+		os.Exit(2)
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "balancectl: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// env - окружение команды: сервисы создаются только после разбора аргументов, чтобы ошибка в них не требовала бд
+type env struct {
+	out      printer
+	services *server.Services
+}
+
+func (e *env) connect(ctx context.Context) (*server.Services, error) {
+	if e.services != nil {
+		return e.services, nil
+	}
+
+	// события outbox публикует сервер, утилита их только пишет
+	services, err := server.NewServices(ctx, nil, clock.Real{}, idgen.UUID{})
+	if err != nil {
+		return nil, err
+	}
+
+	e.services = services
+
+	return services, nil
+}
+
+// operatorContext - контекст команды как у запроса API: id запроса, вызывающий и логгер с их полями
+func operatorContext(ctx context.Context, operator string, command string) context.Context {
+	requestId := idgen.UUID{}.NewId()
+
+	ctx = requestid.NewContext(ctx, requestId)
+	ctx = auth.NewContext(ctx, auth.Principal{Id: operator, Method: auth.MethodCli})
+
+	return logger.WithContext(ctx, logger.GetLogger().WithFields(logrus.Fields{
+		"request_id": requestId,
+		"command":    command,
+	}))
+}
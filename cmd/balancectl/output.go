@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/avito-test/internal/dto"
+	"github.com/avito-test/internal/model"
+)
+
+const (
+	outputTable = "table"
+	outputJson  = "json"
+)
+
+// printer выводит результат команды таблицей или json, json в тех же форматах, что ответы API
+type printer struct {
+	format string
+	w      io.Writer
+}
+
+// print выводит v в json, а для таблицы вызывает table, колонки разделяются табуляцией
+func (p printer) print(v interface{}, table func(w io.Writer)) error {
+	if p.format == outputJson {
+		encoder := json.NewEncoder(p.w)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(v)
+	}
+
+	w := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	table(w)
+
+	return w.Flush()
+}
+
+type balanceOutput struct {
+	UserId       string            `json:"userId"`
+	Balance      float64           `json:"balance"`
+	Total        int               `json:"total"`
+	Transactions []dto.Transaction `json:"transactions"`
+}
+
+type reportOutput struct {
+	File string `json:"file"`
+}
+
+type auditVerificationOutput struct {
+	Entries      int64                `json:"entries"`
+	LastSequence int64                `json:"lastSequence"`
+	LastHash     string               `json:"lastHash"`
+	Unsealed     int64                `json:"unsealed"`
+	Problems     []auditProblemOutput `json:"problems"`
+}
+
+type auditProblemOutput struct {
+	Sequence int64  `json:"sequence"`
+	Problem  string `json:"problem"`
+}
+
+type mismatchOutput struct {
+	UserId     string  `json:"userId"`
+	Balance    float64 `json:"balance"`
+	Expected   float64 `json:"expected"`
+	Difference float64 `json:"difference"`
+}
+
+var reservationStatuses = map[int]string{
+	model.TransactionTypeReserve: "reserved",
+	model.TransactionTypeCapture: "captured",
+	model.TransactionTypeCancel:  "cancelled",
+}
+
+func transactionOutput(tr model.Transaction) dto.Transaction {
+	return dto.Transaction{
+		Id:              tr.Id,
+		OrderId:         tr.OrderId,
+		ServiceId:       tr.ServiceId,
+		TransactionType: tr.TransactionType,
+		Sum:             tr.Sum,
+		Comment:         tr.Comment,
+		UpdTime:         tr.UpdTime,
+	}
+}
+
+func reservationOutput(tr model.Transaction) dto.Reservation {
+	return dto.Reservation{
+		Id:        tr.Id,
+		UserId:    tr.UserId,
+		OrderId:   *tr.OrderId,
+		ServiceId: *tr.ServiceId,
+		Sum:       tr.Sum,
+		Status:    reservationStatuses[tr.TransactionTypeId],
+		Comment:   tr.Comment,
+		UpdTime:   tr.UpdTime,
+	}
+}
+
+func accountOutput(account model.Account) dto.Account {
+	output := dto.Account{
+		UserId: account.UserId,
+		Status: string(account.Status),
+	}
+
+	if account.UpdatedBy != "" {
+		output.Reason = &account.Reason
+		output.UpdatedBy = &account.UpdatedBy
+		output.UpdateTime = &account.UpdateTime
+	}
+
+	return output
+}
+
+func adjustmentOutput(adjustment model.Adjustment) dto.Adjustment {
+	return dto.Adjustment{
+		Id:              adjustment.Id,
+		UserId:          adjustment.UserId,
+		Direction:       adjustment.Direction,
+		Sum:             adjustment.Sum,
+		Reason:          adjustment.Reason,
+		Ticket:          adjustment.Ticket,
+		Status:          string(adjustment.Status),
+		ProposedBy:      adjustment.ProposedBy,
+		ProposeTime:     adjustment.ProposeTime,
+		DecidedBy:       adjustment.DecidedBy,
+		DecisionTime:    adjustment.DecisionTime,
+		DecisionComment: adjustment.DecisionComment,
+		TransactionId:   adjustment.TransactionId,
+	}
+}
+
+func formatSum(sum float64) string {
+	return strconv.FormatFloat(sum, 'f', -1, 64)
+}
+
+func optional(s *string) string {
+	if s == nil {
+		return "-"
+	}
+
+	return *s
+}
@@ -1,16 +1,30 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	balancev1 "github.com/avito-test/api/balance/v1"
 	_ "github.com/avito-test/docs" // docs is generated by Swag CLI, you have to import it.
+	"github.com/avito-test/internal/config"
+	"github.com/avito-test/internal/config/auth"
+	"github.com/avito-test/internal/config/clock"
+	"github.com/avito-test/internal/config/idgen"
 	"github.com/avito-test/internal/config/logger"
 	"github.com/avito-test/internal/config/middleware"
+	"github.com/avito-test/internal/config/ratelimit"
+	"github.com/avito-test/internal/config/tracing"
+	"github.com/avito-test/internal/publisher"
 	"github.com/avito-test/internal/server"
-	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
 
 	swagger "github.com/swaggo/http-swagger"
 )
@@ -20,36 +34,192 @@ import (
 
 // @host localhost:8000
 
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
+
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+
 func main() {
-	router := mux.NewRouter()
+	shutdownTracing, err := tracing.Init(context.Background())
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	authenticator, err := auth.NewAuthenticator()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	policy, err := auth.NewPolicy()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	rateLimitBackend := ratelimit.NewMemoryBackend(clock.Real{})
+
+	eventPublisher, err := publisher.New()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	services, err := server.NewServices(context.Background(), eventPublisher, clock.Real{}, idgen.UUID{})
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	relayDone := make(chan struct{})
+
+	go func() {
+		defer close(relayDone)
+
+		if services.Outbox != nil {
+			services.Outbox.Run(relayCtx)
+		}
+	}()
 
-	httpServer := server.NewHttpServer()
+	webhooksDone := make(chan struct{})
 
-	router.Handle("/balance/{userId}", middleware.ResponseHeaders(middleware.RequestID(middleware.Logging(http.HandlerFunc(httpServer.HandleGetBalance))))).Methods(http.MethodGet)
-	router.Handle("/balance", middleware.ResponseHeaders(middleware.RequestID(middleware.Logging(http.HandlerFunc(httpServer.HandleIncreaseBalance))))).Methods(http.MethodPost)
+	go func() {
+		defer close(webhooksDone)
+		services.Webhooks.Run(relayCtx)
+	}()
 
-	router.Handle("/transaction", middleware.ResponseHeaders(middleware.RequestID(middleware.Logging(http.HandlerFunc(httpServer.HandleGetTransactions))))).Methods(http.MethodGet)
-	router.Handle("/transaction", middleware.ResponseHeaders(middleware.RequestID(middleware.Logging(http.HandlerFunc(httpServer.HandleTransaction))))).Methods(http.MethodPost)
+	auditDone := make(chan struct{})
 
-	router.Handle("/report", middleware.ResponseHeaders(middleware.RequestID(middleware.Logging(http.HandlerFunc(httpServer.HandleCreateReport))))).Methods(http.MethodPost)
+	go func() {
+		defer close(auditDone)
+		services.Audit.Run(relayCtx)
+	}()
 
-	routeGetReport(router)
+	streamCtx, stopStreams := context.WithCancel(context.Background())
+	streamDone := make(chan struct{})
+
+	go func() {
+		defer close(streamDone)
+		services.Stream.Run(streamCtx)
+	}()
+
+	httpServer := server.NewHttpServer(server.HttpDeps{
+		Services:      services,
+		Authenticator: authenticator,
+		Policy:        policy,
+		RateLimit:     rateLimitBackend,
+		Logger:        logger.GetLogger(),
+		Clock:         clock.Real{},
+		Ids:           idgen.UUID{},
+	})
+
+	router, err := httpServer.Router()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
 
 	router.PathPrefix("/swagger").Handler(swagger.WrapHandler).Methods(http.MethodGet)
 
+	srv := &http.Server{Addr: config.HttpAddr, Handler: router}
+
+	// потоки баланса не завершаются сами, при остановке сервера их закрываем, иначе Shutdown ждет до таймаута
+	srv.RegisterOnShutdown(stopStreams)
+
+	grpcSrv := newGrpcServer(services, authenticator, policy, rateLimitBackend)
+
+	grpcListener, err := net.Listen("tcp", config.GrpcAddr)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	go func() {
+		if err := grpcSrv.Serve(grpcListener); err != nil {
+			log.Fatal(err.Error())
+		}
+	}()
+
+	go func() {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		<-stop
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		grpcSrv.GracefulStop()
+
+		if err := srv.Shutdown(ctx); err != nil {
+			logger.GetLogger().Error(err.Error())
+		}
+	}()
+
 	logger.GetLogger().Info("server started successfully")
 
-	if err := http.ListenAndServe(":8000", router); err != nil {
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatal(err.Error())
 	}
+
+	stopRelay()
+	<-relayDone
+	<-webhooksDone
+	<-auditDone
+
+	stopStreams()
+	<-streamDone
+
+	if eventPublisher != nil {
+		if err := eventPublisher.Close(); err != nil {
+			logger.GetLogger().Error(err.Error())
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := shutdownTracing(ctx); err != nil {
+		logger.GetLogger().Error(err.Error())
+	}
 }
 
-// @summary Получения файла по ссылке
-// @tags report
-// @description Метод получения файла по ссылке
-// @success 200 "1 колонка - id услуги (так как названия услуги в моем сервисе не предусмотрено, а доступа к другим нет, так как это просто тест), 2 колонка - общая сумма выручки за услугу"
-// @failure 404 "Если файл не найден"
-// @router /report/{fileName} [get]
-func routeGetReport(router *mux.Router) {
-	router.PathPrefix("/report/").Handler(middleware.RequestID(middleware.Logging(http.StripPrefix("/report/", http.FileServer(http.Dir(fmt.Sprintf("static%sfile", string(os.PathSeparator))))))))
+// newGrpcServer создает grpc сервер с теми же правами и лимитами, что у соответствующих http методов
+func newGrpcServer(services *server.Services, authenticator *auth.Authenticator, policy *auth.Policy, rateLimitBackend ratelimit.Backend) *grpc.Server {
+	methods := map[string]struct {
+		permission auth.Permission
+		route      string
+	}{
+		"/balance.v1.BalanceService/GetBalance":       {auth.PermissionBalanceRead, "get_balance"},
+		"/balance.v1.BalanceService/IncreaseBalance":  {auth.PermissionBalanceCredit, "increase_balance"},
+		"/balance.v1.BalanceService/Reserve":          {auth.PermissionTransactionWrite, "save_transaction"},
+		"/balance.v1.BalanceService/Capture":          {auth.PermissionTransactionWrite, "save_transaction"},
+		"/balance.v1.BalanceService/Cancel":           {auth.PermissionTransactionWrite, "save_transaction"},
+		"/balance.v1.BalanceService/ListTransactions": {auth.PermissionTransactionRead, "get_transactions"},
+		"/balance.v1.BalanceService/CreateReport":     {auth.PermissionReportCreate, "create_report"},
+	}
+
+	permissions := make(map[string]auth.Permission, len(methods))
+	limits := make(map[string]ratelimit.Limit, len(methods))
+
+	for method, m := range methods {
+		limit, err := ratelimit.ParseLimit(config.RateLimit(m.route))
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+
+		permissions[method] = m.permission
+		limits[method] = limit
+	}
+
+	grpcSrv := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		otelgrpc.UnaryServerInterceptor(),
+		middleware.GrpcRequestID(idgen.UUID{}),
+		middleware.GrpcClientIP,
+		middleware.GrpcLogging(logger.GetLogger(), clock.Real{}),
+		middleware.GrpcAuthentication(authenticator, auth.MethodApiKey, auth.MethodJWT),
+		middleware.GrpcRateLimit(rateLimitBackend, limits),
+		middleware.GrpcAuthorization(policy, permissions),
+	))
+
+	balancev1.RegisterBalanceServiceServer(grpcSrv, server.NewGrpcServer(services))
+
+	return grpcSrv
 }
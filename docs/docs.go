@@ -16,46 +16,17 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/balance": {
-            "post": {
-                "description": "Метод для увеличения баланса",
-                "consumes": [
-                    "application/json"
-                ],
-                "produces": [
-                    "application/json"
-                ],
-                "tags": [
-                    "balance"
-                ],
-                "summary": "увеличение баланса",
-                "parameters": [
+        "/accounts/{userId}": {
+            "get": {
+                "security": [
                     {
-                        "description": "userId - id пользователя (UUID)\u003cbr\u003esum - сумма пополнения (больше 0)\u003cbr\u003e comment - комментарий (опционально)",
-                        "name": "IncreaseBalanceRequest",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/IncreaseBalanceRequest"
-                        }
-                    }
-                ],
-                "responses": {
-                    "200": {
-                        "description": "В случае успешного добавления денег к балансу возвращается статус 200"
+                        "ApiKeyAuth": []
                     },
-                    "400": {
-                        "description": "В случае если запрос не валидный возвращается статус 400 и тело ответа",
-                        "schema": {
-                            "$ref": "#/definitions/ApiError"
-                        }
+                    {
+                        "BearerAuth": []
                     }
-                }
-            }
-        },
-        "/balance/{userId}": {
-            "get": {
-                "description": "Метод для получения баланса по userId",
+                ],
+                "description": "Возвращает статус счета: active, frozen-debit (запрещены резервации, списания и корректировки-списания), frozen-all (запрещено любое движение денег) или closed. Для счета, статус которого не задавался, возвращается active без причины",
                 "consumes": [
                     "application/json"
                 ],
@@ -63,14 +34,13 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "balance"
+                    "account"
                 ],
-                "summary": "получение баланса по userId",
+                "summary": "Статус счета пользователя",
                 "parameters": [
                     {
                         "type": "string",
                         "format": "uuid",
-                        "example": "b2b9a788-55fb-11ed-bdc3-0242ac120002",
                         "description": "id пользователя",
                         "name": "userId",
                         "in": "path",
@@ -79,19 +49,43 @@ const docTemplate = `{
                 ],
                 "responses": {
                     "200": {
-                        "description": "В случае если баланс найден",
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/GetBalanceResponse"
+                            "$ref": "#/definitions/Account"
                         }
                     },
                     "400": {
-                        "description": "В случае если невалидный userId",
+                        "description": "Невалидный id",
                         "schema": {
                             "$ref": "#/definitions/ApiError"
                         }
                     },
-                    "404": {
-                        "description": "В случае если баланс не найден по userId",
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права account:read",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "499": {
+                        "description": "Клиент отменил запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "504": {
+                        "description": "Истек таймаут запроса в бд",
                         "schema": {
                             "$ref": "#/definitions/ApiError"
                         }
@@ -99,9 +93,17 @@ const docTemplate = `{
                 }
             }
         },
-        "/report": {
-            "post": {
-                "description": "Метод создание отчета для бухгалтерии. Возвращает ссылку на файл",
+        "/accounts/{userId}/status": {
+            "put": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Замораживает, размораживает (active) или закрывает счет пользователя с причиной, задавшим статус считается вызывающий. Статус действует на последующие операции: заблокированные операции возвращают 423 с кодом account-frozen или account-closed",
                 "consumes": [
                     "application/json"
                 ],
@@ -109,50 +111,85 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "report"
+                    "account"
                 ],
-                "summary": "Создание отчета для бухгалтерии",
+                "summary": "Изменение статуса счета",
                 "parameters": [
                     {
-                        "description": "year - год отчета (2022 \u003c=year \u003c= 2100)\u003cbr\u003emonth - месяц отчета",
-                        "name": "CreateReportRequest",
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "id пользователя",
+                        "name": "userId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "status - active, frozen-debit, frozen-all или closed.\u003cbr\u003e reason - причина",
+                        "name": "SetAccountStatusRequest",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/CreateReportRequest"
+                            "$ref": "#/definitions/SetAccountStatusRequest"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "Статус задан",
                         "schema": {
-                            "$ref": "#/definitions/CreateReportResponse"
+                            "$ref": "#/definitions/Account"
+                        }
+                    },
+                    "400": {
+                        "description": "Невалидный запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права account:manage",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "499": {
+                        "description": "Клиент отменил запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "504": {
+                        "description": "Истек таймаут запроса в бд",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
                         }
                     }
                 }
             }
         },
-        "/report/{fileName}": {
+        "/adjustments": {
             "get": {
-                "description": "Метод получения файла по ссылке",
-                "tags": [
-                    "report"
-                ],
-                "summary": "Получения файла по ссылке",
-                "responses": {
-                    "200": {
-                        "description": "OK"
+                "security": [
+                    {
+                        "ApiKeyAuth": []
                     },
-                    "404": {
-                        "description": "Если файл не найден"
+                    {
+                        "BearerAuth": []
                     }
-                }
-            }
-        },
-        "/transaction": {
-            "get": {
-                "description": "Метод получение списка транзакций пользователя",
+                ],
+                "description": "Возвращает последние 100 корректировок в любом состоянии, новые первыми: кто и когда предложил, кто и когда одобрил или отклонил, транзакция корректировки",
                 "consumes": [
                     "application/json"
                 ],
@@ -160,59 +197,26 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "transaction"
+                    "adjustment"
                 ],
-                "summary": "Получение списка транзакций пользователя",
+                "summary": "История корректировок",
                 "parameters": [
                     {
                         "type": "string",
                         "format": "uuid",
-                        "example": "b2b9a788-55fb-11ed-bdc3-0242ac120002",
-                        "description": "id пользователя",
+                        "description": "Фильтр по пользователю",
                         "name": "userId",
-                        "in": "query",
-                        "required": true
-                    },
-                    {
-                        "minimum": 1,
-                        "type": "integer",
-                        "example": 1,
-                        "description": "номер страницы",
-                        "name": "page",
-                        "in": "query",
-                        "required": true
-                    },
-                    {
-                        "minimum": 1,
-                        "type": "integer",
-                        "default": 10,
-                        "example": 1,
-                        "description": "количество записей на странице",
-                        "name": "itemsPerPage",
-                        "in": "query"
-                    },
-                    {
-                        "enum": [
-                            "date",
-                            "sum"
-                        ],
-                        "type": "string",
-                        "default": "date",
-                        "example": "sum",
-                        "description": "поле по которому надо сортировать",
-                        "name": "sortBy",
                         "in": "query"
                     },
                     {
                         "enum": [
-                            "asc",
-                            "desc"
+                            "pending",
+                            "approved",
+                            "rejected"
                         ],
                         "type": "string",
-                        "default": "desc",
-                        "example": "asc",
-                        "description": "тип сортировки",
-                        "name": "sortType",
+                        "description": "Фильтр по состоянию",
+                        "name": "status",
                         "in": "query"
                     }
                 ],
@@ -220,13 +224,57 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/GetTransactionsResponse"
+                            "$ref": "#/definitions/GetAdjustmentsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Невалидный запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права adjustment:read",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "499": {
+                        "description": "Клиент отменил запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "504": {
+                        "description": "Истек таймаут запроса в бд",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
                         }
                     }
                 }
             },
             "post": {
-                "description": "Метод для обработки транзакции. Для резервации денег со счета в теле запроса поле \"transactionType\" = 1. Для признания выручки и подтверждения списания средств с баланса \"transactionType\" = 2. В случае отмены резервации и возврата средств на основной баланс \"transactionType\" = 3.",
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Создает ручную корректировку баланса, ожидающую решения. Баланс меняется только после одобрения другим оператором (maker-checker), предложившим считается вызывающий",
                 "consumes": [
                     "application/json"
                 ],
@@ -234,51 +282,3255 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "transaction"
+                    "adjustment"
                 ],
-                "summary": "Метод для обработки транзакции",
+                "summary": "Предложение корректировки баланса",
                 "parameters": [
                     {
-                        "description": "orderId - id заказа (UUID).\u003cbr\u003e serviceId - id услуги (UUID).\u003cbr\u003e userId - id пользователя (UUID).\u003cbr\u003e sum - сумма транзакции (больше 0).\u003cbr\u003e transactionType - тип транзакции (enum(1, 2, 3)).\u003cbr\u003e comment - комментарий (опционально)",
-                        "name": "SaveTransactionRequest",
+                        "description": "userId - id пользователя (UUID).\u003cbr\u003e direction - credit (зачисление) или debit (списание).\u003cbr\u003e sum - сумма больше 0.\u003cbr\u003e reason - причина корректировки.\u003cbr\u003e ticket - номер тикета",
+                        "name": "CreateAdjustmentRequest",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/SaveTransactionRequest"
+                            "$ref": "#/definitions/CreateAdjustmentRequest"
                         }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "Воможные статусы:\u003cbr\u003e 1 - добавление/обновление произошло успешно.\u003cbr\u003e 2 - попытка резервации (\"transactionType\" = 1), резервация с соответсвующими orderId, userId, serviceId уже существует, транзакция резервации не добавлена.\u003cbr\u003e 3 - попытка резервации (\"transactionType\" = 1), на балансе недостаточно средств, транзакция резервации не добавлена.\u003cbr\u003e 4 - попытка признания выручки (\"transactionType\" = 2), транзакция с соответсвующими orderId, userId, serviceId не найдена, ошибка.\u003cbr\u003e 5 - попытка признания выручки (\"transactionType\" = 2), транзакция с соответсвующими orderId, userId, serviceId найдена и выручка уже списана ранее, ошибка.\u003cbr\u003e 6 - попытка признания выручки (\"transactionType\" = 2), транзакция с соответсвующими orderId, userId, serviceId найдена и уже была отклонена ранее, ошибка.\u003cbr\u003e 7 - попытка отмены резервации (\"transactionType\" = 3), транзакция с соответсвующими orderId, userId, serviceId не найдена, ошибка.\u003cbr\u003e 8 - попытка отмены резервации (\"transactionType\" = 3), транзакция с соответсвующими orderId, userId, serviceId найдена и уже была отменена ранее, деньги были возвращены, ошибка.\u003cbr\u003e 9 - попытка отмены резервации (\"transactionType\" = 3), транзакция с соответсвующими orderId, userId, serviceId найдена и уже была подтверждена ранее, деньги были списаны, ошибка.\u003cbr\u003e 10 - баланс пользователя не найден, ошибка",
+                    "201": {
+                        "description": "Корректировка ожидает решения",
                         "schema": {
-                            "$ref": "#/definitions/SaveTransactionResponse"
+                            "$ref": "#/definitions/Adjustment"
+                        }
+                    },
+                    "400": {
+                        "description": "Невалидный запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права adjustment:propose",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "499": {
+                        "description": "Клиент отменил запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "504": {
+                        "description": "Истек таймаут запроса в бд",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
                         }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "ApiError": {
-            "type": "object",
-            "properties": {
-                "message": {
-                    "type": "string"
-                }
-            }
         },
-        "CreateReportRequest": {
-            "type": "object",
-            "required": [
-                "month",
-                "year"
-            ],
-            "properties": {
-                "month": {
-                    "type": "integer",
-                    "enum": [
-                        1,
+        "/adjustments/pending": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает первые 100 корректировок, ожидающих решения, в порядке очереди (старые первыми)",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "adjustment"
+                ],
+                "summary": "Корректировки, ожидающие решения",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/GetAdjustmentsResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права adjustment:read",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "499": {
+                        "description": "Клиент отменил запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "504": {
+                        "description": "Истек таймаут запроса в бд",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/adjustments/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "adjustment"
+                ],
+                "summary": "Получение корректировки",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "id корректировки",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/Adjustment"
+                        }
+                    },
+                    "400": {
+                        "description": "Невалидный id",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права adjustment:read",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "404": {
+                        "description": "Корректировка не найдена",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "499": {
+                        "description": "Клиент отменил запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "504": {
+                        "description": "Истек таймаут запроса в бд",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/adjustments/{id}/approve": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Одобряет корректировку и проводит ее транзакцией корректировки (тип 6, сумма списания отрицательная). Одобрить может только оператор, не предлагавший корректировку. Если провести не удалось (нет баланса, не хватает средств для списания), корректировка остается ожидающей",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "adjustment"
+                ],
+                "summary": "Одобрение корректировки",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "id корректировки",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "comment - комментарий к решению (опционально)",
+                        "name": "AdjustmentDecisionRequest",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/AdjustmentDecisionRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Корректировка проведена",
+                        "schema": {
+                            "$ref": "#/definitions/Adjustment"
+                        }
+                    },
+                    "400": {
+                        "description": "Невалидный запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права adjustment:approve или корректировку предложил тот же оператор (same-operator)",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "404": {
+                        "description": "Корректировка или баланс не найдены",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "409": {
+                        "description": "Решение по корректировке уже принято",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "422": {
+                        "description": "Недостаточно средств для списания",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "423": {
+                        "description": "Корректировка запрещена статусом счета, корректировка остается ожидающей",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "499": {
+                        "description": "Клиент отменил запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "504": {
+                        "description": "Истек таймаут запроса в бд",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/adjustments/{id}/reject": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Отклоняет корректировку, баланс не меняется. Отклонить может только оператор, не предлагавший корректировку",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "adjustment"
+                ],
+                "summary": "Отклонение корректировки",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "id корректировки",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "comment - комментарий к решению (опционально)",
+                        "name": "AdjustmentDecisionRequest",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/AdjustmentDecisionRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Корректировка отклонена",
+                        "schema": {
+                            "$ref": "#/definitions/Adjustment"
+                        }
+                    },
+                    "400": {
+                        "description": "Невалидный запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права adjustment:approve или корректировку предложил тот же оператор (same-operator)",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "404": {
+                        "description": "Корректировка не найдена",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "409": {
+                        "description": "Решение по корректировке уже принято",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "499": {
+                        "description": "Клиент отменил запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "504": {
+                        "description": "Истек таймаут запроса в бд",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/balance": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Метод для увеличения баланса",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "balance"
+                ],
+                "summary": "увеличение баланса",
+                "parameters": [
+                    {
+                        "description": "userId - id пользователя (UUID)\u003cbr\u003esum - сумма пополнения (больше 0)\u003cbr\u003e comment - комментарий (опционально)",
+                        "name": "IncreaseBalanceRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/IncreaseBalanceRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "В случае успешного добавления денег к балансу возвращается статус 200"
+                    },
+                    "400": {
+                        "description": "В случае если запрос не валидный возвращается статус 400 и тело ответа",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права balance:credit",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "422": {
+                        "description": "Превышен лимит пополнений (limit-exceeded)",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "423": {
+                        "description": "Пополнение запрещено статусом счета (frozen-all, closed)",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "499": {
+                        "description": "Клиент отменил запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "504": {
+                        "description": "Истек таймаут запроса в бд",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/balance/{userId}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Метод для получения баланса по userId",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "balance"
+                ],
+                "summary": "получение баланса по userId",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "example": "b2b9a788-55fb-11ed-bdc3-0242ac120002",
+                        "description": "id пользователя",
+                        "name": "userId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "В случае если баланс найден",
+                        "schema": {
+                            "$ref": "#/definitions/GetBalanceResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "В случае если невалидный userId",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права balance:read",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "404": {
+                        "description": "В случае если баланс не найден по userId",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "499": {
+                        "description": "Клиент отменил запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "504": {
+                        "description": "Истек таймаут запроса в бд",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/balance/{userId}/stream": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Отправляет события об изменении баланса пользователя (deposit, reserved, captured, cancelled) в формате Server-Sent Events: id - sequence события, event - тип, data - событие в json (как в брокере, в data.balance - баланс после операции). Первое событие balance - текущий баланс. Раз в STREAM_HEARTBEAT отправляется комментарий heartbeat. Чтобы продолжить поток после разрыва, передайте sequence последнего полученного события в заголовке Last-Event-ID (EventSource делает это сам) или параметре lastEventId, тогда снимок не отправляется. С заголовком Upgrade: websocket поток отправляется через WebSocket, каждое сообщение - событие в json",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "balance"
+                ],
+                "summary": "Поток изменений баланса",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "id пользователя",
+                        "name": "userId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "minimum": 0,
+                        "type": "integer",
+                        "description": "sequence последнего полученного события",
+                        "name": "lastEventId",
+                        "in": "query"
+                    },
+                    {
+                        "minimum": 0,
+                        "type": "integer",
+                        "description": "sequence последнего полученного события",
+                        "name": "Last-Event-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Поток событий",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Невалидный userId или lastEventId",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права balance:read",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/limits": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает все заданные лимиты: глобальные, уровней пользователей и отдельных пользователей",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "limit"
+                ],
+                "summary": "Заданные лимиты",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/GetLimitRulesResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права limit:read",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "499": {
+                        "description": "Клиент отменил запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "504": {
+                        "description": "Истек таймаут запроса в бд",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Задает или заменяет лимит на операцию за период, задавшим лимит считается вызывающий. Для пользователя действует самый частный лимит: пользователя, затем его уровня, затем глобальный. Лимит проверяется на последующих операциях, превышение возвращает 422 с кодом limit-exceeded",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "limit"
+                ],
+                "summary": "Задание лимита",
+                "parameters": [
+                    {
+                        "description": "scope - global, tier или user.\u003cbr\u003e scopeId - не передается для global, уровень для tier, id пользователя (UUID) для user.\u003cbr\u003e operation - deposit, reserve или withdraw.\u003cbr\u003e period - transaction (одна операция), day или month (календарные сутки или месяц UTC).\u003cbr\u003e amount - лимит больше 0",
+                        "name": "SetLimitRuleRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/SetLimitRuleRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Лимит задан",
+                        "schema": {
+                            "$ref": "#/definitions/LimitRule"
+                        }
+                    },
+                    "400": {
+                        "description": "Невалидный запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права limit:manage",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "499": {
+                        "description": "Клиент отменил запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "504": {
+                        "description": "Истек таймаут запроса в бд",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Удаляет лимит, после чего для пользователей действует следующий по частности лимит или лимита нет",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "limit"
+                ],
+                "summary": "Удаление лимита",
+                "parameters": [
+                    {
+                        "enum": [
+                            "global",
+                            "tier",
+                            "user"
+                        ],
+                        "type": "string",
+                        "description": "На кого задан лимит",
+                        "name": "scope",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Уровень для tier, id пользователя для user",
+                        "name": "scopeId",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "deposit",
+                            "reserve",
+                            "withdraw"
+                        ],
+                        "type": "string",
+                        "description": "Операция",
+                        "name": "operation",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            "transaction",
+                            "day",
+                            "month"
+                        ],
+                        "type": "string",
+                        "description": "Период",
+                        "name": "period",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Лимит удален"
+                    },
+                    "400": {
+                        "description": "Невалидный запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права limit:manage",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "404": {
+                        "description": "Лимит не найден",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "499": {
+                        "description": "Клиент отменил запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "504": {
+                        "description": "Истек таймаут запроса в бд",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/limits/users/{userId}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает уровень пользователя и действующие для него лимиты: сколько использовано в текущих сутках или месяце UTC, остаток и когда период сбросится. Для лимита одной операции used и resetTime не передаются",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "limit"
+                ],
+                "summary": "Лимиты пользователя",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "id пользователя",
+                        "name": "userId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/UserLimits"
+                        }
+                    },
+                    "400": {
+                        "description": "Невалидный id",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права limit:read",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "499": {
+                        "description": "Клиент отменил запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "504": {
+                        "description": "Истек таймаут запроса в бд",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/limits/users/{userId}/tier": {
+            "put": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Задает уровень пользователя, по которому выбираются лимиты уровня. Задавшим уровень считается вызывающий",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "limit"
+                ],
+                "summary": "Изменение уровня пользователя",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "id пользователя",
+                        "name": "userId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "tier - уровень пользователя",
+                        "name": "SetUserTierRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/SetUserTierRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Уровень задан",
+                        "schema": {
+                            "$ref": "#/definitions/UserTier"
+                        }
+                    },
+                    "400": {
+                        "description": "Невалидный запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права limit:manage",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "499": {
+                        "description": "Клиент отменил запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "504": {
+                        "description": "Истек таймаут запроса в бд",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/orders": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Создает заказ и резервирует деньги под все строки (услуги) в одной транзакции бд: если не удалась резервация хотя бы одной строки, заказ не создается.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "order"
+                ],
+                "summary": "Создание заказа из нескольких услуг",
+                "parameters": [
+                    {
+                        "description": "orderId - id заказа (UUID).\u003cbr\u003e userId - id пользователя (UUID).\u003cbr\u003e lines - строки заказа (от 1 до 100, услуги не повторяются): serviceId - id услуги (UUID), sum - сумма (больше 0), comment - комментарий (опционально)",
+                        "name": "CreateOrderRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/CreateOrderRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Заказ создан, все строки зарезервированы",
+                        "schema": {
+                            "$ref": "#/definitions/Order"
+                        }
+                    },
+                    "400": {
+                        "description": "Невалидный запрос, в том числе повтор serviceId в строках",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права transaction:write",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "404": {
+                        "description": "Баланс пользователя не найден",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "409": {
+                        "description": "Заказ или резервация по услуге заказа уже существует",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "422": {
+                        "description": "Недостаточно средств на балансе или превышен лимит резерваций (limit-exceeded)",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "423": {
+                        "description": "Резервация запрещена статусом счета",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "499": {
+                        "description": "Клиент отменил запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "504": {
+                        "description": "Истек таймаут запроса в бд",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/orders/{orderId}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает заказ со строками, созданными заказом (резервации api v1 с тем же orderId не входят). Статус заказа выводится из статусов строк: reserved - все строки зарезервированы, partially_processed - часть строк еще зарезервирована, captured - все подтверждены, cancelled - все отменены, completed - часть подтверждена, часть отменена",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "order"
+                ],
+                "summary": "Получение заказа",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "id заказа",
+                        "name": "orderId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/Order"
+                        }
+                    },
+                    "400": {
+                        "description": "Невалидный orderId",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права transaction:read",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "404": {
+                        "description": "Заказ не найден",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "499": {
+                        "description": "Клиент отменил запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "504": {
+                        "description": "Истек таймаут запроса в бд",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/orders/{orderId}/lines/{serviceId}/cancel": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Отменяет резервацию по одной строке заказа (услуге) и возвращает деньги на основной баланс",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "order"
+                ],
+                "summary": "Отмена строки заказа",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "id заказа",
+                        "name": "orderId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "id услуги",
+                        "name": "serviceId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "comment - комментарий (опционально)",
+                        "name": "ReservationActionRequest",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/ReservationActionRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Строка отменена, в ответе заказ",
+                        "schema": {
+                            "$ref": "#/definitions/Order"
+                        }
+                    },
+                    "400": {
+                        "description": "Невалидный запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права transaction:write",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "404": {
+                        "description": "Заказ или строка заказа не найдены",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "409": {
+                        "description": "Строка уже подтверждена или отменена",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "423": {
+                        "description": "Отмена запрещена статусом счета (frozen-all, closed)",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "499": {
+                        "description": "Клиент отменил запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "504": {
+                        "description": "Истек таймаут запроса в бд",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/orders/{orderId}/lines/{serviceId}/capture": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Списывает зарезервированные деньги по одной строке заказа (услуге)",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "order"
+                ],
+                "summary": "Признание выручки по строке заказа",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "id заказа",
+                        "name": "orderId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "id услуги",
+                        "name": "serviceId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "comment - комментарий (опционально)",
+                        "name": "ReservationActionRequest",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/ReservationActionRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Выручка по строке признана, в ответе заказ",
+                        "schema": {
+                            "$ref": "#/definitions/Order"
+                        }
+                    },
+                    "400": {
+                        "description": "Невалидный запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права transaction:write",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "404": {
+                        "description": "Заказ или строка заказа не найдены",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "409": {
+                        "description": "Строка уже подтверждена или отменена",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "423": {
+                        "description": "Подтверждение запрещено статусом счета (frozen-all, closed)",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "499": {
+                        "description": "Клиент отменил запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "504": {
+                        "description": "Истек таймаут запроса в бд",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/orders/{orderId}/transactions": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает все транзакции заказа (по всем услугам) с историей состояний каждой",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "transaction"
+                ],
+                "summary": "Получение транзакций заказа с историей изменений",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "id заказа",
+                        "name": "orderId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/GetOrderTransactionsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Невалидный orderId",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права transaction:read",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "499": {
+                        "description": "Клиент отменил запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "504": {
+                        "description": "Истек таймаут запроса в бд",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/report": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Метод создание отчета для бухгалтерии. Возвращает ссылку на файл",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "report"
+                ],
+                "summary": "Создание отчета для бухгалтерии",
+                "parameters": [
+                    {
+                        "description": "year - год отчета (2022 \u003c=year \u003c= 2100)\u003cbr\u003emonth - месяц отчета",
+                        "name": "CreateReportRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/CreateReportRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/CreateReportResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права report:create",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "499": {
+                        "description": "Клиент отменил запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "504": {
+                        "description": "Истек таймаут запроса в бд",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/report/{fileName}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Метод получения файла по ссылке",
+                "tags": [
+                    "report"
+                ],
+                "summary": "Получения файла по ссылке",
+                "responses": {
+                    "200": {
+                        "description": "1 колонка - id услуги (так как названия услуги в моем сервисе не предусмотрено, а доступа к другим нет, так как это просто тест), 2 колонка - общая сумма выручки за услугу"
+                    },
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права report:read",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "404": {
+                        "description": "Если файл не найден или имя не в формате \u003cid\u003e.csv"
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/reservations": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Резервирует деньги с основного баланса пользователя. В отличие от POST /transaction результат передается HTTP статусом.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "reservation"
+                ],
+                "summary": "Резервация денег под услугу заказа",
+                "parameters": [
+                    {
+                        "description": "orderId - id заказа (UUID).\u003cbr\u003e serviceId - id услуги (UUID).\u003cbr\u003e userId - id пользователя (UUID).\u003cbr\u003e sum - сумма (больше 0).\u003cbr\u003e comment - комментарий (опционально)",
+                        "name": "CreateReservationRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/CreateReservationRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Резервация создана",
+                        "schema": {
+                            "$ref": "#/definitions/Reservation"
+                        }
+                    },
+                    "400": {
+                        "description": "Невалидный запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права transaction:write",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "404": {
+                        "description": "Баланс пользователя не найден",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "409": {
+                        "description": "Резервация с такими orderId, userId, serviceId уже существует",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "422": {
+                        "description": "Недостаточно средств на балансе или превышен лимит резерваций (limit-exceeded)",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "423": {
+                        "description": "Резервация запрещена статусом счета",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "499": {
+                        "description": "Клиент отменил запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "504": {
+                        "description": "Истек таймаут запроса в бд",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/reservations/{id}/cancel": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Отменяет резервацию и возвращает деньги на основной баланс.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "reservation"
+                ],
+                "summary": "Отмена резервации",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "id резервации",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "comment - комментарий (опционально)",
+                        "name": "ReservationActionRequest",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/ReservationActionRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Резервация отменена",
+                        "schema": {
+                            "$ref": "#/definitions/Reservation"
+                        }
+                    },
+                    "400": {
+                        "description": "Невалидный запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права transaction:write",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "404": {
+                        "description": "Резервация не найдена",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "409": {
+                        "description": "Резервация уже подтверждена или отменена",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "423": {
+                        "description": "Отмена запрещена статусом счета (frozen-all, closed)",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "499": {
+                        "description": "Клиент отменил запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "504": {
+                        "description": "Истек таймаут запроса в бд",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/reservations/{id}/capture": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Списывает зарезервированные деньги, выручка попадает в отчет для бухгалтерии.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "reservation"
+                ],
+                "summary": "Признание выручки по резервации",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "id резервации",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "comment - комментарий (опционально)",
+                        "name": "ReservationActionRequest",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/ReservationActionRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Выручка признана",
+                        "schema": {
+                            "$ref": "#/definitions/Reservation"
+                        }
+                    },
+                    "400": {
+                        "description": "Невалидный запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права transaction:write",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "404": {
+                        "description": "Резервация не найдена",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "409": {
+                        "description": "Резервация уже подтверждена или отменена",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "423": {
+                        "description": "Подтверждение запрещено статусом счета (frozen-all, closed)",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "499": {
+                        "description": "Клиент отменил запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "504": {
+                        "description": "Истек таймаут запроса в бд",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/transaction": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Метод получение списка транзакций пользователя. Страницы выбираются по курсору: nextCursor из ответа передается в cursor. Постраничный режим (page) оставлен для совместимости, page и cursor вместе передавать нельзя",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "transaction"
+                ],
+                "summary": "Получение списка транзакций пользователя",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "example": "b2b9a788-55fb-11ed-bdc3-0242ac120002",
+                        "description": "id пользователя",
+                        "name": "userId",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "курсор следующей страницы (nextCursor из предыдущего ответа)",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "minimum": 1,
+                        "type": "integer",
+                        "example": 1,
+                        "description": "номер страницы",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "maximum": 100,
+                        "minimum": 1,
+                        "type": "integer",
+                        "default": 10,
+                        "example": 1,
+                        "description": "количество записей на странице",
+                        "name": "itemsPerPage",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "date",
+                            "sum"
+                        ],
+                        "type": "string",
+                        "default": "date",
+                        "example": "sum",
+                        "description": "поле по которому надо сортировать",
+                        "name": "sortBy",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "asc",
+                            "desc"
+                        ],
+                        "type": "string",
+                        "default": "desc",
+                        "example": "asc",
+                        "description": "тип сортировки",
+                        "name": "sortType",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "enum": [
+                                1,
+                                2,
+                                3,
+                                4
+                            ],
+                            "type": "integer"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "типы транзакций",
+                        "name": "transactionType",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "example": "2022-11-01T00:00:00Z",
+                        "description": "дата изменения транзакции от (включительно, RFC 3339)",
+                        "name": "dateFrom",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "example": "2022-12-01T00:00:00Z",
+                        "description": "дата изменения транзакции до (не включительно, RFC 3339)",
+                        "name": "dateTo",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "id услуги",
+                        "name": "serviceId",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "id заказа",
+                        "name": "orderId",
+                        "in": "query"
+                    },
+                    {
+                        "minimum": 0,
+                        "type": "number",
+                        "description": "сумма от (включительно)",
+                        "name": "sumFrom",
+                        "in": "query"
+                    },
+                    {
+                        "minimum": 0,
+                        "type": "number",
+                        "description": "сумма до (включительно)",
+                        "name": "sumTo",
+                        "in": "query"
+                    },
+                    {
+                        "maxLength": 100,
+                        "type": "string",
+                        "description": "поиск подстроки в комментарии без учета регистра",
+                        "name": "comment",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/GetTransactionsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Невалидный запрос или курсор",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права transaction:read",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "499": {
+                        "description": "Клиент отменил запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "504": {
+                        "description": "Истек таймаут запроса в бд",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Метод для обработки транзакции. Для резервации денег со счета в теле запроса поле \"transactionType\" = 1. Для признания выручки и подтверждения списания средств с баланса \"transactionType\" = 2. В случае отмены резервации и возврата средств на основной баланс \"transactionType\" = 3.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "transaction"
+                ],
+                "summary": "Метод для обработки транзакции",
+                "parameters": [
+                    {
+                        "description": "orderId - id заказа (UUID).\u003cbr\u003e serviceId - id услуги (UUID).\u003cbr\u003e userId - id пользователя (UUID).\u003cbr\u003e sum - сумма транзакции (больше 0).\u003cbr\u003e transactionType - тип транзакции (enum(1, 2, 3)).\u003cbr\u003e comment - комментарий (опционально)",
+                        "name": "SaveTransactionRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/SaveTransactionRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Воможные статусы:\u003cbr\u003e 1 - добавление/обновление произошло успешно.\u003cbr\u003e 2 - попытка резервации (\"transactionType\" = 1), резервация с соответсвующими orderId, userId, serviceId уже существует, транзакция резервации не добавлена.\u003cbr\u003e 3 - попытка резервации (\"transactionType\" = 1), на балансе недостаточно средств, транзакция резервации не добавлена.\u003cbr\u003e 4 - попытка признания выручки (\"transactionType\" = 2), транзакция с соответсвующими orderId, userId, serviceId не найдена, ошибка.\u003cbr\u003e 5 - попытка признания выручки (\"transactionType\" = 2), транзакция с соответсвующими orderId, userId, serviceId найдена и выручка уже списана ранее, ошибка.\u003cbr\u003e 6 - попытка признания выручки (\"transactionType\" = 2), транзакция с соответсвующими orderId, userId, serviceId найдена и уже была отклонена ранее, ошибка.\u003cbr\u003e 7 - попытка отмены резервации (\"transactionType\" = 3), транзакция с соответсвующими orderId, userId, serviceId не найдена, ошибка.\u003cbr\u003e 8 - попытка отмены резервации (\"transactionType\" = 3), транзакция с соответсвующими orderId, userId, serviceId найдена и уже была отменена ранее, деньги были возвращены, ошибка.\u003cbr\u003e 9 - попытка отмены резервации (\"transactionType\" = 3), транзакция с соответсвующими orderId, userId, serviceId найдена и уже была подтверждена ранее, деньги были списаны, ошибка.\u003cbr\u003e 10 - баланс пользователя не найден, ошибка",
+                        "schema": {
+                            "$ref": "#/definitions/SaveTransactionResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права transaction:write",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "422": {
+                        "description": "Резервация превышает лимит резерваций (limit-exceeded)",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "423": {
+                        "description": "Операция запрещена статусом счета (account-frozen, account-closed)",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "499": {
+                        "description": "Клиент отменил запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "504": {
+                        "description": "Истек таймаут запроса в бд",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/transaction/batch": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Выполняет по порядку операции reserve, capture, cancel (как POST /transaction) и deposit (как POST /balance). При \"atomic\": true все операции выполняются в одной транзакции бд: при первой ошибке выполненные операции откатываются (rolled_back), остальные не выполняются (skipped). Иначе каждая операция выполняется отдельно. Результат каждой операции - в results с тем же индексом, ошибка в формате ApiError (превышение лимита - limit-exceeded). Для операций deposit нужно право balance:credit",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "transaction"
+                ],
+                "summary": "Пакет операций с балансом",
+                "parameters": [
+                    {
+                        "description": "atomic - все или ничего (по умолчанию false).\u003cbr\u003e operations - операции (не больше BATCH_MAX_OPERATIONS, по умолчанию 100): type - reserve, capture, cancel или deposit, userId, orderId и serviceId (не нужны для deposit), sum (больше 0), comment (опционально)",
+                        "name": "BatchRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/BatchRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Пакет обработан, результаты операций в results",
+                        "schema": {
+                            "$ref": "#/definitions/BatchResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Невалидный запрос или слишком много операций",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права transaction:write или balance:credit для deposit",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "413": {
+                        "description": "Тело запроса больше BATCH_MAX_BODY_BYTES",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "499": {
+                        "description": "Клиент отменил запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "504": {
+                        "description": "Истек таймаут запроса в бд",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/transaction/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает текущее состояние транзакции и все ее состояния по времени (резервация, подтверждение или отмена)",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "transaction"
+                ],
+                "summary": "Получение транзакции с историей изменений",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "id транзакции",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/TransactionDetails"
+                        }
+                    },
+                    "400": {
+                        "description": "Невалидный id",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права transaction:read",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "404": {
+                        "description": "Транзакция не найдена",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "499": {
+                        "description": "Клиент отменил запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "504": {
+                        "description": "Истек таймаут запроса в бд",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает все подписки без секретов",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhook"
+                ],
+                "summary": "Получение подписок webhook",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/GetWebhooksResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права webhook:manage",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "499": {
+                        "description": "Клиент отменил запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "504": {
+                        "description": "Истек таймаут запроса в бд",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Создает подписку: события выбранных типов отправляются POST запросом на url. Тело запроса подписывается HMAC-SHA256 секретом подписки, подпись в заголовке X-Webhook-Signature: t=\u003cunix время\u003e,v1=\u003chex HMAC-SHA256(secret, \"\u003ct\u003e.\u003cтело\u003e\")\u003e. Секрет возвращается только в ответе на создание",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhook"
+                ],
+                "summary": "Создание подписки webhook",
+                "parameters": [
+                    {
+                        "description": "url - адрес подписчика (http или https, адреса loopback, частных сетей и link-local запрещены).\u003cbr\u003e eventTypes - типы событий: deposit, reserved, captured, cancelled.\u003cbr\u003e serviceId - присылать только события по услуге (UUID, опционально, события deposit без услуги не присылаются)",
+                        "name": "CreateWebhookRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/CreateWebhookRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Подписка создана, в ответе секрет подписи",
+                        "schema": {
+                            "$ref": "#/definitions/Webhook"
+                        }
+                    },
+                    "400": {
+                        "description": "Невалидный запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права webhook:manage",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "499": {
+                        "description": "Клиент отменил запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "504": {
+                        "description": "Истек таймаут запроса в бд",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает подписку без секрета",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhook"
+                ],
+                "summary": "Получение подписки webhook",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "id подписки",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/Webhook"
+                        }
+                    },
+                    "400": {
+                        "description": "Невалидный id",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права webhook:manage",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "404": {
+                        "description": "Подписка не найдена",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "499": {
+                        "description": "Клиент отменил запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "504": {
+                        "description": "Истек таймаут запроса в бд",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Удаляет подписку вместе с журналом доставок, неотправленные события подписчику не отправляются",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhook"
+                ],
+                "summary": "Удаление подписки webhook",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "id подписки",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Подписка удалена"
+                    },
+                    "400": {
+                        "description": "Невалидный id",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права webhook:manage",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "404": {
+                        "description": "Подписка не найдена",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "499": {
+                        "description": "Клиент отменил запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "504": {
+                        "description": "Истек таймаут запроса в бд",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/{id}/deliveries": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает последние 100 доставок подписки, новые первыми. pending - ждет отправки или повторной попытки (nextAttemptTime), delivered - подписчик ответил 2xx, dead - попытки исчерпаны",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhook"
+                ],
+                "summary": "Журнал доставок webhook",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "id подписки",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            "pending",
+                            "delivered",
+                            "dead"
+                        ],
+                        "type": "string",
+                        "description": "Фильтр по статусу",
+                        "name": "status",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/GetWebhookDeliveriesResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Невалидный запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права webhook:manage",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "404": {
+                        "description": "Подписка не найдена",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "499": {
+                        "description": "Клиент отменил запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "504": {
+                        "description": "Истек таймаут запроса в бд",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/{id}/deliveries/{deliveryId}/redeliver": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Ставит доставку в очередь на немедленную отправку с новым счетчиком попыток, в том числе уже доставленную или dead",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhook"
+                ],
+                "summary": "Повторная отправка доставки webhook",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "id подписки",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "id доставки",
+                        "name": "deliveryId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Доставка поставлена в очередь",
+                        "schema": {
+                            "$ref": "#/definitions/WebhookDelivery"
+                        }
+                    },
+                    "400": {
+                        "description": "Невалидный id или deliveryId",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "401": {
+                        "description": "Не передан или невалидный api ключ/токен",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права webhook:manage",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "404": {
+                        "description": "Доставка подписки не найдена",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышен лимит запросов, время ожидания в заголовке Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "499": {
+                        "description": "Клиент отменил запрос",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    },
+                    "504": {
+                        "description": "Истек таймаут запроса в бд",
+                        "schema": {
+                            "$ref": "#/definitions/ApiError"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "Account": {
+            "type": "object",
+            "properties": {
+                "reason": {
+                    "type": "string",
+                    "example": "Подозрение на мошенничество, тикет RISK-42"
+                },
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "active",
+                        "frozen-debit",
+                        "frozen-all",
+                        "closed"
+                    ],
+                    "example": "frozen-debit"
+                },
+                "updateTime": {
+                    "type": "string",
+                    "example": "2022-11-01T16:37:52.717392Z"
+                },
+                "updatedBy": {
+                    "type": "string",
+                    "example": "risk-carol"
+                },
+                "userId": {
+                    "type": "string",
+                    "example": "e8c49cf0-d984-4ed8-a37c-2d60f74c7fe5"
+                }
+            }
+        },
+        "Adjustment": {
+            "type": "object",
+            "properties": {
+                "decidedBy": {
+                    "type": "string",
+                    "example": "finance-bob"
+                },
+                "decisionComment": {
+                    "type": "string",
+                    "example": "Проверено по выписке"
+                },
+                "decisionTime": {
+                    "type": "string",
+                    "example": "2022-11-01T17:02:11.104233Z"
+                },
+                "direction": {
+                    "type": "string",
+                    "enum": [
+                        "credit",
+                        "debit"
+                    ],
+                    "example": "debit"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "3c2b1a0f-9e8d-4c7b-a6f5-e4d3c2b1a0f9"
+                },
+                "proposeTime": {
+                    "type": "string",
+                    "example": "2022-11-01T16:37:52.717392Z"
+                },
+                "proposedBy": {
+                    "type": "string",
+                    "example": "support-alice"
+                },
+                "reason": {
+                    "type": "string",
+                    "example": "Двойное зачисление платежа"
+                },
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "pending",
+                        "approved",
+                        "rejected"
+                    ],
+                    "example": "approved"
+                },
+                "sum": {
+                    "type": "number",
+                    "example": 150
+                },
+                "ticket": {
+                    "type": "string",
+                    "example": "SUP-1234"
+                },
+                "transactionId": {
+                    "type": "string",
+                    "example": "0d3b2a4c-6b0e-4c9b-9d8c-3c4f0a1e2b7d"
+                },
+                "userId": {
+                    "type": "string",
+                    "example": "e8c49cf0-d984-4ed8-a37c-2d60f74c7fe5"
+                }
+            }
+        },
+        "AdjustmentDecisionRequest": {
+            "type": "object",
+            "properties": {
+                "comment": {
+                    "type": "string",
+                    "maxLength": 1000,
+                    "example": "Проверено по выписке"
+                }
+            }
+        },
+        "ApiError": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string",
+                    "example": "validation-error"
+                },
+                "detail": {
+                    "type": "string",
+                    "example": "field sum should be \u003e 0"
+                },
+                "instance": {
+                    "type": "string",
+                    "example": "/balance"
+                },
+                "invalidParams": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/InvalidParam"
+                    }
+                },
+                "message": {
+                    "type": "string",
+                    "example": "field sum should be \u003e 0"
+                },
+                "requestId": {
+                    "type": "string",
+                    "example": "03070038-3459-45d8-ad22-a8fc0fbb634c"
+                },
+                "status": {
+                    "type": "integer",
+                    "example": 400
+                },
+                "title": {
+                    "type": "string",
+                    "example": "Request validation failed"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "https://balance-service/problems/validation-error"
+                }
+            }
+        },
+        "BatchOperation": {
+            "type": "object",
+            "required": [
+                "sum",
+                "type",
+                "userId"
+            ],
+            "properties": {
+                "comment": {
+                    "type": "string",
+                    "example": "заказ 42"
+                },
+                "orderId": {
+                    "type": "string",
+                    "format": "uuid",
+                    "example": "6c87959d-aa88-4f51-932b-ff70563ad87b"
+                },
+                "serviceId": {
+                    "type": "string",
+                    "format": "uuid",
+                    "example": "15aa9f91-c8f7-40e4-9108-d45891c10444"
+                },
+                "sum": {
+                    "type": "number",
+                    "example": 100
+                },
+                "type": {
+                    "type": "string",
+                    "enum": [
+                        "reserve",
+                        "capture",
+                        "cancel",
+                        "deposit"
+                    ],
+                    "example": "reserve"
+                },
+                "userId": {
+                    "type": "string",
+                    "format": "uuid",
+                    "example": "c806ce22-7ea3-4402-b979-9959746bb956"
+                }
+            }
+        },
+        "BatchOperationResult": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "$ref": "#/definitions/ApiError"
+                },
+                "index": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "applied",
+                        "rolled_back",
+                        "failed",
+                        "skipped"
+                    ],
+                    "example": "applied"
+                }
+            }
+        },
+        "BatchRequest": {
+            "type": "object",
+            "required": [
+                "operations"
+            ],
+            "properties": {
+                "atomic": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "operations": {
+                    "type": "array",
+                    "minItems": 1,
+                    "items": {
+                        "$ref": "#/definitions/BatchOperation"
+                    }
+                }
+            }
+        },
+        "BatchResponse": {
+            "type": "object",
+            "properties": {
+                "atomic": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/BatchOperationResult"
+                    }
+                }
+            }
+        },
+        "CreateAdjustmentRequest": {
+            "type": "object",
+            "required": [
+                "direction",
+                "reason",
+                "sum",
+                "ticket",
+                "userId"
+            ],
+            "properties": {
+                "direction": {
+                    "type": "string",
+                    "enum": [
+                        "credit",
+                        "debit"
+                    ],
+                    "example": "debit"
+                },
+                "reason": {
+                    "type": "string",
+                    "maxLength": 1000,
+                    "minLength": 1,
+                    "example": "Двойное зачисление платежа"
+                },
+                "sum": {
+                    "type": "number",
+                    "format": "numeric",
+                    "example": 150
+                },
+                "ticket": {
+                    "type": "string",
+                    "maxLength": 100,
+                    "minLength": 1,
+                    "example": "SUP-1234"
+                },
+                "userId": {
+                    "type": "string",
+                    "format": "uuid",
+                    "example": "e8c49cf0-d984-4ed8-a37c-2d60f74c7fe5"
+                }
+            }
+        },
+        "CreateOrderLine": {
+            "type": "object",
+            "required": [
+                "serviceId",
+                "sum"
+            ],
+            "properties": {
+                "comment": {
+                    "type": "string",
+                    "example": "доставка"
+                },
+                "serviceId": {
+                    "type": "string",
+                    "format": "uuid",
+                    "example": "15aa9f91-c8f7-40e4-9108-d45891c10444"
+                },
+                "sum": {
+                    "type": "number",
+                    "example": 100
+                }
+            }
+        },
+        "CreateOrderRequest": {
+            "type": "object",
+            "required": [
+                "lines",
+                "orderId",
+                "userId"
+            ],
+            "properties": {
+                "lines": {
+                    "type": "array",
+                    "maxItems": 100,
+                    "minItems": 1,
+                    "items": {
+                        "$ref": "#/definitions/CreateOrderLine"
+                    }
+                },
+                "orderId": {
+                    "type": "string",
+                    "format": "uuid",
+                    "example": "6c87959d-aa88-4f51-932b-ff70563ad87b"
+                },
+                "userId": {
+                    "type": "string",
+                    "format": "uuid",
+                    "example": "c806ce22-7ea3-4402-b979-9959746bb956"
+                }
+            }
+        },
+        "CreateReportRequest": {
+            "type": "object",
+            "required": [
+                "month",
+                "year"
+            ],
+            "properties": {
+                "month": {
+                    "type": "integer",
+                    "enum": [
+                        1,
                         2,
                         3,
                         4,
@@ -292,64 +3544,450 @@ const docTemplate = `{
                         12
                     ]
                 },
-                "year": {
-                    "type": "integer",
-                    "maximum": 2100,
-                    "minimum": 2022
+                "year": {
+                    "type": "integer",
+                    "maximum": 2100,
+                    "minimum": 2022
+                }
+            }
+        },
+        "CreateReportResponse": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "string",
+                    "example": "5b0f7c1e-2f4a-4d8e-9c3b-6a1d2e4f8b7c"
+                },
+                "url": {
+                    "type": "string",
+                    "example": "http://localhost:8000/report/03070038-3459-45d8-ad22-a8fc0fbb634c.csv"
+                }
+            }
+        },
+        "CreateReservationRequest": {
+            "type": "object",
+            "required": [
+                "orderId",
+                "serviceId",
+                "sum",
+                "userId"
+            ],
+            "properties": {
+                "comment": {
+                    "type": "string",
+                    "format": "string",
+                    "example": "Резервация денежных средств"
+                },
+                "orderId": {
+                    "type": "string",
+                    "format": "uuid",
+                    "example": "6c87959d-aa88-4f51-932b-ff70563ad87a"
+                },
+                "serviceId": {
+                    "type": "string",
+                    "format": "uuid",
+                    "example": "15aa9f91-c8f7-40e4-9108-d45891c10444"
+                },
+                "sum": {
+                    "type": "number",
+                    "format": "numeric",
+                    "example": 345
+                },
+                "userId": {
+                    "type": "string",
+                    "format": "uuid",
+                    "example": "e8c49cf0-d984-4ed8-a37c-2d60f74c7fe5"
                 }
             }
         },
-        "CreateReportResponse": {
+        "CreateWebhookRequest": {
             "type": "object",
+            "required": [
+                "eventTypes",
+                "url"
+            ],
             "properties": {
+                "eventTypes": {
+                    "type": "array",
+                    "minItems": 1,
+                    "items": {
+                        "type": "string",
+                        "enum": [
+                            "deposit",
+                            "withdrawal",
+                            "adjustment",
+                            "reserved",
+                            "captured",
+                            "cancelled"
+                        ]
+                    }
+                },
+                "serviceId": {
+                    "type": "string",
+                    "format": "uuid",
+                    "example": "15aa9f91-c8f7-40e4-9108-d45891c10444"
+                },
                 "url": {
                     "type": "string",
-                    "example": "http://localhost:8000/report/03070038-3459-45d8-ad22-a8fc0fbb634c.csv"
+                    "maxLength": 2048,
+                    "example": "https://partner.example.com/balance-events"
+                }
+            }
+        },
+        "GetAdjustmentsResponse": {
+            "type": "object",
+            "properties": {
+                "adjustments": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/Adjustment"
+                    }
+                }
+            }
+        },
+        "GetBalanceResponse": {
+            "type": "object",
+            "properties": {
+                "balance": {
+                    "type": "number",
+                    "format": "numeric",
+                    "example": 53.68
+                }
+            }
+        },
+        "GetLimitRulesResponse": {
+            "type": "object",
+            "properties": {
+                "limits": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/LimitRule"
+                    }
+                }
+            }
+        },
+        "GetOrderTransactionsResponse": {
+            "type": "object",
+            "properties": {
+                "transactions": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/TransactionDetails"
+                    }
+                }
+            }
+        },
+        "GetTransactionsResponse": {
+            "type": "object",
+            "properties": {
+                "hasMore": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "itemsPerPage": {
+                    "type": "integer",
+                    "example": 10
+                },
+                "nextCursor": {
+                    "type": "string",
+                    "example": "eyJzIjoiZGF0ZSIsIm8iOiJkZXNjIn0"
+                },
+                "page": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "total": {
+                    "type": "integer",
+                    "example": 42
+                },
+                "transactions": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/Transaction"
+                    }
+                }
+            }
+        },
+        "GetWebhookDeliveriesResponse": {
+            "type": "object",
+            "properties": {
+                "deliveries": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/WebhookDelivery"
+                    }
+                }
+            }
+        },
+        "GetWebhooksResponse": {
+            "type": "object",
+            "properties": {
+                "webhooks": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/Webhook"
+                    }
+                }
+            }
+        },
+        "IncreaseBalanceRequest": {
+            "type": "object",
+            "required": [
+                "sum",
+                "userId"
+            ],
+            "properties": {
+                "comment": {
+                    "type": "string",
+                    "format": "string",
+                    "example": "Зачисление денежных средств на баланс"
+                },
+                "sum": {
+                    "type": "number",
+                    "format": "numeric",
+                    "example": 53.68
+                },
+                "userId": {
+                    "type": "string",
+                    "format": "uuid",
+                    "example": "c806ce22-7ea3-4402-b979-9959746bb956"
+                }
+            }
+        },
+        "InvalidParam": {
+            "type": "object",
+            "properties": {
+                "constraint": {
+                    "type": "string",
+                    "example": "gt=0"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "sum"
+                },
+                "reason": {
+                    "type": "string",
+                    "example": "field sum should be \u003e 0"
+                }
+            }
+        },
+        "LimitRule": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "number",
+                    "example": 50000
+                },
+                "operation": {
+                    "type": "string",
+                    "enum": [
+                        "deposit",
+                        "reserve",
+                        "withdraw"
+                    ],
+                    "example": "deposit"
+                },
+                "period": {
+                    "type": "string",
+                    "enum": [
+                        "transaction",
+                        "day",
+                        "month"
+                    ],
+                    "example": "day"
+                },
+                "scope": {
+                    "type": "string",
+                    "enum": [
+                        "global",
+                        "tier",
+                        "user"
+                    ],
+                    "example": "tier"
+                },
+                "scopeId": {
+                    "type": "string",
+                    "example": "basic"
+                },
+                "updateTime": {
+                    "type": "string",
+                    "example": "2022-11-01T16:37:52.717392Z"
+                },
+                "updatedBy": {
+                    "type": "string",
+                    "example": "risk-carol"
+                }
+            }
+        },
+        "LimitUsage": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "number",
+                    "example": 50000
+                },
+                "operation": {
+                    "type": "string",
+                    "enum": [
+                        "deposit",
+                        "reserve",
+                        "withdraw"
+                    ],
+                    "example": "deposit"
+                },
+                "period": {
+                    "type": "string",
+                    "enum": [
+                        "transaction",
+                        "day",
+                        "month"
+                    ],
+                    "example": "day"
+                },
+                "remaining": {
+                    "type": "number",
+                    "example": 37500
+                },
+                "resetTime": {
+                    "type": "string",
+                    "example": "2022-11-02T00:00:00Z"
+                },
+                "scope": {
+                    "type": "string",
+                    "enum": [
+                        "global",
+                        "tier",
+                        "user"
+                    ],
+                    "example": "tier"
+                },
+                "used": {
+                    "type": "number",
+                    "example": 12500
+                }
+            }
+        },
+        "Order": {
+            "type": "object",
+            "properties": {
+                "createTime": {
+                    "type": "string",
+                    "example": "2022-11-01T16:30:12.114215Z"
+                },
+                "lines": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/OrderLine"
+                    }
+                },
+                "orderId": {
+                    "type": "string",
+                    "example": "6c87959d-aa88-4f51-932b-ff70563ad87b"
+                },
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "reserved",
+                        "partially_processed",
+                        "captured",
+                        "cancelled",
+                        "completed"
+                    ],
+                    "example": "partially_processed"
+                },
+                "sum": {
+                    "type": "number",
+                    "example": 350
+                },
+                "userId": {
+                    "type": "string",
+                    "example": "c806ce22-7ea3-4402-b979-9959746bb956"
+                }
+            }
+        },
+        "OrderLine": {
+            "type": "object",
+            "properties": {
+                "comment": {
+                    "type": "string",
+                    "example": "доставка"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "0d3b2a4c-6b0e-4c9b-9d8c-3c4f0a1e2b7d"
+                },
+                "serviceId": {
+                    "type": "string",
+                    "example": "15aa9f91-c8f7-40e4-9108-d45891c10444"
+                },
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "reserved",
+                        "captured",
+                        "cancelled"
+                    ],
+                    "example": "captured"
+                },
+                "sum": {
+                    "type": "number",
+                    "example": 100
+                },
+                "updTime": {
+                    "type": "string",
+                    "example": "2022-11-01T16:37:52.717392Z"
                 }
             }
         },
-        "GetBalanceResponse": {
+        "Reservation": {
             "type": "object",
             "properties": {
-                "balance": {
+                "comment": {
+                    "type": "string",
+                    "example": "Резервация денежных средств"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "2f1c7f1e-9a3b-4a57-8a0e-7f6f3b0a8d11"
+                },
+                "orderId": {
+                    "type": "string",
+                    "example": "6c87959d-aa88-4f51-932b-ff70563ad87a"
+                },
+                "serviceId": {
+                    "type": "string",
+                    "example": "15aa9f91-c8f7-40e4-9108-d45891c10444"
+                },
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "reserved",
+                        "captured",
+                        "cancelled"
+                    ],
+                    "example": "reserved"
+                },
+                "sum": {
                     "type": "number",
-                    "format": "numeric",
-                    "example": 53.68
-                }
-            }
-        },
-        "GetTransactionsResponse": {
-            "type": "object",
-            "properties": {
-                "transactions": {
-                    "type": "array",
-                    "items": {
-                        "$ref": "#/definitions/Transaction"
-                    }
+                    "example": 345
+                },
+                "updatedAt": {
+                    "type": "string",
+                    "example": "2022-11-01T16:37:52.717392Z"
+                },
+                "userId": {
+                    "type": "string",
+                    "example": "e8c49cf0-d984-4ed8-a37c-2d60f74c7fe5"
                 }
             }
         },
-        "IncreaseBalanceRequest": {
+        "ReservationActionRequest": {
             "type": "object",
-            "required": [
-                "sum",
-                "userId"
-            ],
             "properties": {
                 "comment": {
                     "type": "string",
                     "format": "string",
-                    "example": "Зачисление денежных средств на баланс"
-                },
-                "sum": {
-                    "type": "number",
-                    "format": "numeric",
-                    "example": 53.68
-                },
-                "userId": {
-                    "type": "string",
-                    "format": "uuid",
-                    "example": "c806ce22-7ea3-4402-b979-9959746bb956"
+                    "example": "оплата подтверждена"
                 }
             }
         },
@@ -409,6 +4047,93 @@ const docTemplate = `{
                 }
             }
         },
+        "SetAccountStatusRequest": {
+            "type": "object",
+            "required": [
+                "reason",
+                "status"
+            ],
+            "properties": {
+                "reason": {
+                    "type": "string",
+                    "maxLength": 1000,
+                    "minLength": 1,
+                    "example": "Подозрение на мошенничество, тикет RISK-42"
+                },
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "active",
+                        "frozen-debit",
+                        "frozen-all",
+                        "closed"
+                    ],
+                    "example": "frozen-debit"
+                }
+            }
+        },
+        "SetLimitRuleRequest": {
+            "type": "object",
+            "required": [
+                "amount",
+                "operation",
+                "period",
+                "scope"
+            ],
+            "properties": {
+                "amount": {
+                    "type": "number",
+                    "format": "numeric",
+                    "example": 50000
+                },
+                "operation": {
+                    "type": "string",
+                    "enum": [
+                        "deposit",
+                        "reserve",
+                        "withdraw"
+                    ],
+                    "example": "deposit"
+                },
+                "period": {
+                    "type": "string",
+                    "enum": [
+                        "transaction",
+                        "day",
+                        "month"
+                    ],
+                    "example": "day"
+                },
+                "scope": {
+                    "type": "string",
+                    "enum": [
+                        "global",
+                        "tier",
+                        "user"
+                    ],
+                    "example": "tier"
+                },
+                "scopeId": {
+                    "type": "string",
+                    "maxLength": 100,
+                    "example": "basic"
+                }
+            }
+        },
+        "SetUserTierRequest": {
+            "type": "object",
+            "required": [
+                "tier"
+            ],
+            "properties": {
+                "tier": {
+                    "type": "string",
+                    "maxLength": 100,
+                    "minLength": 1,
+                    "example": "basic"
+                }
+            }
+        },
         "Transaction": {
             "type": "object",
             "properties": {
@@ -420,6 +4145,49 @@ const docTemplate = `{
                     "type": "string",
                     "example": "2022-11-01T16:37:52.717392Z"
                 },
+                "id": {
+                    "type": "string",
+                    "example": "0d3b2a4c-6b0e-4c9b-9d8c-3c4f0a1e2b7d"
+                },
+                "order_id": {
+                    "type": "string",
+                    "example": "6c87959d-aa88-4f51-932b-ff70563ad87b"
+                },
+                "service_id": {
+                    "type": "string",
+                    "example": "15aa9f91-c8f7-40e4-9108-d45891c10444"
+                },
+                "sum": {
+                    "type": "number",
+                    "example": 1000
+                },
+                "transaction_type": {
+                    "type": "string",
+                    "example": "Резервация подтверждена, средства списаны, оплата прошла"
+                }
+            }
+        },
+        "TransactionDetails": {
+            "type": "object",
+            "properties": {
+                "comment": {
+                    "type": "string",
+                    "example": "оплата подтверждена"
+                },
+                "date": {
+                    "type": "string",
+                    "example": "2022-11-01T16:37:52.717392Z"
+                },
+                "history": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/TransactionState"
+                    }
+                },
+                "id": {
+                    "type": "string",
+                    "example": "0d3b2a4c-6b0e-4c9b-9d8c-3c4f0a1e2b7d"
+                },
                 "order_id": {
                     "type": "string",
                     "example": "6c87959d-aa88-4f51-932b-ff70563ad87b"
@@ -435,9 +4203,183 @@ const docTemplate = `{
                 "transaction_type": {
                     "type": "string",
                     "example": "Резервация подтверждена, средства списаны, оплата прошла"
+                },
+                "user_id": {
+                    "type": "string",
+                    "example": "c806ce22-7ea3-4402-b979-9959746bb956"
+                }
+            }
+        },
+        "TransactionState": {
+            "type": "object",
+            "properties": {
+                "comment": {
+                    "type": "string",
+                    "example": "резервация под заказ"
+                },
+                "date": {
+                    "type": "string",
+                    "example": "2022-11-01T16:30:12.114215Z"
+                },
+                "sum": {
+                    "type": "number",
+                    "example": 1000
+                },
+                "transaction_type": {
+                    "type": "string",
+                    "example": "Деньги зарезервированы с основного баланса"
+                },
+                "transaction_type_id": {
+                    "type": "integer",
+                    "example": 1
+                }
+            }
+        },
+        "UserLimits": {
+            "type": "object",
+            "properties": {
+                "limits": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/LimitUsage"
+                    }
+                },
+                "tier": {
+                    "type": "string",
+                    "example": "basic"
+                },
+                "userId": {
+                    "type": "string",
+                    "example": "e8c49cf0-d984-4ed8-a37c-2d60f74c7fe5"
+                }
+            }
+        },
+        "UserTier": {
+            "type": "object",
+            "properties": {
+                "tier": {
+                    "type": "string",
+                    "example": "basic"
+                },
+                "updateTime": {
+                    "type": "string",
+                    "example": "2022-11-01T16:37:52.717392Z"
+                },
+                "updatedBy": {
+                    "type": "string",
+                    "example": "risk-carol"
+                },
+                "userId": {
+                    "type": "string",
+                    "example": "e8c49cf0-d984-4ed8-a37c-2d60f74c7fe5"
+                }
+            }
+        },
+        "Webhook": {
+            "type": "object",
+            "properties": {
+                "createTime": {
+                    "type": "string",
+                    "example": "2022-11-01T16:37:52.717392Z"
+                },
+                "eventTypes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "reserved",
+                        "captured"
+                    ]
+                },
+                "id": {
+                    "type": "string",
+                    "example": "9b2f6c1e-3d4a-4f8b-a1c2-5e6f7a8b9c0d"
+                },
+                "secret": {
+                    "type": "string",
+                    "example": "whsec_5f0c1e..."
+                },
+                "serviceId": {
+                    "type": "string",
+                    "example": "15aa9f91-c8f7-40e4-9108-d45891c10444"
+                },
+                "url": {
+                    "type": "string",
+                    "example": "https://partner.example.com/balance-events"
+                }
+            }
+        },
+        "WebhookDelivery": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer",
+                    "example": 2
+                },
+                "eventId": {
+                    "type": "string",
+                    "example": "7a8b9c0d-1e2f-4a3b-8c4d-5e6f7a8b9c0d"
+                },
+                "eventSequence": {
+                    "type": "integer",
+                    "example": 42
+                },
+                "eventTime": {
+                    "type": "string",
+                    "example": "2022-11-01T16:37:52.717392Z"
+                },
+                "eventType": {
+                    "type": "string",
+                    "example": "captured"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "4e1d2c3b-5a6f-4b7c-8d9e-0f1a2b3c4d5e"
+                },
+                "lastAttemptTime": {
+                    "type": "string",
+                    "example": "2022-11-01T16:37:52.717392Z"
+                },
+                "lastError": {
+                    "type": "string",
+                    "example": "unexpected status code 503"
+                },
+                "lastStatusCode": {
+                    "type": "integer",
+                    "example": 503
+                },
+                "nextAttemptTime": {
+                    "type": "string",
+                    "example": "2022-11-01T16:38:52.717392Z"
+                },
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "pending",
+                        "delivered",
+                        "dead"
+                    ],
+                    "example": "pending"
+                },
+                "userId": {
+                    "type": "string",
+                    "example": "e8c49cf0-d984-4ed8-a37c-2d60f74c7fe5"
                 }
             }
         }
+    },
+    "securityDefinitions": {
+        "ApiKeyAuth": {
+            "type": "apiKey",
+            "name": "X-API-Key",
+            "in": "header"
+        },
+        "BearerAuth": {
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
+        }
     }
 }`
 
@@ -14,7 +14,9 @@ INSERT INTO public.transaction_type(id, type)
 VALUES (1::smallint, 'Деньги зарезервированы с основного баланса'),
        (2::smallint, 'Резервация подтверждена, средства списаны, оплата прошла'),
        (3::smallint, 'Резервация отменена, средства возвращены на основной счет баланса'),
-       (4::smallint, 'Добавление средств к балансу');
+       (4::smallint, 'Добавление средств к балансу'),
+       (5::smallint, 'Списание средств с баланса'),
+       (6::smallint, 'Корректировка баланса');
 
 create table public.transaction(
     id                  uuid default gen_random_uuid() not null
@@ -31,6 +33,13 @@ create table public.transaction(
 create unique index transaction_order_id_user_id_service_id__unique
     on transaction (order_id, user_id, service_id);
 
+-- индексы для выборки истории по курсору (сортировка по дате или сумме, затем по id)
+create index transaction_user_id_upd_time_id__index
+    on transaction (user_id, upd_time, id);
+
+create index transaction_user_id_sum_id__index
+    on transaction (user_id, sum, id);
+
 create table public.transaction_upd(
     upd_id              uuid default gen_random_uuid() not null
         primary key,
@@ -44,11 +53,264 @@ create table public.transaction_upd(
     upd_time            timestamp                      not null
 );
 
-create function public.add_balance(user_id_i uuid, sum_i numeric, comment_i character varying) returns void
+-- заказ из нескольких строк, строки - транзакции с order_id заказа (по одной на услугу).
+-- service_ids - услуги строк, созданных заказом: резервации api v1 с тем же order_id в заказ не входят
+create table public.orders(
+    order_id    uuid      not null
+        primary key,
+    user_id     uuid      not null,
+    service_ids uuid[]    not null,
+    create_time timestamp not null
+);
+
+create index transaction_upd_id__index
+    on transaction_upd (id, upd_time);
+
+-- outbox: события об изменении баланса пишутся в той же транзакции бд, что и изменение, и публикуются relay воркером
+create table public.outbox(
+    id           bigserial                          not null
+        primary key,
+    event_id     uuid    default gen_random_uuid() not null,
+    event_type   varchar(50)                        not null,
+    user_id      uuid                               not null,
+    payload      jsonb                              not null,
+    create_time  timestamp                          not null,
+    publish_time timestamp
+);
+
+create index outbox_unpublished__index
+    on outbox (id) where publish_time is null;
+
+-- подписки партнеров на события (webhook), service_id - фильтр по услуге
+create table public.webhook_subscription(
+    id          uuid    default gen_random_uuid() not null
+        primary key,
+    url         varchar                            not null,
+    event_types varchar[]                          not null,
+    service_id  uuid,
+    secret      varchar                            not null,
+    create_time timestamp                          not null
+);
+
+-- доставки событий подписчикам, status: pending - ждет отправки, delivered - доставлено, dead - попытки исчерпаны
+create table public.webhook_delivery(
+    id                uuid    default gen_random_uuid() not null
+        primary key,
+    subscription_id   uuid                               not null
+        references public.webhook_subscription (id) on delete cascade,
+    event_id          uuid                               not null,
+    event_sequence    bigint                             not null,
+    event_type        varchar(50)                        not null,
+    user_id           uuid                               not null,
+    payload           jsonb                              not null,
+    event_time        timestamp                          not null,
+    status            varchar(20)                        not null,
+    attempts          integer default 0                  not null,
+    next_attempt_time timestamp                          not null,
+    last_attempt_time timestamp,
+    last_status_code  integer,
+    last_error        varchar
+);
+
+create index webhook_delivery_pending__index
+    on webhook_delivery (next_attempt_time) where status = 'pending';
+
+create index webhook_delivery_subscription_id__index
+    on webhook_delivery (subscription_id, event_sequence);
+
+-- ручные корректировки баланса (maker-checker): предлагает proposed_by, проводит или отклоняет другой оператор decided_by,
+-- status: pending - ждет решения, approved - проведена транзакцией transaction_id, rejected - отклонена
+create table public.adjustment(
+    id               uuid           not null
+        primary key,
+    user_id          uuid           not null,
+    direction        varchar(10)    not null,
+    sum              numeric(16, 4) not null,
+    reason           varchar        not null,
+    ticket           varchar(100)   not null,
+    status           varchar(20)    not null,
+    proposed_by      varchar(200)   not null,
+    propose_time     timestamp      not null,
+    decided_by       varchar(200),
+    decision_time    timestamp,
+    decision_comment varchar,
+    transaction_id   uuid
+);
+
+create index adjustment_pending__index
+    on adjustment (propose_time) where status = 'pending';
+
+create index adjustment_user_id_propose_time__index
+    on adjustment (user_id, propose_time);
+
+-- статус счета пользователя, нет строки - счет активен. status: active, frozen-debit - запрещено уменьшать доступный баланс,
+-- frozen-all - запрещено любое движение денег, closed - счет закрыт. reason и updated_by - причина и кто задал статус
+create table public.account_status(
+    user_id     uuid         not null
+        primary key,
+    status      varchar(20)  not null,
+    reason      varchar      not null,
+    updated_by  varchar(200) not null,
+    update_time timestamp    not null
+);
+
+-- ограничение операции статусом счета: debit_i - операция уменьшает доступный баланс (резервация, списание).
+-- 1 - разрешено, 11 - счет заморожен, 12 - счет закрыт. Перевод между пользователями должен проверять списание
+-- у отправителя и зачисление у получателя
+create function public.account_restriction(user_id_i uuid, debit_i boolean) returns integer
+    language sql
+    stable
+as
+$$
+SELECT CASE
+    WHEN a.status = 'closed' THEN 12
+    WHEN a.status = 'frozen-all' THEN 11
+    WHEN a.status = 'frozen-debit' AND debit_i THEN 11
+    ELSE 1
+END
+FROM (SELECT (SELECT s.status FROM public.account_status s WHERE s.user_id = user_id_i) AS status) a
+$$;
+
+-- уровень пользователя для лимитов (например, verified, vip), нет строки - действуют только глобальные лимиты и лимиты пользователя
+create table public.user_tier(
+    user_id     uuid         not null
+        primary key,
+    tier        varchar(100) not null,
+    updated_by  varchar(200) not null,
+    update_time timestamp    not null
+);
+
+-- лимиты операций. scope: global (scope_id пустой), tier (scope_id - уровень), user (scope_id - id пользователя).
+-- operation: deposit - пополнение, reserve - резервация, withdraw - списание. period: transaction - сумма одной операции,
+-- day и month - сумма операций за календарные сутки и месяц (UTC). rule_key - id правила для журнала аудита
+create table public.limit_rule(
+    scope       varchar(10)    not null,
+    scope_id    varchar(100)   not null,
+    operation   varchar(10)    not null,
+    period      varchar(15)    not null,
+    amount      numeric(16, 4) not null,
+    updated_by  varchar(200)   not null,
+    update_time timestamp      not null,
+    rule_key    varchar generated always as (scope || ':' || scope_id || ':' || operation || ':' || period) stored,
+    primary key (scope, scope_id, operation, period)
+);
+
+-- действующий лимит пользователя на операцию за период: самый частный из лимитов пользователя, его уровня и глобального.
+-- Нет лимита - пустой результат
+create function public.limit_rule_for(user_id_i uuid, operation_i varchar, period_i varchar) returns setof public.limit_rule
+    language sql
+    stable
+as
+$$
+SELECT r.*
+FROM public.limit_rule r
+WHERE r.operation = operation_i
+  AND r.period = period_i
+  AND (r.scope = 'global'
+    OR r.scope = 'tier' AND r.scope_id = (SELECT t.tier FROM public.user_tier t WHERE t.user_id = user_id_i)
+    OR r.scope = 'user' AND r.scope_id = user_id_i::text)
+ORDER BY CASE r.scope WHEN 'user' THEN 1 WHEN 'tier' THEN 2 ELSE 3 END
+LIMIT 1
+$$;
+
+-- сумма операций пользователя за [from_i, to_i): пополнений, списаний или резерваций по времени резервации. Отмененные
+-- резервации не учитываются - отмена возвращает деньги и освобождает лимит. Подтверждение не раньше резервации,
+-- поэтому подтвержденные ищутся по upd_time >= from_i
+create function public.limit_usage(user_id_i uuid, operation_i varchar, from_i timestamp, to_i timestamp) returns numeric
+    language sql
+    stable
+as
+$$
+SELECT COALESCE(SUM(t.sum), 0)
+FROM public.transaction t
+WHERE t.user_id = user_id_i
+  AND t.upd_time >= from_i
+  AND CASE operation_i
+    WHEN 'deposit' THEN t.transaction_type_id = 4 AND t.upd_time < to_i
+    WHEN 'withdraw' THEN t.transaction_type_id = 5 AND t.upd_time < to_i
+    ELSE t.transaction_type_id = 1 AND t.upd_time < to_i
+        OR t.transaction_type_id = 2 AND EXISTS(
+            SELECT 1
+            FROM public.transaction_upd u
+            WHERE u.id = t.id AND u.transaction_type_id = 1 AND u.upd_time >= from_i AND u.upd_time < to_i)
+  END
+$$;
+
+-- проверка лимитов операции пользователя: 1 - в пределах лимитов, 13 - превышен лимит одной операции, 14 - суточный,
+-- 15 - месячный. Блокировка пользователя до конца транзакции упорядочивает проверки его лимитов, в том числе первые
+-- пополнения без баланса. Вызывающие функции берут ее после блокировки строки баланса
+create function public.check_limits(user_id_i uuid, operation_i varchar, sum_i numeric, operation_time_i timestamp) returns integer
     language plpgsql
 as
 $$
+DECLARE
+    limit_o numeric;
+    day_o   timestamp := date_trunc('day', operation_time_i);
+    month_o timestamp := date_trunc('month', operation_time_i);
 begin
+    PERFORM pg_advisory_xact_lock(7040003, hashtext(user_id_i::text));
+
+    SELECT r.amount INTO limit_o FROM public.limit_rule_for(user_id_i, operation_i, 'transaction') r;
+    IF(limit_o IS NOT NULL AND sum_i > limit_o)THEN
+        RETURN 13;
+    END IF;
+
+    SELECT r.amount INTO limit_o FROM public.limit_rule_for(user_id_i, operation_i, 'day') r;
+    IF(limit_o IS NOT NULL AND public.limit_usage(user_id_i, operation_i, day_o, day_o + interval '1 day') + sum_i > limit_o)THEN
+        RETURN 14;
+    END IF;
+
+    SELECT r.amount INTO limit_o FROM public.limit_rule_for(user_id_i, operation_i, 'month') r;
+    IF(limit_o IS NOT NULL AND public.limit_usage(user_id_i, operation_i, month_o, month_o + interval '1 month') + sum_i > limit_o)THEN
+        RETURN 15;
+    END IF;
+
+    RETURN 1;
+end;
+$$;
+
+create function public.add_outbox_event(event_type_i character varying, user_id_i uuid, payload_i jsonb, event_id_i uuid, create_time_i timestamp) returns void
+    language plpgsql
+as
+$$
+DECLARE
+    outbox_id_o bigint;
+begin
+    INSERT INTO public.outbox(event_id, event_type, user_id, payload, create_time)
+    VALUES (event_id_i, event_type_i, user_id_i, payload_i, create_time_i)
+    RETURNING id INTO outbox_id_o;
+
+    -- доставки подписчикам webhook создаются в той же транзакции, что и событие, время попыток считается по часам бд
+    INSERT INTO public.webhook_delivery(subscription_id, event_id, event_sequence, event_type, user_id, payload, event_time, status, next_attempt_time)
+    SELECT s.id, event_id_i, outbox_id_o, event_type_i, user_id_i, payload_i, create_time_i, 'pending', CURRENT_TIMESTAMP
+    FROM public.webhook_subscription s
+    WHERE event_type_i = ANY(s.event_types)
+      AND (s.service_id IS NULL OR s.service_id = (payload_i->>'serviceId')::uuid);
+
+    -- потоки баланса пользователя на всех инстансах дочитывают события из outbox после фиксации транзакции
+    PERFORM pg_notify('balance_events', user_id_i::text);
+end;
+$$;
+
+-- id и время операции (id транзакции пополнения и события) передаются сервисом.
+-- Статусы как у save_transaction: 1 - успешно, 11 - счет заморожен, 12 - счет закрыт, 13-15 - превышен лимит пополнений
+create function public.add_balance(user_id_i uuid, sum_i numeric, comment_i character varying, operation_id_i uuid, operation_time_i timestamp, OUT status integer) returns integer
+    language plpgsql
+as
+$$
+begin
+    PERFORM 1 FROM public.balance b WHERE b.user_id = user_id_i FOR UPDATE;
+
+    status := public.account_restriction(user_id_i, false);
+    IF(status <> 1)THEN
+        RETURN;
+    END IF;
+
+    status := public.check_limits(user_id_i, 'deposit', sum_i, operation_time_i);
+    IF(status <> 1)THEN
+        RETURN;
+    END IF;
+
     IF(EXISTS(SELECT 1 FROM public.balance b WHERE b.user_id = user_id_i))THEN
         UPDATE public.balance b SET
             balance = b.balance + sum_i
@@ -58,12 +320,120 @@ begin
         VALUES (user_id_i, sum_i);
     END IF;
 
-    INSERT INTO public.transaction(order_id, user_id, service_id, transaction_type_id, sum, comment, upd_time)
-    VALUES (null, user_id_i, null, 4::smallint, sum_i, comment_i, CURRENT_TIMESTAMP);
+    INSERT INTO public.transaction(id, order_id, user_id, service_id, transaction_type_id, sum, comment, upd_time)
+    VALUES (operation_id_i, null, user_id_i, null, 4::smallint, sum_i, comment_i, operation_time_i);
+
+    PERFORM public.add_outbox_event('deposit', user_id_i, jsonb_build_object(
+        'transactionId', operation_id_i,
+        'sum', sum_i,
+        'comment', comment_i,
+        'balance', (SELECT balance FROM public.balance WHERE user_id = user_id_i)), operation_id_i, operation_time_i);
 end;
 $$;
 
-create function save_transaction(order_id_i uuid, user_id_i uuid, service_id_i uuid, sum_i numeric, transaction_type_id_i smallint, comment_i character varying, OUT status integer) returns integer
+-- списание с баланса оператором, статусы как у save_transaction: 1 - успешно, 3 - недостаточно средств, 10 - нет баланса,
+-- 11 - счет заморожен, 12 - счет закрыт, 13-15 - превышен лимит списаний
+create function public.withdraw_balance(user_id_i uuid, sum_i numeric, comment_i character varying, operation_id_i uuid, operation_time_i timestamp, OUT status integer) returns integer
+    language plpgsql
+as
+$$
+DECLARE
+    current_balance numeric;
+begin
+    SELECT balance INTO current_balance
+    FROM public.balance
+    WHERE user_id = user_id_i
+    FOR UPDATE;
+
+    IF(current_balance IS NULL)THEN
+        status := 10;
+        RETURN;
+    END IF;
+
+    status := public.account_restriction(user_id_i, true);
+    IF(status <> 1)THEN
+        RETURN;
+    END IF;
+
+    status := public.check_limits(user_id_i, 'withdraw', sum_i, operation_time_i);
+    IF(status <> 1)THEN
+        RETURN;
+    END IF;
+
+    IF(current_balance < sum_i)THEN
+        status := 3;
+        RETURN;
+    END IF;
+
+    UPDATE public.balance SET
+        balance = balance - sum_i
+    WHERE user_id = user_id_i;
+
+    INSERT INTO public.transaction(id, order_id, user_id, service_id, transaction_type_id, sum, comment, upd_time)
+    VALUES (operation_id_i, null, user_id_i, null, 5::smallint, sum_i, comment_i, operation_time_i);
+
+    PERFORM public.add_outbox_event('withdrawal', user_id_i, jsonb_build_object(
+        'transactionId', operation_id_i,
+        'sum', sum_i,
+        'comment', comment_i,
+        'balance', (SELECT balance FROM public.balance WHERE user_id = user_id_i)), operation_id_i, operation_time_i);
+
+    status := 1;
+end;
+$$;
+
+-- проводит одобренную корректировку: sum_i положительная - зачисление, отрицательная - списание (сумма транзакции со знаком).
+-- Статусы как у save_transaction: 1 - успешно, 3 - недостаточно средств для списания, 10 - нет баланса,
+-- 11 - счет заморожен, 12 - счет закрыт
+create function public.post_adjustment(adjustment_id_i uuid, user_id_i uuid, sum_i numeric, comment_i character varying, operation_id_i uuid, operation_time_i timestamp, OUT status integer) returns integer
+    language plpgsql
+as
+$$
+DECLARE
+    current_balance numeric;
+begin
+    SELECT balance INTO current_balance
+    FROM public.balance
+    WHERE user_id = user_id_i
+    FOR UPDATE;
+
+    IF(current_balance IS NULL)THEN
+        status := 10;
+        RETURN;
+    END IF;
+
+    status := public.account_restriction(user_id_i, sum_i < 0);
+    IF(status <> 1)THEN
+        RETURN;
+    END IF;
+
+    IF(current_balance + sum_i < 0)THEN
+        status := 3;
+        RETURN;
+    END IF;
+
+    UPDATE public.balance SET
+        balance = balance + sum_i
+    WHERE user_id = user_id_i;
+
+    INSERT INTO public.transaction(id, order_id, user_id, service_id, transaction_type_id, sum, comment, upd_time)
+    VALUES (operation_id_i, null, user_id_i, null, 6::smallint, sum_i, comment_i, operation_time_i);
+
+    PERFORM public.add_outbox_event('adjustment', user_id_i, jsonb_build_object(
+        'transactionId', operation_id_i,
+        'adjustmentId', adjustment_id_i,
+        'sum', sum_i,
+        'comment', comment_i,
+        'balance', (SELECT balance FROM public.balance WHERE user_id = user_id_i)), operation_id_i, operation_time_i);
+
+    status := 1;
+end;
+$$;
+
+-- id операции - id новой резервации и события, при подтверждении и отмене - только id события.
+-- Резервацию запрещает любая заморозка счета, подтверждение и отмену - только frozen-all и closed (статусы 11 и 12).
+-- Лимиты проверяются только у резерваций (статусы 13-15)
+create function save_transaction(order_id_i uuid, user_id_i uuid, service_id_i uuid, sum_i numeric, transaction_type_id_i smallint, comment_i character varying, operation_id_i uuid, operation_time_i timestamp, OUT status integer) returns integer
     language plpgsql
 as
 $$
@@ -80,25 +450,42 @@ DECLARE
     user_id_balance uuid;
     current_balance numeric;
 begin
+    -- блокировка баланса упорядочивает все операции пользователя, а значит и его события в outbox.
+    -- Транзакция читается только после нее: иначе параллельные подтверждение и отмена увидят одну и ту же
+    -- резервацию и обе пройдут (двойной возврат, лишние строки transaction_upd и события)
+    SELECT user_id, balance INTO user_id_balance, current_balance
+    FROM public.balance
+    WHERE user_id = user_id_i
+    FOR UPDATE;
+
     SELECT id, order_id, user_id, service_id, sum, transaction_type_id, comment, upd_time
     INTO id_o, order_id_o, user_id_o, service_id_o, sum_o, transaction_type_id_o, comment_o, upd_time_o
     FROM public.transaction
-    WHERE order_id = order_id_i AND user_id = user_id_i AND service_id = service_id_i;
-
-    SELECT user_id, balance INTO user_id_balance, current_balance
-    FROM public.balance
-    WHERE user_id = user_id_i;
+    WHERE order_id = order_id_i AND user_id = user_id_i AND service_id = service_id_i
+    FOR UPDATE;
 
     IF(current_balance IS NULL)THEN
            status := 10;
            RETURN;
     END IF;
 
+    status := public.account_restriction(user_id_i, transaction_type_id_i = 1);
+    IF(status <> 1)THEN
+        RETURN;
+    END IF;
+
    IF(transaction_type_id_i = 1)THEN
        IF(transaction_type_id_o IS NOT NULL)THEN
            status := 2;
            RETURN;
-       ELSEIF(current_balance < sum_i)THEN
+       END IF;
+
+       status := public.check_limits(user_id_i, 'reserve', sum_i, operation_time_i);
+       IF(status <> 1)THEN
+           RETURN;
+       END IF;
+
+       IF(current_balance < sum_i)THEN
            status := 3;
            RETURN;
         END IF;
@@ -127,8 +514,10 @@ begin
     END IF;
 
    IF(transaction_type_id_i = 1)THEN
-       INSERT INTO public.transaction(order_id, user_id, service_id, transaction_type_id, sum, comment, upd_time)
-       VALUES (order_id_i, user_id_i, service_id_i, transaction_type_id_i, sum_i, comment_i, CURRENT_TIMESTAMP);
+       INSERT INTO public.transaction(id, order_id, user_id, service_id, transaction_type_id, sum, comment, upd_time)
+       VALUES (operation_id_i, order_id_i, user_id_i, service_id_i, transaction_type_id_i, sum_i, comment_i, operation_time_i);
+
+       id_o := operation_id_i;
 
         UPDATE public.balance SET
             balance = balance - sum_i
@@ -140,7 +529,7 @@ begin
         UPDATE public.transaction SET
             transaction_type_id = transaction_type_id_i,
             comment = comment_i,
-            upd_time = CURRENT_TIMESTAMP
+            upd_time = operation_time_i
         WHERE order_id = order_id_i AND user_id = user_id_i AND service_id = service_id_i;
 
         IF(transaction_type_id_i = 3)THEN
@@ -150,6 +539,153 @@ begin
         END IF;
     END IF;
 
+    PERFORM public.add_outbox_event(
+        CASE transaction_type_id_i WHEN 1 THEN 'reserved' WHEN 2 THEN 'captured' ELSE 'cancelled' END,
+        user_id_i,
+        jsonb_build_object(
+            'transactionId', id_o,
+            'orderId', order_id_i,
+            'serviceId', service_id_i,
+            'sum', COALESCE(sum_o, sum_i),
+            'comment', comment_i,
+            'balance', (SELECT balance FROM public.balance WHERE user_id = user_id_i)),
+        operation_id_i,
+        operation_time_i);
+
    status := 1;
 end;
-$$;
\ No newline at end of file
+$$;
+-- журнал аудита: каждое изменение строк таблиц ниже - кто (actor, auth_method), откуда (request_id, source_ip), какой
+-- операцией и строка до и после. Триггеры только добавляют записи (id - порядок добавления), без общей блокировки.
+-- Сервис запечатывает их по порядку (AuditService.SealBatch): задает sequence без пропусков и цепочку
+-- hash = HMAC-SHA256(AUDIT_HMAC_KEY, prev_hash и поля записи). Ключа нет в бд, поэтому переписать цепочку
+-- без него нельзя, проверяется командой balancectl audit-verify
+create table public.audit_log(
+    id          bigserial    not null
+        primary key,
+    sequence    bigint
+        unique,
+    time        timestamp    not null,
+    actor       varchar(200) not null,
+    db_user     varchar(200) not null,
+    auth_method varchar(20)  not null,
+    request_id  varchar(64)  not null,
+    source_ip   varchar(64)  not null,
+    operation   varchar(100) not null,
+    entity      varchar(100) not null,
+    entity_id   varchar(100) not null,
+    action      varchar(10)  not null,
+    before      jsonb,
+    after       jsonb,
+    prev_hash   varchar(64),
+    hash        varchar(64)
+);
+
+create index audit_log_unsealed_idx on public.audit_log(id) where hash is null;
+
+-- триггер журнала аудита, TG_ARGV[0] - колонка id строки. Контекст вызова сервис задает настройками audit.* в транзакции,
+-- для изменений в обход сервиса пишутся пользователь и адрес соединения бд. Секреты подписок webhook в журнал не попадают
+create function public.audit_row() returns trigger
+    language plpgsql
+as
+$$
+DECLARE
+    before_o jsonb;
+    after_o  jsonb;
+begin
+    IF(TG_OP <> 'INSERT')THEN
+        before_o := to_jsonb(OLD) - 'secret';
+    END IF;
+
+    IF(TG_OP <> 'DELETE')THEN
+        after_o := to_jsonb(NEW) - 'secret';
+    END IF;
+
+    INSERT INTO public.audit_log(time, actor, db_user, auth_method, request_id, source_ip, operation, entity, entity_id, action, before, after)
+    VALUES (
+        date_trunc('microseconds', clock_timestamp() AT TIME ZONE 'UTC'),
+        COALESCE(NULLIF(current_setting('audit.actor', true), ''), session_user),
+        -- пользователь соединения с бд записывается всегда: actor передает клиент, а его подставить нельзя
+        session_user,
+        COALESCE(NULLIF(current_setting('audit.auth_method', true), ''), 'db'),
+        COALESCE(current_setting('audit.request_id', true), ''),
+        COALESCE(NULLIF(current_setting('audit.source_ip', true), ''), host(inet_client_addr()), 'local'),
+        COALESCE(NULLIF(current_setting('audit.operation', true), ''), 'manual'),
+        TG_TABLE_NAME,
+        COALESCE(after_o, before_o) ->> TG_ARGV[0],
+        lower(TG_OP),
+        before_o,
+        after_o);
+
+    RETURN NULL;
+end;
+$$;
+
+-- журнал только дополняется: единственное изменение - запечатывание записи (sequence, prev_hash и hash) один раз
+create function public.audit_log_append_only() returns trigger
+    language plpgsql
+as
+$$
+begin
+    -- у триггера TRUNCATE нет OLD, поэтому поля проверяются только для UPDATE
+    IF(TG_OP = 'UPDATE')THEN
+        IF(OLD.hash IS NULL AND OLD.sequence IS NULL AND
+           to_jsonb(NEW) - 'sequence' - 'prev_hash' - 'hash' = to_jsonb(OLD) - 'sequence' - 'prev_hash' - 'hash')THEN
+            RETURN NEW;
+        END IF;
+    END IF;
+
+    RAISE EXCEPTION 'audit_log is append-only';
+end;
+$$;
+
+create trigger audit_log_append_only
+    before update or delete on public.audit_log
+    for each row execute function public.audit_log_append_only();
+
+create trigger audit_log_no_truncate
+    before truncate on public.audit_log
+    for each statement execute function public.audit_log_append_only();
+
+create trigger balance_audit
+    after insert or update or delete on public.balance
+    for each row execute function public.audit_row('user_id');
+
+create trigger transaction_audit
+    after insert or update or delete on public.transaction
+    for each row execute function public.audit_row('id');
+
+create trigger transaction_upd_audit
+    after insert or update or delete on public.transaction_upd
+    for each row execute function public.audit_row('upd_id');
+
+create trigger orders_audit
+    after insert or update or delete on public.orders
+    for each row execute function public.audit_row('order_id');
+
+create trigger adjustment_audit
+    after insert or update or delete on public.adjustment
+    for each row execute function public.audit_row('id');
+
+create trigger account_status_audit
+    after insert or update or delete on public.account_status
+    for each row execute function public.audit_row('user_id');
+
+create trigger user_tier_audit
+    after insert or update or delete on public.user_tier
+    for each row execute function public.audit_row('user_id');
+
+create trigger limit_rule_audit
+    after insert or update or delete on public.limit_rule
+    for each row execute function public.audit_row('rule_key');
+
+create trigger webhook_subscription_audit
+    after insert or update or delete on public.webhook_subscription
+    for each row execute function public.audit_row('id');
+
+-- попытки отправки воркером не аудируются, только изменения доставок вызовами API (повторная отправка)
+create trigger webhook_delivery_audit
+    after update on public.webhook_delivery
+    for each row
+    when (current_setting('audit.operation', true) <> '')
+    execute function public.audit_row('id');
@@ -0,0 +1,12 @@
+package config
+
+import "time"
+
+// AuditHmacKey - ключ HMAC цепочки хешей журнала аудита, обязателен. Хранится вне бд, чтобы переписать журнал
+// вместе с хешами мог только тот, у кого есть ключ
+var AuditHmacKey = getEnv("AUDIT_HMAC_KEY", "")
+
+// AuditSealInterval - как часто сервис запечатывает новые записи журнала аудита
+var AuditSealInterval = getEnvDuration("AUDIT_SEAL_INTERVAL", time.Second)
+
+var AuditSealBatchSize = getEnvInt("AUDIT_SEAL_BATCH_SIZE", 1000)
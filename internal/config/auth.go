@@ -0,0 +1,20 @@
+package config
+
+// AuthEnabled - проверять ли аутентификацию (выключать только для локального запуска)
+var AuthEnabled = getEnv("AUTH_ENABLED", "true") == "true"
+
+// AuthApiKeysFile - json файл со статическими api ключами внутренних сервисов
+var AuthApiKeysFile = getEnv("AUTH_API_KEYS_FILE", "")
+
+// AuthJwksFile - локальный JWKS файл с публичными ключами для проверки JWT
+var AuthJwksFile = getEnv("AUTH_JWKS_FILE", "")
+
+// AuthJwtSecret - общий секрет для JWT, подписанных HS256
+var AuthJwtSecret = getEnv("AUTH_JWT_SECRET", "")
+
+var AuthJwtIssuer = getEnv("AUTH_JWT_ISSUER", "")
+
+var AuthJwtAudience = getEnv("AUTH_JWT_AUDIENCE", "")
+
+// AuthRolesFile - json файл с ролями и их правами ({"role": ["permission", ...]}), заменяет роли по умолчанию
+var AuthRolesFile = getEnv("AUTH_ROLES_FILE", "")
@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/avito-test/internal/config"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+type Method string
+
+const (
+	MethodApiKey Method = "api_key"
+	MethodJWT    Method = "jwt"
+	MethodNone   Method = "none"
+	// MethodCli - оператор balancectl, аутентифицирован доступом к бд
+	MethodCli Method = "cli"
+)
+
+const ApiKeyHeader = "X-API-Key"
+
+var (
+	ErrUnauthenticated = errors.New("authentication required")
+	ErrInvalidApiKey   = errors.New("invalid api key")
+	ErrInvalidToken    = errors.New("invalid bearer token")
+)
+
+// Principal - аутентифицированный вызывающий (внутренний сервис или пользователь из JWT)
+type Principal struct {
+	Id     string
+	Method Method
+	Roles  []string
+}
+
+// Anonymous используется когда аутентификация выключена
+var Anonymous = Principal{Id: "anonymous", Method: MethodNone}
+
+type ctxKey struct{}
+
+func NewContext(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, ctxKey{}, principal)
+}
+
+func FromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(ctxKey{}).(Principal)
+
+	return principal, ok
+}
+
+type apiKey struct {
+	Key       string   `json:"key"`
+	Principal string   `json:"principal"`
+	Roles     []string `json:"roles"`
+}
+
+type Authenticator struct {
+	apiKeys []apiKey
+	keys    *keySet
+	parser  *jwt.Parser
+}
+
+// NewAuthenticator загружает api ключи и ключи проверки JWT из файлов, указанных в конфиге
+func NewAuthenticator() (*Authenticator, error) {
+	a := &Authenticator{
+		keys:   &keySet{},
+		parser: jwt.NewParser(jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "HS256"})),
+	}
+
+	if config.AuthApiKeysFile != "" {
+		content, err := os.ReadFile(config.AuthApiKeysFile)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(content, &a.apiKeys); err != nil {
+			return nil, fmt.Errorf("invalid api keys file: %w", err)
+		}
+	}
+
+	if config.AuthJwksFile != "" {
+		keys, err := loadJwks(config.AuthJwksFile)
+		if err != nil {
+			return nil, err
+		}
+
+		a.keys = keys
+	}
+
+	if config.AuthJwtSecret != "" {
+		a.keys.secret = []byte(config.AuthJwtSecret)
+	}
+
+	return a, nil
+}
+
+// Credentials - учетные данные из заголовков http запроса или метаданных grpc
+type Credentials struct {
+	ApiKey        string
+	Authorization string
+}
+
+func CredentialsFromRequest(r *http.Request) Credentials {
+	return Credentials{
+		ApiKey:        r.Header.Get(ApiKeyHeader),
+		Authorization: r.Header.Get("Authorization"),
+	}
+}
+
+// Authenticate проверяет учетные данные одним из разрешенных для маршрута методов
+func (a *Authenticator) Authenticate(credentials Credentials, methods ...Method) (Principal, error) {
+	for _, method := range methods {
+		switch method {
+		case MethodApiKey:
+			if credentials.ApiKey != "" {
+				return a.authenticateApiKey(credentials.ApiKey)
+			}
+		case MethodJWT:
+			if strings.HasPrefix(credentials.Authorization, "Bearer ") {
+				return a.authenticateToken(strings.TrimPrefix(credentials.Authorization, "Bearer "))
+			}
+		}
+	}
+
+	return Principal{}, ErrUnauthenticated
+}
+
+func (a *Authenticator) authenticateApiKey(key string) (Principal, error) {
+	for _, k := range a.apiKeys {
+		if subtle.ConstantTimeCompare([]byte(k.Key), []byte(key)) == 1 {
+			return Principal{Id: k.Principal, Method: MethodApiKey, Roles: k.Roles}, nil
+		}
+	}
+
+	return Principal{}, ErrInvalidApiKey
+}
+
+type claims struct {
+	jwt.RegisteredClaims
+	Roles []string `json:"roles"`
+}
+
+func (a *Authenticator) authenticateToken(tokenString string) (Principal, error) {
+	var c claims
+
+	if _, err := a.parser.ParseWithClaims(tokenString, &c, a.keys.keyFunc); err != nil {
+		return Principal{}, fmt.Errorf("%w: %s", ErrInvalidToken, err.Error())
+	}
+
+	// jwt/v4 проверяет exp, только если он есть: токен без срока действия остался бы валидным навсегда
+	if c.ExpiresAt == nil {
+		return Principal{}, fmt.Errorf("%w: missing exp", ErrInvalidToken)
+	}
+
+	if config.AuthJwtIssuer != "" && !c.VerifyIssuer(config.AuthJwtIssuer, true) {
+		return Principal{}, fmt.Errorf("%w: unexpected issuer", ErrInvalidToken)
+	}
+
+	if config.AuthJwtAudience != "" && !c.VerifyAudience(config.AuthJwtAudience, true) {
+		return Principal{}, fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	}
+
+	if c.Subject == "" {
+		return Principal{}, fmt.Errorf("%w: missing sub", ErrInvalidToken)
+	}
+
+	return Principal{Id: c.Subject, Method: MethodJWT, Roles: c.Roles}, nil
+}
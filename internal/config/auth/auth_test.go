@@ -0,0 +1,313 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/avito-test/internal/config"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	testIssuer   = "https://auth.example"
+	testAudience = "balance"
+	testSecret   = "hmac-secret"
+)
+
+// testKeys - ключи подписи тестовых токенов, публичные части лежат в JWKS аутентификатора
+type testKeys struct {
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+}
+
+func newTestKeys(t *testing.T) testKeys {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testKeys{rsa: rsaKey, ec: ecKey}
+}
+
+func b64(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func (k testKeys) jwks() map[string]interface{} {
+	return map[string]interface{}{"keys": []map[string]string{
+		{"kid": "rsa", "kty": "RSA", "n": b64(k.rsa.N), "e": b64(big.NewInt(int64(k.rsa.E)))},
+		{"kid": "ec", "kty": "EC", "crv": "P-256", "x": b64(k.ec.X), "y": b64(k.ec.Y)},
+	}}
+}
+
+// setConfig задает переменную конфига на время теста
+func setConfig(t *testing.T, variable *string, value string) {
+	t.Helper()
+
+	previous := *variable
+	*variable = value
+
+	t.Cleanup(func() { *variable = previous })
+}
+
+func writeJson(t *testing.T, name string, value interface{}) string {
+	t.Helper()
+
+	content, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// newTestAuthenticator создает аутентификатор из файлов ключей, как в main, secret пустой - HS256 не принимается
+func newTestAuthenticator(t *testing.T, keys testKeys, secret string) *Authenticator {
+	t.Helper()
+
+	setConfig(t, &config.AuthApiKeysFile, writeJson(t, "api-keys.json", []apiKey{
+		{Key: "order-key", Principal: "order-service", Roles: []string{"order-service"}},
+		{Key: "payment-key", Principal: "payment-service", Roles: []string{"payment-service"}},
+	}))
+	setConfig(t, &config.AuthJwksFile, writeJson(t, "jwks.json", keys.jwks()))
+	setConfig(t, &config.AuthJwtSecret, secret)
+	setConfig(t, &config.AuthJwtIssuer, testIssuer)
+	setConfig(t, &config.AuthJwtAudience, testAudience)
+
+	a, err := NewAuthenticator()
+	if err != nil {
+		t.Fatalf("NewAuthenticator: %v", err)
+	}
+
+	return a
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":   "support-alice",
+		"iss":   testIssuer,
+		"aud":   testAudience,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"roles": []string{"support"},
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+func TestAuthenticateApiKey(t *testing.T) {
+	a := newTestAuthenticator(t, newTestKeys(t), "")
+
+	tests := []struct {
+		name        string
+		credentials Credentials
+		methods     []Method
+		want        string
+		wantErr     error
+	}{
+		{"match", Credentials{ApiKey: "order-key"}, []Method{MethodApiKey}, "order-service", nil},
+		{"second key", Credentials{ApiKey: "payment-key"}, []Method{MethodApiKey}, "payment-service", nil},
+		{"mismatch", Credentials{ApiKey: "unknown-key"}, []Method{MethodApiKey}, "", ErrInvalidApiKey},
+		{"prefix", Credentials{ApiKey: "order"}, []Method{MethodApiKey}, "", ErrInvalidApiKey},
+		{"longer", Credentials{ApiKey: "order-key-2"}, []Method{MethodApiKey}, "", ErrInvalidApiKey},
+		{"no credentials", Credentials{}, []Method{MethodApiKey, MethodJWT}, "", ErrUnauthenticated},
+		{"method not allowed", Credentials{ApiKey: "order-key"}, []Method{MethodJWT}, "", ErrUnauthenticated},
+		{"not bearer", Credentials{Authorization: "Basic b3JkZXI6a2V5"}, []Method{MethodJWT}, "", ErrUnauthenticated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal, err := a.Authenticate(tt.credentials, tt.methods...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Authenticate error = %v, want %v", err, tt.wantErr)
+			}
+
+			if principal.Id != tt.want {
+				t.Fatalf("principal = %q, want %q", principal.Id, tt.want)
+			}
+
+			if tt.wantErr == nil && principal.Method != MethodApiKey {
+				t.Fatalf("method = %s, want %s", principal.Method, MethodApiKey)
+			}
+		})
+	}
+}
+
+func TestAuthenticateToken(t *testing.T) {
+	keys := newTestKeys(t)
+
+	publicPem := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&keys.rsa.PublicKey)})
+
+	with := func(change func(c jwt.MapClaims)) jwt.MapClaims {
+		c := validClaims()
+		change(c)
+
+		return c
+	}
+
+	tests := []struct {
+		name   string
+		secret string
+		token  func(t *testing.T) string
+		ok     bool
+	}{
+		{"rsa", "", func(t *testing.T) string { return sign(t, jwt.SigningMethodRS256, "rsa", keys.rsa, validClaims()) }, true},
+		{"ec", "", func(t *testing.T) string { return sign(t, jwt.SigningMethodES256, "ec", keys.ec, validClaims()) }, true},
+		{"hmac", testSecret, func(t *testing.T) string {
+			return sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), validClaims())
+		}, true},
+		{"hmac without secret", "", func(t *testing.T) string {
+			return sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), validClaims())
+		}, false},
+		// подмена алгоритма: HS256, подписанный публичным ключом RSA как секретом
+		{"hmac signed with rsa public key", "", func(t *testing.T) string {
+			return sign(t, jwt.SigningMethodHS256, "rsa", publicPem, validClaims())
+		}, false},
+		{"hmac signed with rsa public key and secret set", testSecret, func(t *testing.T) string {
+			return sign(t, jwt.SigningMethodHS256, "rsa", publicPem, validClaims())
+		}, false},
+		{"rsa alg with ec key id", "", func(t *testing.T) string { return sign(t, jwt.SigningMethodRS256, "ec", keys.rsa, validClaims()) }, false},
+		{"ec alg with rsa key id", "", func(t *testing.T) string { return sign(t, jwt.SigningMethodES256, "rsa", keys.ec, validClaims()) }, false},
+		{"alg none", "", func(t *testing.T) string {
+			return sign(t, jwt.SigningMethodNone, "rsa", jwt.UnsafeAllowNoneSignatureType, validClaims())
+		}, false},
+		{"unknown key id", "", func(t *testing.T) string { return sign(t, jwt.SigningMethodRS256, "other", keys.rsa, validClaims()) }, false},
+		{"foreign rsa key", "", func(t *testing.T) string {
+			return sign(t, jwt.SigningMethodRS256, "rsa", newTestKeys(t).rsa, validClaims())
+		}, false},
+		{"expired", "", func(t *testing.T) string {
+			return sign(t, jwt.SigningMethodRS256, "rsa", keys.rsa, with(func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }))
+		}, false},
+		{"missing exp", "", func(t *testing.T) string {
+			return sign(t, jwt.SigningMethodRS256, "rsa", keys.rsa, with(func(c jwt.MapClaims) { delete(c, "exp") }))
+		}, false},
+		{"not before", "", func(t *testing.T) string {
+			return sign(t, jwt.SigningMethodRS256, "rsa", keys.rsa, with(func(c jwt.MapClaims) { c["nbf"] = time.Now().Add(time.Hour).Unix() }))
+		}, false},
+		{"wrong issuer", "", func(t *testing.T) string {
+			return sign(t, jwt.SigningMethodRS256, "rsa", keys.rsa, with(func(c jwt.MapClaims) { c["iss"] = "https://evil.example" }))
+		}, false},
+		{"missing issuer", "", func(t *testing.T) string {
+			return sign(t, jwt.SigningMethodRS256, "rsa", keys.rsa, with(func(c jwt.MapClaims) { delete(c, "iss") }))
+		}, false},
+		{"wrong audience", "", func(t *testing.T) string {
+			return sign(t, jwt.SigningMethodRS256, "rsa", keys.rsa, with(func(c jwt.MapClaims) { c["aud"] = "reports" }))
+		}, false},
+		{"audience list", "", func(t *testing.T) string {
+			return sign(t, jwt.SigningMethodRS256, "rsa", keys.rsa, with(func(c jwt.MapClaims) { c["aud"] = []string{"reports", testAudience} }))
+		}, true},
+		{"missing sub", "", func(t *testing.T) string {
+			return sign(t, jwt.SigningMethodRS256, "rsa", keys.rsa, with(func(c jwt.MapClaims) { delete(c, "sub") }))
+		}, false},
+		{"malformed", "", func(t *testing.T) string { return "not.a.token" }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAuthenticator(t, keys, tt.secret)
+
+			principal, err := a.Authenticate(Credentials{Authorization: "Bearer " + tt.token(t)}, MethodApiKey, MethodJWT)
+
+			if !tt.ok {
+				if !errors.Is(err, ErrInvalidToken) {
+					t.Fatalf("Authenticate = %+v, %v, want ErrInvalidToken", principal, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+
+			if principal.Id != "support-alice" || principal.Method != MethodJWT || len(principal.Roles) != 1 || principal.Roles[0] != "support" {
+				t.Fatalf("principal = %+v", principal)
+			}
+		})
+	}
+}
+
+func TestLoadJwks(t *testing.T) {
+	keys := newTestKeys(t)
+
+	set, err := loadJwks(writeJson(t, "jwks.json", keys.jwks()))
+	if err != nil {
+		t.Fatalf("loadJwks: %v", err)
+	}
+
+	if key, ok := set.keys["rsa"].(*rsa.PublicKey); !ok || !key.Equal(&keys.rsa.PublicKey) {
+		t.Fatalf("rsa key = %#v, want %#v", set.keys["rsa"], keys.rsa.PublicKey)
+	}
+
+	if key, ok := set.keys["ec"].(*ecdsa.PublicKey); !ok || !key.Equal(&keys.ec.PublicKey) {
+		t.Fatalf("ec key = %#v, want %#v", set.keys["ec"], keys.ec.PublicKey)
+	}
+
+	invalid := []struct {
+		name string
+		key  map[string]string
+	}{
+		{"unsupported key type", map[string]string{"kid": "oct", "kty": "oct"}},
+		{"unsupported curve", map[string]string{"kid": "ec", "kty": "EC", "crv": "P-192", "x": b64(keys.ec.X), "y": b64(keys.ec.Y)}},
+		{"invalid modulus", map[string]string{"kid": "rsa", "kty": "RSA", "n": "!!", "e": "AQAB"}},
+		{"invalid coordinate", map[string]string{"kid": "ec", "kty": "EC", "crv": "P-256", "x": b64(keys.ec.X), "y": "=="}},
+	}
+
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeJson(t, "jwks.json", map[string]interface{}{"keys": []map[string]string{tt.key}})
+
+			if _, err := loadJwks(path); err == nil {
+				t.Fatal("loadJwks: want error")
+			}
+		})
+	}
+
+	t.Run("invalid json", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "jwks.json")
+		if err := os.WriteFile(path, []byte("{"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := loadJwks(path); err == nil {
+			t.Fatal("loadJwks: want error")
+		}
+	})
+}
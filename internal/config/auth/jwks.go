@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type keySet struct {
+	keys   map[string]interface{}
+	secret []byte
+}
+
+func loadJwks(path string) (*keySet, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	if err := json.Unmarshal(content, &jwks); err != nil {
+		return nil, fmt.Errorf("invalid jwks file: %w", err)
+	}
+
+	set := &keySet{keys: make(map[string]interface{})}
+
+	for _, k := range jwks.Keys {
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid jwk %s: %w", k.Kid, err)
+		}
+
+		set.keys[k.Kid] = key
+	}
+
+	return set, nil
+}
+
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
+
+func (s *keySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if len(s.secret) == 0 {
+			return nil, errors.New("hmac tokens are not accepted")
+		}
+
+		return s.secret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+
+	if key, ok := s.keys[kid]; ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/avito-test/internal/config"
+)
+
+type Permission string
+
+const (
+	PermissionBalanceRead      Permission = "balance:read"
+	PermissionBalanceCredit    Permission = "balance:credit"
+	PermissionTransactionRead  Permission = "transaction:read"
+	PermissionTransactionWrite Permission = "transaction:write"
+	PermissionReportCreate     Permission = "report:create"
+	PermissionReportRead       Permission = "report:read"
+	PermissionWebhookManage    Permission = "webhook:manage"
+	PermissionAdjustmentRead   Permission = "adjustment:read"
+	// PermissionAdjustmentPropose - предложить корректировку, PermissionAdjustmentApprove - одобрить или отклонить чужую
+	PermissionAdjustmentPropose Permission = "adjustment:propose"
+	PermissionAdjustmentApprove Permission = "adjustment:approve"
+	// PermissionAccountRead - статус счета, PermissionAccountManage - заморозить, разморозить или закрыть счет
+	PermissionAccountRead   Permission = "account:read"
+	PermissionAccountManage Permission = "account:manage"
+	// PermissionLimitRead - лимиты и их остаток у пользователя, PermissionLimitManage - задать лимиты и уровни пользователей
+	PermissionLimitRead   Permission = "limit:read"
+	PermissionLimitManage Permission = "limit:manage"
+)
+
+// роли по умолчанию: сервис заказов резервирует, подтверждает и отменяет, но не пополняет баланс,
+// поддержка читает и предлагает корректировки, отчеты формирует и корректировки одобряет финансовый отдел,
+// счета замораживает и лимиты задает отдел рисков
+var defaultRoles = map[string][]Permission{
+	"order-service":   {PermissionBalanceRead, PermissionTransactionWrite},
+	"payment-service": {PermissionBalanceRead, PermissionBalanceCredit},
+	"support": {
+		PermissionBalanceRead, PermissionTransactionRead, PermissionAdjustmentRead, PermissionAdjustmentPropose,
+		PermissionAccountRead, PermissionLimitRead,
+	},
+	"finance": {
+		PermissionBalanceRead, PermissionTransactionRead, PermissionReportCreate, PermissionReportRead,
+		PermissionAdjustmentRead, PermissionAdjustmentApprove, PermissionAccountRead, PermissionLimitRead,
+	},
+	"risk": {
+		PermissionBalanceRead, PermissionTransactionRead, PermissionAccountRead, PermissionAccountManage,
+		PermissionLimitRead, PermissionLimitManage,
+	},
+	"admin": {
+		PermissionBalanceRead, PermissionBalanceCredit,
+		PermissionTransactionRead, PermissionTransactionWrite,
+		PermissionReportCreate, PermissionReportRead,
+		PermissionWebhookManage,
+		PermissionAdjustmentRead, PermissionAdjustmentPropose, PermissionAdjustmentApprove,
+		PermissionAccountRead, PermissionAccountManage,
+		PermissionLimitRead, PermissionLimitManage,
+	},
+}
+
+// Policy - соответствие ролей и прав
+type Policy struct {
+	roles map[string]map[Permission]bool
+}
+
+// NewPolicy загружает роли из config.AuthRolesFile или берет роли по умолчанию
+func NewPolicy() (*Policy, error) {
+	roles := defaultRoles
+
+	if config.AuthRolesFile != "" {
+		content, err := os.ReadFile(config.AuthRolesFile)
+		if err != nil {
+			return nil, err
+		}
+
+		roles = make(map[string][]Permission)
+
+		if err := json.Unmarshal(content, &roles); err != nil {
+			return nil, fmt.Errorf("invalid roles file: %w", err)
+		}
+	}
+
+	p := &Policy{roles: make(map[string]map[Permission]bool, len(roles))}
+
+	for role, permissions := range roles {
+		p.roles[role] = make(map[Permission]bool, len(permissions))
+
+		for _, permission := range permissions {
+			p.roles[role][permission] = true
+		}
+	}
+
+	return p, nil
+}
+
+// Allowed проверяет, есть ли право хотя бы у одной из ролей вызывающего
+func (p *Policy) Allowed(principal Principal, permission Permission) bool {
+	if principal.Method == MethodNone {
+		return true
+	}
+
+	for _, role := range principal.Roles {
+		if p.roles[role][permission] {
+			return true
+		}
+	}
+
+	return false
+}
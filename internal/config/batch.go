@@ -0,0 +1,7 @@
+package config
+
+// BatchMaxOperations - максимальное количество операций в одном пакете
+var BatchMaxOperations = getEnvInt("BATCH_MAX_OPERATIONS", 100)
+
+// BatchMaxBodyBytes - максимальный размер тела запроса пакета, больший запрос отклоняется до чтения тела
+var BatchMaxBodyBytes = getEnvInt("BATCH_MAX_BODY_BYTES", 1<<20)
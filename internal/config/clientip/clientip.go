@@ -0,0 +1,28 @@
+package clientip
+
+import (
+	"context"
+	"net"
+)
+
+type ctxKey struct{}
+
+func NewContext(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, ip)
+}
+
+func FromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(ctxKey{}).(string)
+
+	return ip
+}
+
+// FromAddr возвращает хост из адреса вида host:port, если порта нет - адрес как есть
+func FromAddr(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	return host
+}
@@ -0,0 +1,54 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock - источник текущего времени, в тестах подменяется на Manual
+type Clock interface {
+	Now() time.Time
+}
+
+// Real - системное время
+type Real struct{}
+
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+// Manual - время, которое меняется только явно (Set, Advance) или на step при каждом вызове Now
+type Manual struct {
+	mu   sync.Mutex
+	now  time.Time
+	step time.Duration
+}
+
+// NewManual создает часы с временем now, step > 0 сдвигает время после каждого Now, чтобы моменты не совпадали
+func NewManual(now time.Time, step time.Duration) *Manual {
+	return &Manual{now: now, step: step}
+}
+
+func (m *Manual) Now() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now
+	m.now = m.now.Add(m.step)
+
+	return now
+}
+
+func (m *Manual) Set(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.now = now
+}
+
+func (m *Manual) Advance(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.now = m.now.Add(d)
+}
@@ -0,0 +1,40 @@
+package idgen
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Generator - источник id (запросов, транзакций), в тестах подменяется на Sequence
+type Generator interface {
+	NewId() string
+}
+
+// UUID - случайные uuid v4
+type UUID struct{}
+
+func (UUID) NewId() string {
+	return uuid.New().String()
+}
+
+// Sequence - предсказуемые uuid вида 00000000-0000-4000-8000-<prefix><номер>, prefix отличает генераторы между собой
+type Sequence struct {
+	mu     sync.Mutex
+	prefix uint16
+	next   uint64
+}
+
+func NewSequence(prefix uint16) *Sequence {
+	return &Sequence{prefix: prefix}
+}
+
+func (s *Sequence) NewId() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.next++
+
+	return fmt.Sprintf("00000000-0000-4000-8000-%04x%08x", s.prefix, s.next)
+}
@@ -1,13 +1,46 @@
 package logger
 
-import "github.com/sirupsen/logrus"
+import (
+	"context"
+
+	"github.com/avito-test/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+type ctxKey struct{}
 
 var l *logrus.Logger
 
 func init() {
 	l = logrus.New()
+	l.SetFormatter(&logrus.JSONFormatter{})
+
+	level, err := logrus.ParseLevel(config.LogLevel)
+	if err != nil {
+		l.WithFields(logrus.Fields{
+			"error_message": err.Error(),
+		}).Warn("invalid log level, using info")
+
+		level = logrus.InfoLevel
+	}
+
+	l.SetLevel(level)
 }
 
 func GetLogger() *logrus.Logger {
 	return l
 }
+
+// WithContext кладет в контекст логгер запроса
+func WithContext(ctx context.Context, entry *logrus.Entry) context.Context {
+	return context.WithValue(ctx, ctxKey{}, entry)
+}
+
+// FromContext возвращает логгер запроса с его полями (request_id и т.д.), если его нет - общий логгер
+func FromContext(ctx context.Context) *logrus.Entry {
+	if entry, ok := ctx.Value(ctxKey{}).(*logrus.Entry); ok {
+		return entry
+	}
+
+	return logrus.NewEntry(l)
+}
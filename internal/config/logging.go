@@ -0,0 +1,27 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+)
+
+// LogLevel - уровень логирования (trace, debug, info, warn, error)
+var LogLevel = getEnv("LOG_LEVEL", "info")
+
+// LogBody - логировать ли тела запросов и ответов
+var LogBody = getEnv("LOG_BODY", "true") == "true"
+
+// LogBodyMaxSize - максимальный размер тела в логе (в байтах), остальное обрезается
+var LogBodyMaxSize = getEnvInt("LOG_BODY_MAX_SIZE", 4096)
+
+// LogRedactFields - поля json тела, значения которых заменяются на "***"
+var LogRedactFields = strings.Split(getEnv("LOG_REDACT_FIELDS", "userId,comment"), ",")
+
+func getEnvInt(key string, defaultValue int) int {
+	i, err := strconv.Atoi(getEnv(key, strconv.Itoa(defaultValue)))
+	if err != nil {
+		return defaultValue
+	}
+
+	return i
+}
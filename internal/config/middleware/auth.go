@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/avito-test/internal/config"
+	"github.com/avito-test/internal/config/auth"
+	"github.com/avito-test/internal/config/logger"
+	"github.com/avito-test/internal/config/requestid"
+	"github.com/avito-test/internal/dto"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Authentication пропускает запрос только если вызывающий прошел аутентификацию одним из methods
+// и кладет его в контекст запроса
+func Authentication(authenticator *auth.Authenticator, methods ...auth.Method) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal := auth.Anonymous
+
+			if config.AuthEnabled {
+				var err error
+
+				principal, err = authenticator.Authenticate(auth.CredentialsFromRequest(r), methods...)
+				if err != nil {
+					logger.FromContext(r.Context()).WithFields(logrus.Fields{
+						"error_message": err.Error(),
+					}).Warn("authentication failed")
+
+					w.Header().Set("WWW-Authenticate", `Bearer realm="balance-service"`)
+					writeApiError(w, r, http.StatusUnauthorized, dto.ErrorCodeUnauthenticated, err.Error())
+					return
+				}
+			}
+
+			trace.SpanFromContext(r.Context()).SetAttributes(
+				attribute.String("enduser.id", principal.Id),
+				attribute.String("auth.method", string(principal.Method)),
+			)
+
+			ctx := auth.NewContext(r.Context(), principal)
+			ctx = logger.WithContext(ctx, logger.FromContext(ctx).WithField("principal_id", principal.Id))
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func writeApiError(w http.ResponseWriter, r *http.Request, status int, code string, message string) {
+	apiError := dto.NewApiError(status, code, message)
+	apiError.Instance = r.URL.Path
+	apiError.RequestId = requestid.FromContext(r.Context())
+
+	w.Header().Set("Content-Type", dto.ProblemContentType)
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(apiError); err != nil {
+		logger.FromContext(r.Context()).WithFields(logrus.Fields{
+			"error_message": err.Error(),
+		}).Error("failed to write response")
+	}
+}
+
+// Authorization пропускает запрос только если у вызывающего есть право permission
+func Authorization(policy *auth.Policy, permission auth.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := auth.FromContext(r.Context())
+
+			if !ok || !policy.Allowed(principal, permission) {
+				logger.FromContext(r.Context()).WithFields(logrus.Fields{
+					"permission": permission,
+					"roles":      principal.Roles,
+				}).Warn("access denied")
+
+				writeApiError(w, r, http.StatusForbidden, dto.ErrorCodeForbidden, fmt.Sprintf("access denied: permission %s required", permission))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/avito-test/internal/config"
+	"github.com/avito-test/internal/config/auth"
+	"github.com/avito-test/internal/config/clientip"
+	"github.com/avito-test/internal/config/clock"
+	"github.com/avito-test/internal/config/idgen"
+	"github.com/avito-test/internal/config/logger"
+	"github.com/avito-test/internal/config/ratelimit"
+	"github.com/avito-test/internal/config/requestid"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// аналоги http middleware для grpc сервера
+
+func metadataValue(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+// GrpcClientIP - ClientIP для grpc: ip из адреса соединения
+func GrpcClientIP(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return handler(clientip.NewContext(ctx, grpcPeerIp(ctx)), req)
+}
+
+func grpcPeerIp(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok {
+		return clientip.FromAddr(p.Addr.String())
+	}
+
+	return ""
+}
+
+// GrpcRequestID - RequestID для grpc: id из метаданных x-request-id или новый из ids
+func GrpcRequestID(ids idgen.Generator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		requestId := metadataValue(ctx, requestid.Header)
+
+		if !requestid.IsValid(requestId) {
+			requestId = ids.NewId()
+		}
+
+		if err := grpc.SetHeader(ctx, metadata.Pairs(requestid.Header, requestId)); err != nil {
+			logger.FromContext(ctx).WithFields(logrus.Fields{
+				"error_message": err.Error(),
+			}).Warn("failed to set request id header")
+		}
+
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("request_id", requestId))
+
+		return handler(requestid.NewContext(ctx, requestId), req)
+	}
+}
+
+// GrpcLogging - Logging для grpc, длительность считается по clk
+func GrpcLogging(base *logrus.Logger, clk clock.Clock) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		log := base.WithFields(logrus.Fields{
+			"request_id": requestid.FromContext(ctx),
+			"method":     info.FullMethod,
+		})
+
+		if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+			log = log.WithField("trace_id", spanContext.TraceID().String())
+		}
+
+		log.Info("request")
+
+		start := clk.Now()
+
+		resp, err := handler(logger.WithContext(ctx, log), req)
+
+		log.WithFields(logrus.Fields{
+			"status":      status.Code(err).String(),
+			"duration_ms": clk.Now().Sub(start).Milliseconds(),
+		}).Info("response")
+
+		return resp, err
+	}
+}
+
+// GrpcAuthentication - аутентификация по метаданным x-api-key / authorization, как у http методов
+func GrpcAuthentication(authenticator *auth.Authenticator, methods ...auth.Method) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		principal := auth.Anonymous
+
+		if config.AuthEnabled {
+			var err error
+
+			principal, err = authenticator.Authenticate(auth.Credentials{
+				ApiKey:        metadataValue(ctx, auth.ApiKeyHeader),
+				Authorization: metadataValue(ctx, "authorization"),
+			}, methods...)
+			if err != nil {
+				logger.FromContext(ctx).WithFields(logrus.Fields{
+					"error_message": err.Error(),
+				}).Warn("authentication failed")
+
+				return nil, status.Error(codes.Unauthenticated, err.Error())
+			}
+		}
+
+		trace.SpanFromContext(ctx).SetAttributes(
+			attribute.String("enduser.id", principal.Id),
+			attribute.String("auth.method", string(principal.Method)),
+		)
+
+		ctx = auth.NewContext(ctx, principal)
+		ctx = logger.WithContext(ctx, logger.FromContext(ctx).WithField("principal_id", principal.Id))
+
+		return handler(ctx, req)
+	}
+}
+
+// GrpcAuthorization проверяет право вызывающего на метод, методы без права в permissions запрещены
+func GrpcAuthorization(policy *auth.Policy, permissions map[string]auth.Permission) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		principal, ok := auth.FromContext(ctx)
+		permission, known := permissions[info.FullMethod]
+
+		if !ok || !known || !policy.Allowed(principal, permission) {
+			logger.FromContext(ctx).WithFields(logrus.Fields{
+				"permission": permission,
+				"roles":      principal.Roles,
+			}).Warn("access denied")
+
+			return nil, status.Error(codes.PermissionDenied, fmt.Sprintf("access denied: permission %s required", permission))
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// GrpcRateLimit ограничивает частоту вызовов каждого метода для клиента, методы без лимита в limits не ограничиваются
+func GrpcRateLimit(backend ratelimit.Backend, limits map[string]ratelimit.Limit) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		limit, ok := limits[info.FullMethod]
+		if !config.RateLimitEnabled || !ok || limit.IsUnlimited() {
+			return handler(ctx, req)
+		}
+
+		result, err := backend.Take(ctx, info.FullMethod+":"+grpcClientKey(ctx), limit)
+		if err != nil {
+			logger.FromContext(ctx).WithFields(logrus.Fields{
+				"error_message": err.Error(),
+			}).Error("rate limit backend failed")
+
+			return handler(ctx, req)
+		}
+
+		if !result.Allowed {
+			if err := grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(ceilSeconds(result.RetryAfter)))); err != nil {
+				logger.FromContext(ctx).WithFields(logrus.Fields{
+					"error_message": err.Error(),
+				}).Warn("failed to set retry-after header")
+			}
+
+			return nil, status.Error(codes.ResourceExhausted, "rate limit exceeded")
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func grpcClientKey(ctx context.Context) string {
+	if principal, ok := auth.FromContext(ctx); ok && principal.Method != auth.MethodNone {
+		return "principal:" + principal.Id
+	}
+
+	if ip := grpcPeerIp(ctx); ip != "" {
+		return "ip:" + ip
+	}
+
+	return "ip:unknown"
+}
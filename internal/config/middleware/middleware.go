@@ -1,18 +1,34 @@
 package middleware
 
 import (
+	"bufio"
 	"bytes"
-	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
+	"sort"
+	"strings"
 
+	"github.com/avito-test/internal/config"
+	"github.com/avito-test/internal/config/clientip"
+	"github.com/avito-test/internal/config/clock"
+	"github.com/avito-test/internal/config/idgen"
 	"github.com/avito-test/internal/config/logger"
-	"github.com/google/uuid"
+	"github.com/avito-test/internal/config/requestid"
+	"github.com/avito-test/internal/config/tracing"
+	"github.com/avito-test/internal/dto"
+	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
-
-	_ "github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func ResponseHeaders(next http.Handler) http.Handler {
@@ -22,13 +38,65 @@ func ResponseHeaders(next http.Handler) http.Handler {
 	})
 }
 
-func RequestID(next http.Handler) http.Handler {
+// RequestID берет id запроса из заголовка X-Request-ID (если он валидный) или генерирует новый в ids и возвращает его в ответе
+func RequestID(ids idgen.Generator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestId := r.Header.Get(requestid.Header)
+
+			if !requestid.IsValid(requestId) {
+				requestId = ids.NewId()
+			}
+
+			w.Header().Set(requestid.Header, requestId)
+
+			trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("request_id", requestId))
+
+			r = r.Clone(requestid.NewContext(r.Context(), requestId))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientIP сохраняет в контексте ip клиента (адрес соединения) для журнала аудита
+func ClientIP(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		r = r.Clone(context.WithValue(r.Context(), "requestId", uuid.New().String())) //r.WithContext(context.WithValue(r.Context(), "requestId", uuid.New().String()))
+		r = r.Clone(clientip.NewContext(r.Context(), clientip.FromAddr(r.RemoteAddr)))
 		next.ServeHTTP(w, r)
 	})
 }
 
+// Tracing открывает серверный спан запроса, продолжая трейс из заголовка traceparent если он передан
+func Tracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		ctx, span := tracing.Tracer().Start(ctx, fmt.Sprintf("%s %s", r.Method, route),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest(config.ServiceName, route, r)...),
+			trace.WithAttributes(semconv.NetAttributesFromHTTPRequest("tcp", r)...),
+		)
+		defer span.End()
+
+		rw := responseWriter{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(&rw, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(rw.status)...)
+
+		if rw.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rw.status))
+		}
+	})
+}
+
 type responseWriter struct {
 	http.ResponseWriter
 	status int
@@ -46,35 +114,194 @@ func (rw *responseWriter) Write(body []byte) (int, error) {
 	return i, err
 }
 
-func Logging(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log := logger.GetLogger()
+// Flush нужен потоковым ответам (SSE)
+func (rw *responseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack нужен для перехода соединения на WebSocket
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+
+	return hijacker.Hijack()
+}
+
+// BodyLimit ограничивает тело запроса limit байтами: запрос с большим Content-Length отклоняется с 413 до чтения тела,
+// чтение тела без длины обрывается ошибкой после limit байт. Должен стоять перед Logging, который читает тело
+func BodyLimit(limit int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > int64(limit) {
+				writeApiError(w, r, http.StatusRequestEntityTooLarge, dto.ErrorCodeBodyTooLarge,
+					fmt.Sprintf("request body should be at most %d bytes", limit))
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, int64(limit))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Logging пишет в base запрос и ответ, длительность считается по clk
+func Logging(base *logrus.Logger, clk clock.Clock) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			log := base.WithFields(logrus.Fields{
+				"request_id": requestid.FromContext(r.Context()),
+				"method":     r.Method,
+				"uri":        maskedURI(r),
+			})
+
+			if spanContext := trace.SpanContextFromContext(r.Context()); spanContext.HasTraceID() {
+				log = log.WithField("trace_id", spanContext.TraceID().String())
+			}
+
+			requestFields := logrus.Fields{}
+
+			if config.LogBody {
+				prefix, complete, err := readPrefix(r.Body, config.LogBodyMaxSize)
+
+				if err != nil {
+					log.WithFields(logrus.Fields{
+						"error_message": err.Error(),
+					}).Error("failed to read request body")
 
-		bodyBuf, err := io.ReadAll(r.Body)
+					http.Error(w, "invalid request body", http.StatusBadRequest)
+					return
+				}
 
-		if err != nil {
-			log.Fatal(err.Error())
+				// прочитанное начало тела возвращается перед непрочитанным остатком
+				r.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(prefix), r.Body), Closer: r.Body}
+
+				if complete {
+					requestFields["body"] = redactBody(prefix)
+				} else {
+					// обрезанный json не разобрать, а без разбора нельзя скрыть поля LogRedactFields
+					requestFields["body"] = fmt.Sprintf("(not logged, larger than %d bytes)", config.LogBodyMaxSize)
+				}
+			}
+
+			rw := responseWriter{ResponseWriter: w, status: http.StatusOK}
+
+			log.WithFields(requestFields).Info("request")
+
+			start := clk.Now()
+
+			next.ServeHTTP(&rw, r.WithContext(logger.WithContext(r.Context(), log)))
+
+			responseFields := logrus.Fields{
+				"status":      rw.status,
+				"duration_ms": clk.Now().Sub(start).Milliseconds(),
+			}
+
+			if config.LogBody {
+				responseFields["body"] = redactBody(rw.body)
+			}
+
+			log.WithFields(responseFields).Info("response")
+		})
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// readPrefix читает из body не больше max байт (max < 0 - без ограничения), complete - тело прочитано целиком
+func readPrefix(body io.Reader, max int) (prefix []byte, complete bool, err error) {
+	if max < 0 {
+		prefix, err = io.ReadAll(body)
+		return prefix, true, err
+	}
+
+	// лишний байт показывает, что тело длиннее max
+	prefix, err = io.ReadAll(io.LimitReader(body, int64(max)+1))
+	if err != nil {
+		return nil, false, err
+	}
+
+	return prefix, len(prefix) <= max, nil
+}
+
+// maskedURI - путь запроса для лога: идентификаторы заменены именами переменных маршрута ({userId}),
+// значения query параметров - на "***"
+func maskedURI(r *http.Request) string {
+	path := r.URL.Path
+
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			path = template
 		}
+	}
+
+	query := r.URL.Query()
+	if len(query) == 0 {
+		return path
+	}
 
-		r.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBuf))
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
 
-		requestId := r.Context().Value("requestId")
+	sort.Strings(names)
 
-		rw := responseWriter{ResponseWriter: w}
+	for i, name := range names {
+		names[i] = url.QueryEscape(name) + "=***"
+	}
 
-		log.WithFields(logrus.Fields{
-			"request_id": requestId,
-			"method":     r.Method,
-			"uri":        r.RequestURI,
-			"body":       string(bodyBuf),
-		}).Info(fmt.Sprintf("%s_REQUEST", requestId))
+	return path + "?" + strings.Join(names, "&")
+}
 
-		next.ServeHTTP(&rw, r)
+// redactBody скрывает значения полей из config.LogRedactFields в json теле и обрезает его до config.LogBodyMaxSize
+func redactBody(body []byte) string {
+	var parsed interface{}
 
-		log.WithFields(logrus.Fields{
-			"request_id": requestId,
-			"status":     rw.status,
-			"body":       string(rw.body),
-		}).Info(fmt.Sprintf("%s_RESPONSE", requestId))
-	})
+	if err := json.Unmarshal(body, &parsed); err == nil {
+		if redacted, err := json.Marshal(redactValue(parsed)); err == nil {
+			body = redacted
+		}
+	}
+
+	if config.LogBodyMaxSize >= 0 && len(body) > config.LogBodyMaxSize {
+		return fmt.Sprintf("%s...(truncated, %d bytes)", body[:config.LogBodyMaxSize], len(body))
+	}
+
+	return string(body)
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, fieldValue := range v {
+			if isRedactedField(key) {
+				v[key] = "***"
+			} else {
+				v[key] = redactValue(fieldValue)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = redactValue(v[i])
+		}
+	}
+
+	return value
+}
+
+func isRedactedField(name string) bool {
+	for _, field := range config.LogRedactFields {
+		if strings.EqualFold(strings.TrimSpace(field), name) {
+			return true
+		}
+	}
+
+	return false
 }
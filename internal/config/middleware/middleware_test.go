@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/avito-test/internal/config"
+	"github.com/avito-test/internal/config/clock"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestLogging(t *testing.T) {
+	logBody, logBodyMaxSize := config.LogBody, config.LogBodyMaxSize
+	config.LogBody, config.LogBodyMaxSize = true, 32
+	t.Cleanup(func() { config.LogBody, config.LogBodyMaxSize = logBody, logBodyMaxSize })
+
+	tests := []struct {
+		name     string
+		uri      string
+		body     string
+		wantUri  string
+		wantBody string
+	}{
+		{"small", "/balance/3fa85f64-5717-4562-b3fc-2c963f66afa6", `{"userId":"u","sum":1}`,
+			"/balance/{userId}", `{"sum":1,"userId":"***"}`},
+		{"large", "/balance/3fa85f64-5717-4562-b3fc-2c963f66afa6?userId=u&limit=10", `{"userId":"u","comment":"` + strings.Repeat("x", 64) + `"}`,
+			"/balance/{userId}?limit=***&userId=***", "(not logged, larger than 32 bytes)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log, hook := test.NewNullLogger()
+
+			var received string
+
+			router := mux.NewRouter()
+			router.Handle("/balance/{userId}", Logging(log, clock.NewManual(time.Now(), 0))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				received = string(body)
+			})))
+
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, tt.uri, strings.NewReader(tt.body)))
+
+			// обработчик получает тело целиком, в том числе непрочитанный логированием остаток
+			if received != tt.body {
+				t.Fatalf("handler received %q, want %q", received, tt.body)
+			}
+
+			request := hook.AllEntries()[0]
+
+			if request.Data["uri"] != tt.wantUri {
+				t.Fatalf("logged uri %q, want %q", request.Data["uri"], tt.wantUri)
+			}
+
+			if request.Data["body"] != tt.wantBody {
+				t.Fatalf("logged body %q, want %q", request.Data["body"], tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/avito-test/internal/config"
+	"github.com/avito-test/internal/config/auth"
+	"github.com/avito-test/internal/config/clientip"
+	"github.com/avito-test/internal/config/logger"
+	"github.com/avito-test/internal/config/ratelimit"
+	"github.com/avito-test/internal/dto"
+	"github.com/sirupsen/logrus"
+)
+
+// RateLimit ограничивает частоту запросов к маршруту route для каждого клиента (api клиент, иначе ip)
+func RateLimit(backend ratelimit.Backend, route string, limit ratelimit.Limit) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !config.RateLimitEnabled || limit.IsUnlimited() {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			result, err := backend.Take(r.Context(), route+":"+clientKey(r), limit)
+			if err != nil {
+				// недоступность хранилища лимитов не должна останавливать сервис
+				logger.FromContext(r.Context()).WithFields(logrus.Fields{
+					"error_message": err.Error(),
+				}).Error("rate limit backend failed")
+
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+
+			if !result.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+				writeApiError(w, r, http.StatusTooManyRequests, dto.ErrorCodeRateLimited, "rate limit exceeded")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func clientKey(r *http.Request) string {
+	if principal, ok := auth.FromContext(r.Context()); ok && principal.Method != auth.MethodNone {
+		return "principal:" + principal.Id
+	}
+
+	return "ip:" + clientip.FromAddr(r.RemoteAddr)
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,28 @@
+package config
+
+import (
+	"strings"
+	"time"
+)
+
+// OutboxPublisher - куда публиковать события outbox: "kafka", "nats", "file", "stdout" или "none" (relay не запускается)
+var OutboxPublisher = getEnv("OUTBOX_PUBLISHER", "none")
+
+var OutboxPollInterval = getEnvDuration("OUTBOX_POLL_INTERVAL", time.Second)
+
+var OutboxBatchSize = getEnvInt("OUTBOX_BATCH_SIZE", 100)
+
+// OutboxRetention - сколько хранить опубликованные события
+var OutboxRetention = getEnvDuration("OUTBOX_RETENTION", 24*time.Hour)
+
+// OutboxFile - файл для публикатора "file", события дописываются построчно в json
+var OutboxFile = getEnv("OUTBOX_FILE", "static/events.jsonl")
+
+var KafkaBrokers = strings.Split(getEnv("KAFKA_BROKERS", "localhost:9092"), ",")
+
+var KafkaTopic = getEnv("KAFKA_TOPIC", "balance-events")
+
+var NatsUrl = getEnv("NATS_URL", "nats://localhost:4222")
+
+// NatsSubject - префикс subject, событие публикуется в <NatsSubject>.<тип события> через JetStream
+var NatsSubject = getEnv("NATS_SUBJECT", "balance.events")
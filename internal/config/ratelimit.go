@@ -0,0 +1,31 @@
+package config
+
+import "strings"
+
+var RateLimitEnabled = getEnv("RATE_LIMIT_ENABLED", "true") == "true"
+
+// лимиты по умолчанию в формате "<количество>/<s|m|h>", переопределяются переменной RATE_LIMIT_<МАРШРУТ>
+var rateLimits = map[string]string{
+	"get_balance":      "50/s",
+	"increase_balance": "20/s",
+	"balance_stream":   "30/m",
+	"get_transactions": "20/s",
+	"save_transaction": "50/s",
+	"batch":            "10/s",
+	"create_report":    "10/m",
+	"get_report":       "30/m",
+	"webhooks":         "10/s",
+	"adjustments":      "10/s",
+	"accounts":         "10/s",
+	"limits":           "10/s",
+}
+
+// RateLimit возвращает лимит для маршрута route, для неизвестных маршрутов - RATE_LIMIT_DEFAULT
+func RateLimit(route string) string {
+	defaultLimit, ok := rateLimits[route]
+	if !ok {
+		defaultLimit = getEnv("RATE_LIMIT_DEFAULT", "50/s")
+	}
+
+	return getEnv("RATE_LIMIT_"+strings.ToUpper(route), defaultLimit)
+}
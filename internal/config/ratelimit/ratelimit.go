@@ -0,0 +1,163 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/avito-test/internal/config/clock"
+)
+
+// Limit - token bucket: Burst запросов сразу, дальше Rate запросов в секунду
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Unlimited - лимит выключен
+var Unlimited = Limit{}
+
+func (l Limit) IsUnlimited() bool {
+	return l.Rate <= 0 || l.Burst <= 0
+}
+
+// ParseLimit разбирает лимит вида "100/s", "10/m", "600/h" (burst равен количеству запросов)
+func ParseLimit(s string) (Limit, error) {
+	if s == "" || s == "0" {
+		return Unlimited, nil
+	}
+
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, expected <count>/<s|m|h>", s)
+	}
+
+	count, err := strconv.Atoi(parts[0])
+	if err != nil || count < 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit count %q", parts[0])
+	}
+
+	var period time.Duration
+
+	switch parts[1] {
+	case "s":
+		period = time.Second
+	case "m":
+		period = time.Minute
+	case "h":
+		period = time.Hour
+	default:
+		return Limit{}, fmt.Errorf("invalid rate limit period %q", parts[1])
+	}
+
+	return Limit{Rate: float64(count) / period.Seconds(), Burst: count}, nil
+}
+
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	ResetAfter time.Duration
+	RetryAfter time.Duration
+}
+
+// Backend хранит состояние бакетов. MemoryBackend подходит для одного инстанса,
+// для кластера нужна реализация поверх общего хранилища (redis, postgres)
+type Backend interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// full - когда бакет полностью восстановится по своему лимиту, после этого его можно удалить:
+	// новый бакет с полным запасом ведет себя так же
+	full time.Time
+}
+
+type MemoryBackend struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	clock   clock.Clock
+	// nextCleanup - время следующей очистки, cleanupSize - размер, при котором очистка выполняется раньше
+	nextCleanup time.Time
+	cleanupSize int
+}
+
+const (
+	// восстановившиеся бакеты удаляются раз в memoryBackendCleanupInterval
+	memoryBackendCleanupInterval = time.Minute
+	// и раньше, если бакетов больше memoryBackendCleanupSize. После очистки порог поднимается до удвоенного
+	// числа оставшихся бакетов, поэтому полный обход оплачивается таким же числом новых бакетов
+	memoryBackendCleanupSize = 10000
+)
+
+// NewMemoryBackend создает хранилище бакетов в памяти, пополнение бакетов считается по clk
+func NewMemoryBackend(clk clock.Clock) *MemoryBackend {
+	return &MemoryBackend{
+		buckets:     make(map[string]*bucket),
+		clock:       clk,
+		nextCleanup: clk.Now().Add(memoryBackendCleanupInterval),
+		cleanupSize: memoryBackendCleanupSize,
+	}
+}
+
+func (m *MemoryBackend) Take(_ context.Context, key string, limit Limit) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.clock.Now()
+
+	if !now.Before(m.nextCleanup) || len(m.buckets) > m.cleanupSize {
+		m.cleanup(now)
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		m.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*limit.Rate)
+	b.updated = now
+
+	result := Result{Limit: limit.Burst}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsToDuration((1 - b.tokens) / limit.Rate)
+	}
+
+	result.Remaining = int(b.tokens)
+	result.ResetAfter = secondsToDuration((float64(limit.Burst) - b.tokens) / limit.Rate)
+
+	b.full = now.Add(result.ResetAfter)
+
+	return result, nil
+}
+
+// cleanup удаляет бакеты, которые полностью восстановились по своему лимиту
+func (m *MemoryBackend) cleanup(now time.Time) {
+	for key, b := range m.buckets {
+		if !now.Before(b.full) {
+			delete(m.buckets, key)
+		}
+	}
+
+	m.nextCleanup = now.Add(memoryBackendCleanupInterval)
+	m.cleanupSize = memoryBackendCleanupSize
+
+	if size := 2 * len(m.buckets); size > m.cleanupSize {
+		m.cleanupSize = size
+	}
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(math.Ceil(seconds * float64(time.Second)))
+}
@@ -0,0 +1,154 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/avito-test/internal/config/clock"
+)
+
+var start = time.Date(2022, time.November, 1, 10, 0, 0, 0, time.UTC)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Limit
+		wantErr bool
+	}{
+		{"", Unlimited, false},
+		{"0", Unlimited, false},
+		{"50/s", Limit{Rate: 50, Burst: 50}, false},
+		{"30/m", Limit{Rate: 0.5, Burst: 30}, false},
+		{"360/h", Limit{Rate: 0.1, Burst: 360}, false},
+		{"50", Limit{}, true},
+		{"x/s", Limit{}, true},
+		{"-1/s", Limit{}, true},
+		{"10/d", Limit{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseLimit(tt.value)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Fatalf("ParseLimit(%q) = %+v, %v, want %+v, error %v", tt.value, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func take(t *testing.T, m *MemoryBackend, key string, limit Limit) Result {
+	t.Helper()
+
+	result, err := m.Take(context.Background(), key, limit)
+	if err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+
+	return result
+}
+
+func TestTake(t *testing.T) {
+	clk := clock.NewManual(start, 0)
+	m := NewMemoryBackend(clk)
+	limit := Limit{Rate: 1, Burst: 3}
+
+	for i := 2; i >= 0; i-- {
+		if r := take(t, m, "client", limit); !r.Allowed || r.Remaining != i || r.Limit != 3 {
+			t.Fatalf("take = %+v, want allowed with %d remaining", r, i)
+		}
+	}
+
+	r := take(t, m, "client", limit)
+	if r.Allowed || r.RetryAfter != time.Second || r.ResetAfter != 3*time.Second {
+		t.Fatalf("take over burst = %+v, want denied, retry after 1s, reset after 3s", r)
+	}
+
+	if r := take(t, m, "other", limit); !r.Allowed {
+		t.Fatalf("take of other key = %+v, want allowed", r)
+	}
+
+	clk.Advance(1500 * time.Millisecond)
+
+	if r := take(t, m, "client", limit); !r.Allowed || r.Remaining != 0 {
+		t.Fatalf("take after refill = %+v, want allowed with 0 remaining", r)
+	}
+
+	if r := take(t, m, "client", limit); r.Allowed || r.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("take = %+v, want denied, retry after 500ms", r)
+	}
+}
+
+// TestCleanupKeepsStricterBuckets - очистка, вызванная запросом маршрута с мягким лимитом, не сбрасывает
+// исчерпанный бакет маршрута со строгим лимитом
+func TestCleanupKeepsStricterBuckets(t *testing.T) {
+	clk := clock.NewManual(start, 0)
+	m := NewMemoryBackend(clk)
+	strict, loose := Limit{Rate: 10.0 / 3600, Burst: 10}, Limit{Rate: 50, Burst: 50}
+
+	for i := 0; i < 10; i++ {
+		take(t, m, "create_report:client", strict)
+	}
+
+	for i := 0; i <= memoryBackendCleanupSize; i++ {
+		take(t, m, fmt.Sprintf("get_balance:%d", i), loose)
+	}
+
+	clk.Advance(memoryBackendCleanupInterval)
+	take(t, m, "get_balance:trigger", loose)
+
+	if len(m.buckets) != 2 {
+		t.Fatalf("buckets after cleanup = %d, want exhausted strict bucket and trigger", len(m.buckets))
+	}
+
+	if r := take(t, m, "create_report:client", strict); r.Allowed {
+		t.Fatalf("take of exhausted strict bucket after cleanup = %+v, want denied", r)
+	}
+}
+
+// TestCleanupAmortized - если очистка ничего не удалила, следующая по размеру выполняется только после удвоения
+// числа бакетов, а не на каждом запросе
+func TestCleanupAmortized(t *testing.T) {
+	clk := clock.NewManual(start, 0)
+	m := NewMemoryBackend(clk)
+	strict := Limit{Rate: 1.0 / 3600, Burst: 1}
+
+	for i := 0; i <= memoryBackendCleanupSize+1; i++ {
+		take(t, m, fmt.Sprintf("client:%d", i), strict)
+	}
+
+	size := len(m.buckets)
+	if m.cleanupSize < 2*(size-1) {
+		t.Fatalf("cleanup size = %d with %d buckets, want at least doubled", m.cleanupSize, size)
+	}
+
+	next := m.nextCleanup
+
+	take(t, m, "client:next", strict)
+
+	if m.nextCleanup != next {
+		t.Fatal("cleanup ran again before the map doubled")
+	}
+}
+
+// TestCleanupInterval - восстановившиеся бакеты удаляются раз в интервал и при небольшом числе бакетов
+func TestCleanupInterval(t *testing.T) {
+	clk := clock.NewManual(start, 0)
+	m := NewMemoryBackend(clk)
+	limit := Limit{Rate: 1, Burst: 5}
+
+	take(t, m, "idle", limit)
+	take(t, m, "exhausted", Limit{Rate: 1.0 / 3600, Burst: 1})
+
+	clk.Advance(memoryBackendCleanupInterval)
+	take(t, m, "active", limit)
+
+	if _, ok := m.buckets["idle"]; ok {
+		t.Fatal("idle bucket was not removed after the cleanup interval")
+	}
+
+	if _, ok := m.buckets["exhausted"]; !ok {
+		t.Fatal("exhausted bucket was removed before it refilled")
+	}
+}
@@ -0,0 +1,6 @@
+package config
+
+import "path/filepath"
+
+// ReportDir - каталог файлов отчетов, отдается по /report/{fileName}
+var ReportDir = getEnv("REPORT_DIR", filepath.Join("static", "file"))
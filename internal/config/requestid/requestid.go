@@ -0,0 +1,27 @@
+package requestid
+
+import (
+	"context"
+	"regexp"
+)
+
+const Header = "X-Request-ID"
+
+type ctxKey struct{}
+
+// входящий id попадает в логи, заголовки и имя файла отчета, поэтому допускаем только безопасные символы
+var validId = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+func IsValid(id string) bool {
+	return validId.MatchString(id)
+}
+
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+
+	return id
+}
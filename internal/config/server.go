@@ -0,0 +1,8 @@
+package config
+
+var HttpAddr = getEnv("HTTP_ADDR", ":8000")
+
+var GrpcAddr = getEnv("GRPC_ADDR", ":9000")
+
+// HttpMaxBodyBytes - максимальный размер тела запроса REST API, у пакета операций свой лимит BatchMaxBodyBytes
+var HttpMaxBodyBytes = getEnvInt("HTTP_MAX_BODY_BYTES", 1<<20)
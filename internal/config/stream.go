@@ -0,0 +1,9 @@
+package config
+
+import "time"
+
+// StreamHeartbeat - как часто в поток баланса отправляется heartbeat, чтобы прокси не закрывали соединение
+var StreamHeartbeat = getEnvDuration("STREAM_HEARTBEAT", 15*time.Second)
+
+// StreamBatchSize - сколько событий outbox читается за один запрос при дочитывании потока
+var StreamBatchSize = getEnvInt("STREAM_BATCH_SIZE", 100)
@@ -0,0 +1,23 @@
+package config
+
+import (
+	"strings"
+	"time"
+)
+
+// DbQueryTimeout - таймаут запроса в бд по умолчанию (DB_QUERY_TIMEOUT, например "5s")
+var DbQueryTimeout = getEnvDuration("DB_QUERY_TIMEOUT", 5*time.Second)
+
+var dbTimeouts = map[string]time.Duration{
+	"get_report_rows":        getEnvDuration("DB_TIMEOUT_GET_REPORT_ROWS", 30*time.Second),
+	"get_balance_mismatches": getEnvDuration("DB_TIMEOUT_GET_BALANCE_MISMATCHES", 60*time.Second),
+}
+
+// DbTimeout возвращает таймаут для конкретного запроса, переопределяется переменной DB_TIMEOUT_<ИМЯ_ЗАПРОСА>
+func DbTimeout(statement string) time.Duration {
+	if timeout, ok := dbTimeouts[statement]; ok {
+		return timeout
+	}
+
+	return getEnvDuration("DB_TIMEOUT_"+strings.ToUpper(statement), DbQueryTimeout)
+}
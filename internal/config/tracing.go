@@ -0,0 +1,11 @@
+package config
+
+const ServiceName = "balance-service"
+
+// TraceExporter - куда выгружать спаны: "otlp", "stdout" (для локального запуска) или "none"
+var TraceExporter = getEnv("TRACE_EXPORTER", "none")
+
+// OtlpEndpoint - адрес OTLP/HTTP коллектора (host:port)
+var OtlpEndpoint = getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", "localhost:4318")
+
+var OtlpInsecure = getEnv("OTEL_EXPORTER_OTLP_INSECURE", "true") == "true"
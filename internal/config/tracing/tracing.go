@@ -0,0 +1,89 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/avito-test/internal/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/avito-test"
+
+// Init настраивает глобальный TracerProvider и W3C propagator.
+// Возвращаемую функцию нужно вызвать при остановке сервера, чтобы выгрузить оставшиеся спаны.
+func Init(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch config.TraceExporter {
+	case "none", "":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout), stdouttrace.WithPrettyPrint())
+	case "otlp":
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(config.OtlpEndpoint)}
+
+		if config.OtlpInsecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter: %s", config.TraceExporter)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(config.ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// Start открывает спан уровня сервиса/хендлера
+func Start(ctx context.Context, name string) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name)
+}
+
+// StartDb открывает клиентский спан запроса в бд, statement - имя запроса (функции) в бд
+func StartDb(ctx context.Context, statement string) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, fmt.Sprintf("db %s", statement),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBNameKey.String(config.DbName),
+			semconv.DBOperationKey.String(statement),
+			attribute.String("db.statement.name", statement),
+		))
+}
+
+// Error помечает спан ошибкой
+func Error(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
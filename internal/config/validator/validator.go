@@ -20,6 +20,44 @@ func init() {
 		}
 		return name
 	})
+
+	if err := v.RegisterValidation("unique_field", uniqueField); err != nil {
+		panic(err)
+	}
+}
+
+// uniqueField проверяет, что поле с именем из параметра у элементов слайса структур не повторяется.
+// В отличие от встроенного unique элементы с nil в поле пропускаются: их отклоняет required при dive
+func uniqueField(fl validator.FieldLevel) bool {
+	field := fl.Field()
+	if field.Kind() != reflect.Slice && field.Kind() != reflect.Array {
+		return false
+	}
+
+	seen := make(map[interface{}]struct{}, field.Len())
+
+	for i := 0; i < field.Len(); i++ {
+		value := reflect.Indirect(field.Index(i)).FieldByName(fl.Param())
+		if !value.IsValid() {
+			return false
+		}
+
+		if value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				continue
+			}
+
+			value = value.Elem()
+		}
+
+		if _, ok := seen[value.Interface()]; ok {
+			return false
+		}
+
+		seen[value.Interface()] = struct{}{}
+	}
+
+	return true
 }
 
 func GetValidator() *validator.Validate {
@@ -0,0 +1,18 @@
+package config
+
+import "time"
+
+// WebhookMaxAttempts - после стольких неудачных попыток доставка переходит в статус dead
+var WebhookMaxAttempts = getEnvInt("WEBHOOK_MAX_ATTEMPTS", 8)
+
+// WebhookBackoffBase - задержка перед второй попыткой, дальше удваивается до WebhookBackoffMax
+var WebhookBackoffBase = getEnvDuration("WEBHOOK_BACKOFF_BASE", 30*time.Second)
+
+var WebhookBackoffMax = getEnvDuration("WEBHOOK_BACKOFF_MAX", time.Hour)
+
+// WebhookTimeout - таймаут одного запроса к подписчику
+var WebhookTimeout = getEnvDuration("WEBHOOK_TIMEOUT", 10*time.Second)
+
+var WebhookPollInterval = getEnvDuration("WEBHOOK_POLL_INTERVAL", time.Second)
+
+var WebhookBatchSize = getEnvInt("WEBHOOK_BATCH_SIZE", 50)
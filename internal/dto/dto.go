@@ -4,10 +4,26 @@ import (
 	"time"
 )
 
+// ApiError - ошибка в формате RFC 7807 (application/problem+json).
+// Message дублирует Detail для клиентов первой версии API
 type ApiError struct {
-	Message string `json:"message"`
+	Type          string         `json:"type" example:"https://balance-service/problems/validation-error"`
+	Title         string         `json:"title" example:"Request validation failed"`
+	Status        int            `json:"status" example:"400"`
+	Detail        string         `json:"detail,omitempty" example:"field sum should be > 0"`
+	Instance      string         `json:"instance,omitempty" example:"/balance"`
+	Code          string         `json:"code" example:"validation-error"`
+	Message       string         `json:"message" example:"field sum should be > 0"`
+	RequestId     string         `json:"requestId,omitempty" example:"03070038-3459-45d8-ad22-a8fc0fbb634c"`
+	InvalidParams []InvalidParam `json:"invalidParams,omitempty"`
 } //@name ApiError
 
+type InvalidParam struct {
+	Name       string `json:"name" example:"sum"`
+	Reason     string `json:"reason" example:"field sum should be > 0"`
+	Constraint string `json:"constraint" example:"gt=0"`
+} //@name InvalidParam
+
 type IncreaseBalanceRequest struct {
 	UserId  *string  `json:"userId" validate:"required,uuid_rfc4122" example:"c806ce22-7ea3-4402-b979-9959746bb956" format:"uuid" binding:"required"`
 	Sum     *float64 `json:"sum" validate:"required,numeric,gt=0" example:"53.68" format:"numeric" binding:"required"`
@@ -32,18 +48,34 @@ type SaveTransactionResponse struct {
 } //@name SaveTransactionResponse
 
 type GetTransactionsRequest struct {
-	UserId       *string `json:"userId" validate:"required,uuid_rfc4122"`
-	Page         *int    `json:"page" validate:"required,min=1"`
-	ItemsPerPage *int    `json:"itemsPerPage" validate:"omitempty,min=1"`
-	SortBy       *string `json:"sortBy" validate:"omitempty,oneof=sum date"`
-	SortType     *string `json:"sortType" validate:"omitempty,oneof=asc desc"`
+	UserId           *string  `json:"userId" validate:"required,uuid_rfc4122"`
+	Page             *int     `json:"page" validate:"omitempty,min=1"`
+	Cursor           *string  `json:"cursor" validate:"omitempty,excluded_with=Page"`
+	ItemsPerPage     *int     `json:"itemsPerPage" validate:"omitempty,min=1,max=100"`
+	SortBy           *string  `json:"sortBy" validate:"omitempty,oneof=sum date"`
+	SortType         *string  `json:"sortType" validate:"omitempty,oneof=asc desc"`
+	TransactionTypes []int    `json:"transactionType" validate:"omitempty,dive,oneof=1 2 3 4 5 6"`
+	DateFrom         *string  `json:"dateFrom" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	DateTo           *string  `json:"dateTo" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	ServiceId        *string  `json:"serviceId" validate:"omitempty,uuid_rfc4122"`
+	OrderId          *string  `json:"orderId" validate:"omitempty,uuid_rfc4122"`
+	SumFrom          *float64 `json:"sumFrom" validate:"omitempty,min=0"`
+	SumTo            *float64 `json:"sumTo" validate:"omitempty,min=0"`
+	Comment          *string  `json:"comment" validate:"omitempty,max=100"`
 }
 
+// GetTransactionsResponse - страница транзакций. nextCursor передается в cursor для получения следующей страницы
 type GetTransactionsResponse struct {
 	Transactions []Transaction `json:"transactions"`
+	NextCursor   *string       `json:"nextCursor,omitempty" example:"eyJzIjoiZGF0ZSIsIm8iOiJkZXNjIn0"`
+	HasMore      bool          `json:"hasMore" example:"true"`
+	Total        int           `json:"total" example:"42"`
+	ItemsPerPage int           `json:"itemsPerPage" example:"10"`
+	Page         *int          `json:"page,omitempty" example:"1"`
 } //@name GetTransactionsResponse
 
 type Transaction struct {
+	Id                string    `json:"id" example:"0d3b2a4c-6b0e-4c9b-9d8c-3c4f0a1e2b7d"`
 	UserId            *string   `json:"user_id,omitempty" swaggerignore:"true"`
 	OrderId           *string   `json:"order_id,omitempty" example:"6c87959d-aa88-4f51-932b-ff70563ad87b"`
 	ServiceId         *string   `json:"service_id,omitempty" example:"15aa9f91-c8f7-40e4-9108-d45891c10444"`
@@ -54,11 +86,250 @@ type Transaction struct {
 	UpdTime           time.Time `json:"date" example:"2022-11-01T16:37:52.717392Z"`
 } //@name Transaction
 
+// TransactionDetails - транзакция с историей состояний, последнее состояние в history - текущее
+type TransactionDetails struct {
+	Id              string             `json:"id" example:"0d3b2a4c-6b0e-4c9b-9d8c-3c4f0a1e2b7d"`
+	UserId          string             `json:"user_id" example:"c806ce22-7ea3-4402-b979-9959746bb956"`
+	OrderId         *string            `json:"order_id,omitempty" example:"6c87959d-aa88-4f51-932b-ff70563ad87b"`
+	ServiceId       *string            `json:"service_id,omitempty" example:"15aa9f91-c8f7-40e4-9108-d45891c10444"`
+	Sum             float64            `json:"sum" example:"1000"`
+	TransactionType string             `json:"transaction_type" example:"Резервация подтверждена, средства списаны, оплата прошла"`
+	Comment         *string            `json:"comment,omitempty" example:"оплата подтверждена"`
+	UpdTime         time.Time          `json:"date" example:"2022-11-01T16:37:52.717392Z"`
+	History         []TransactionState `json:"history"`
+} //@name TransactionDetails
+
+type TransactionState struct {
+	TransactionTypeId int       `json:"transaction_type_id" example:"1"`
+	TransactionType   string    `json:"transaction_type" example:"Деньги зарезервированы с основного баланса"`
+	Sum               float64   `json:"sum" example:"1000"`
+	Comment           *string   `json:"comment,omitempty" example:"резервация под заказ"`
+	UpdTime           time.Time `json:"date" example:"2022-11-01T16:30:12.114215Z"`
+} //@name TransactionState
+
+type GetOrderTransactionsResponse struct {
+	Transactions []TransactionDetails `json:"transactions"`
+} //@name GetOrderTransactionsResponse
+
+// BatchRequest - пакет операций. atomic - выполнить все операции в одной транзакции бд или ни одной
+type BatchRequest struct {
+	Atomic     *bool            `json:"atomic" example:"true"`
+	Operations []BatchOperation `json:"operations" validate:"required,min=1,dive"`
+} //@name BatchRequest
+
+type BatchOperation struct {
+	Type      *string  `json:"type" validate:"required,oneof=reserve capture cancel deposit" enums:"reserve,capture,cancel,deposit" example:"reserve"`
+	UserId    *string  `json:"userId" validate:"required,uuid_rfc4122" example:"c806ce22-7ea3-4402-b979-9959746bb956" format:"uuid"`
+	OrderId   *string  `json:"orderId" validate:"required_unless=Type deposit,omitempty,uuid_rfc4122" example:"6c87959d-aa88-4f51-932b-ff70563ad87b" format:"uuid"`
+	ServiceId *string  `json:"serviceId" validate:"required_unless=Type deposit,omitempty,uuid_rfc4122" example:"15aa9f91-c8f7-40e4-9108-d45891c10444" format:"uuid"`
+	Sum       *float64 `json:"sum" validate:"required,numeric,gt=0" example:"100"`
+	Comment   *string  `json:"comment" example:"заказ 42"`
+} //@name BatchOperation
+
+type BatchResponse struct {
+	Atomic  bool                   `json:"atomic" example:"true"`
+	Results []BatchOperationResult `json:"results"`
+} //@name BatchResponse
+
+// BatchOperationResult - результат операции пакета с тем же индексом. error заполняется для статуса failed
+type BatchOperationResult struct {
+	Index  int       `json:"index" example:"0"`
+	Status string    `json:"status" enums:"applied,rolled_back,failed,skipped" example:"applied"`
+	Error  *ApiError `json:"error,omitempty"`
+} //@name BatchOperationResult
+
+type CreateOrderRequest struct {
+	OrderId *string           `json:"orderId" validate:"required,uuid_rfc4122" example:"6c87959d-aa88-4f51-932b-ff70563ad87b" format:"uuid"`
+	UserId  *string           `json:"userId" validate:"required,uuid_rfc4122" example:"c806ce22-7ea3-4402-b979-9959746bb956" format:"uuid"`
+	Lines   []CreateOrderLine `json:"lines" validate:"required,min=1,max=100,unique_field=ServiceId,dive"`
+} //@name CreateOrderRequest
+
+type CreateOrderLine struct {
+	ServiceId *string  `json:"serviceId" validate:"required,uuid_rfc4122" example:"15aa9f91-c8f7-40e4-9108-d45891c10444" format:"uuid"`
+	Sum       *float64 `json:"sum" validate:"required,numeric,gt=0" example:"100"`
+	Comment   *string  `json:"comment" example:"доставка"`
+} //@name CreateOrderLine
+
+// Order - заказ со строками, status выводится из статусов строк
+type Order struct {
+	OrderId    string      `json:"orderId" example:"6c87959d-aa88-4f51-932b-ff70563ad87b"`
+	UserId     string      `json:"userId" example:"c806ce22-7ea3-4402-b979-9959746bb956"`
+	Status     string      `json:"status" enums:"reserved,partially_processed,captured,cancelled,completed" example:"partially_processed"`
+	Sum        float64     `json:"sum" example:"350"`
+	CreateTime time.Time   `json:"createTime" example:"2022-11-01T16:30:12.114215Z"`
+	Lines      []OrderLine `json:"lines"`
+} //@name Order
+
+type OrderLine struct {
+	Id        string    `json:"id" example:"0d3b2a4c-6b0e-4c9b-9d8c-3c4f0a1e2b7d"`
+	ServiceId string    `json:"serviceId" example:"15aa9f91-c8f7-40e4-9108-d45891c10444"`
+	Sum       float64   `json:"sum" example:"100"`
+	Status    string    `json:"status" enums:"reserved,captured,cancelled" example:"captured"`
+	Comment   *string   `json:"comment,omitempty" example:"доставка"`
+	UpdTime   time.Time `json:"updTime" example:"2022-11-01T16:37:52.717392Z"`
+} //@name OrderLine
+
 type CreateReportRequest struct {
 	Year  *int `json:"year" validate:"required,min=2022,max=2100" minimum:"2022" maximum:"2100"`
 	Month *int `json:"month" validate:"required,oneof=1 2 3 4 5 6 7 8 9 10 11 12" enums:"1,2,3,4,5,6,7,8,9,10,11,12"`
 } //@name CreateReportRequest
 
 type CreateReportResponse struct {
+	Id  string `json:"id" example:"5b0f7c1e-2f4a-4d8e-9c3b-6a1d2e4f8b7c"`
 	URL string `json:"url" example:"http://localhost:8000/report/03070038-3459-45d8-ad22-a8fc0fbb634c.csv"`
 } //@name CreateReportResponse
+
+type CreateReservationRequest struct {
+	UserId    *string  `json:"userId" validate:"required,uuid_rfc4122" example:"e8c49cf0-d984-4ed8-a37c-2d60f74c7fe5" format:"uuid"`
+	OrderId   *string  `json:"orderId" validate:"required,uuid_rfc4122" example:"6c87959d-aa88-4f51-932b-ff70563ad87a" format:"uuid"`
+	ServiceId *string  `json:"serviceId" validate:"required,uuid_rfc4122" example:"15aa9f91-c8f7-40e4-9108-d45891c10444" format:"uuid"`
+	Sum       *float64 `json:"sum" validate:"required,numeric,gt=0" example:"345" format:"numeric"`
+	Comment   *string  `json:"comment" example:"Резервация денежных средств" format:"string"`
+} //@name CreateReservationRequest
+
+type ReservationActionRequest struct {
+	Comment *string `json:"comment" example:"оплата подтверждена" format:"string"`
+} //@name ReservationActionRequest
+
+type Reservation struct {
+	Id        string    `json:"id" example:"2f1c7f1e-9a3b-4a57-8a0e-7f6f3b0a8d11"`
+	UserId    string    `json:"userId" example:"e8c49cf0-d984-4ed8-a37c-2d60f74c7fe5"`
+	OrderId   string    `json:"orderId" example:"6c87959d-aa88-4f51-932b-ff70563ad87a"`
+	ServiceId string    `json:"serviceId" example:"15aa9f91-c8f7-40e4-9108-d45891c10444"`
+	Sum       float64   `json:"sum" example:"345"`
+	Status    string    `json:"status" example:"reserved" enums:"reserved,captured,cancelled"`
+	Comment   *string   `json:"comment,omitempty" example:"Резервация денежных средств"`
+	UpdTime   time.Time `json:"updatedAt" example:"2022-11-01T16:37:52.717392Z"`
+} //@name Reservation
+
+type CreateWebhookRequest struct {
+	Url        *string  `json:"url" validate:"required,max=2048,url" example:"https://partner.example.com/balance-events"`
+	EventTypes []string `json:"eventTypes" validate:"required,min=1,dive,oneof=deposit withdrawal adjustment reserved captured cancelled" enums:"deposit,withdrawal,adjustment,reserved,captured,cancelled"`
+	ServiceId  *string  `json:"serviceId" validate:"omitempty,uuid_rfc4122" example:"15aa9f91-c8f7-40e4-9108-d45891c10444" format:"uuid"`
+} //@name CreateWebhookRequest
+
+type Webhook struct {
+	Id         string    `json:"id" example:"9b2f6c1e-3d4a-4f8b-a1c2-5e6f7a8b9c0d"`
+	Url        string    `json:"url" example:"https://partner.example.com/balance-events"`
+	EventTypes []string  `json:"eventTypes" example:"reserved,captured"`
+	ServiceId  *string   `json:"serviceId,omitempty" example:"15aa9f91-c8f7-40e4-9108-d45891c10444"`
+	Secret     string    `json:"secret,omitempty" example:"whsec_5f0c1e..."`
+	CreateTime time.Time `json:"createTime" example:"2022-11-01T16:37:52.717392Z"`
+} //@name Webhook
+
+type GetWebhooksResponse struct {
+	Webhooks []Webhook `json:"webhooks"`
+} //@name GetWebhooksResponse
+
+type WebhookDelivery struct {
+	Id              string     `json:"id" example:"4e1d2c3b-5a6f-4b7c-8d9e-0f1a2b3c4d5e"`
+	EventId         string     `json:"eventId" example:"7a8b9c0d-1e2f-4a3b-8c4d-5e6f7a8b9c0d"`
+	EventSequence   int64      `json:"eventSequence" example:"42"`
+	EventType       string     `json:"eventType" example:"captured"`
+	UserId          string     `json:"userId" example:"e8c49cf0-d984-4ed8-a37c-2d60f74c7fe5"`
+	EventTime       time.Time  `json:"eventTime" example:"2022-11-01T16:37:52.717392Z"`
+	Status          string     `json:"status" enums:"pending,delivered,dead" example:"pending"`
+	Attempts        int        `json:"attempts" example:"2"`
+	NextAttemptTime *time.Time `json:"nextAttemptTime,omitempty" example:"2022-11-01T16:38:52.717392Z"`
+	LastAttemptTime *time.Time `json:"lastAttemptTime,omitempty" example:"2022-11-01T16:37:52.717392Z"`
+	LastStatusCode  *int       `json:"lastStatusCode,omitempty" example:"503"`
+	LastError       *string    `json:"lastError,omitempty" example:"unexpected status code 503"`
+} //@name WebhookDelivery
+
+type GetWebhookDeliveriesResponse struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+} //@name GetWebhookDeliveriesResponse
+
+type CreateAdjustmentRequest struct {
+	UserId    *string  `json:"userId" validate:"required,uuid_rfc4122" example:"e8c49cf0-d984-4ed8-a37c-2d60f74c7fe5" format:"uuid"`
+	Direction *string  `json:"direction" validate:"required,oneof=credit debit" example:"debit" enums:"credit,debit"`
+	Sum       *float64 `json:"sum" validate:"required,numeric,gt=0" example:"150" format:"numeric"`
+	Reason    *string  `json:"reason" validate:"required,min=1,max=1000" example:"Двойное зачисление платежа"`
+	Ticket    *string  `json:"ticket" validate:"required,min=1,max=100" example:"SUP-1234"`
+} //@name CreateAdjustmentRequest
+
+type AdjustmentDecisionRequest struct {
+	Comment *string `json:"comment" validate:"omitempty,max=1000" example:"Проверено по выписке"`
+} //@name AdjustmentDecisionRequest
+
+type Adjustment struct {
+	Id              string     `json:"id" example:"3c2b1a0f-9e8d-4c7b-a6f5-e4d3c2b1a0f9"`
+	UserId          string     `json:"userId" example:"e8c49cf0-d984-4ed8-a37c-2d60f74c7fe5"`
+	Direction       string     `json:"direction" enums:"credit,debit" example:"debit"`
+	Sum             float64    `json:"sum" example:"150"`
+	Reason          string     `json:"reason" example:"Двойное зачисление платежа"`
+	Ticket          string     `json:"ticket" example:"SUP-1234"`
+	Status          string     `json:"status" enums:"pending,approved,rejected" example:"approved"`
+	ProposedBy      string     `json:"proposedBy" example:"support-alice"`
+	ProposeTime     time.Time  `json:"proposeTime" example:"2022-11-01T16:37:52.717392Z"`
+	DecidedBy       *string    `json:"decidedBy,omitempty" example:"finance-bob"`
+	DecisionTime    *time.Time `json:"decisionTime,omitempty" example:"2022-11-01T17:02:11.104233Z"`
+	DecisionComment *string    `json:"decisionComment,omitempty" example:"Проверено по выписке"`
+	TransactionId   *string    `json:"transactionId,omitempty" example:"0d3b2a4c-6b0e-4c9b-9d8c-3c4f0a1e2b7d"`
+} //@name Adjustment
+
+type GetAdjustmentsResponse struct {
+	Adjustments []Adjustment `json:"adjustments"`
+} //@name GetAdjustmentsResponse
+
+type SetAccountStatusRequest struct {
+	Status *string `json:"status" validate:"required,oneof=active frozen-debit frozen-all closed" example:"frozen-debit" enums:"active,frozen-debit,frozen-all,closed"`
+	Reason *string `json:"reason" validate:"required,min=1,max=1000" example:"Подозрение на мошенничество, тикет RISK-42"`
+} //@name SetAccountStatusRequest
+
+type Account struct {
+	UserId     string     `json:"userId" example:"e8c49cf0-d984-4ed8-a37c-2d60f74c7fe5"`
+	Status     string     `json:"status" enums:"active,frozen-debit,frozen-all,closed" example:"frozen-debit"`
+	Reason     *string    `json:"reason,omitempty" example:"Подозрение на мошенничество, тикет RISK-42"`
+	UpdatedBy  *string    `json:"updatedBy,omitempty" example:"risk-carol"`
+	UpdateTime *time.Time `json:"updateTime,omitempty" example:"2022-11-01T16:37:52.717392Z"`
+} //@name Account
+
+type SetLimitRuleRequest struct {
+	Scope     *string  `json:"scope" validate:"required,oneof=global tier user" example:"tier" enums:"global,tier,user"`
+	ScopeId   *string  `json:"scopeId" validate:"omitempty,max=100" example:"basic"`
+	Operation *string  `json:"operation" validate:"required,oneof=deposit reserve withdraw" example:"deposit" enums:"deposit,reserve,withdraw"`
+	Period    *string  `json:"period" validate:"required,oneof=transaction day month" example:"day" enums:"transaction,day,month"`
+	Amount    *float64 `json:"amount" validate:"required,numeric,gt=0" example:"50000" format:"numeric"`
+} //@name SetLimitRuleRequest
+
+type LimitRule struct {
+	Scope      string    `json:"scope" enums:"global,tier,user" example:"tier"`
+	ScopeId    *string   `json:"scopeId,omitempty" example:"basic"`
+	Operation  string    `json:"operation" enums:"deposit,reserve,withdraw" example:"deposit"`
+	Period     string    `json:"period" enums:"transaction,day,month" example:"day"`
+	Amount     float64   `json:"amount" example:"50000"`
+	UpdatedBy  string    `json:"updatedBy" example:"risk-carol"`
+	UpdateTime time.Time `json:"updateTime" example:"2022-11-01T16:37:52.717392Z"`
+} //@name LimitRule
+
+type GetLimitRulesResponse struct {
+	Limits []LimitRule `json:"limits"`
+} //@name GetLimitRulesResponse
+
+type SetUserTierRequest struct {
+	Tier *string `json:"tier" validate:"required,min=1,max=100" example:"basic"`
+} //@name SetUserTierRequest
+
+type UserTier struct {
+	UserId     string    `json:"userId" example:"e8c49cf0-d984-4ed8-a37c-2d60f74c7fe5"`
+	Tier       string    `json:"tier" example:"basic"`
+	UpdatedBy  string    `json:"updatedBy" example:"risk-carol"`
+	UpdateTime time.Time `json:"updateTime" example:"2022-11-01T16:37:52.717392Z"`
+} //@name UserTier
+
+type LimitUsage struct {
+	Operation string     `json:"operation" enums:"deposit,reserve,withdraw" example:"deposit"`
+	Period    string     `json:"period" enums:"transaction,day,month" example:"day"`
+	Scope     string     `json:"scope" enums:"global,tier,user" example:"tier"`
+	Amount    float64    `json:"amount" example:"50000"`
+	Used      *float64   `json:"used,omitempty" example:"12500"`
+	Remaining float64    `json:"remaining" example:"37500"`
+	ResetTime *time.Time `json:"resetTime,omitempty" example:"2022-11-02T00:00:00Z"`
+} //@name LimitUsage
+
+type UserLimits struct {
+	UserId string       `json:"userId" example:"e8c49cf0-d984-4ed8-a37c-2d60f74c7fe5"`
+	Tier   *string      `json:"tier,omitempty" example:"basic"`
+	Limits []LimitUsage `json:"limits"`
+} //@name UserLimits
@@ -0,0 +1,87 @@
+package dto
+
+import "net/http"
+
+const ProblemContentType = "application/problem+json"
+
+const problemTypeBase = "https://balance-service/problems/"
+
+// стабильные коды ошибок, по ним клиенты различают ошибки (поле code и последний сегмент type)
+const (
+	ErrorCodeBadRequest          = "bad-request"
+	ErrorCodeValidation          = "validation-error"
+	ErrorCodeUnauthenticated     = "unauthenticated"
+	ErrorCodeForbidden           = "forbidden"
+	ErrorCodeRateLimited         = "rate-limited"
+	ErrorCodeBodyTooLarge        = "body-too-large"
+	ErrorCodeBalanceNotFound     = "balance-not-found"
+	ErrorCodeReservationNotFound = "reservation-not-found"
+	ErrorCodeTransactionNotFound = "transaction-not-found"
+	ErrorCodeOrderNotFound       = "order-not-found"
+	ErrorCodeOrderLineNotFound   = "order-line-not-found"
+	ErrorCodeOrderExists         = "order-exists"
+	ErrorCodeWebhookNotFound     = "webhook-not-found"
+	ErrorCodeDeliveryNotFound    = "webhook-delivery-not-found"
+	ErrorCodeAdjustmentNotFound  = "adjustment-not-found"
+	ErrorCodeAdjustmentDecided   = "adjustment-already-decided"
+	ErrorCodeSameOperator        = "same-operator"
+	ErrorCodeReservationExists   = "reservation-exists"
+	ErrorCodeAlreadyCaptured     = "already-captured"
+	ErrorCodeAlreadyCancelled    = "already-cancelled"
+	ErrorCodeInsufficientFunds   = "insufficient-funds"
+	ErrorCodeAccountFrozen       = "account-frozen"
+	ErrorCodeAccountClosed       = "account-closed"
+	ErrorCodeLimitExceeded       = "limit-exceeded"
+	ErrorCodeLimitNotFound       = "limit-not-found"
+	ErrorCodeRequestCanceled     = "request-canceled"
+	ErrorCodeTimeout             = "timeout"
+	ErrorCodeInternal            = "internal-error"
+)
+
+var errorTitles = map[string]string{
+	ErrorCodeBadRequest:          "Bad request",
+	ErrorCodeValidation:          "Request validation failed",
+	ErrorCodeUnauthenticated:     "Authentication required",
+	ErrorCodeForbidden:           "Access denied",
+	ErrorCodeRateLimited:         "Rate limit exceeded",
+	ErrorCodeBodyTooLarge:        "Request body too large",
+	ErrorCodeBalanceNotFound:     "Balance not found",
+	ErrorCodeReservationNotFound: "Reservation not found",
+	ErrorCodeTransactionNotFound: "Transaction not found",
+	ErrorCodeOrderNotFound:       "Order not found",
+	ErrorCodeOrderLineNotFound:   "Order line not found",
+	ErrorCodeOrderExists:         "Order already exists",
+	ErrorCodeWebhookNotFound:     "Webhook not found",
+	ErrorCodeDeliveryNotFound:    "Webhook delivery not found",
+	ErrorCodeAdjustmentNotFound:  "Adjustment not found",
+	ErrorCodeAdjustmentDecided:   "Adjustment already decided",
+	ErrorCodeSameOperator:        "Adjustment must be decided by another operator",
+	ErrorCodeReservationExists:   "Reservation already exists",
+	ErrorCodeAlreadyCaptured:     "Reservation already captured",
+	ErrorCodeAlreadyCancelled:    "Reservation already cancelled",
+	ErrorCodeInsufficientFunds:   "Insufficient funds",
+	ErrorCodeAccountFrozen:       "Account is frozen",
+	ErrorCodeAccountClosed:       "Account is closed",
+	ErrorCodeLimitExceeded:       "Limit exceeded",
+	ErrorCodeLimitNotFound:       "Limit not found",
+	ErrorCodeRequestCanceled:     "Request canceled",
+	ErrorCodeTimeout:             "Request timeout",
+	ErrorCodeInternal:            "Internal server error",
+}
+
+// NewApiError создает ошибку с кодом code, title берется по коду
+func NewApiError(status int, code string, detail string) ApiError {
+	title, ok := errorTitles[code]
+	if !ok {
+		title = http.StatusText(status)
+	}
+
+	return ApiError{
+		Type:    problemTypeBase + code,
+		Title:   title,
+		Status:  status,
+		Detail:  detail,
+		Code:    code,
+		Message: detail,
+	}
+}
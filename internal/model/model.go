@@ -1,6 +1,213 @@
 package model
 
-import "time"
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// типы транзакций (public.transaction_type)
+const (
+	TransactionTypeReserve = 1
+	TransactionTypeCapture = 2
+	TransactionTypeCancel  = 3
+	TransactionTypeDeposit = 4
+	// TransactionTypeWithdrawal - списание с баланса оператором (balancectl debit)
+	TransactionTypeWithdrawal = 5
+	// TransactionTypeAdjustment - одобренная ручная корректировка, сумма со знаком: отрицательная - списание
+	TransactionTypeAdjustment = 6
+)
+
+// TransactionStatus - результат функции save_transaction
+type TransactionStatus int
+
+const (
+	// TransactionStatusOk - добавление/обновление произошло успешно
+	TransactionStatusOk TransactionStatus = iota + 1
+	// TransactionStatusReservationExists - резервация с такими orderId, userId, serviceId уже существует
+	TransactionStatusReservationExists
+	// TransactionStatusInsufficientFunds - на балансе недостаточно средств для резервации
+	TransactionStatusInsufficientFunds
+	// TransactionStatusCaptureNotFound - подтверждаемая резервация не найдена
+	TransactionStatusCaptureNotFound
+	// TransactionStatusCaptureAlreadyCaptured - выручка по резервации уже признана
+	TransactionStatusCaptureAlreadyCaptured
+	// TransactionStatusCaptureAlreadyCancelled - подтверждаемая резервация уже отменена
+	TransactionStatusCaptureAlreadyCancelled
+	// TransactionStatusCancelNotFound - отменяемая резервация не найдена
+	TransactionStatusCancelNotFound
+	// TransactionStatusCancelAlreadyCancelled - резервация уже отменена
+	TransactionStatusCancelAlreadyCancelled
+	// TransactionStatusCancelAlreadyCaptured - отменяемая резервация уже подтверждена
+	TransactionStatusCancelAlreadyCaptured
+	// TransactionStatusBalanceNotFound - баланс пользователя не найден
+	TransactionStatusBalanceNotFound
+	// TransactionStatusAccountFrozen - операцию запрещает заморозка счета пользователя
+	TransactionStatusAccountFrozen
+	// TransactionStatusAccountClosed - счет пользователя закрыт
+	TransactionStatusAccountClosed
+	// TransactionStatusTransactionLimitExceeded - сумма больше лимита одной операции
+	TransactionStatusTransactionLimitExceeded
+	// TransactionStatusDailyLimitExceeded - с операцией превышен суточный лимит
+	TransactionStatusDailyLimitExceeded
+	// TransactionStatusMonthlyLimitExceeded - с операцией превышен месячный лимит
+	TransactionStatusMonthlyLimitExceeded
+)
+
+// LimitPeriod возвращает период превышенного лимита для статусов 13-15, для остальных статусов - false
+func (s TransactionStatus) LimitPeriod() (LimitPeriod, bool) {
+	switch s {
+	case TransactionStatusTransactionLimitExceeded:
+		return LimitPerTransaction, true
+	case TransactionStatusDailyLimitExceeded:
+		return LimitDaily, true
+	case TransactionStatusMonthlyLimitExceeded:
+		return LimitMonthly, true
+	default:
+		return "", false
+	}
+}
+
+// Operation - id и время изменения баланса. Задаются в Go (clock.Clock, idgen.Generator), а не в бд, чтобы
+// поведение, зависящее от времени, воспроизводилось в тестах. Id - id новой транзакции (пополнение, резервация)
+// и id события outbox
+type Operation struct {
+	Id   string
+	Time time.Time
+}
+
+// AccountStatus - статус счета пользователя (public.account_status)
+type AccountStatus string
+
+const (
+	// AccountActive - ограничений нет, статус счетов, для которых он не задавался
+	AccountActive AccountStatus = "active"
+	// AccountFrozenDebit - запрещено уменьшать доступный баланс: резервации, списания, корректировки-списания
+	AccountFrozenDebit AccountStatus = "frozen-debit"
+	// AccountFrozenAll - запрещено любое движение денег, в том числе пополнения, подтверждение и отмена резерваций
+	AccountFrozenAll AccountStatus = "frozen-all"
+	// AccountClosed - счет закрыт, операции запрещены как при frozen-all
+	AccountClosed AccountStatus = "closed"
+)
+
+// Restriction повторяет account_restriction в бд: TransactionStatusOk, если статус разрешает операцию, иначе
+// TransactionStatusAccountFrozen или TransactionStatusAccountClosed. debit - операция уменьшает доступный баланс
+func (s AccountStatus) Restriction(debit bool) TransactionStatus {
+	switch {
+	case s == AccountClosed:
+		return TransactionStatusAccountClosed
+	case s == AccountFrozenAll, s == AccountFrozenDebit && debit:
+		return TransactionStatusAccountFrozen
+	default:
+		return TransactionStatusOk
+	}
+}
+
+// Account - статус счета пользователя, причина и кто (UpdatedBy) и когда его задал
+type Account struct {
+	UserId     string
+	Status     AccountStatus
+	Reason     string
+	UpdatedBy  string
+	UpdateTime time.Time
+}
+
+// LimitOperation - операция, на которую действует лимит
+type LimitOperation string
+
+const (
+	LimitDeposit  LimitOperation = "deposit"
+	LimitReserve  LimitOperation = "reserve"
+	LimitWithdraw LimitOperation = "withdraw"
+)
+
+// LimitPeriod - за что считается лимит: одна операция, календарные сутки или месяц UTC
+type LimitPeriod string
+
+const (
+	LimitPerTransaction LimitPeriod = "transaction"
+	LimitDaily          LimitPeriod = "day"
+	LimitMonthly        LimitPeriod = "month"
+)
+
+// LimitOperations и LimitPeriods - все операции и периоды в порядке вывода
+var (
+	LimitOperations = []LimitOperation{LimitDeposit, LimitReserve, LimitWithdraw}
+	LimitPeriods    = []LimitPeriod{LimitPerTransaction, LimitDaily, LimitMonthly}
+)
+
+// Window - границы [from, to) периода, в который попадает at, для LimitPerTransaction - false
+func (p LimitPeriod) Window(at time.Time) (time.Time, time.Time, bool) {
+	at = at.UTC()
+
+	switch p {
+	case LimitDaily:
+		from := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, time.UTC)
+		return from, from.AddDate(0, 0, 1), true
+	case LimitMonthly:
+		from := time.Date(at.Year(), at.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return from, from.AddDate(0, 1, 0), true
+	default:
+		return time.Time{}, time.Time{}, false
+	}
+}
+
+// LimitScope - на кого задан лимит. Действует самый частный: пользователя, затем уровня пользователя, затем глобальный
+type LimitScope string
+
+const (
+	LimitGlobal LimitScope = "global"
+	LimitTier   LimitScope = "tier"
+	LimitUser   LimitScope = "user"
+)
+
+// LimitRule - лимит Amount на операцию за период. ScopeId - уровень для LimitTier, id пользователя для LimitUser,
+// для LimitGlobal пустой
+type LimitRule struct {
+	Scope      LimitScope
+	ScopeId    string
+	Operation  LimitOperation
+	Period     LimitPeriod
+	Amount     float64
+	UpdatedBy  string
+	UpdateTime time.Time
+}
+
+// UserTier - уровень пользователя для лимитов уровня
+type UserTier struct {
+	UserId     string
+	Tier       string
+	UpdatedBy  string
+	UpdateTime time.Time
+}
+
+// LimitUsage - действующий лимит пользователя и сколько от него использовано в текущем периоде.
+// Для LimitPerTransaction Used - 0, а ResetTime не задано
+type LimitUsage struct {
+	Rule      LimitRule
+	Used      float64
+	Remaining float64
+	ResetTime *time.Time
+}
+
+// UserLimits - уровень пользователя (nil - не задан) и его действующие лимиты с использованием
+type UserLimits struct {
+	UserId string
+	Tier   *string
+	Limits []LimitUsage
+}
+
+// BalanceMismatch - баланс пользователя, не совпадающий с суммой его транзакций: пополнения и корректировки минус списания,
+// действующие и подтвержденные резервации
+type BalanceMismatch struct {
+	UserId   string
+	Balance  float64
+	Expected float64
+}
 
 type IncreaseBalanceTransaction struct {
 	UserId  string
@@ -9,6 +216,7 @@ type IncreaseBalanceTransaction struct {
 }
 
 type Transaction struct {
+	Id                string
 	UserId            string
 	OrderId           *string
 	ServiceId         *string
@@ -19,15 +227,320 @@ type Transaction struct {
 	UpdTime           time.Time
 }
 
+// TransactionState - состояние транзакции до очередного изменения (строка transaction_upd) или текущее состояние
+type TransactionState struct {
+	TransactionTypeId int
+	TransactionType   string
+	Sum               float64
+	Comment           *string
+	UpdTime           time.Time
+}
+
+// TransactionHistory - транзакция и все ее состояния по времени, последнее состояние - текущее
+type TransactionHistory struct {
+	Transaction Transaction
+	States      []TransactionState
+}
+
+// TransactionFilter - фильтры списка транзакций, пустые поля не фильтруют
+type TransactionFilter struct {
+	TransactionTypeIds []int
+	DateFrom           *time.Time
+	DateTo             *time.Time
+	ServiceId          *string
+	OrderId            *string
+	SumFrom            *float64
+	SumTo              *float64
+	Comment            *string
+}
+
+// TransactionCursor - позиция в списке транзакций: значение поля сортировки и id последней транзакции страницы
+type TransactionCursor struct {
+	SortBy   string
+	SortType string
+	UpdTime  time.Time
+	Sum      float64
+	Id       string
+}
+
+// GetTransactionsRequest - запрос страницы транзакций. Если задан Cursor, страница начинается после него, иначе с Offset
 type GetTransactionsRequest struct {
 	UserId   string
+	Filter   TransactionFilter
+	Cursor   *TransactionCursor
 	Offset   int
 	Limit    int
 	SortBy   string
 	SortType string
 }
 
+type TransactionPage struct {
+	Transactions []Transaction
+	Total        int
+	HasMore      bool
+	NextCursor   *TransactionCursor
+}
+
 type ReportRow struct {
 	ServiceName string
 	TotalSum    float64
 }
+
+// BatchOperationStatus - результат операции пакета
+type BatchOperationStatus string
+
+const (
+	// BatchApplied - операция выполнена
+	BatchApplied BatchOperationStatus = "applied"
+	// BatchRolledBack - операция выполнилась, но откатилась вместе с атомарным пакетом
+	BatchRolledBack BatchOperationStatus = "rolled_back"
+	// BatchFailed - операция не выполнена, причина в Err
+	BatchFailed BatchOperationStatus = "failed"
+	// BatchSkipped - операция не выполнялась, атомарный пакет остановился на ошибке раньше
+	BatchSkipped BatchOperationStatus = "skipped"
+)
+
+type BatchOperationResult struct {
+	Status BatchOperationStatus
+	Err    error
+}
+
+// OrderStatus - статус заказа, выводится из состояний строк
+type OrderStatus string
+
+const (
+	// OrderReserved - все строки зарезервированы
+	OrderReserved OrderStatus = "reserved"
+	// OrderPartiallyProcessed - часть строк еще зарезервирована, часть подтверждена или отменена
+	OrderPartiallyProcessed OrderStatus = "partially_processed"
+	// OrderCaptured - выручка признана по всем строкам
+	OrderCaptured OrderStatus = "captured"
+	// OrderCancelled - все строки отменены
+	OrderCancelled OrderStatus = "cancelled"
+	// OrderCompleted - зарезервированных строк нет, часть подтверждена, часть отменена
+	OrderCompleted OrderStatus = "completed"
+)
+
+// Order - заказ пользователя, строки заказа - транзакции с OrderId заказа, по одной на услугу
+type Order struct {
+	Id     string
+	UserId string
+	// ServiceIds - услуги строк, созданных заказом, по ним строки отличаются от резерваций api v1 с тем же OrderId
+	ServiceIds []string
+	CreateTime time.Time
+	Lines      []Transaction
+}
+
+// Status выводит статус заказа из типов транзакций строк
+func (o Order) Status() OrderStatus {
+	counts := make(map[int]int, 3)
+
+	for _, line := range o.Lines {
+		counts[line.TransactionTypeId]++
+	}
+
+	switch len(o.Lines) {
+	case counts[TransactionTypeReserve]:
+		return OrderReserved
+	case counts[TransactionTypeCapture]:
+		return OrderCaptured
+	case counts[TransactionTypeCancel]:
+		return OrderCancelled
+	}
+
+	if counts[TransactionTypeReserve] > 0 {
+		return OrderPartiallyProcessed
+	}
+
+	return OrderCompleted
+}
+
+// типы событий outbox
+const (
+	EventDeposit    = "deposit"
+	EventWithdrawal = "withdrawal"
+	EventAdjustment = "adjustment"
+	EventReserved   = "reserved"
+	EventCaptured   = "captured"
+	EventCancelled  = "cancelled"
+	// EventBalance - снимок баланса, первое сообщение потока баланса без Last-Event-ID
+	EventBalance = "balance"
+)
+
+// Event - событие об изменении баланса из outbox. Sequence растет в порядке операций пользователя
+type Event struct {
+	Sequence   int64
+	Id         string
+	Type       string
+	UserId     string
+	Payload    []byte
+	CreateTime time.Time
+}
+
+// WebhookDeliveryStatus - состояние доставки события подписчику webhook
+type WebhookDeliveryStatus string
+
+const (
+	// WebhookPending - ждет отправки или повторной попытки
+	WebhookPending WebhookDeliveryStatus = "pending"
+	// WebhookDelivered - подписчик ответил 2xx
+	WebhookDelivered WebhookDeliveryStatus = "delivered"
+	// WebhookDead - попытки исчерпаны, доставить можно только вручную
+	WebhookDead WebhookDeliveryStatus = "dead"
+)
+
+// WebhookSubscription - подписка на события, ServiceId - фильтр по услуге
+type WebhookSubscription struct {
+	Id         string
+	Url        string
+	EventTypes []string
+	ServiceId  *string
+	Secret     string
+	CreateTime time.Time
+}
+
+// WebhookDelivery - доставка события подписке. Url и Secret подписки заполняются при выборке на отправку
+type WebhookDelivery struct {
+	Id              string
+	SubscriptionId  string
+	Event           Event
+	Status          WebhookDeliveryStatus
+	Attempts        int
+	NextAttemptTime time.Time
+	LastAttemptTime *time.Time
+	LastStatusCode  *int
+	LastError       *string
+
+	Url    string
+	Secret string
+}
+
+// AdjustmentStatus - состояние ручной корректировки баланса
+type AdjustmentStatus string
+
+const (
+	// AdjustmentPending - ждет решения второго оператора
+	AdjustmentPending AdjustmentStatus = "pending"
+	// AdjustmentApproved - одобрена и проведена транзакцией корректировки
+	AdjustmentApproved AdjustmentStatus = "approved"
+	// AdjustmentRejected - отклонена, баланс не менялся
+	AdjustmentRejected AdjustmentStatus = "rejected"
+)
+
+// направления корректировки
+const (
+	AdjustmentCredit = "credit"
+	AdjustmentDebit  = "debit"
+)
+
+// Adjustment - ручная корректировка баланса (maker-checker): ProposedBy предлагает, другой оператор DecidedBy
+// одобряет или отклоняет. TransactionId - транзакция корректировки, есть только у одобренной
+type Adjustment struct {
+	Id              string
+	UserId          string
+	Direction       string
+	Sum             float64
+	Reason          string
+	Ticket          string
+	Status          AdjustmentStatus
+	ProposedBy      string
+	ProposeTime     time.Time
+	DecidedBy       *string
+	DecisionTime    *time.Time
+	DecisionComment *string
+	TransactionId   *string
+}
+
+// SignedSum - сумма транзакции корректировки: списание отрицательное
+func (a Adjustment) SignedSum() float64 {
+	if a.Direction == AdjustmentDebit {
+		return -a.Sum
+	}
+
+	return a.Sum
+}
+
+// AuditEntry - запись журнала аудита (public.audit_log): изменение строки Entity с id EntityId операцией Operation.
+// Before и After - строка до и после изменения в json (Before нет у вставки, After - у удаления).
+// Id - порядок добавления, Sequence, PrevHash и Hash задаются при запечатывании, до него они пустые
+type AuditEntry struct {
+	Id       int64
+	Sequence int64
+	Time     time.Time
+	Actor    string
+	// DbUser - пользователь соединения с бд (session_user), в отличие от Actor его не задает клиент
+	DbUser     string
+	AuthMethod string
+	RequestId  string
+	SourceIp   string
+	Operation  string
+	Entity     string
+	EntityId   string
+	Action     string
+	Before     *string
+	After      *string
+	PrevHash   string
+	Hash       string
+}
+
+// ComputeHash считает хеш записи: HMAC-SHA256 с ключом key от предыдущего хеша и полей записи,
+// каждое поле - "<длина в символах>:<значение>", чтобы нельзя было перенести символы из одного поля в соседнее
+func (e AuditEntry) ComputeHash(key []byte) string {
+	var b strings.Builder
+
+	for _, field := range []string{
+		e.PrevHash,
+		strconv.FormatInt(e.Sequence, 10),
+		e.Time.UTC().Format("2006-01-02T15:04:05.000000"),
+		e.Actor,
+		e.DbUser,
+		e.AuthMethod,
+		e.RequestId,
+		e.SourceIp,
+		e.Operation,
+		e.Entity,
+		e.EntityId,
+		e.Action,
+		optional(e.Before),
+		optional(e.After),
+	} {
+		b.WriteString(strconv.Itoa(utf8.RuneCountInString(field)))
+		b.WriteString(":")
+		b.WriteString(field)
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(b.String()))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func optional(value *string) string {
+	if value == nil {
+		return ""
+	}
+
+	return *value
+}
+
+// AuditProblem - нарушение журнала аудита у записи Sequence
+type AuditProblem struct {
+	Sequence int64
+	Problem  string
+}
+
+// AuditVerification - результат проверки журнала аудита. LastSequence и LastHash - последняя запись, их стоит сохранять
+// вне бд: удаление записей с конца журнала цепочка хешей не показывает. Unsealed - записи, еще не запечатанные сервисом
+type AuditVerification struct {
+	Entries      int64
+	LastSequence int64
+	LastHash     string
+	Unsealed     int64
+	Problems     []AuditProblem
+}
+
+// AuditAnchor - последняя запись журнала аудита, сохраненная вне бд при прошлой проверке
+type AuditAnchor struct {
+	Sequence int64
+	Hash     string
+}
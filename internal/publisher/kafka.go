@@ -0,0 +1,45 @@
+package publisher
+
+import (
+	"context"
+
+	"github.com/avito-test/internal/model"
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaPublisher публикует события в топик, ключ сообщения - id пользователя,
+// поэтому события одного пользователя попадают в одну партицию и читаются по порядку
+type KafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+func NewKafkaPublisher(brokers []string, topic string) *KafkaPublisher {
+	return &KafkaPublisher{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+		},
+	}
+}
+
+func (p *KafkaPublisher) Publish(ctx context.Context, event model.Event) error {
+	data, err := Encode(event)
+	if err != nil {
+		return err
+	}
+
+	return p.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(event.UserId),
+		Value: data,
+		Headers: []kafka.Header{
+			{Key: "event-id", Value: []byte(event.Id)},
+			{Key: "event-type", Value: []byte(event.Type)},
+		},
+	})
+}
+
+func (p *KafkaPublisher) Close() error {
+	return p.writer.Close()
+}
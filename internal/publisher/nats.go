@@ -0,0 +1,46 @@
+package publisher
+
+import (
+	"context"
+
+	"github.com/avito-test/internal/model"
+	"github.com/nats-io/nats.go"
+)
+
+// NatsPublisher публикует события в JetStream в subject <subject>.<тип события>.
+// id события передается в Nats-Msg-Id, повторная публикация в окне дедупликации стрима отбрасывается
+type NatsPublisher struct {
+	conn    *nats.Conn
+	js      nats.JetStreamContext
+	subject string
+}
+
+func NewNatsPublisher(url string, subject string) (*NatsPublisher, error) {
+	conn, err := nats.Connect(url)
+	if err != nil {
+		return nil, err
+	}
+
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &NatsPublisher{conn: conn, js: js, subject: subject}, nil
+}
+
+func (p *NatsPublisher) Publish(ctx context.Context, event model.Event) error {
+	data, err := Encode(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.js.Publish(p.subject+"."+event.Type, data, nats.MsgId(event.Id), nats.Context(ctx))
+
+	return err
+}
+
+func (p *NatsPublisher) Close() error {
+	return p.conn.Drain()
+}
@@ -0,0 +1,59 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/avito-test/internal/config"
+	"github.com/avito-test/internal/model"
+)
+
+// Publisher публикует события outbox. Publish возвращается только после того, как брокер принял событие,
+// ошибка означает, что событие нужно опубликовать повторно
+type Publisher interface {
+	Publish(ctx context.Context, event model.Event) error
+	Close() error
+}
+
+// New создает публикатор по config.OutboxPublisher, для "none" - nil
+func New() (Publisher, error) {
+	switch config.OutboxPublisher {
+	case "kafka":
+		return NewKafkaPublisher(config.KafkaBrokers, config.KafkaTopic), nil
+	case "nats":
+		return NewNatsPublisher(config.NatsUrl, config.NatsSubject)
+	case "file":
+		return NewFilePublisher(config.OutboxFile)
+	case "stdout":
+		return NewWriterPublisher(os.Stdout), nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown outbox publisher %q", config.OutboxPublisher)
+	}
+}
+
+// message - формат события у подписчиков
+type message struct {
+	Id       string          `json:"id"`
+	Sequence int64           `json:"sequence"`
+	Type     string          `json:"type"`
+	UserId   string          `json:"userId"`
+	Time     time.Time       `json:"time"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// Encode сериализует событие в формат сообщения подписчика, этот же формат отправляется в webhook
+func Encode(event model.Event) ([]byte, error) {
+	return json.Marshal(message{
+		Id:       event.Id,
+		Sequence: event.Sequence,
+		Type:     event.Type,
+		UserId:   event.UserId,
+		Time:     event.CreateTime,
+		Data:     event.Payload,
+	})
+}
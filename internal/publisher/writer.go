@@ -0,0 +1,52 @@
+package publisher
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/avito-test/internal/model"
+)
+
+// WriterPublisher пишет события построчно в json, для локального запуска и тестов
+type WriterPublisher struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterPublisher(w io.Writer) *WriterPublisher {
+	return &WriterPublisher{w: w}
+}
+
+// NewFilePublisher дописывает события в файл path
+func NewFilePublisher(path string) (*WriterPublisher, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWriterPublisher(file), nil
+}
+
+func (p *WriterPublisher) Publish(_ context.Context, event model.Event) error {
+	data, err := Encode(event)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, err = p.w.Write(append(data, '\n'))
+
+	return err
+}
+
+func (p *WriterPublisher) Close() error {
+	if closer, ok := p.w.(io.Closer); ok && p.w != os.Stdout {
+		return closer.Close()
+	}
+
+	return nil
+}
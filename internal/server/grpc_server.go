@@ -0,0 +1,298 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	balancev1 "github.com/avito-test/api/balance/v1"
+	valid "github.com/avito-test/internal/config/validator"
+	"github.com/avito-test/internal/dto"
+	"github.com/avito-test/internal/model"
+	"github.com/avito-test/internal/service"
+	"github.com/go-playground/validator/v10"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const errorDomain = "balance-service"
+
+type grpcServer struct {
+	balancev1.UnimplementedBalanceServiceServer
+
+	validator          *validator.Validate
+	balanceService     *service.BalanceService
+	transactionService *service.TransactionService
+	reportService      *service.ReportService
+}
+
+func NewGrpcServer(services *Services) *grpcServer {
+	return &grpcServer{
+		validator:          valid.GetValidator(),
+		balanceService:     services.Balance,
+		transactionService: services.Transaction,
+		reportService:      services.Report,
+	}
+}
+
+func (s *grpcServer) GetBalance(ctx context.Context, request *balancev1.GetBalanceRequest) (*balancev1.GetBalanceResponse, error) {
+	if err := s.validator.Var(request.GetUserId(), "uuid"); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "parameter userId should be uuid")
+	}
+
+	balance, err := s.balanceService.GetBalanceByUserID(ctx, request.GetUserId())
+	if err != nil {
+		return nil, s.serviceError(ctx, err)
+	}
+
+	return &balancev1.GetBalanceResponse{Balance: balance}, nil
+}
+
+func (s *grpcServer) IncreaseBalance(ctx context.Context, request *balancev1.IncreaseBalanceRequest) (*balancev1.IncreaseBalanceResponse, error) {
+	requestDto := dto.IncreaseBalanceRequest{
+		UserId:  &request.UserId,
+		Sum:     &request.Sum,
+		Comment: request.Comment,
+	}
+
+	if err := s.validate(requestDto); err != nil {
+		return nil, err
+	}
+
+	if err := s.balanceService.AddBalance(ctx, increaseBalanceTransaction(requestDto)); err != nil {
+		return nil, s.serviceError(ctx, err)
+	}
+
+	return &balancev1.IncreaseBalanceResponse{}, nil
+}
+
+func (s *grpcServer) Reserve(ctx context.Context, request *balancev1.ReserveRequest) (*balancev1.ReserveResponse, error) {
+	if err := s.saveTransaction(ctx, request.GetKey(), request.Sum, request.Comment, s.transactionService.Reserve); err != nil {
+		return nil, err
+	}
+
+	return &balancev1.ReserveResponse{}, nil
+}
+
+func (s *grpcServer) Capture(ctx context.Context, request *balancev1.CaptureRequest) (*balancev1.CaptureResponse, error) {
+	if err := s.saveTransaction(ctx, request.GetKey(), request.Sum, request.Comment, s.transactionService.Capture); err != nil {
+		return nil, err
+	}
+
+	return &balancev1.CaptureResponse{}, nil
+}
+
+func (s *grpcServer) Cancel(ctx context.Context, request *balancev1.CancelRequest) (*balancev1.CancelResponse, error) {
+	if err := s.saveTransaction(ctx, request.GetKey(), request.Sum, request.Comment, s.transactionService.Cancel); err != nil {
+		return nil, err
+	}
+
+	return &balancev1.CancelResponse{}, nil
+}
+
+func (s *grpcServer) ListTransactions(ctx context.Context, request *balancev1.ListTransactionsRequest) (*balancev1.ListTransactionsResponse, error) {
+	requestDto := dto.GetTransactionsRequest{
+		UserId:    &request.UserId,
+		Cursor:    request.Cursor,
+		ServiceId: request.ServiceId,
+		OrderId:   request.OrderId,
+		SumFrom:   request.SumFrom,
+		SumTo:     request.SumTo,
+		Comment:   request.Comment,
+	}
+
+	if request.Page != nil {
+		page := int(request.GetPage())
+		requestDto.Page = &page
+	}
+
+	for _, transactionType := range request.GetTransactionTypes() {
+		requestDto.TransactionTypes = append(requestDto.TransactionTypes, int(transactionType))
+	}
+
+	if request.DateFrom != nil {
+		dateFrom := request.GetDateFrom().AsTime().Format(time.RFC3339Nano)
+		requestDto.DateFrom = &dateFrom
+	}
+
+	if request.DateTo != nil {
+		dateTo := request.GetDateTo().AsTime().Format(time.RFC3339Nano)
+		requestDto.DateTo = &dateTo
+	}
+
+	if request.ItemsPerPage != nil {
+		itemsPerPage := int(request.GetItemsPerPage())
+		requestDto.ItemsPerPage = &itemsPerPage
+	}
+
+	if request.GetSortBy() != balancev1.ListTransactionsRequest_SORT_BY_UNSPECIFIED {
+		sortBy := map[balancev1.ListTransactionsRequest_SortBy]string{
+			balancev1.ListTransactionsRequest_SORT_BY_DATE: "date",
+			balancev1.ListTransactionsRequest_SORT_BY_SUM:  "sum",
+		}[request.GetSortBy()]
+		requestDto.SortBy = &sortBy
+	}
+
+	if request.GetSortType() != balancev1.ListTransactionsRequest_SORT_TYPE_UNSPECIFIED {
+		sortType := map[balancev1.ListTransactionsRequest_SortType]string{
+			balancev1.ListTransactionsRequest_SORT_TYPE_DESC: "desc",
+			balancev1.ListTransactionsRequest_SORT_TYPE_ASC:  "asc",
+		}[request.GetSortType()]
+		requestDto.SortType = &sortType
+	}
+
+	if err := s.validate(requestDto); err != nil {
+		return nil, err
+	}
+
+	transactionsRequest, err := getTransactionsRequest(requestDto)
+	if err != nil {
+		return nil, s.serviceError(ctx, err)
+	}
+
+	page, err := s.transactionService.GetTransactions(ctx, transactionsRequest)
+	if err != nil {
+		return nil, s.serviceError(ctx, err)
+	}
+
+	response := &balancev1.ListTransactionsResponse{
+		Transactions: make([]*balancev1.Transaction, 0, len(page.Transactions)),
+		NextCursor:   encodeCursor(page.NextCursor),
+		HasMore:      page.HasMore,
+		Total:        int32(page.Total),
+		ItemsPerPage: int32(transactionsRequest.Limit),
+	}
+
+	for _, tr := range page.Transactions {
+		response.Transactions = append(response.Transactions, &balancev1.Transaction{
+			Id:              tr.Id,
+			OrderId:         tr.OrderId,
+			ServiceId:       tr.ServiceId,
+			Sum:             tr.Sum,
+			TransactionType: tr.TransactionType,
+			Comment:         tr.Comment,
+			Date:            timestamppb.New(tr.UpdTime),
+		})
+	}
+
+	return response, nil
+}
+
+func (s *grpcServer) CreateReport(ctx context.Context, request *balancev1.CreateReportRequest) (*balancev1.CreateReportResponse, error) {
+	year := int(request.GetYear())
+	month := int(request.GetMonth())
+
+	requestDto := dto.CreateReportRequest{
+		Year:  &year,
+		Month: &month,
+	}
+
+	if err := s.validate(requestDto); err != nil {
+		return nil, err
+	}
+
+	id, err := s.reportService.CreateReport(ctx, reportDate(requestDto))
+	if err != nil {
+		return nil, s.serviceError(ctx, err)
+	}
+
+	return &balancev1.CreateReportResponse{Url: reportURL(id)}, nil
+}
+
+func (s *grpcServer) saveTransaction(ctx context.Context, key *balancev1.ReservationKey, sum float64, comment *string, save func(context.Context, model.Transaction) error) error {
+	// тип транзакции задается методом, для валидации берем любой допустимый
+	transactionType := model.TransactionTypeReserve
+
+	requestDto := dto.SaveTransactionRequest{
+		UserId:            &key.UserId,
+		OrderId:           &key.OrderId,
+		ServiceId:         &key.ServiceId,
+		Sum:               &sum,
+		TransactionTypeId: &transactionType,
+		Comment:           comment,
+	}
+
+	if err := s.validate(requestDto); err != nil {
+		return err
+	}
+
+	if err := save(ctx, reservationTransaction(requestDto.UserId, requestDto.OrderId, requestDto.ServiceId, requestDto.Sum, requestDto.Comment)); err != nil {
+		return s.serviceError(ctx, err)
+	}
+
+	return nil
+}
+
+// validate проверяет запрос, невалидные поля передаются в BadRequest
+func (s *grpcServer) validate(request any) error {
+	err := validateRequest(s.validator, request)
+	if err == nil {
+		return nil
+	}
+
+	var validationErr *validationError
+	if !errors.As(err, &validationErr) {
+		return status.Error(codes.Internal, internalServerError.Error())
+	}
+
+	badRequest := &errdetails.BadRequest{}
+
+	for _, param := range validationErr.invalidParams {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       param.Name,
+			Description: param.Reason,
+		})
+	}
+
+	st, detailsErr := status.New(codes.InvalidArgument, validationErr.Error()).WithDetails(badRequest)
+	if detailsErr != nil {
+		return status.Error(codes.InvalidArgument, validationErr.Error())
+	}
+
+	return st.Err()
+}
+
+// serviceError переводит ошибку сервиса в статус grpc, причина ошибки передается в ErrorInfo
+func (s *grpcServer) serviceError(ctx context.Context, err error) error {
+	var code codes.Code
+	var reason string
+	var requestErr *requestError
+
+	switch {
+	case errors.As(err, &requestErr):
+		return status.Error(codes.InvalidArgument, requestErr.Error())
+	case errors.Is(err, s.balanceService.BalanceNotFoundErr), errors.Is(err, s.transactionService.BalanceNotFoundErr):
+		code, reason = codes.NotFound, "BALANCE_NOT_FOUND"
+	case errors.Is(err, s.transactionService.ReservationExistsErr):
+		code, reason = codes.AlreadyExists, "RESERVATION_EXISTS"
+	case errors.Is(err, s.transactionService.InsufficientFundsErr):
+		code, reason = codes.FailedPrecondition, "INSUFFICIENT_FUNDS"
+	case errors.Is(err, s.transactionService.TransactionNotFoundErr):
+		code, reason = codes.NotFound, "TRANSACTION_NOT_FOUND"
+	case errors.Is(err, s.transactionService.AlreadyCapturedErr):
+		code, reason = codes.FailedPrecondition, "ALREADY_CAPTURED"
+	case errors.Is(err, s.transactionService.AlreadyCancelledErr):
+		code, reason = codes.FailedPrecondition, "ALREADY_CANCELLED"
+	case errors.Is(err, s.balanceService.AccountFrozenErr), errors.Is(err, s.transactionService.AccountFrozenErr):
+		code, reason = codes.FailedPrecondition, "ACCOUNT_FROZEN"
+	case errors.Is(err, s.balanceService.AccountClosedErr), errors.Is(err, s.transactionService.AccountClosedErr):
+		code, reason = codes.FailedPrecondition, "ACCOUNT_CLOSED"
+	case errors.Is(err, s.balanceService.LimitExceededErr), errors.Is(err, s.transactionService.LimitExceededErr):
+		code, reason = codes.FailedPrecondition, "LIMIT_EXCEEDED"
+	case isCanceled(ctx, err):
+		return status.Error(codes.Canceled, "request canceled")
+	case isTimeout(err):
+		return status.Error(codes.DeadlineExceeded, "request timeout")
+	default:
+		return status.Error(codes.Internal, internalServerError.Error())
+	}
+
+	st, detailsErr := status.New(code, err.Error()).WithDetails(&errdetails.ErrorInfo{Reason: reason, Domain: errorDomain})
+	if detailsErr != nil {
+		return status.Error(code, err.Error())
+	}
+
+	return st.Err()
+}
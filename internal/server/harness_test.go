@@ -0,0 +1,310 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/avito-test/internal/config"
+	"github.com/avito-test/internal/config/auth"
+	"github.com/avito-test/internal/config/clock"
+	"github.com/avito-test/internal/config/idgen"
+	"github.com/avito-test/internal/config/ratelimit"
+	"github.com/avito-test/internal/server"
+	"github.com/avito-test/internal/service"
+	"github.com/avito-test/internal/storage/memory"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// Http тесты: сервер собирается из сервисов с хранилищем в памяти, Manual часов и Sequence id, поэтому ответы
+// детерминированы и сравниваются с golden файлами testdata/<тест>.golden.json. После намеренного изменения
+// ответов golden файлы перезаписываются: go test ./internal/server/ -update
+
+var update = flag.Bool("update", false, "перезаписать golden файлы")
+
+// api ключи тестов, роли - роли по умолчанию из auth.Policy
+const (
+	adminKey   = "admin-key"
+	supportKey = "support-key"
+	paymentKey = "payment-key"
+)
+
+// start - время первой операции, часы сервисов сдвигаются на секунду при каждом чтении,
+// чтобы транзакции различались по дате. Часы сервера (логи, лимиты запросов) стоят на месте
+var start = time.Date(2022, time.November, 1, 10, 0, 0, 0, time.UTC)
+
+// routes - все маршруты роутера ("<метод> <шаблон пути>"), covered - по которым был хотя бы один запрос
+var (
+	coveredMu sync.Mutex
+	routes    = make(map[string]bool)
+	covered   = make(map[string]bool)
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+
+	dir, err := os.MkdirTemp("", "http-test")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	code := run(m, dir)
+
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func run(m *testing.M, dir string) int {
+	keys, err := json.Marshal([]map[string]interface{}{
+		{"key": adminKey, "principal": "admin", "roles": []string{"admin"}},
+		{"key": supportKey, "principal": "support", "roles": []string{"support"}},
+		{"key": paymentKey, "principal": "payment-service", "roles": []string{"payment-service"}},
+	})
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	config.AuthEnabled = true
+	config.AuthApiKeysFile = filepath.Join(dir, "api_keys.json")
+	config.AuthRolesFile = ""
+	config.LogBody = false
+
+	if err := os.WriteFile(config.AuthApiKeysFile, keys, 0600); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	code := m.Run()
+
+	// проверка покрытия имеет смысл только при запуске всех тестов
+	if code == 0 && flag.Lookup("test.run").Value.String() == "" {
+		if missing := uncoveredRoutes(); len(missing) > 0 {
+			fmt.Printf("routes without http tests: %s\n", strings.Join(missing, ", "))
+			return 1
+		}
+	}
+
+	return code
+}
+
+type harness struct {
+	router *mux.Router
+}
+
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+
+	storage := memory.NewStorage()
+
+	// время и id операций задают сервисы, время бд для webhook - те же часы
+	operationClock := clock.NewManual(start, time.Second)
+	operationIds := idgen.NewSequence(1)
+
+	repos := memory.NewRepos(storage, operationClock)
+	transactor := memory.NewTransactor(storage, repos)
+
+	transactionService := service.NewTransactionService(repos.Transaction, operationClock, operationIds)
+
+	services := &server.Services{
+		Balance:     service.NewBalanceService(repos.Balance, operationClock, operationIds),
+		Transaction: transactionService,
+		Report:      service.NewReportService(memory.NewReportRepo(storage), t.TempDir(), operationIds),
+		Batch:       service.NewBatchService(transactionService, repos, transactor),
+		Order:       service.NewOrderService(transactionService, repos, transactor, operationClock),
+		Webhook:     service.NewWebhookService(repos.Webhook, operationClock, operationIds, rand.New(rand.NewSource(1))),
+		Adjustment:  service.NewAdjustmentService(repos.Adjustment, transactor, operationClock, operationIds),
+		Account:     service.NewAccountService(repos.Account, operationClock),
+		Limit:       service.NewLimitService(repos.Limit, operationClock),
+	}
+
+	authenticator, err := auth.NewAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := auth.NewPolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clk := clock.NewManual(start, 0)
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	httpServer := server.NewHttpServer(server.HttpDeps{
+		Services:      services,
+		Authenticator: authenticator,
+		Policy:        policy,
+		RateLimit:     ratelimit.NewMemoryBackend(clk),
+		Logger:        log,
+		Clock:         clk,
+		Ids:           idgen.NewSequence(2),
+	})
+
+	router, err := httpServer.Router()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	coveredMu.Lock()
+	defer coveredMu.Unlock()
+
+	_ = router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		routes[routeName(route)] = true
+		return nil
+	})
+
+	return &harness{router: router}
+}
+
+// do выполняет запрос с api ключом key (пустой - без аутентификации), body кодируется в json, строка передается как есть
+func (h *harness) do(t *testing.T, method string, path string, key string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var reader io.Reader
+
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(b)
+	default:
+		encoded, err := json.Marshal(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reader = bytes.NewReader(encoded)
+	}
+
+	r := httptest.NewRequest(method, path, reader)
+	if key != "" {
+		r.Header.Set(auth.ApiKeyHeader, key)
+	}
+
+	var match mux.RouteMatch
+	if h.router.Match(r, &match) && match.Route != nil {
+		coveredMu.Lock()
+		covered[routeName(match.Route)] = true
+		coveredMu.Unlock()
+	}
+
+	w := httptest.NewRecorder()
+	h.router.ServeHTTP(w, r)
+
+	return w
+}
+
+// json выполняет запрос и декодирует ответ в v, статус ответа должен быть status
+func (h *harness) json(t *testing.T, method string, path string, key string, body interface{}, status int, v interface{}) {
+	t.Helper()
+
+	w := h.do(t, method, path, key, body)
+	if w.Code != status {
+		t.Fatalf("%s %s: status %d, want %d, body %s", method, path, w.Code, status, w.Body.String())
+	}
+
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+}
+
+// golden сравнивает статус, тип и тело ответа с testdata/<имя теста>.golden.json
+func golden(t *testing.T, w *httptest.ResponseRecorder) {
+	t.Helper()
+
+	actual := goldenResponse{
+		Status:      w.Code,
+		ContentType: w.Header().Get("Content-Type"),
+	}
+
+	if body := w.Body.Bytes(); json.Valid(body) {
+		actual.Body = json.RawMessage(body)
+	} else if len(body) > 0 {
+		text, err := json.Marshal(string(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		actual.Body = text
+	}
+
+	encoded, err := json.MarshalIndent(actual, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoded = append(encoded, '\n')
+
+	path := filepath.Join("testdata", strings.ReplaceAll(t.Name(), "/", "__")+".golden.json")
+
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, encoded, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		return
+	}
+
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (go test ./internal/server/ -update создаст golden файл)", err)
+	}
+
+	if !bytes.Equal(expected, encoded) {
+		t.Errorf("response differs from %s\nexpected:\n%s\nactual:\n%s", path, expected, encoded)
+	}
+}
+
+type goldenResponse struct {
+	Status      int             `json:"status"`
+	ContentType string          `json:"contentType,omitempty"`
+	Body        json.RawMessage `json:"body,omitempty"`
+}
+
+func routeName(route *mux.Route) string {
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		template = "?"
+	}
+
+	methods, err := route.GetMethods()
+	if err != nil {
+		methods = []string{"*"}
+	}
+
+	return strings.Join(methods, ",") + " " + template
+}
+
+// uncoveredRoutes - маршруты роутера, по которым не было запросов в тестах
+func uncoveredRoutes() []string {
+	var missing []string
+
+	for name := range routes {
+		if !covered[name] {
+			missing = append(missing, name)
+		}
+	}
+
+	sort.Strings(missing)
+
+	return missing
+}
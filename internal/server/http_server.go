@@ -4,54 +4,88 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"net/http"
-	"reflect"
 	"strconv"
-	"time"
 
+	"github.com/avito-test/internal/config/auth"
+	"github.com/avito-test/internal/config/clock"
+	"github.com/avito-test/internal/config/idgen"
 	"github.com/avito-test/internal/config/logger"
+	"github.com/avito-test/internal/config/ratelimit"
+	"github.com/avito-test/internal/config/requestid"
 	valid "github.com/avito-test/internal/config/validator"
 	"github.com/avito-test/internal/dto"
-	"github.com/avito-test/internal/model"
 	"github.com/avito-test/internal/service"
-	"github.com/avito-test/internal/storage/db"
-	"github.com/avito-test/internal/storage/repo"
 	"github.com/go-playground/validator/v10"
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 )
 
+// StatusClientClosedRequest - нестандартный статус (nginx), клиент отменил запрос не дождавшись ответа
+const StatusClientClosedRequest = 499
+
 type httpServer struct {
-	InternalServerError error
+	InternalServerError  error
+	RequestCanceledError error
+	RequestTimeoutError  error
 
 	validator          *validator.Validate
-	log                *logrus.Logger
+	authenticator      *auth.Authenticator
+	policy             *auth.Policy
+	rateLimitBackend   ratelimit.Backend
+	logger             *logrus.Logger
+	clock              clock.Clock
+	ids                idgen.Generator
 	balanceService     *service.BalanceService
 	transactionService *service.TransactionService
 	reportService      *service.ReportService
+	batchService       *service.BatchService
+	orderService       *service.OrderService
+	webhookService     *service.WebhookService
+	adjustmentService  *service.AdjustmentService
+	accountService     *service.AccountService
+	limitService       *service.LimitService
+	balanceStream      *service.BalanceStream
 }
 
-func NewHttpServer() *httpServer {
-	log := logger.GetLogger()
-
-	dbClient, err := db.NewDbPool(context.Background())
-	if err != nil {
-		log.Fatal(err.Error())
-	}
+// HttpDeps - зависимости http сервера. В main - сервисы с Postgres, системное время и uuid,
+// в тестах - сервисы с хранилищем в памяти, Manual часы и Sequence id
+type HttpDeps struct {
+	Services      *Services
+	Authenticator *auth.Authenticator
+	Policy        *auth.Policy
+	RateLimit     ratelimit.Backend
+	Logger        *logrus.Logger
+	Clock         clock.Clock
+	// Ids - генератор id запросов, если клиент не передал X-Request-ID
+	Ids idgen.Generator
+}
 
-	balanceRepo := repo.NewBalanceRepo(dbClient)
-	transactionRepo := repo.NewTransactionRepo(dbClient)
-	reportRepo := repo.NewReportRepo(dbClient)
+func NewHttpServer(deps HttpDeps) *httpServer {
+	services := deps.Services
 
 	return &httpServer{
-		InternalServerError: errors.New("internal server error"),
+		InternalServerError:  internalServerError,
+		RequestCanceledError: errors.New("request canceled"),
+		RequestTimeoutError:  errors.New("request timeout"),
 
 		validator:          valid.GetValidator(),
-		log:                log,
-		balanceService:     service.NewBalanceService(balanceRepo),
-		transactionService: service.NewTransactionService(transactionRepo),
-		reportService:      service.NewReportService(reportRepo),
+		authenticator:      deps.Authenticator,
+		policy:             deps.Policy,
+		rateLimitBackend:   deps.RateLimit,
+		logger:             deps.Logger,
+		clock:              deps.Clock,
+		ids:                deps.Ids,
+		balanceService:     services.Balance,
+		transactionService: services.Transaction,
+		reportService:      services.Report,
+		batchService:       services.Batch,
+		orderService:       services.Order,
+		webhookService:     services.Webhook,
+		adjustmentService:  services.Adjustment,
+		accountService:     services.Account,
+		limitService:       services.Limit,
+		balanceStream:      services.Stream,
 	}
 }
 
@@ -64,40 +98,30 @@ func NewHttpServer() *httpServer {
 // @param IncreaseBalanceRequest body dto.IncreaseBalanceRequest true "userId - id пользователя (UUID)<br>sum - сумма пополнения (больше 0)<br> comment - комментарий (опционально)"
 // @success 200 "В случае успешного добавления денег к балансу возвращается статус 200"
 // @failure 400 {object} dto.ApiError "В случае если запрос не валидный возвращается статус 400 и тело ответа"
+// @failure 422 {object} dto.ApiError "Превышен лимит пополнений (limit-exceeded)"
+// @failure 423 {object} dto.ApiError "Пополнение запрещено статусом счета (frozen-all, closed)"
+// @security ApiKeyAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 403 {object} dto.ApiError "Нет права balance:credit"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @failure 499 {object} dto.ApiError "Клиент отменил запрос"
+// @failure 504 {object} dto.ApiError "Истек таймаут запроса в бд"
 // @router /balance [post]
 func (s *httpServer) HandleIncreaseBalance(w http.ResponseWriter, r *http.Request) {
 	var request dto.IncreaseBalanceRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		s.sendJsonResponse(r.Context(), w, http.StatusBadRequest, dto.ApiError{Message: "invalid request body"})
+		s.sendError(w, r, newRequestError("invalid request body"))
 		return
 	}
 
-	if ok, validationMessage, err := s.isValidRequest(r.Context(), s.validator, request); err != nil {
-		if errors.Is(err, s.InternalServerError) {
-			s.sendJsonResponse(r.Context(), w, http.StatusInternalServerError, dto.ApiError{Message: err.Error()})
-		} else {
-			s.log.WithFields(logrus.Fields{
-				"error_message": err.Error(),
-			}).Error(fmt.Sprintf("%s_ERROR", r.Context().Value("requestId")))
-		}
-
+	if err := validateRequest(s.validator, request); err != nil {
+		s.sendError(w, r, err)
 		return
-	} else {
-		if !ok {
-			s.sendJsonResponse(r.Context(), w, http.StatusBadRequest, dto.ApiError{Message: validationMessage})
-			return
-		}
-	}
-
-	transaction := model.IncreaseBalanceTransaction{
-		UserId:  *request.UserId,
-		Sum:     *request.Sum,
-		Comment: request.Comment,
 	}
 
-	if err := s.balanceService.AddBalance(r.Context(), transaction); err != nil {
-		s.sendJsonResponse(r.Context(), w, http.StatusInternalServerError, dto.ApiError{Message: s.InternalServerError.Error()})
+	if err := s.balanceService.AddBalance(r.Context(), increaseBalanceTransaction(request)); err != nil {
+		s.sendError(w, r, err)
 	}
 }
 
@@ -111,24 +135,26 @@ func (s *httpServer) HandleIncreaseBalance(w http.ResponseWriter, r *http.Reques
 // @success 200 {object} dto.GetBalanceResponse "В случае если баланс найден"
 // @failure 400 {object} dto.ApiError "В случае если невалидный userId"
 // @failure 404 {object} dto.ApiError "В случае если баланс не найден по userId"
+// @security ApiKeyAuth
+// @security BearerAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 403 {object} dto.ApiError "Нет права balance:read"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @failure 499 {object} dto.ApiError "Клиент отменил запрос"
+// @failure 504 {object} dto.ApiError "Истек таймаут запроса в бд"
 // @router /balance/{userId} [get]
 func (s *httpServer) HandleGetBalance(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 
 	if err := s.validator.Var(params["userId"], "uuid"); err != nil {
-		s.sendJsonResponse(r.Context(), w, http.StatusBadRequest, dto.ApiError{Message: "parameter userId should be uuid"})
+		s.sendError(w, r, newRequestError("parameter userId should be uuid"))
 		return
 	}
 
 	balance, err := s.balanceService.GetBalanceByUserID(r.Context(), params["userId"])
 
 	if err != nil {
-		if errors.Is(err, s.balanceService.BalanceNotFoundErr) {
-			s.sendJsonResponse(r.Context(), w, http.StatusNotFound, dto.ApiError{Message: err.Error()})
-		} else {
-			s.sendJsonResponse(r.Context(), w, http.StatusInternalServerError, dto.ApiError{Message: s.InternalServerError.Error()})
-		}
-
+		s.sendError(w, r, err)
 		return
 	}
 
@@ -143,152 +169,214 @@ func (s *httpServer) HandleGetBalance(w http.ResponseWriter, r *http.Request) {
 // @produce json
 // @param SaveTransactionRequest body dto.SaveTransactionRequest true "orderId - id заказа (UUID).<br> serviceId - id услуги (UUID).<br> userId - id пользователя (UUID).<br> sum - сумма транзакции (больше 0).<br> transactionType - тип транзакции (enum(1, 2, 3)).<br> comment - комментарий (опционально)"
 // @success 200 {object} dto.SaveTransactionResponse "Воможные статусы:<br> 1 - добавление/обновление произошло успешно.<br> 2 - попытка резервации ("transactionType" = 1), резервация с соответсвующими orderId, userId, serviceId уже существует, транзакция резервации не добавлена.<br> 3 - попытка резервации ("transactionType" = 1), на балансе недостаточно средств, транзакция резервации не добавлена.<br> 4 - попытка признания выручки ("transactionType" = 2), транзакция с соответсвующими orderId, userId, serviceId не найдена, ошибка.<br> 5 - попытка признания выручки ("transactionType" = 2), транзакция с соответсвующими orderId, userId, serviceId найдена и выручка уже списана ранее, ошибка.<br> 6 - попытка признания выручки ("transactionType" = 2), транзакция с соответсвующими orderId, userId, serviceId найдена и уже была отклонена ранее, ошибка.<br> 7 - попытка отмены резервации ("transactionType" = 3), транзакция с соответсвующими orderId, userId, serviceId не найдена, ошибка.<br> 8 - попытка отмены резервации ("transactionType" = 3), транзакция с соответсвующими orderId, userId, serviceId найдена и уже была отменена ранее, деньги были возвращены, ошибка.<br> 9 - попытка отмены резервации ("transactionType" = 3), транзакция с соответсвующими orderId, userId, serviceId найдена и уже была подтверждена ранее, деньги были списаны, ошибка.<br> 10 - баланс пользователя не найден, ошибка"
+// @failure 422 {object} dto.ApiError "Резервация превышает лимит резерваций (limit-exceeded)"
+// @failure 423 {object} dto.ApiError "Операция запрещена статусом счета (account-frozen, account-closed)"
+// @security ApiKeyAuth
+// @security BearerAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 403 {object} dto.ApiError "Нет права transaction:write"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @failure 499 {object} dto.ApiError "Клиент отменил запрос"
+// @failure 504 {object} dto.ApiError "Истек таймаут запроса в бд"
 // @router /transaction [post]
 func (s *httpServer) HandleTransaction(w http.ResponseWriter, r *http.Request) {
 	var request dto.SaveTransactionRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		s.sendJsonResponse(r.Context(), w, http.StatusBadRequest, dto.ApiError{Message: "invalid request body"})
+		s.sendError(w, r, newRequestError("invalid request body"))
 		return
 	}
 
-	if ok, validationMessage, err := s.isValidRequest(r.Context(), s.validator, request); err != nil {
-		if errors.Is(err, s.InternalServerError) {
-			s.sendJsonResponse(r.Context(), w, http.StatusInternalServerError, dto.ApiError{Message: err.Error()})
-		} else {
-			s.log.WithFields(logrus.Fields{
-				"error_message": err.Error(),
-			}).Error(fmt.Sprintf("%s_ERROR", r.Context().Value("requestId")))
-		}
-
+	if err := validateRequest(s.validator, request); err != nil {
+		s.sendError(w, r, err)
 		return
-	} else {
-		if !ok {
-			s.sendJsonResponse(r.Context(), w, http.StatusBadRequest, dto.ApiError{Message: validationMessage})
-			return
-		}
 	}
 
-	transaction := model.Transaction{
-		UserId:            *request.UserId,
-		OrderId:           request.OrderId,
-		ServiceId:         request.ServiceId,
-		Sum:               *request.Sum,
-		TransactionTypeId: *request.TransactionTypeId,
-		Comment:           request.Comment,
-	}
+	transaction := reservationTransaction(request.UserId, request.OrderId, request.ServiceId, request.Sum, request.Comment)
+	transaction.TransactionTypeId = *request.TransactionTypeId
 
 	if status, err := s.transactionService.SaveTransaction(r.Context(), transaction); err != nil {
-		s.sendJsonResponse(r.Context(), w, http.StatusInternalServerError, dto.ApiError{Message: s.InternalServerError.Error()})
+		s.sendError(w, r, err)
 	} else {
-		s.sendJsonResponse(r.Context(), w, http.StatusOK, dto.SaveTransactionResponse{Status: status})
+		s.sendJsonResponse(r.Context(), w, http.StatusOK, dto.SaveTransactionResponse{Status: int(status)})
 	}
 }
 
 // HandleGetTransactions
 // @summary Получение списка транзакций пользователя
 // @tags transaction
-// @description Метод получение списка транзакций пользователя
+// @description Метод получение списка транзакций пользователя. Страницы выбираются по курсору: nextCursor из ответа передается в cursor. Постраничный режим (page) оставлен для совместимости, page и cursor вместе передавать нельзя
 // @accept json
 // @produce json
 // @param userId query string true "id пользователя" Format(uuid) example(b2b9a788-55fb-11ed-bdc3-0242ac120002)
-// @param page query integer true "номер страницы" example(1) minimum(1)
-// @param itemsPerPage query integer false "количество записей на странице" example(1) minimum(1) default(10)
+// @param cursor query string false "курсор следующей страницы (nextCursor из предыдущего ответа)"
+// @param page query integer false "номер страницы" example(1) minimum(1)
+// @param itemsPerPage query integer false "количество записей на странице" example(1) minimum(1) maximum(100) default(10)
 // @param sortBy query string false "поле по которому надо сортировать" example(sum) default(date) enums(date, sum)
 // @param sortType query string false "тип сортировки" example(asc) default(desc) enums(asc, desc)
+// @param transactionType query []integer false "типы транзакций" collectionFormat(multi) enums(1, 2, 3, 4)
+// @param dateFrom query string false "дата изменения транзакции от (включительно, RFC 3339)" example(2022-11-01T00:00:00Z)
+// @param dateTo query string false "дата изменения транзакции до (не включительно, RFC 3339)" example(2022-12-01T00:00:00Z)
+// @param serviceId query string false "id услуги" Format(uuid)
+// @param orderId query string false "id заказа" Format(uuid)
+// @param sumFrom query number false "сумма от (включительно)" minimum(0)
+// @param sumTo query number false "сумма до (включительно)" minimum(0)
+// @param comment query string false "поиск подстроки в комментарии без учета регистра" maxlength(100)
 // @success 200 {object} dto.GetTransactionsResponse
+// @failure 400 {object} dto.ApiError "Невалидный запрос или курсор"
+// @security ApiKeyAuth
+// @security BearerAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 403 {object} dto.ApiError "Нет права transaction:read"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @failure 499 {object} dto.ApiError "Клиент отменил запрос"
+// @failure 504 {object} dto.ApiError "Истек таймаут запроса в бд"
 // @router /transaction [get]
 func (s *httpServer) HandleGetTransactions(w http.ResponseWriter, r *http.Request) {
 	var requestDto dto.GetTransactionsRequest
 
 	queryParams := r.URL.Query()
 
-	if userIds, ok := queryParams["userId"]; ok {
-		requestDto.UserId = &userIds[0]
-	}
+	requestDto.UserId = queryString(queryParams, "userId")
+	requestDto.Cursor = queryString(queryParams, "cursor")
+	requestDto.SortBy = queryString(queryParams, "sortBy")
+	requestDto.SortType = queryString(queryParams, "sortType")
+	requestDto.DateFrom = queryString(queryParams, "dateFrom")
+	requestDto.DateTo = queryString(queryParams, "dateTo")
+	requestDto.ServiceId = queryString(queryParams, "serviceId")
+	requestDto.OrderId = queryString(queryParams, "orderId")
+	requestDto.Comment = queryString(queryParams, "comment")
 
-	if pages, ok := queryParams["page"]; ok {
-		if i, err := strconv.Atoi(pages[0]); err != nil {
-			s.sendJsonResponse(r.Context(), w, http.StatusBadRequest, dto.ApiError{Message: "parameter page should be integer"})
-			return
-		} else {
-			requestDto.Page = &i
-		}
+	var err error
+
+	if requestDto.Page, err = queryInt(queryParams, "page"); err != nil {
+		s.sendError(w, r, err)
+		return
 	}
 
-	if itemsPerPageArr, ok := queryParams["itemsPerPage"]; ok {
-		if i, err := strconv.Atoi(itemsPerPageArr[0]); err != nil {
-			s.sendJsonResponse(r.Context(), w, http.StatusBadRequest, dto.ApiError{Message: "parameter itemsPerPage should be integer"})
-			return
-		} else {
-			requestDto.ItemsPerPage = &i
-		}
+	if requestDto.ItemsPerPage, err = queryInt(queryParams, "itemsPerPage"); err != nil {
+		s.sendError(w, r, err)
+		return
 	}
 
-	if sortByArr, ok := queryParams["sortBy"]; ok {
-		requestDto.SortBy = &sortByArr[0]
+	if requestDto.SumFrom, err = queryFloat(queryParams, "sumFrom"); err != nil {
+		s.sendError(w, r, err)
+		return
 	}
 
-	if sortTypeArr, ok := queryParams["sortType"]; ok {
-		requestDto.SortType = &sortTypeArr[0]
+	if requestDto.SumTo, err = queryFloat(queryParams, "sumTo"); err != nil {
+		s.sendError(w, r, err)
+		return
 	}
 
-	if ok, validationMessage, err := s.isValidRequest(r.Context(), s.validator, requestDto); err != nil {
-		if errors.Is(err, s.InternalServerError) {
-			s.sendJsonResponse(r.Context(), w, http.StatusInternalServerError, dto.ApiError{Message: err.Error()})
-		} else {
-			s.log.WithFields(logrus.Fields{
-				"error_message": err.Error(),
-			}).Error(fmt.Sprintf("%s_ERROR", r.Context().Value("requestId")))
+	for _, transactionType := range queryParams["transactionType"] {
+		i, err := strconv.Atoi(transactionType)
+		if err != nil {
+			s.sendError(w, r, newRequestError("parameter transactionType should be integer"))
+			return
 		}
 
+		requestDto.TransactionTypes = append(requestDto.TransactionTypes, i)
+	}
+
+	if err := validateRequest(s.validator, requestDto); err != nil {
+		s.sendError(w, r, err)
 		return
-	} else {
-		if !ok {
-			s.sendJsonResponse(r.Context(), w, http.StatusBadRequest, dto.ApiError{Message: validationMessage})
-			return
-		}
 	}
 
-	var request model.GetTransactionsRequest
+	request, err := getTransactionsRequest(requestDto)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
 
-	if requestDto.ItemsPerPage == nil {
-		request.Limit = 10
+	if page, err := s.transactionService.GetTransactions(r.Context(), request); err != nil {
+		s.sendError(w, r, err)
 	} else {
-		request.Limit = *requestDto.ItemsPerPage
+		response := dto.GetTransactionsResponse{
+			Transactions: make([]dto.Transaction, 0, len(page.Transactions)),
+			NextCursor:   encodeCursor(page.NextCursor),
+			HasMore:      page.HasMore,
+			Total:        page.Total,
+			ItemsPerPage: request.Limit,
+			Page:         requestDto.Page,
+		}
+
+		for _, tr := range page.Transactions {
+			response.Transactions = append(response.Transactions, transactionResponse(tr))
+		}
+
+		s.sendJsonResponse(r.Context(), w, http.StatusOK, response)
 	}
+}
 
-	request.UserId = *requestDto.UserId
-	request.Offset = (*requestDto.Page - 1) * request.Limit
+// HandleGetTransaction
+// @summary Получение транзакции с историей изменений
+// @tags transaction
+// @description Возвращает текущее состояние транзакции и все ее состояния по времени (резервация, подтверждение или отмена)
+// @accept json
+// @produce json
+// @param id path string true "id транзакции" Format(uuid)
+// @success 200 {object} dto.TransactionDetails
+// @failure 400 {object} dto.ApiError "Невалидный id"
+// @failure 404 {object} dto.ApiError "Транзакция не найдена"
+// @security ApiKeyAuth
+// @security BearerAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 403 {object} dto.ApiError "Нет права transaction:read"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @failure 499 {object} dto.ApiError "Клиент отменил запрос"
+// @failure 504 {object} dto.ApiError "Истек таймаут запроса в бд"
+// @router /transaction/{id} [get]
+func (s *httpServer) HandleGetTransaction(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	if err := s.validator.Var(id, "uuid"); err != nil {
+		s.sendError(w, r, newRequestError("parameter id should be uuid"))
+		return
+	}
 
-	if requestDto.SortBy == nil {
-		request.SortBy = "date"
+	if history, err := s.transactionService.GetTransactionHistory(r.Context(), id); err != nil {
+		s.sendError(w, r, err)
 	} else {
-		request.SortBy = *requestDto.SortBy
+		s.sendJsonResponse(r.Context(), w, http.StatusOK, transactionDetailsResponse(history))
 	}
+}
 
-	if requestDto.SortType == nil {
-		request.SortType = "desc"
-	} else {
-		request.SortType = *requestDto.SortType
+// HandleGetOrderTransactions
+// @summary Получение транзакций заказа с историей изменений
+// @tags transaction
+// @description Возвращает все транзакции заказа (по всем услугам) с историей состояний каждой
+// @accept json
+// @produce json
+// @param orderId path string true "id заказа" Format(uuid)
+// @success 200 {object} dto.GetOrderTransactionsResponse
+// @failure 400 {object} dto.ApiError "Невалидный orderId"
+// @security ApiKeyAuth
+// @security BearerAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 403 {object} dto.ApiError "Нет права transaction:read"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @failure 499 {object} dto.ApiError "Клиент отменил запрос"
+// @failure 504 {object} dto.ApiError "Истек таймаут запроса в бд"
+// @router /orders/{orderId}/transactions [get]
+func (s *httpServer) HandleGetOrderTransactions(w http.ResponseWriter, r *http.Request) {
+	orderId := mux.Vars(r)["orderId"]
+
+	if err := s.validator.Var(orderId, "uuid"); err != nil {
+		s.sendError(w, r, newRequestError("parameter orderId should be uuid"))
+		return
 	}
 
-	if transactions, err := s.transactionService.GetTransactions(r.Context(), request); err != nil {
-		s.sendJsonResponse(r.Context(), w, http.StatusInternalServerError, dto.ApiError{Message: "internal server error"})
+	if histories, err := s.transactionService.GetOrderTransactionHistory(r.Context(), orderId); err != nil {
+		s.sendError(w, r, err)
 	} else {
-		var response dto.GetTransactionsResponse
-
-		response.Transactions = make([]dto.Transaction, 0)
-
-		for _, tr := range transactions {
-			response.Transactions = append(response.Transactions, dto.Transaction{
-				OrderId:         tr.OrderId,
-				ServiceId:       tr.ServiceId,
-				TransactionType: tr.TransactionType,
-				Sum:             tr.Sum,
-				Comment:         tr.Comment,
-				UpdTime:         tr.UpdTime,
-			})
+		response := dto.GetOrderTransactionsResponse{
+			Transactions: make([]dto.TransactionDetails, 0, len(histories)),
+		}
+
+		for _, history := range histories {
+			response.Transactions = append(response.Transactions, transactionDetailsResponse(history))
 		}
 
 		s.sendJsonResponse(r.Context(), w, http.StatusOK, response)
@@ -303,112 +391,115 @@ func (s *httpServer) HandleGetTransactions(w http.ResponseWriter, r *http.Reques
 // @produce json
 // @param CreateReportRequest body dto.CreateReportRequest true "year - год отчета (2022 <=year <= 2100)<br>month - месяц отчета"
 // @success 200 {object} dto.CreateReportResponse
+// @security ApiKeyAuth
+// @security BearerAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 403 {object} dto.ApiError "Нет права report:create"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @failure 499 {object} dto.ApiError "Клиент отменил запрос"
+// @failure 504 {object} dto.ApiError "Истек таймаут запроса в бд"
 // @router /report [post]
 func (s *httpServer) HandleCreateReport(w http.ResponseWriter, r *http.Request) {
 	var request dto.CreateReportRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		s.sendJsonResponse(r.Context(), w, http.StatusBadRequest, dto.ApiError{Message: "invalid request body"})
+		s.sendError(w, r, newRequestError("invalid request body"))
 		return
 	}
 
-	if ok, validationMessage, err := s.isValidRequest(r.Context(), s.validator, request); err != nil {
-		if errors.Is(err, s.InternalServerError) {
-			s.sendJsonResponse(r.Context(), w, http.StatusInternalServerError, dto.ApiError{Message: err.Error()})
-		} else {
-			s.log.WithFields(logrus.Fields{
-				"error_message": err.Error(),
-			}).Error(fmt.Sprintf("%s_ERROR", r.Context().Value("requestId")))
-		}
-
+	if err := validateRequest(s.validator, request); err != nil {
+		s.sendError(w, r, err)
 		return
-	} else {
-		if !ok {
-			s.sendJsonResponse(r.Context(), w, http.StatusBadRequest, dto.ApiError{Message: validationMessage})
-			return
-		}
 	}
 
-	t := time.Date(*request.Year, time.Month(*request.Month), 0, 0, 0, 0, 0, time.UTC)
-
-	if err := s.reportService.CreateReport(r.Context(), t); err != nil {
-		s.sendJsonResponse(r.Context(), w, http.StatusInternalServerError, dto.ApiError{Message: "internal server error"})
+	if id, err := s.reportService.CreateReport(r.Context(), reportDate(request)); err != nil {
+		s.sendError(w, r, err)
 	} else {
 		s.sendJsonResponse(r.Context(), w, http.StatusOK, dto.CreateReportResponse{
-			URL: fmt.Sprintf("%s/%s.csv", "http://localhost:8000/report", r.Context().Value("requestId")),
+			Id:  id,
+			URL: reportURL(id),
 		})
 	}
 }
 
-func (s *httpServer) isValidRequest(ctx context.Context, v *validator.Validate, requestBody any) (bool, string, error) {
-	ok := true
-	var validationMessage string
-
-	if err := v.Struct(requestBody); err != nil {
-		for _, err := range err.(validator.ValidationErrors) {
-			switch err.Tag() {
-			case "required":
-				switch err.Type().Kind() {
-				case reflect.Pointer:
-					validationMessage = fmt.Sprintf("field %s missing", err.Field())
-				default:
-					s.log.WithFields(logrus.Fields{
-						"error_message": fmt.Sprintf("unexpected field type when validating required tag: %s", err.Type()),
-					}).Error(fmt.Sprintf("%s_ERROR", ctx.Value("requestId")))
-
-					return false, "", s.InternalServerError
-				}
-			case "gt":
-				switch err.Type().Kind() {
-				case reflect.Float64:
-					validationMessage = fmt.Sprintf("field %s should be > %s", err.Field(), err.Param())
-				default:
-					s.log.WithFields(logrus.Fields{
-						"error_message": fmt.Sprintf("unexpected field type when validating gt tag: %s", err.Type()),
-					}).Error(fmt.Sprintf("%s_ERROR", ctx.Value("requestId")))
-
-					return false, "", s.InternalServerError
-				}
-			case "uuid_rfc4122":
-				validationMessage = fmt.Sprintf("field %s should be uuid", err.Field())
-			case "oneof":
-				validationMessage = fmt.Sprintf("field %s should be in [%s]", err.Field(), err.Param())
-			case "min":
-				switch err.Type().Kind() {
-				case reflect.Int:
-					validationMessage = fmt.Sprintf("field %s should be >= %s", err.Field(), err.Param())
-				default:
-					s.log.WithFields(logrus.Fields{
-						"error_message": fmt.Sprintf("unexpected field type when validating min tag: %s", err.Type()),
-					}).Error(fmt.Sprintf("%s_ERROR", ctx.Value("requestId")))
-
-					return false, "", s.InternalServerError
-				}
-			case "max":
-				switch err.Type().Kind() {
-				case reflect.Int:
-					validationMessage = fmt.Sprintf("field %s should be <= %s", err.Field(), err.Param())
-				default:
-					s.log.WithFields(logrus.Fields{
-						"error_message": fmt.Sprintf("unexpected field type when validating max tag: %s", err.Type()),
-					}).Error(fmt.Sprintf("%s_ERROR", ctx.Value("requestId")))
-
-					return false, "", s.InternalServerError
-				}
-			default:
-				s.log.WithFields(logrus.Fields{
-					"error_message": fmt.Sprintf("unexpected validation tag: %s", err.Tag()),
-				}).Error(fmt.Sprintf("%s_ERROR", ctx.Value("requestId")))
-
-				return false, "", s.InternalServerError
-			}
-
-			ok = false
-			break
-		}
+// sendError отвечает на ошибку в формате application/problem+json
+func (s *httpServer) sendError(w http.ResponseWriter, r *http.Request, err error) {
+	apiError := s.apiError(r.Context(), err)
+	apiError.Instance = r.URL.Path
+	apiError.RequestId = requestid.FromContext(r.Context())
+
+	w.Header().Set("Content-Type", dto.ProblemContentType)
+
+	s.sendJsonResponse(r.Context(), w, apiError.Status, apiError)
+}
+
+// apiError - единая точка перевода ошибок в problem details: ошибки запроса - 400, нет права - 403,
+// ошибки сервисов - 404/409/422/423, отмена запроса клиентом - 499, истекший таймаут - 504, остальное - 500
+func (s *httpServer) apiError(ctx context.Context, err error) dto.ApiError {
+	var apiError dto.ApiError
+	var requestErr *requestError
+	var validationErr *validationError
+	var forbiddenErr *forbiddenError
+
+	switch {
+	case errors.As(err, &validationErr):
+		apiError = dto.NewApiError(http.StatusBadRequest, dto.ErrorCodeValidation, validationErr.Error())
+		apiError.InvalidParams = validationErr.invalidParams
+	case errors.As(err, &requestErr):
+		apiError = dto.NewApiError(http.StatusBadRequest, dto.ErrorCodeBadRequest, requestErr.Error())
+	case errors.As(err, &forbiddenErr):
+		apiError = dto.NewApiError(http.StatusForbidden, dto.ErrorCodeForbidden, forbiddenErr.Error())
+	case errors.Is(err, s.balanceService.BalanceNotFoundErr), errors.Is(err, s.transactionService.BalanceNotFoundErr),
+		errors.Is(err, s.adjustmentService.BalanceNotFoundErr):
+		apiError = dto.NewApiError(http.StatusNotFound, dto.ErrorCodeBalanceNotFound, err.Error())
+	case errors.Is(err, s.transactionService.TransactionNotFoundErr):
+		apiError = dto.NewApiError(http.StatusNotFound, dto.ErrorCodeReservationNotFound, err.Error())
+	case errors.Is(err, s.transactionService.UnknownTransactionErr):
+		apiError = dto.NewApiError(http.StatusNotFound, dto.ErrorCodeTransactionNotFound, err.Error())
+	case errors.Is(err, s.orderService.OrderNotFoundErr):
+		apiError = dto.NewApiError(http.StatusNotFound, dto.ErrorCodeOrderNotFound, err.Error())
+	case errors.Is(err, s.orderService.LineNotFoundErr):
+		apiError = dto.NewApiError(http.StatusNotFound, dto.ErrorCodeOrderLineNotFound, err.Error())
+	case errors.Is(err, s.webhookService.WebhookNotFoundErr):
+		apiError = dto.NewApiError(http.StatusNotFound, dto.ErrorCodeWebhookNotFound, err.Error())
+	case errors.Is(err, s.webhookService.DeliveryNotFoundErr):
+		apiError = dto.NewApiError(http.StatusNotFound, dto.ErrorCodeDeliveryNotFound, err.Error())
+	case errors.Is(err, s.limitService.LimitRuleNotFoundErr):
+		apiError = dto.NewApiError(http.StatusNotFound, dto.ErrorCodeLimitNotFound, err.Error())
+	case errors.Is(err, s.adjustmentService.AdjustmentNotFoundErr):
+		apiError = dto.NewApiError(http.StatusNotFound, dto.ErrorCodeAdjustmentNotFound, err.Error())
+	case errors.Is(err, s.adjustmentService.SameOperatorErr):
+		apiError = dto.NewApiError(http.StatusForbidden, dto.ErrorCodeSameOperator, err.Error())
+	case errors.Is(err, s.adjustmentService.AlreadyDecidedErr):
+		apiError = dto.NewApiError(http.StatusConflict, dto.ErrorCodeAdjustmentDecided, err.Error())
+	case errors.Is(err, s.orderService.OrderExistsErr):
+		apiError = dto.NewApiError(http.StatusConflict, dto.ErrorCodeOrderExists, err.Error())
+	case errors.Is(err, s.transactionService.ReservationExistsErr):
+		apiError = dto.NewApiError(http.StatusConflict, dto.ErrorCodeReservationExists, err.Error())
+	case errors.Is(err, s.transactionService.AlreadyCapturedErr):
+		apiError = dto.NewApiError(http.StatusConflict, dto.ErrorCodeAlreadyCaptured, err.Error())
+	case errors.Is(err, s.transactionService.AlreadyCancelledErr):
+		apiError = dto.NewApiError(http.StatusConflict, dto.ErrorCodeAlreadyCancelled, err.Error())
+	case errors.Is(err, s.transactionService.InsufficientFundsErr), errors.Is(err, s.balanceService.InsufficientFundsErr),
+		errors.Is(err, s.adjustmentService.InsufficientFundsErr):
+		apiError = dto.NewApiError(http.StatusUnprocessableEntity, dto.ErrorCodeInsufficientFunds, err.Error())
+	case errors.Is(err, s.balanceService.LimitExceededErr), errors.Is(err, s.transactionService.LimitExceededErr):
+		apiError = dto.NewApiError(http.StatusUnprocessableEntity, dto.ErrorCodeLimitExceeded, err.Error())
+	case errors.Is(err, s.balanceService.AccountFrozenErr), errors.Is(err, s.transactionService.AccountFrozenErr),
+		errors.Is(err, s.adjustmentService.AccountFrozenErr):
+		apiError = dto.NewApiError(http.StatusLocked, dto.ErrorCodeAccountFrozen, err.Error())
+	case errors.Is(err, s.balanceService.AccountClosedErr), errors.Is(err, s.transactionService.AccountClosedErr),
+		errors.Is(err, s.adjustmentService.AccountClosedErr):
+		apiError = dto.NewApiError(http.StatusLocked, dto.ErrorCodeAccountClosed, err.Error())
+	case isCanceled(ctx, err):
+		apiError = dto.NewApiError(StatusClientClosedRequest, dto.ErrorCodeRequestCanceled, s.RequestCanceledError.Error())
+	case isTimeout(err):
+		apiError = dto.NewApiError(http.StatusGatewayTimeout, dto.ErrorCodeTimeout, s.RequestTimeoutError.Error())
+	default:
+		apiError = dto.NewApiError(http.StatusInternalServerError, dto.ErrorCodeInternal, s.InternalServerError.Error())
 	}
 
-	return ok, validationMessage, nil
+	return apiError
 }
 
 func (s *httpServer) sendJsonResponse(ctx context.Context, w http.ResponseWriter, status int, v interface{}) {
@@ -416,15 +507,17 @@ func (s *httpServer) sendJsonResponse(ctx context.Context, w http.ResponseWriter
 
 	response, err := json.Marshal(v)
 	if err != nil {
-		s.log.WithFields(logrus.Fields{
+		logger.FromContext(ctx).WithFields(logrus.Fields{
 			"error_message": err.Error(),
-		}).Error(fmt.Sprintf("%s_ERROR", ctx.Value("requestId")))
+		}).Error("failed to marshal response")
 
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	if _, err := w.Write(response); err != nil {
-		s.log.Fatal(err.Error())
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"error_message": err.Error(),
+		}).Error("failed to write response")
 	}
 }
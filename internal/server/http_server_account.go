@@ -0,0 +1,95 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/avito-test/internal/dto"
+	"github.com/avito-test/internal/model"
+	"github.com/gorilla/mux"
+)
+
+// HandleGetAccount
+// @summary Статус счета пользователя
+// @tags account
+// @description Возвращает статус счета: active, frozen-debit (запрещены резервации, списания и корректировки-списания), frozen-all (запрещено любое движение денег) или closed. Для счета, статус которого не задавался, возвращается active без причины
+// @accept json
+// @produce json
+// @param userId path string true "id пользователя" Format(uuid)
+// @success 200 {object} dto.Account
+// @failure 400 {object} dto.ApiError "Невалидный id"
+// @security ApiKeyAuth
+// @security BearerAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 403 {object} dto.ApiError "Нет права account:read"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @failure 499 {object} dto.ApiError "Клиент отменил запрос"
+// @failure 504 {object} dto.ApiError "Истек таймаут запроса в бд"
+// @router /accounts/{userId} [get]
+func (s *httpServer) HandleGetAccount(w http.ResponseWriter, r *http.Request) {
+	userId, ok := s.accountUserId(w, r)
+	if !ok {
+		return
+	}
+
+	if account, err := s.accountService.GetAccount(r.Context(), userId); err != nil {
+		s.sendError(w, r, err)
+	} else {
+		s.sendJsonResponse(r.Context(), w, http.StatusOK, accountResponse(account))
+	}
+}
+
+// HandleSetAccountStatus
+// @summary Изменение статуса счета
+// @tags account
+// @description Замораживает, размораживает (active) или закрывает счет пользователя с причиной, задавшим статус считается вызывающий. Статус действует на последующие операции: заблокированные операции возвращают 423 с кодом account-frozen или account-closed
+// @accept json
+// @produce json
+// @param userId path string true "id пользователя" Format(uuid)
+// @param SetAccountStatusRequest body dto.SetAccountStatusRequest true "status - active, frozen-debit, frozen-all или closed.<br> reason - причина"
+// @success 200 {object} dto.Account "Статус задан"
+// @failure 400 {object} dto.ApiError "Невалидный запрос"
+// @security ApiKeyAuth
+// @security BearerAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 403 {object} dto.ApiError "Нет права account:manage"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @failure 499 {object} dto.ApiError "Клиент отменил запрос"
+// @failure 504 {object} dto.ApiError "Истек таймаут запроса в бд"
+// @router /accounts/{userId}/status [put]
+func (s *httpServer) HandleSetAccountStatus(w http.ResponseWriter, r *http.Request) {
+	userId, ok := s.accountUserId(w, r)
+	if !ok {
+		return
+	}
+
+	var request dto.SetAccountStatusRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendError(w, r, newRequestError("invalid request body"))
+		return
+	}
+
+	if err := validateRequest(s.validator, request); err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	if account, err := s.accountService.SetStatus(r.Context(), userId, model.AccountStatus(*request.Status), *request.Reason); err != nil {
+		s.sendError(w, r, err)
+	} else {
+		s.sendJsonResponse(r.Context(), w, http.StatusOK, accountResponse(account))
+	}
+}
+
+// accountUserId разбирает id пользователя из пути
+func (s *httpServer) accountUserId(w http.ResponseWriter, r *http.Request) (string, bool) {
+	userId := mux.Vars(r)["userId"]
+
+	if err := s.validator.Var(userId, "uuid"); err != nil {
+		s.sendError(w, r, newRequestError("parameter userId should be uuid"))
+		return "", false
+	}
+
+	return userId, true
+}
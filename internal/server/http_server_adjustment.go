@@ -0,0 +1,252 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/avito-test/internal/dto"
+	"github.com/avito-test/internal/model"
+	"github.com/gorilla/mux"
+)
+
+// HandleCreateAdjustment
+// @summary Предложение корректировки баланса
+// @tags adjustment
+// @description Создает ручную корректировку баланса, ожидающую решения. Баланс меняется только после одобрения другим оператором (maker-checker), предложившим считается вызывающий
+// @accept json
+// @produce json
+// @param CreateAdjustmentRequest body dto.CreateAdjustmentRequest true "userId - id пользователя (UUID).<br> direction - credit (зачисление) или debit (списание).<br> sum - сумма больше 0.<br> reason - причина корректировки.<br> ticket - номер тикета"
+// @success 201 {object} dto.Adjustment "Корректировка ожидает решения"
+// @failure 400 {object} dto.ApiError "Невалидный запрос"
+// @security ApiKeyAuth
+// @security BearerAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 403 {object} dto.ApiError "Нет права adjustment:propose"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @failure 499 {object} dto.ApiError "Клиент отменил запрос"
+// @failure 504 {object} dto.ApiError "Истек таймаут запроса в бд"
+// @router /adjustments [post]
+func (s *httpServer) HandleCreateAdjustment(w http.ResponseWriter, r *http.Request) {
+	var request dto.CreateAdjustmentRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendError(w, r, newRequestError("invalid request body"))
+		return
+	}
+
+	if err := validateRequest(s.validator, request); err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	if adjustment, err := s.adjustmentService.Propose(r.Context(), adjustmentRequest(request)); err != nil {
+		s.sendError(w, r, err)
+	} else {
+		s.sendJsonResponse(r.Context(), w, http.StatusCreated, adjustmentResponse(adjustment))
+	}
+}
+
+// HandleGetPendingAdjustments
+// @summary Корректировки, ожидающие решения
+// @tags adjustment
+// @description Возвращает первые 100 корректировок, ожидающих решения, в порядке очереди (старые первыми)
+// @accept json
+// @produce json
+// @success 200 {object} dto.GetAdjustmentsResponse
+// @security ApiKeyAuth
+// @security BearerAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 403 {object} dto.ApiError "Нет права adjustment:read"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @failure 499 {object} dto.ApiError "Клиент отменил запрос"
+// @failure 504 {object} dto.ApiError "Истек таймаут запроса в бд"
+// @router /adjustments/pending [get]
+func (s *httpServer) HandleGetPendingAdjustments(w http.ResponseWriter, r *http.Request) {
+	if adjustments, err := s.adjustmentService.GetPending(r.Context()); err != nil {
+		s.sendError(w, r, err)
+	} else {
+		s.sendJsonResponse(r.Context(), w, http.StatusOK, adjustmentsResponse(adjustments))
+	}
+}
+
+// HandleGetAdjustments
+// @summary История корректировок
+// @tags adjustment
+// @description Возвращает последние 100 корректировок в любом состоянии, новые первыми: кто и когда предложил, кто и когда одобрил или отклонил, транзакция корректировки
+// @accept json
+// @produce json
+// @param userId query string false "Фильтр по пользователю" Format(uuid)
+// @param status query string false "Фильтр по состоянию" Enums(pending, approved, rejected)
+// @success 200 {object} dto.GetAdjustmentsResponse
+// @failure 400 {object} dto.ApiError "Невалидный запрос"
+// @security ApiKeyAuth
+// @security BearerAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 403 {object} dto.ApiError "Нет права adjustment:read"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @failure 499 {object} dto.ApiError "Клиент отменил запрос"
+// @failure 504 {object} dto.ApiError "Истек таймаут запроса в бд"
+// @router /adjustments [get]
+func (s *httpServer) HandleGetAdjustments(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	userId := queryString(query, "userId")
+	if userId != nil {
+		if err := s.validator.Var(*userId, "uuid"); err != nil {
+			s.sendError(w, r, newRequestError("parameter userId should be uuid"))
+			return
+		}
+	}
+
+	var status *model.AdjustmentStatus
+
+	if value := queryString(query, "status"); value != nil {
+		if err := s.validator.Var(*value, "oneof=pending approved rejected"); err != nil {
+			s.sendError(w, r, newRequestError("parameter status should be in [pending approved rejected]"))
+			return
+		}
+
+		adjustmentStatus := model.AdjustmentStatus(*value)
+		status = &adjustmentStatus
+	}
+
+	if adjustments, err := s.adjustmentService.GetHistory(r.Context(), userId, status); err != nil {
+		s.sendError(w, r, err)
+	} else {
+		s.sendJsonResponse(r.Context(), w, http.StatusOK, adjustmentsResponse(adjustments))
+	}
+}
+
+// HandleGetAdjustment
+// @summary Получение корректировки
+// @tags adjustment
+// @accept json
+// @produce json
+// @param id path string true "id корректировки" Format(uuid)
+// @success 200 {object} dto.Adjustment
+// @failure 400 {object} dto.ApiError "Невалидный id"
+// @failure 404 {object} dto.ApiError "Корректировка не найдена"
+// @security ApiKeyAuth
+// @security BearerAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 403 {object} dto.ApiError "Нет права adjustment:read"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @failure 499 {object} dto.ApiError "Клиент отменил запрос"
+// @failure 504 {object} dto.ApiError "Истек таймаут запроса в бд"
+// @router /adjustments/{id} [get]
+func (s *httpServer) HandleGetAdjustment(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.adjustmentId(w, r)
+	if !ok {
+		return
+	}
+
+	if adjustment, err := s.adjustmentService.GetAdjustment(r.Context(), id); err != nil {
+		s.sendError(w, r, err)
+	} else {
+		s.sendJsonResponse(r.Context(), w, http.StatusOK, adjustmentResponse(adjustment))
+	}
+}
+
+// HandleApproveAdjustment
+// @summary Одобрение корректировки
+// @tags adjustment
+// @description Одобряет корректировку и проводит ее транзакцией корректировки (тип 6, сумма списания отрицательная). Одобрить может только оператор, не предлагавший корректировку. Если провести не удалось (нет баланса, не хватает средств для списания), корректировка остается ожидающей
+// @accept json
+// @produce json
+// @param id path string true "id корректировки" Format(uuid)
+// @param AdjustmentDecisionRequest body dto.AdjustmentDecisionRequest false "comment - комментарий к решению (опционально)"
+// @success 200 {object} dto.Adjustment "Корректировка проведена"
+// @failure 400 {object} dto.ApiError "Невалидный запрос"
+// @failure 403 {object} dto.ApiError "Нет права adjustment:approve или корректировку предложил тот же оператор (same-operator)"
+// @failure 404 {object} dto.ApiError "Корректировка или баланс не найдены"
+// @failure 409 {object} dto.ApiError "Решение по корректировке уже принято"
+// @failure 422 {object} dto.ApiError "Недостаточно средств для списания"
+// @failure 423 {object} dto.ApiError "Корректировка запрещена статусом счета, корректировка остается ожидающей"
+// @security ApiKeyAuth
+// @security BearerAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @failure 499 {object} dto.ApiError "Клиент отменил запрос"
+// @failure 504 {object} dto.ApiError "Истек таймаут запроса в бд"
+// @router /adjustments/{id}/approve [post]
+func (s *httpServer) HandleApproveAdjustment(w http.ResponseWriter, r *http.Request) {
+	id, request, ok := s.adjustmentDecision(w, r)
+	if !ok {
+		return
+	}
+
+	if adjustment, err := s.adjustmentService.Approve(r.Context(), id, request.Comment); err != nil {
+		s.sendError(w, r, err)
+	} else {
+		s.sendJsonResponse(r.Context(), w, http.StatusOK, adjustmentResponse(adjustment))
+	}
+}
+
+// HandleRejectAdjustment
+// @summary Отклонение корректировки
+// @tags adjustment
+// @description Отклоняет корректировку, баланс не меняется. Отклонить может только оператор, не предлагавший корректировку
+// @accept json
+// @produce json
+// @param id path string true "id корректировки" Format(uuid)
+// @param AdjustmentDecisionRequest body dto.AdjustmentDecisionRequest false "comment - комментарий к решению (опционально)"
+// @success 200 {object} dto.Adjustment "Корректировка отклонена"
+// @failure 400 {object} dto.ApiError "Невалидный запрос"
+// @failure 403 {object} dto.ApiError "Нет права adjustment:approve или корректировку предложил тот же оператор (same-operator)"
+// @failure 404 {object} dto.ApiError "Корректировка не найдена"
+// @failure 409 {object} dto.ApiError "Решение по корректировке уже принято"
+// @security ApiKeyAuth
+// @security BearerAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @failure 499 {object} dto.ApiError "Клиент отменил запрос"
+// @failure 504 {object} dto.ApiError "Истек таймаут запроса в бд"
+// @router /adjustments/{id}/reject [post]
+func (s *httpServer) HandleRejectAdjustment(w http.ResponseWriter, r *http.Request) {
+	id, request, ok := s.adjustmentDecision(w, r)
+	if !ok {
+		return
+	}
+
+	if adjustment, err := s.adjustmentService.Reject(r.Context(), id, request.Comment); err != nil {
+		s.sendError(w, r, err)
+	} else {
+		s.sendJsonResponse(r.Context(), w, http.StatusOK, adjustmentResponse(adjustment))
+	}
+}
+
+// adjustmentDecision разбирает id корректировки и необязательное тело решения
+func (s *httpServer) adjustmentDecision(w http.ResponseWriter, r *http.Request) (string, dto.AdjustmentDecisionRequest, bool) {
+	var request dto.AdjustmentDecisionRequest
+
+	id, ok := s.adjustmentId(w, r)
+	if !ok {
+		return "", request, false
+	}
+
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			s.sendError(w, r, newRequestError("invalid request body"))
+			return "", request, false
+		}
+	}
+
+	if err := validateRequest(s.validator, request); err != nil {
+		s.sendError(w, r, err)
+		return "", request, false
+	}
+
+	return id, request, true
+}
+
+// adjustmentId разбирает id корректировки из пути
+func (s *httpServer) adjustmentId(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := mux.Vars(r)["id"]
+
+	if err := s.validator.Var(id, "uuid"); err != nil {
+		s.sendError(w, r, newRequestError("parameter id should be uuid"))
+		return "", false
+	}
+
+	return id, true
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/avito-test/internal/config"
+	"github.com/avito-test/internal/config/auth"
+	"github.com/avito-test/internal/dto"
+	"github.com/avito-test/internal/model"
+)
+
+// HandleBatch
+// @summary Пакет операций с балансом
+// @tags transaction
+// @description Выполняет по порядку операции reserve, capture, cancel (как POST /transaction) и deposit (как POST /balance). При "atomic": true все операции выполняются в одной транзакции бд: при первой ошибке выполненные операции откатываются (rolled_back), остальные не выполняются (skipped). Иначе каждая операция выполняется отдельно. Результат каждой операции - в results с тем же индексом, ошибка в формате ApiError (превышение лимита - limit-exceeded). Для операций deposit нужно право balance:credit
+// @accept json
+// @produce json
+// @param BatchRequest body dto.BatchRequest true "atomic - все или ничего (по умолчанию false).<br> operations - операции (не больше BATCH_MAX_OPERATIONS, по умолчанию 100): type - reserve, capture, cancel или deposit, userId, orderId и serviceId (не нужны для deposit), sum (больше 0), comment (опционально)"
+// @success 200 {object} dto.BatchResponse "Пакет обработан, результаты операций в results"
+// @failure 400 {object} dto.ApiError "Невалидный запрос или слишком много операций"
+// @failure 413 {object} dto.ApiError "Тело запроса больше BATCH_MAX_BODY_BYTES"
+// @security ApiKeyAuth
+// @security BearerAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 403 {object} dto.ApiError "Нет права transaction:write или balance:credit для deposit"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @failure 499 {object} dto.ApiError "Клиент отменил запрос"
+// @failure 504 {object} dto.ApiError "Истек таймаут запроса в бд"
+// @router /transaction/batch [post]
+func (s *httpServer) HandleBatch(w http.ResponseWriter, r *http.Request) {
+	var request dto.BatchRequest
+
+	// размер тела ограничен BATCH_MAX_BODY_BYTES в роутере (middleware.BodyLimit)
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendError(w, r, newRequestError("invalid request body"))
+		return
+	}
+
+	// количество операций проверяется до валидации, которая обходит каждую операцию
+	if len(request.Operations) > config.BatchMaxOperations {
+		s.sendError(w, r, newRequestError("batch should contain at most %d operations", config.BatchMaxOperations))
+		return
+	}
+
+	if err := validateRequest(s.validator, request); err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	operations := make([]model.Transaction, 0, len(request.Operations))
+
+	for _, operation := range request.Operations {
+		if *operation.Type == batchDeposit && !s.allowed(r, auth.PermissionBalanceCredit) {
+			s.sendError(w, r, &forbiddenError{permission: auth.PermissionBalanceCredit})
+			return
+		}
+
+		operations = append(operations, batchOperationTransaction(operation))
+	}
+
+	atomic := request.Atomic != nil && *request.Atomic
+
+	results, err := s.batchService.Execute(r.Context(), operations, atomic)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	response := dto.BatchResponse{
+		Atomic:  atomic,
+		Results: make([]dto.BatchOperationResult, 0, len(results)),
+	}
+
+	for i, result := range results {
+		item := dto.BatchOperationResult{Index: i, Status: string(result.Status)}
+
+		if result.Err != nil {
+			apiError := s.apiError(r.Context(), result.Err)
+			item.Error = &apiError
+		}
+
+		response.Results = append(response.Results, item)
+	}
+
+	s.sendJsonResponse(r.Context(), w, http.StatusOK, response)
+}
+
+// allowed проверяет право вызывающего так же, как middleware.Authorization
+func (s *httpServer) allowed(r *http.Request, permission auth.Permission) bool {
+	principal, ok := auth.FromContext(r.Context())
+
+	return ok && s.policy.Allowed(principal, permission)
+}
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/avito-test/internal/dto"
+	"github.com/avito-test/internal/model"
+)
+
+// HandleGetLimits
+// @summary Заданные лимиты
+// @tags limit
+// @description Возвращает все заданные лимиты: глобальные, уровней пользователей и отдельных пользователей
+// @accept json
+// @produce json
+// @success 200 {object} dto.GetLimitRulesResponse
+// @security ApiKeyAuth
+// @security BearerAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 403 {object} dto.ApiError "Нет права limit:read"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @failure 499 {object} dto.ApiError "Клиент отменил запрос"
+// @failure 504 {object} dto.ApiError "Истек таймаут запроса в бд"
+// @router /limits [get]
+func (s *httpServer) HandleGetLimits(w http.ResponseWriter, r *http.Request) {
+	if rules, err := s.limitService.GetRules(r.Context()); err != nil {
+		s.sendError(w, r, err)
+	} else {
+		s.sendJsonResponse(r.Context(), w, http.StatusOK, limitRulesResponse(rules))
+	}
+}
+
+// HandleSetLimit
+// @summary Задание лимита
+// @tags limit
+// @description Задает или заменяет лимит на операцию за период, задавшим лимит считается вызывающий. Для пользователя действует самый частный лимит: пользователя, затем его уровня, затем глобальный. Лимит проверяется на последующих операциях, превышение возвращает 422 с кодом limit-exceeded
+// @accept json
+// @produce json
+// @param SetLimitRuleRequest body dto.SetLimitRuleRequest true "scope - global, tier или user.<br> scopeId - не передается для global, уровень для tier, id пользователя (UUID) для user.<br> operation - deposit, reserve или withdraw.<br> period - transaction (одна операция), day или month (календарные сутки или месяц UTC).<br> amount - лимит больше 0"
+// @success 200 {object} dto.LimitRule "Лимит задан"
+// @failure 400 {object} dto.ApiError "Невалидный запрос"
+// @security ApiKeyAuth
+// @security BearerAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 403 {object} dto.ApiError "Нет права limit:manage"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @failure 499 {object} dto.ApiError "Клиент отменил запрос"
+// @failure 504 {object} dto.ApiError "Истек таймаут запроса в бд"
+// @router /limits [put]
+func (s *httpServer) HandleSetLimit(w http.ResponseWriter, r *http.Request) {
+	var request dto.SetLimitRuleRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendError(w, r, newRequestError("invalid request body"))
+		return
+	}
+
+	if err := validateRequest(s.validator, request); err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	rule := limitRuleRequest(request)
+
+	if err := s.validateLimitScope(rule.Scope, rule.ScopeId); err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	if rule, err := s.limitService.SetRule(r.Context(), rule); err != nil {
+		s.sendError(w, r, err)
+	} else {
+		s.sendJsonResponse(r.Context(), w, http.StatusOK, limitRuleResponse(rule))
+	}
+}
+
+// HandleDeleteLimit
+// @summary Удаление лимита
+// @tags limit
+// @description Удаляет лимит, после чего для пользователей действует следующий по частности лимит или лимита нет
+// @accept json
+// @produce json
+// @param scope query string true "На кого задан лимит" Enums(global, tier, user)
+// @param scopeId query string false "Уровень для tier, id пользователя для user"
+// @param operation query string true "Операция" Enums(deposit, reserve, withdraw)
+// @param period query string true "Период" Enums(transaction, day, month)
+// @success 204 "Лимит удален"
+// @failure 400 {object} dto.ApiError "Невалидный запрос"
+// @failure 404 {object} dto.ApiError "Лимит не найден"
+// @security ApiKeyAuth
+// @security BearerAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 403 {object} dto.ApiError "Нет права limit:manage"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @failure 499 {object} dto.ApiError "Клиент отменил запрос"
+// @failure 504 {object} dto.ApiError "Истек таймаут запроса в бд"
+// @router /limits [delete]
+func (s *httpServer) HandleDeleteLimit(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	values := make(map[string]string, 3)
+
+	for _, param := range []struct{ name, values string }{
+		{"scope", "global tier user"},
+		{"operation", "deposit reserve withdraw"},
+		{"period", "transaction day month"},
+	} {
+		values[param.name] = query.Get(param.name)
+
+		if err := s.validator.Var(values[param.name], "oneof="+param.values); err != nil {
+			s.sendError(w, r, newRequestError("parameter %s should be in [%s]", param.name, param.values))
+			return
+		}
+	}
+
+	rule := model.LimitRule{
+		Scope:     model.LimitScope(values["scope"]),
+		ScopeId:   query.Get("scopeId"),
+		Operation: model.LimitOperation(values["operation"]),
+		Period:    model.LimitPeriod(values["period"]),
+	}
+
+	if err := s.validateLimitScope(rule.Scope, rule.ScopeId); err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	if err := s.limitService.DeleteRule(r.Context(), rule); err != nil {
+		s.sendError(w, r, err)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleGetUserLimits
+// @summary Лимиты пользователя
+// @tags limit
+// @description Возвращает уровень пользователя и действующие для него лимиты: сколько использовано в текущих сутках или месяце UTC, остаток и когда период сбросится. Для лимита одной операции used и resetTime не передаются
+// @accept json
+// @produce json
+// @param userId path string true "id пользователя" Format(uuid)
+// @success 200 {object} dto.UserLimits
+// @failure 400 {object} dto.ApiError "Невалидный id"
+// @security ApiKeyAuth
+// @security BearerAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 403 {object} dto.ApiError "Нет права limit:read"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @failure 499 {object} dto.ApiError "Клиент отменил запрос"
+// @failure 504 {object} dto.ApiError "Истек таймаут запроса в бд"
+// @router /limits/users/{userId} [get]
+func (s *httpServer) HandleGetUserLimits(w http.ResponseWriter, r *http.Request) {
+	userId, ok := s.accountUserId(w, r)
+	if !ok {
+		return
+	}
+
+	if limits, err := s.limitService.GetUserLimits(r.Context(), userId); err != nil {
+		s.sendError(w, r, err)
+	} else {
+		s.sendJsonResponse(r.Context(), w, http.StatusOK, userLimitsResponse(limits))
+	}
+}
+
+// HandleSetUserTier
+// @summary Изменение уровня пользователя
+// @tags limit
+// @description Задает уровень пользователя, по которому выбираются лимиты уровня. Задавшим уровень считается вызывающий
+// @accept json
+// @produce json
+// @param userId path string true "id пользователя" Format(uuid)
+// @param SetUserTierRequest body dto.SetUserTierRequest true "tier - уровень пользователя"
+// @success 200 {object} dto.UserTier "Уровень задан"
+// @failure 400 {object} dto.ApiError "Невалидный запрос"
+// @security ApiKeyAuth
+// @security BearerAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 403 {object} dto.ApiError "Нет права limit:manage"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @failure 499 {object} dto.ApiError "Клиент отменил запрос"
+// @failure 504 {object} dto.ApiError "Истек таймаут запроса в бд"
+// @router /limits/users/{userId}/tier [put]
+func (s *httpServer) HandleSetUserTier(w http.ResponseWriter, r *http.Request) {
+	userId, ok := s.accountUserId(w, r)
+	if !ok {
+		return
+	}
+
+	var request dto.SetUserTierRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendError(w, r, newRequestError("invalid request body"))
+		return
+	}
+
+	if err := validateRequest(s.validator, request); err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	if tier, err := s.limitService.SetUserTier(r.Context(), userId, *request.Tier); err != nil {
+		s.sendError(w, r, err)
+	} else {
+		s.sendJsonResponse(r.Context(), w, http.StatusOK, userTierResponse(tier))
+	}
+}
+
+// validateLimitScope проверяет scopeId для scope: у глобального лимита пустой, у лимита уровня - уровень,
+// у лимита пользователя - id пользователя
+func (s *httpServer) validateLimitScope(scope model.LimitScope, scopeId string) error {
+	switch scope {
+	case model.LimitGlobal:
+		if scopeId != "" {
+			return newRequestError("scopeId should be empty for scope global")
+		}
+	case model.LimitTier:
+		if scopeId == "" || len(scopeId) > 100 {
+			return newRequestError("scopeId should be tier of 1-100 characters for scope tier")
+		}
+	case model.LimitUser:
+		if err := s.validator.Var(scopeId, "uuid"); err != nil {
+			return newRequestError("scopeId should be uuid for scope user")
+		}
+	}
+
+	return nil
+}
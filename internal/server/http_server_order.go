@@ -0,0 +1,172 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/avito-test/internal/dto"
+	"github.com/gorilla/mux"
+)
+
+// HandleCreateOrder
+// @summary Создание заказа из нескольких услуг
+// @tags order
+// @description Создает заказ и резервирует деньги под все строки (услуги) в одной транзакции бд: если не удалась резервация хотя бы одной строки, заказ не создается.
+// @accept json
+// @produce json
+// @param CreateOrderRequest body dto.CreateOrderRequest true "orderId - id заказа (UUID).<br> userId - id пользователя (UUID).<br> lines - строки заказа (от 1 до 100, услуги не повторяются): serviceId - id услуги (UUID), sum - сумма (больше 0), comment - комментарий (опционально)"
+// @success 201 {object} dto.Order "Заказ создан, все строки зарезервированы"
+// @failure 400 {object} dto.ApiError "Невалидный запрос, в том числе повтор serviceId в строках"
+// @failure 423 {object} dto.ApiError "Резервация запрещена статусом счета"
+// @security ApiKeyAuth
+// @security BearerAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 403 {object} dto.ApiError "Нет права transaction:write"
+// @failure 404 {object} dto.ApiError "Баланс пользователя не найден"
+// @failure 409 {object} dto.ApiError "Заказ или резервация по услуге заказа уже существует"
+// @failure 422 {object} dto.ApiError "Недостаточно средств на балансе или превышен лимит резерваций (limit-exceeded)"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @failure 499 {object} dto.ApiError "Клиент отменил запрос"
+// @failure 504 {object} dto.ApiError "Истек таймаут запроса в бд"
+// @router /orders [post]
+func (s *httpServer) HandleCreateOrder(w http.ResponseWriter, r *http.Request) {
+	var request dto.CreateOrderRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendError(w, r, newRequestError("invalid request body"))
+		return
+	}
+
+	if err := validateRequest(s.validator, request); err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	if order, err := s.orderService.CreateOrder(r.Context(), orderRequest(request)); err != nil {
+		s.sendError(w, r, err)
+	} else {
+		s.sendJsonResponse(r.Context(), w, http.StatusCreated, orderResponse(order))
+	}
+}
+
+// HandleGetOrder
+// @summary Получение заказа
+// @tags order
+// @description Возвращает заказ со строками, созданными заказом (резервации api v1 с тем же orderId не входят). Статус заказа выводится из статусов строк: reserved - все строки зарезервированы, partially_processed - часть строк еще зарезервирована, captured - все подтверждены, cancelled - все отменены, completed - часть подтверждена, часть отменена
+// @accept json
+// @produce json
+// @param orderId path string true "id заказа" Format(uuid)
+// @success 200 {object} dto.Order
+// @failure 400 {object} dto.ApiError "Невалидный orderId"
+// @failure 404 {object} dto.ApiError "Заказ не найден"
+// @security ApiKeyAuth
+// @security BearerAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 403 {object} dto.ApiError "Нет права transaction:read"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @failure 499 {object} dto.ApiError "Клиент отменил запрос"
+// @failure 504 {object} dto.ApiError "Истек таймаут запроса в бд"
+// @router /orders/{orderId} [get]
+func (s *httpServer) HandleGetOrder(w http.ResponseWriter, r *http.Request) {
+	orderId := mux.Vars(r)["orderId"]
+
+	if err := s.validator.Var(orderId, "uuid"); err != nil {
+		s.sendError(w, r, newRequestError("parameter orderId should be uuid"))
+		return
+	}
+
+	if order, err := s.orderService.GetOrder(r.Context(), orderId); err != nil {
+		s.sendError(w, r, err)
+	} else {
+		s.sendJsonResponse(r.Context(), w, http.StatusOK, orderResponse(order))
+	}
+}
+
+// HandleCaptureOrderLine
+// @summary Признание выручки по строке заказа
+// @tags order
+// @description Списывает зарезервированные деньги по одной строке заказа (услуге)
+// @accept json
+// @produce json
+// @param orderId path string true "id заказа" Format(uuid)
+// @param serviceId path string true "id услуги" Format(uuid)
+// @param ReservationActionRequest body dto.ReservationActionRequest false "comment - комментарий (опционально)"
+// @success 200 {object} dto.Order "Выручка по строке признана, в ответе заказ"
+// @failure 400 {object} dto.ApiError "Невалидный запрос"
+// @failure 423 {object} dto.ApiError "Подтверждение запрещено статусом счета (frozen-all, closed)"
+// @security ApiKeyAuth
+// @security BearerAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 403 {object} dto.ApiError "Нет права transaction:write"
+// @failure 404 {object} dto.ApiError "Заказ или строка заказа не найдены"
+// @failure 409 {object} dto.ApiError "Строка уже подтверждена или отменена"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @failure 499 {object} dto.ApiError "Клиент отменил запрос"
+// @failure 504 {object} dto.ApiError "Истек таймаут запроса в бд"
+// @router /orders/{orderId}/lines/{serviceId}/capture [post]
+func (s *httpServer) HandleCaptureOrderLine(w http.ResponseWriter, r *http.Request) {
+	orderId, serviceId, request, ok := s.orderLineActionRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if order, err := s.orderService.CaptureLine(r.Context(), orderId, serviceId, request.Comment); err != nil {
+		s.sendError(w, r, err)
+	} else {
+		s.sendJsonResponse(r.Context(), w, http.StatusOK, orderResponse(order))
+	}
+}
+
+// HandleCancelOrderLine
+// @summary Отмена строки заказа
+// @tags order
+// @description Отменяет резервацию по одной строке заказа (услуге) и возвращает деньги на основной баланс
+// @accept json
+// @produce json
+// @param orderId path string true "id заказа" Format(uuid)
+// @param serviceId path string true "id услуги" Format(uuid)
+// @param ReservationActionRequest body dto.ReservationActionRequest false "comment - комментарий (опционально)"
+// @success 200 {object} dto.Order "Строка отменена, в ответе заказ"
+// @failure 400 {object} dto.ApiError "Невалидный запрос"
+// @failure 423 {object} dto.ApiError "Отмена запрещена статусом счета (frozen-all, closed)"
+// @security ApiKeyAuth
+// @security BearerAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 403 {object} dto.ApiError "Нет права transaction:write"
+// @failure 404 {object} dto.ApiError "Заказ или строка заказа не найдены"
+// @failure 409 {object} dto.ApiError "Строка уже подтверждена или отменена"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @failure 499 {object} dto.ApiError "Клиент отменил запрос"
+// @failure 504 {object} dto.ApiError "Истек таймаут запроса в бд"
+// @router /orders/{orderId}/lines/{serviceId}/cancel [post]
+func (s *httpServer) HandleCancelOrderLine(w http.ResponseWriter, r *http.Request) {
+	orderId, serviceId, request, ok := s.orderLineActionRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if order, err := s.orderService.CancelLine(r.Context(), orderId, serviceId, request.Comment); err != nil {
+		s.sendError(w, r, err)
+	} else {
+		s.sendJsonResponse(r.Context(), w, http.StatusOK, orderResponse(order))
+	}
+}
+
+// orderLineActionRequest разбирает orderId и serviceId из пути и необязательное тело запроса capture/cancel
+func (s *httpServer) orderLineActionRequest(w http.ResponseWriter, r *http.Request) (string, string, dto.ReservationActionRequest, bool) {
+	params := mux.Vars(r)
+
+	if err := s.validator.Var(params["orderId"], "uuid"); err != nil {
+		s.sendError(w, r, newRequestError("parameter orderId should be uuid"))
+		return "", "", dto.ReservationActionRequest{}, false
+	}
+
+	if err := s.validator.Var(params["serviceId"], "uuid"); err != nil {
+		s.sendError(w, r, newRequestError("parameter serviceId should be uuid"))
+		return "", "", dto.ReservationActionRequest{}, false
+	}
+
+	request, ok := s.actionRequest(w, r)
+
+	return params["orderId"], params["serviceId"], request, ok
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/avito-test/internal/config/logger"
+	"github.com/avito-test/internal/model"
+	"github.com/avito-test/internal/publisher"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+// webSocketWriteTimeout - таймаут записи одного сообщения в WebSocket
+const webSocketWriteTimeout = 10 * time.Second
+
+var upgrader = websocket.Upgrader{
+	// аутентификация только по заголовкам, cookie не используются, поэтому запросы с чужих origin не опасны
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// HandleBalanceStream
+// @summary Поток изменений баланса
+// @tags balance
+// @description Отправляет события об изменении баланса пользователя (deposit, reserved, captured, cancelled) в формате Server-Sent Events: id - sequence события, event - тип, data - событие в json (как в брокере, в data.balance - баланс после операции). Первое событие balance - текущий баланс. Раз в STREAM_HEARTBEAT отправляется комментарий heartbeat. Чтобы продолжить поток после разрыва, передайте sequence последнего полученного события в заголовке Last-Event-ID (EventSource делает это сам) или параметре lastEventId, тогда снимок не отправляется. С заголовком Upgrade: websocket поток отправляется через WebSocket, каждое сообщение - событие в json
+// @produce text/event-stream
+// @param userId path string true "id пользователя" Format(uuid)
+// @param lastEventId query integer false "sequence последнего полученного события" minimum(0)
+// @param Last-Event-ID header integer false "sequence последнего полученного события" minimum(0)
+// @success 200 {string} string "Поток событий"
+// @failure 400 {object} dto.ApiError "Невалидный userId или lastEventId"
+// @security ApiKeyAuth
+// @security BearerAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 403 {object} dto.ApiError "Нет права balance:read"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @router /balance/{userId}/stream [get]
+func (s *httpServer) HandleBalanceStream(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["userId"]
+
+	if err := s.validator.Var(userId, "uuid"); err != nil {
+		s.sendError(w, r, newRequestError("parameter userId should be uuid"))
+		return
+	}
+
+	lastSequence, err := lastEventId(r)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	if websocket.IsWebSocketUpgrade(r) {
+		s.streamWebSocket(w, r, userId, lastSequence)
+	} else {
+		s.streamSse(w, r, userId, lastSequence)
+	}
+}
+
+func (s *httpServer) streamSse(w http.ResponseWriter, r *http.Request, userId string, lastSequence *int64) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.sendError(w, r, errors.New("response writer does not support flushing"))
+		return
+	}
+
+	// заголовки отправляются с первым сообщением, до этого ошибку можно вернуть обычным ответом
+	started := false
+
+	write := func(format string, args ...any) error {
+		if !started {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("X-Accel-Buffering", "no")
+			w.WriteHeader(http.StatusOK)
+
+			started = true
+		}
+
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return err
+		}
+
+		flusher.Flush()
+
+		return nil
+	}
+
+	send := func(event model.Event) error {
+		data, err := publisher.Encode(event)
+		if err != nil {
+			return err
+		}
+
+		return write("id: %d\nevent: %s\ndata: %s\n\n", event.Sequence, event.Type, data)
+	}
+
+	heartbeat := func() error {
+		return write(": heartbeat\n\n")
+	}
+
+	err := s.balanceStream.Stream(r.Context(), userId, lastSequence, send, heartbeat)
+	if err == nil {
+		return
+	}
+
+	if !started {
+		s.sendError(w, r, err)
+		return
+	}
+
+	if !isCanceled(r.Context(), err) {
+		logger.FromContext(r.Context()).WithFields(logrus.Fields{
+			"error_message": err.Error(),
+		}).Error("balance stream failed")
+	}
+}
+
+func (s *httpServer) streamWebSocket(w http.ResponseWriter, r *http.Request, userId string, lastSequence *int64) {
+	// при ошибке Upgrade сам отвечает клиенту
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	// чтение обрабатывает ping и close от клиента, закрытие соединения завершает поток
+	go func() {
+		defer cancel()
+
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(event model.Event) error {
+		data, err := publisher.Encode(event)
+		if err != nil {
+			return err
+		}
+
+		if err := conn.SetWriteDeadline(time.Now().Add(webSocketWriteTimeout)); err != nil {
+			return err
+		}
+
+		return conn.WriteMessage(websocket.TextMessage, data)
+	}
+
+	heartbeat := func() error {
+		return conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(webSocketWriteTimeout))
+	}
+
+	closeCode, closeText := websocket.CloseNormalClosure, ""
+
+	if err := s.balanceStream.Stream(ctx, userId, lastSequence, send, heartbeat); err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"error_message": err.Error(),
+		}).Error("balance stream failed")
+
+		closeCode, closeText = websocket.CloseInternalServerErr, internalServerError.Error()
+	}
+
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(closeCode, closeText), time.Now().Add(webSocketWriteTimeout))
+}
+
+// lastEventId возвращает sequence последнего полученного события из заголовка Last-Event-ID или параметра lastEventId
+func lastEventId(r *http.Request) (*int64, error) {
+	value := r.Header.Get("Last-Event-ID")
+
+	if value == "" {
+		value = r.URL.Query().Get("lastEventId")
+	}
+
+	if value == "" {
+		return nil, nil
+	}
+
+	sequence, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || sequence < 0 {
+		return nil, newRequestError("parameter lastEventId should be integer >= 0")
+	}
+
+	return &sequence, nil
+}
@@ -0,0 +1,597 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/avito-test/internal/config"
+	"github.com/avito-test/internal/dto"
+)
+
+const (
+	user1 = "11111111-1111-4111-8111-111111111111"
+	user2 = "22222222-2222-4222-8222-222222222222"
+
+	order1 = "a1111111-1111-4111-8111-111111111111"
+	order2 = "a2222222-2222-4222-8222-222222222222"
+	order3 = "a3333333-3333-4333-8333-333333333333"
+	order4 = "a4444444-4444-4444-8444-444444444444"
+	order5 = "a5555555-5555-4555-8555-555555555555"
+
+	service1 = "b1111111-1111-4111-8111-111111111111"
+	service2 = "b2222222-2222-4222-8222-222222222222"
+	service3 = "b3333333-3333-4333-8333-333333333333"
+
+	unknownId = "c0000000-0000-4000-8000-000000000000"
+)
+
+// call - запрос, ответ на который сравнивается с golden файлом подтеста name
+type call struct {
+	name   string
+	method string
+	path   string
+	key    string
+	body   interface{}
+}
+
+// run выполняет запросы по порядку, каждый в своем подтесте
+func (h *harness) run(t *testing.T, calls []call) {
+	t.Helper()
+
+	for _, c := range calls {
+		c := c
+
+		t.Run(c.name, func(t *testing.T) {
+			golden(t, h.do(t, c.method, c.path, c.key, c.body))
+		})
+	}
+}
+
+// runJson выполняет запрос как run и декодирует ответ в v, чтобы следующие запросы использовали id из ответа
+func (h *harness) runJson(t *testing.T, c call, v interface{}) {
+	t.Helper()
+
+	t.Run(c.name, func(t *testing.T) {
+		w := h.do(t, c.method, c.path, c.key, c.body)
+		golden(t, w)
+
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s: %v", c.method, c.path, err)
+		}
+	})
+}
+
+func deposit(userId string, sum float64) map[string]interface{} {
+	return map[string]interface{}{"userId": userId, "sum": sum, "comment": "пополнение"}
+}
+
+func transaction(userId string, orderId string, serviceId string, sum float64, transactionType int) map[string]interface{} {
+	return map[string]interface{}{
+		"userId":          userId,
+		"orderId":         orderId,
+		"serviceId":       serviceId,
+		"sum":             sum,
+		"transactionType": transactionType,
+	}
+}
+
+func reservation(userId string, orderId string, serviceId string, sum float64) map[string]interface{} {
+	return map[string]interface{}{"userId": userId, "orderId": orderId, "serviceId": serviceId, "sum": sum}
+}
+
+func TestBalance(t *testing.T) {
+	h := newHarness(t)
+
+	h.run(t, []call{
+		{"increase_unauthenticated", http.MethodPost, "/balance", "", deposit(user1, 100)},
+		{"increase_invalid_key", http.MethodPost, "/balance", "wrong-key", deposit(user1, 100)},
+		{"increase_forbidden", http.MethodPost, "/balance", supportKey, deposit(user1, 100)},
+		{"increase_invalid_body", http.MethodPost, "/balance", paymentKey, "{"},
+		{"increase_validation", http.MethodPost, "/balance", paymentKey, map[string]interface{}{"userId": "user", "sum": -1}},
+		{"increase_ok", http.MethodPost, "/balance", paymentKey, deposit(user1, 100.5)},
+		{"increase_again", http.MethodPost, "/balance", paymentKey, deposit(user1, 0.25)},
+		{"get_invalid_user", http.MethodGet, "/balance/user", supportKey, nil},
+		{"get_not_found", http.MethodGet, "/balance/" + user2, supportKey, nil},
+		{"get_ok", http.MethodGet, "/balance/" + user1, supportKey, nil},
+		{"stream_invalid_user", http.MethodGet, "/balance/user/stream", supportKey, nil},
+		{"stream_unauthenticated", http.MethodGet, "/balance/" + user1 + "/stream", "", nil},
+	})
+}
+
+// TestSaveTransaction проходит все статусы save_transaction
+func TestSaveTransaction(t *testing.T) {
+	h := newHarness(t)
+
+	h.do(t, http.MethodPost, "/balance", paymentKey, deposit(user1, 100))
+
+	h.run(t, []call{
+		{"invalid_body", http.MethodPost, "/transaction", adminKey, "{"},
+		{"validation", http.MethodPost, "/transaction", adminKey, map[string]interface{}{"userId": user1, "orderId": "order", "sum": 0, "transactionType": 4}},
+		{"forbidden", http.MethodPost, "/transaction", supportKey, transaction(user1, order1, service1, 30, 1)},
+		{"status_1_reserved", http.MethodPost, "/transaction", adminKey, transaction(user1, order1, service1, 30, 1)},
+		{"status_2_reservation_exists", http.MethodPost, "/transaction", adminKey, transaction(user1, order1, service1, 30, 1)},
+		{"status_3_insufficient_funds", http.MethodPost, "/transaction", adminKey, transaction(user1, order2, service1, 1000, 1)},
+		{"status_4_capture_not_found", http.MethodPost, "/transaction", adminKey, transaction(user1, order3, service1, 30, 2)},
+		{"status_1_captured", http.MethodPost, "/transaction", adminKey, transaction(user1, order1, service1, 30, 2)},
+		{"status_5_already_captured", http.MethodPost, "/transaction", adminKey, transaction(user1, order1, service1, 30, 2)},
+		{"status_9_cancel_captured", http.MethodPost, "/transaction", adminKey, transaction(user1, order1, service1, 30, 3)},
+		{"status_1_reserved_second", http.MethodPost, "/transaction", adminKey, transaction(user1, order4, service1, 10, 1)},
+		{"status_1_cancelled", http.MethodPost, "/transaction", adminKey, transaction(user1, order4, service1, 10, 3)},
+		{"status_6_capture_cancelled", http.MethodPost, "/transaction", adminKey, transaction(user1, order4, service1, 10, 2)},
+		{"status_8_already_cancelled", http.MethodPost, "/transaction", adminKey, transaction(user1, order4, service1, 10, 3)},
+		{"status_7_cancel_not_found", http.MethodPost, "/transaction", adminKey, transaction(user1, order5, service1, 10, 3)},
+		{"status_10_balance_not_found", http.MethodPost, "/transaction", adminKey, transaction(user2, order1, service1, 10, 1)},
+		{"balance", http.MethodGet, "/balance/" + user1, adminKey, nil},
+	})
+}
+
+func TestReservations(t *testing.T) {
+	h := newHarness(t)
+
+	h.do(t, http.MethodPost, "/balance", paymentKey, deposit(user1, 100))
+
+	var captured, cancelled dto.Reservation
+
+	h.json(t, http.MethodPost, "/reservations", adminKey, reservation(user1, order1, service1, 40), http.StatusCreated, &captured)
+	h.json(t, http.MethodPost, "/reservations", adminKey, reservation(user1, order2, service1, 20), http.StatusCreated, &cancelled)
+
+	h.run(t, []call{
+		{"create_validation", http.MethodPost, "/reservations", adminKey, map[string]interface{}{"userId": user1}},
+		{"create_ok", http.MethodPost, "/reservations", adminKey, reservation(user1, order3, service2, 15)},
+		{"create_exists", http.MethodPost, "/reservations", adminKey, reservation(user1, order3, service2, 15)},
+		{"create_insufficient_funds", http.MethodPost, "/reservations", adminKey, reservation(user1, order4, service2, 1000)},
+		{"create_balance_not_found", http.MethodPost, "/reservations", adminKey, reservation(user2, order4, service2, 10)},
+		{"capture_invalid_id", http.MethodPost, "/reservations/id/capture", adminKey, nil},
+		{"capture_not_found", http.MethodPost, "/reservations/" + unknownId + "/capture", adminKey, nil},
+		{"capture_ok", http.MethodPost, "/reservations/" + captured.Id + "/capture", adminKey, map[string]interface{}{"comment": "оплата подтверждена"}},
+		{"capture_again", http.MethodPost, "/reservations/" + captured.Id + "/capture", adminKey, nil},
+		{"cancel_captured", http.MethodPost, "/reservations/" + captured.Id + "/cancel", adminKey, nil},
+		{"cancel_invalid_body", http.MethodPost, "/reservations/" + cancelled.Id + "/cancel", adminKey, "{"},
+		{"cancel_ok", http.MethodPost, "/reservations/" + cancelled.Id + "/cancel", adminKey, nil},
+		{"cancel_again", http.MethodPost, "/reservations/" + cancelled.Id + "/cancel", adminKey, nil},
+		{"capture_cancelled", http.MethodPost, "/reservations/" + cancelled.Id + "/capture", adminKey, nil},
+		{"cancel_not_found", http.MethodPost, "/reservations/" + unknownId + "/cancel", adminKey, nil},
+	})
+}
+
+func TestTransactions(t *testing.T) {
+	h := newHarness(t)
+
+	h.do(t, http.MethodPost, "/balance", paymentKey, deposit(user1, 100))
+	h.do(t, http.MethodPost, "/transaction", adminKey, transaction(user1, order1, service1, 10, 1))
+	h.do(t, http.MethodPost, "/transaction", adminKey, transaction(user1, order1, service2, 20, 1))
+	h.do(t, http.MethodPost, "/transaction", adminKey, transaction(user1, order2, service1, 30, 1))
+	h.do(t, http.MethodPost, "/transaction", adminKey, transaction(user1, order1, service1, 10, 2))
+	h.do(t, http.MethodPost, "/transaction", adminKey, transaction(user1, order1, service2, 20, 3))
+
+	list := "/transaction?userId=" + user1
+
+	var all dto.GetTransactionsResponse
+	h.json(t, http.MethodGet, list, supportKey, nil, http.StatusOK, &all)
+
+	if len(all.Transactions) != 4 {
+		t.Fatalf("got %d transactions, want 4", len(all.Transactions))
+	}
+
+	var first, second dto.GetTransactionsResponse
+	h.json(t, http.MethodGet, list+"&itemsPerPage=2", supportKey, nil, http.StatusOK, &first)
+	h.json(t, http.MethodGet, list+"&itemsPerPage=2&cursor="+url.QueryEscape(*first.NextCursor), supportKey, nil, http.StatusOK, &second)
+
+	// страницы по курсору вместе дают тот же список, что и один запрос
+	if paged := append(first.Transactions, second.Transactions...); !reflect.DeepEqual(paged, all.Transactions) {
+		t.Errorf("cursor pages %v differ from full list %v", paged, all.Transactions)
+	}
+
+	if second.HasMore || second.NextCursor != nil {
+		t.Errorf("last page should not have next cursor")
+	}
+
+	history := all.Transactions[1].Id
+
+	h.run(t, []call{
+		{"list_all", http.MethodGet, list, supportKey, nil},
+		{"list_first_page", http.MethodGet, list + "&itemsPerPage=2", supportKey, nil},
+		{"list_next_page", http.MethodGet, list + "&itemsPerPage=2&cursor=" + url.QueryEscape(*first.NextCursor), supportKey, nil},
+		{"list_page_mode", http.MethodGet, list + "&itemsPerPage=3&page=2", supportKey, nil},
+		{"list_sort_sum_asc", http.MethodGet, list + "&sortBy=sum&sortType=asc", supportKey, nil},
+		{"list_filter_types", http.MethodGet, list + "&transactionType=2&transactionType=3", supportKey, nil},
+		{"list_filter_sum", http.MethodGet, list + "&sumFrom=15&sumTo=30", supportKey, nil},
+		{"list_filter_service", http.MethodGet, list + "&serviceId=" + service1, supportKey, nil},
+		{"list_filter_order", http.MethodGet, list + "&orderId=" + order2, supportKey, nil},
+		{"list_filter_comment", http.MethodGet, list + "&comment=" + url.QueryEscape("ПОПОЛНЕНИЕ"), supportKey, nil},
+		{"list_filter_date", http.MethodGet, list + "&dateFrom=2022-11-01T10:00:02Z&dateTo=2022-11-01T10:00:05Z", supportKey, nil},
+		{"list_empty", http.MethodGet, "/transaction?userId=" + user2, supportKey, nil},
+		{"list_missing_user", http.MethodGet, "/transaction", supportKey, nil},
+		{"list_cursor_and_page", http.MethodGet, list + "&page=1&cursor=" + url.QueryEscape(*first.NextCursor), supportKey, nil},
+		{"list_invalid_cursor", http.MethodGet, list + "&cursor=abc", supportKey, nil},
+		{"list_cursor_other_sort", http.MethodGet, list + "&sortBy=sum&cursor=" + url.QueryEscape(*first.NextCursor), supportKey, nil},
+		{"list_invalid_items_per_page", http.MethodGet, list + "&itemsPerPage=101", supportKey, nil},
+		{"list_invalid_type", http.MethodGet, list + "&transactionType=x", supportKey, nil},
+		{"list_invalid_sort", http.MethodGet, list + "&sortBy=name&sortType=up", supportKey, nil},
+		{"list_invalid_date", http.MethodGet, list + "&dateFrom=yesterday", supportKey, nil},
+		{"list_forbidden", http.MethodGet, list, paymentKey, nil},
+		{"history", http.MethodGet, "/transaction/" + history, supportKey, nil},
+		{"history_invalid_id", http.MethodGet, "/transaction/id", supportKey, nil},
+		{"history_not_found", http.MethodGet, "/transaction/" + unknownId, supportKey, nil},
+		{"order", http.MethodGet, "/orders/" + order1 + "/transactions", supportKey, nil},
+		{"order_unknown", http.MethodGet, "/orders/" + unknownId + "/transactions", supportKey, nil},
+		{"order_invalid_id", http.MethodGet, "/orders/order/transactions", supportKey, nil},
+	})
+}
+
+func TestReport(t *testing.T) {
+	h := newHarness(t)
+
+	h.do(t, http.MethodPost, "/balance", paymentKey, deposit(user1, 100))
+	h.do(t, http.MethodPost, "/transaction", adminKey, transaction(user1, order1, service1, 10, 1))
+	h.do(t, http.MethodPost, "/transaction", adminKey, transaction(user1, order2, service1, 15.5, 1))
+	h.do(t, http.MethodPost, "/transaction", adminKey, transaction(user1, order1, service2, 20, 1))
+	h.do(t, http.MethodPost, "/transaction", adminKey, transaction(user1, order1, service1, 10, 2))
+	h.do(t, http.MethodPost, "/transaction", adminKey, transaction(user1, order2, service1, 15.5, 2))
+	h.do(t, http.MethodPost, "/transaction", adminKey, transaction(user1, order1, service2, 20, 3))
+
+	var report, empty dto.CreateReportResponse
+	h.json(t, http.MethodPost, "/report", adminKey, map[string]interface{}{"year": 2022, "month": 11}, http.StatusOK, &report)
+	h.json(t, http.MethodPost, "/report", adminKey, map[string]interface{}{"year": 2022, "month": 12}, http.StatusOK, &empty)
+
+	h.run(t, []call{
+		{"create_invalid_body", http.MethodPost, "/report", adminKey, "{"},
+		{"create_validation", http.MethodPost, "/report", adminKey, map[string]interface{}{"year": 2021, "month": 13}},
+		{"create_forbidden", http.MethodPost, "/report", supportKey, map[string]interface{}{"year": 2022, "month": 11}},
+		{"create_ok", http.MethodPost, "/report", adminKey, map[string]interface{}{"year": 2022, "month": 11}},
+		{"download_not_found", http.MethodGet, "/report/" + unknownId + ".csv", adminKey, nil},
+		{"download_invalid_name", http.MethodGet, "/report/missing.csv", adminKey, nil},
+		{"download_directory", http.MethodGet, "/report/", adminKey, nil},
+		{"download_forbidden", http.MethodGet, reportPath(t, report.URL), paymentKey, nil},
+	})
+
+	for name, link := range map[string]string{"download": report.URL, "download_empty": empty.URL} {
+		link := link
+
+		t.Run(name, func(t *testing.T) {
+			w := h.do(t, http.MethodGet, reportPath(t, link), adminKey, nil)
+
+			// тип csv файла ServeFile берет из mime таблиц системы, в golden файл он не попадает
+			w.Header().Del("Content-Type")
+
+			golden(t, w)
+		})
+	}
+}
+
+// reportPath - путь ссылки на отчет
+func reportPath(t *testing.T, link string) string {
+	t.Helper()
+
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return "/report/" + path.Base(u.Path)
+}
+
+func TestBatch(t *testing.T) {
+	h := newHarness(t)
+
+	operation := func(operationType string, userId string, orderId string, sum float64) map[string]interface{} {
+		op := map[string]interface{}{"type": operationType, "userId": userId, "sum": sum}
+
+		if orderId != "" {
+			op["orderId"] = orderId
+			op["serviceId"] = service1
+		}
+
+		return op
+	}
+
+	// невалидные операции сверх лимита: ошибка о количестве, а не о валидации каждой операции
+	tooMany := make([]interface{}, config.BatchMaxOperations+1)
+	for i := range tooMany {
+		tooMany[i] = map[string]interface{}{"type": "transfer"}
+	}
+
+	h.run(t, []call{
+		{"invalid_body", http.MethodPost, "/transaction/batch", adminKey, "{"},
+		{"validation", http.MethodPost, "/transaction/batch", adminKey, map[string]interface{}{"operations": []interface{}{
+			map[string]interface{}{"type": "transfer", "userId": user1, "sum": 1},
+			map[string]interface{}{"type": "reserve", "userId": user1, "sum": 1},
+		}}},
+		{"empty", http.MethodPost, "/transaction/batch", adminKey, map[string]interface{}{"operations": []interface{}{}}},
+		{"too_many_operations", http.MethodPost, "/transaction/batch", adminKey, map[string]interface{}{"operations": tooMany}},
+		{"deposit_forbidden", http.MethodPost, "/transaction/batch", supportKey, map[string]interface{}{"operations": []interface{}{
+			operation("deposit", user1, "", 100),
+		}}},
+		{"partial", http.MethodPost, "/transaction/batch", adminKey, map[string]interface{}{"atomic": false, "operations": []interface{}{
+			operation("deposit", user1, "", 100),
+			operation("reserve", user1, order1, 40),
+			operation("reserve", user1, order2, 1000),
+			operation("capture", user1, order1, 40),
+			operation("cancel", user1, order3, 10),
+			operation("reserve", user2, order1, 10),
+		}}},
+		{"atomic_rolled_back", http.MethodPost, "/transaction/batch", adminKey, map[string]interface{}{"atomic": true, "operations": []interface{}{
+			operation("deposit", user1, "", 100),
+			operation("reserve", user1, order4, 50),
+			operation("reserve", user1, order5, 1000),
+			operation("capture", user1, order4, 50),
+		}}},
+		{"balance", http.MethodGet, "/balance/" + user1, adminKey, nil},
+	})
+}
+
+// тело больше лимита отклоняется до middleware.Logging, который при LOG_BODY читает тело
+func TestBodyLimit(t *testing.T) {
+	logBody := config.LogBody
+	config.LogBody = true
+	t.Cleanup(func() { config.LogBody = logBody })
+
+	h := newHarness(t)
+
+	h.run(t, []call{
+		{"batch_too_large", http.MethodPost, "/transaction/batch", adminKey, map[string]interface{}{"operations": []interface{}{
+			map[string]interface{}{"type": "deposit", "userId": user1, "sum": 1, "comment": strings.Repeat("x", config.BatchMaxBodyBytes)},
+		}}},
+		{"too_large", http.MethodPost, "/balance", paymentKey, map[string]interface{}{"userId": user1, "sum": 1, "comment": strings.Repeat("x", config.HttpMaxBodyBytes)}},
+		{"deposit", http.MethodPost, "/balance", paymentKey, deposit(user1, 100)},
+	})
+}
+
+func TestOrders(t *testing.T) {
+	h := newHarness(t)
+
+	h.run(t, []call{
+		{"create_invalid_body", http.MethodPost, "/orders", adminKey, "{"},
+		{"create_validation", http.MethodPost, "/orders", adminKey, map[string]interface{}{"orderId": order1, "userId": user1, "lines": []interface{}{
+			map[string]interface{}{"serviceId": "service", "sum": 0},
+		}}},
+		{"create_duplicate_service", http.MethodPost, "/orders", adminKey, map[string]interface{}{"orderId": order1, "userId": user1, "lines": []interface{}{
+			map[string]interface{}{"serviceId": service1, "sum": 10},
+			map[string]interface{}{"serviceId": service1, "sum": 20},
+			map[string]interface{}{"sum": 30},
+		}}},
+		{"create_without_lines", http.MethodPost, "/orders", adminKey, map[string]interface{}{"orderId": order1, "userId": user1}},
+		{"create_forbidden", http.MethodPost, "/orders", supportKey, nil},
+		{"get_invalid_id", http.MethodGet, "/orders/order", supportKey, nil},
+		{"get_unauthenticated", http.MethodGet, "/orders/" + order1, "", nil},
+		{"capture_invalid_order", http.MethodPost, "/orders/order/lines/" + service1 + "/capture", adminKey, nil},
+		{"capture_invalid_service", http.MethodPost, "/orders/" + order1 + "/lines/service/capture", adminKey, nil},
+		{"cancel_invalid_body", http.MethodPost, "/orders/" + order1 + "/lines/" + service1 + "/cancel", adminKey, "{"},
+		{"cancel_forbidden", http.MethodPost, "/orders/" + order1 + "/lines/" + service1 + "/cancel", supportKey, nil},
+		{"deposit", http.MethodPost, "/balance", adminKey, deposit(user1, 300)},
+		{"create", http.MethodPost, "/orders", adminKey, map[string]interface{}{"orderId": order1, "userId": user1, "lines": []interface{}{
+			map[string]interface{}{"serviceId": service1, "sum": 100, "comment": "доставка"},
+			map[string]interface{}{"serviceId": service2, "sum": 50},
+		}}},
+		{"create_existing", http.MethodPost, "/orders", adminKey, map[string]interface{}{"orderId": order1, "userId": user1, "lines": []interface{}{
+			map[string]interface{}{"serviceId": service3, "sum": 10},
+		}}},
+		{"create_insufficient_funds", http.MethodPost, "/orders", adminKey, map[string]interface{}{"orderId": order2, "userId": user1, "lines": []interface{}{
+			map[string]interface{}{"serviceId": service1, "sum": 100},
+			map[string]interface{}{"serviceId": service2, "sum": 1000},
+		}}},
+		{"get_not_created", http.MethodGet, "/orders/" + order2, supportKey, nil},
+		// резервация api v1 с тем же заказом и пользователем не становится строкой заказа
+		{"reserve_v1", http.MethodPost, "/transaction", adminKey, transaction(user1, order1, service3, 20, 1)},
+		{"get", http.MethodGet, "/orders/" + order1, supportKey, nil},
+		{"capture", http.MethodPost, "/orders/" + order1 + "/lines/" + service1 + "/capture", adminKey, map[string]interface{}{"comment": "оказана"}},
+		{"capture_again", http.MethodPost, "/orders/" + order1 + "/lines/" + service1 + "/capture", adminKey, nil},
+		{"cancel", http.MethodPost, "/orders/" + order1 + "/lines/" + service2 + "/cancel", adminKey, nil},
+		{"cancel_v1_line", http.MethodPost, "/orders/" + order1 + "/lines/" + service3 + "/cancel", adminKey, nil},
+		{"get_completed", http.MethodGet, "/orders/" + order1, supportKey, nil},
+		{"get_unknown", http.MethodGet, "/orders/" + unknownId, supportKey, nil},
+		{"balance", http.MethodGet, "/balance/" + user1, adminKey, nil},
+	})
+}
+
+func TestWebhooks(t *testing.T) {
+	h := newHarness(t)
+
+	h.run(t, []call{
+		{"create_invalid_body", http.MethodPost, "/webhooks", adminKey, "{"},
+		{"create_validation", http.MethodPost, "/webhooks", adminKey, map[string]interface{}{"url": "ftp://partner.example.com", "eventTypes": []string{"refund"}}},
+		{"create_private", http.MethodPost, "/webhooks", adminKey, map[string]interface{}{"url": "http://10.0.0.5/events", "eventTypes": []string{"deposit"}}},
+		{"create_localhost", http.MethodPost, "/webhooks", adminKey, map[string]interface{}{"url": "http://localhost:8080/events", "eventTypes": []string{"deposit"}}},
+		{"create_metadata", http.MethodPost, "/webhooks", adminKey, map[string]interface{}{"url": "http://169.254.169.254/latest/meta-data", "eventTypes": []string{"deposit"}}},
+		{"create_forbidden", http.MethodPost, "/webhooks", supportKey, nil},
+		{"list_forbidden", http.MethodGet, "/webhooks", supportKey, nil},
+		{"get_invalid_id", http.MethodGet, "/webhooks/id", adminKey, nil},
+		{"delete_invalid_id", http.MethodDelete, "/webhooks/id", adminKey, nil},
+		{"deliveries_invalid_status", http.MethodGet, "/webhooks/" + unknownId + "/deliveries?status=lost", adminKey, nil},
+		{"redeliver_invalid_delivery", http.MethodPost, "/webhooks/" + unknownId + "/deliveries/delivery/redeliver", adminKey, nil},
+	})
+}
+
+// TestWebhookDeliveries - доставки создаются операциями с балансом по подходящим подпискам,
+// отдельный harness, чтобы не превысить лимит запросов webhooks
+func TestWebhookDeliveries(t *testing.T) {
+	h := newHarness(t)
+
+	var reserved, deposits dto.Webhook
+
+	h.runJson(t, call{"create", http.MethodPost, "/webhooks", adminKey, map[string]interface{}{
+		"url": "https://partner.example.com/events", "eventTypes": []string{"reserved", "captured"}, "serviceId": service1,
+	}}, &reserved)
+	h.runJson(t, call{"create_deposits", http.MethodPost, "/webhooks", adminKey, map[string]interface{}{
+		"url": "https://partner.example.com/deposits", "eventTypes": []string{"deposit"},
+	}}, &deposits)
+
+	h.run(t, []call{
+		{"list", http.MethodGet, "/webhooks", adminKey, nil},
+		{"get", http.MethodGet, "/webhooks/" + reserved.Id, adminKey, nil},
+		{"deposit", http.MethodPost, "/balance", adminKey, deposit(user1, 500)},
+		{"reserve", http.MethodPost, "/transaction", adminKey, transaction(user1, order1, service1, 100, 1)},
+		// услуга не совпадает с фильтром подписки
+		{"reserve_other_service", http.MethodPost, "/transaction", adminKey, transaction(user1, order1, service2, 50, 1)},
+		{"capture", http.MethodPost, "/transaction", adminKey, transaction(user1, order1, service1, 100, 2)},
+		{"deliveries_deposits", http.MethodGet, "/webhooks/" + deposits.Id + "/deliveries?status=pending", adminKey, nil},
+	})
+
+	var deliveries dto.GetWebhookDeliveriesResponse
+
+	h.runJson(t, call{"deliveries", http.MethodGet, "/webhooks/" + reserved.Id + "/deliveries", adminKey, nil}, &deliveries)
+
+	if len(deliveries.Deliveries) != 2 {
+		t.Fatalf("deliveries = %+v, want reserved and captured", deliveries.Deliveries)
+	}
+
+	h.run(t, []call{
+		{"redeliver", http.MethodPost, "/webhooks/" + reserved.Id + "/deliveries/" + deliveries.Deliveries[1].Id + "/redeliver", adminKey, nil},
+		{"redeliver_unknown", http.MethodPost, "/webhooks/" + reserved.Id + "/deliveries/" + unknownId + "/redeliver", adminKey, nil},
+		{"delete", http.MethodDelete, "/webhooks/" + reserved.Id, adminKey, nil},
+		{"get_deleted", http.MethodGet, "/webhooks/" + reserved.Id, adminKey, nil},
+	})
+}
+
+// TestAdjustments проверяет разбор запроса и права, решения по корректировкам - в TestAdjustmentDecisions
+func TestAdjustments(t *testing.T) {
+	h := newHarness(t)
+
+	h.run(t, []call{
+		{"create_invalid_body", http.MethodPost, "/adjustments", supportKey, "{"},
+		{"create_validation", http.MethodPost, "/adjustments", supportKey, map[string]interface{}{"userId": "user", "direction": "refund", "sum": 0}},
+		{"create_forbidden", http.MethodPost, "/adjustments", paymentKey, nil},
+		{"list_invalid_user", http.MethodGet, "/adjustments?userId=user", supportKey, nil},
+		{"list_invalid_status", http.MethodGet, "/adjustments?status=lost", supportKey, nil},
+		{"pending_forbidden", http.MethodGet, "/adjustments/pending", paymentKey, nil},
+		{"get_invalid_id", http.MethodGet, "/adjustments/id", supportKey, nil},
+		{"get_unauthenticated", http.MethodGet, "/adjustments/" + unknownId, "", nil},
+		{"approve_forbidden", http.MethodPost, "/adjustments/" + unknownId + "/approve", supportKey, nil},
+		{"approve_invalid_id", http.MethodPost, "/adjustments/id/approve", adminKey, nil},
+		{"reject_invalid_body", http.MethodPost, "/adjustments/" + unknownId + "/reject", adminKey, "{"},
+	})
+}
+
+func adjustment(userId string, direction string, sum float64) map[string]interface{} {
+	return map[string]interface{}{"userId": userId, "direction": direction, "sum": sum, "reason": "Двойное зачисление", "ticket": "SUP-1"}
+}
+
+// TestAdjustmentDecisions - support предлагает, admin решает: одобренная корректировка проводится, отклоненная баланс
+// не меняет, свою корректировку одобрить нельзя, решение принимается один раз
+func TestAdjustmentDecisions(t *testing.T) {
+	h := newHarness(t)
+
+	h.do(t, http.MethodPost, "/balance", paymentKey, deposit(user1, 100))
+
+	var credit, debit, own dto.Adjustment
+
+	h.runJson(t, call{"propose_credit", http.MethodPost, "/adjustments", supportKey, adjustment(user1, "credit", 50)}, &credit)
+	h.runJson(t, call{"propose_debit", http.MethodPost, "/adjustments", supportKey, adjustment(user1, "debit", 30)}, &debit)
+	h.runJson(t, call{"propose_own", http.MethodPost, "/adjustments", adminKey, adjustment(user1, "credit", 10)}, &own)
+
+	h.run(t, []call{
+		{"approve", http.MethodPost, "/adjustments/" + credit.Id + "/approve", adminKey, map[string]interface{}{"comment": "Проверено по выписке"}},
+		{"reject", http.MethodPost, "/adjustments/" + debit.Id + "/reject", adminKey, nil},
+		{"approve_own", http.MethodPost, "/adjustments/" + own.Id + "/approve", adminKey, nil},
+		{"approve_decided", http.MethodPost, "/adjustments/" + credit.Id + "/approve", adminKey, nil},
+		{"reject_decided", http.MethodPost, "/adjustments/" + debit.Id + "/reject", adminKey, nil},
+		{"approve_unknown", http.MethodPost, "/adjustments/" + unknownId + "/approve", adminKey, nil},
+		// одобренная корректировка зачислила 50, отклоненная списание не провела
+		{"balance", http.MethodGet, "/balance/" + user1, adminKey, nil},
+		{"transactions", http.MethodGet, "/transaction?userId=" + user1, adminKey, nil},
+		{"pending", http.MethodGet, "/adjustments/pending", supportKey, nil},
+		{"history", http.MethodGet, "/adjustments?userId=" + user1, supportKey, nil},
+		{"get", http.MethodGet, "/adjustments/" + credit.Id, supportKey, nil},
+	})
+}
+
+func accountStatus(status string, reason string) map[string]interface{} {
+	return map[string]interface{}{"status": status, "reason": reason}
+}
+
+// TestAccounts проходит статусы счета и их действие на пополнение, резервации и подтверждение
+func TestAccounts(t *testing.T) {
+	h := newHarness(t)
+
+	h.do(t, http.MethodPost, "/balance", paymentKey, deposit(user1, 100))
+
+	var reserved dto.Reservation
+
+	h.json(t, http.MethodPost, "/reservations", adminKey, reservation(user1, order1, service1, 40), http.StatusCreated, &reserved)
+
+	h.run(t, []call{
+		{"get_invalid_user", http.MethodGet, "/accounts/user", supportKey, nil},
+		{"get_unauthenticated", http.MethodGet, "/accounts/" + user1, "", nil},
+		{"get_active", http.MethodGet, "/accounts/" + user1, supportKey, nil},
+		{"set_forbidden", http.MethodPut, "/accounts/" + user1 + "/status", supportKey, accountStatus("frozen-debit", "fraud check")},
+		{"set_invalid_user", http.MethodPut, "/accounts/user/status", adminKey, accountStatus("frozen-debit", "fraud check")},
+		{"set_invalid_body", http.MethodPut, "/accounts/" + user1 + "/status", adminKey, "{"},
+		{"set_validation", http.MethodPut, "/accounts/" + user1 + "/status", adminKey, map[string]interface{}{"status": "blocked", "reason": ""}},
+		{"set_frozen_debit", http.MethodPut, "/accounts/" + user1 + "/status", adminKey, accountStatus("frozen-debit", "fraud check")},
+		{"get_frozen_debit", http.MethodGet, "/accounts/" + user1, supportKey, nil},
+		{"frozen_debit_reserve", http.MethodPost, "/reservations", adminKey, reservation(user1, order2, service1, 10)},
+		{"frozen_debit_reserve_v1", http.MethodPost, "/transaction", adminKey, transaction(user1, order2, service1, 10, 1)},
+		{"frozen_debit_increase", http.MethodPost, "/balance", paymentKey, deposit(user1, 10)},
+		{"set_frozen_all", http.MethodPut, "/accounts/" + user1 + "/status", adminKey, accountStatus("frozen-all", "court order")},
+		{"frozen_all_increase", http.MethodPost, "/balance", paymentKey, deposit(user1, 10)},
+		{"frozen_all_capture", http.MethodPost, "/reservations/" + reserved.Id + "/capture", adminKey, nil},
+		{"set_closed", http.MethodPut, "/accounts/" + user1 + "/status", adminKey, accountStatus("closed", "account closed by user")},
+		{"closed_reserve", http.MethodPost, "/reservations", adminKey, reservation(user1, order2, service1, 10)},
+		{"set_active", http.MethodPut, "/accounts/" + user1 + "/status", adminKey, accountStatus("active", "reopened")},
+		{"active_capture", http.MethodPost, "/reservations/" + reserved.Id + "/capture", adminKey, nil},
+		{"balance", http.MethodGet, "/balance/" + user1, adminKey, nil},
+	})
+}
+
+// TestLimits проходит задание, вывод и удаление лимитов. Маршруты /limits делят один лимит запросов
+// (10/s при неподвижных часах сервера), поэтому запросов к ним в тесте не больше 10
+func TestLimits(t *testing.T) {
+	h := newHarness(t)
+
+	h.run(t, []call{
+		{"set_forbidden", http.MethodPut, "/limits", supportKey, limitRule("global", "", "deposit", "transaction", 1000)},
+		{"set_invalid_body", http.MethodPut, "/limits", adminKey, "{"},
+		{"set_validation", http.MethodPut, "/limits", adminKey, limitRule("team", "", "refund", "week", 0)},
+		{"set_global_with_scope_id", http.MethodPut, "/limits", adminKey, limitRule("global", "basic", "deposit", "day", 1000)},
+		{"set_user_invalid_scope_id", http.MethodPut, "/limits", adminKey, limitRule("user", "user", "deposit", "day", 1000)},
+		{"set_tier", http.MethodPut, "/limits", adminKey, limitRule("tier", "basic", "deposit", "day", 150)},
+		{"get_unauthenticated", http.MethodGet, "/limits", "", nil},
+		{"get", http.MethodGet, "/limits", supportKey, nil},
+		{"delete_forbidden", http.MethodDelete, "/limits?scope=tier&scopeId=basic&operation=deposit&period=day", supportKey, nil},
+		{"delete_invalid_period", http.MethodDelete, "/limits?scope=tier&scopeId=basic&operation=deposit&period=week", adminKey, nil},
+		{"delete_not_found", http.MethodDelete, "/limits?scope=tier&scopeId=premium&operation=deposit&period=day", adminKey, nil},
+	})
+}
+
+// TestLimitBreaches задает лимиты глобально, на уровень и пользователю и проходит превышение лимитов пополнений
+// и резерваций, остаток лимитов пользователя и пополнение после удаления лимита
+func TestLimitBreaches(t *testing.T) {
+	h := newHarness(t)
+
+	h.do(t, http.MethodPut, "/limits", adminKey, limitRule("global", "", "deposit", "transaction", 1000))
+	h.do(t, http.MethodPut, "/limits", adminKey, limitRule("tier", "basic", "deposit", "day", 150))
+	h.do(t, http.MethodPut, "/limits", adminKey, limitRule("user", user1, "reserve", "day", 50))
+
+	h.run(t, []call{
+		{"tier_forbidden", http.MethodPut, "/limits/users/" + user1 + "/tier", supportKey, map[string]interface{}{"tier": "basic"}},
+		{"tier_validation", http.MethodPut, "/limits/users/" + user1 + "/tier", adminKey, map[string]interface{}{"tier": ""}},
+		{"tier", http.MethodPut, "/limits/users/" + user1 + "/tier", adminKey, map[string]interface{}{"tier": "basic"}},
+		{"deposit_over_transaction", http.MethodPost, "/balance", paymentKey, deposit(user1, 1500)},
+		{"deposit", http.MethodPost, "/balance", paymentKey, deposit(user1, 100)},
+		{"deposit_over_daily", http.MethodPost, "/balance", paymentKey, deposit(user1, 60)},
+		{"deposit_other_user", http.MethodPost, "/balance", paymentKey, deposit(user2, 600)},
+		{"reserve", http.MethodPost, "/reservations", adminKey, reservation(user1, order1, service1, 30)},
+		{"reserve_over_daily", http.MethodPost, "/reservations", adminKey, reservation(user1, order2, service1, 30)},
+		{"reserve_over_daily_v1", http.MethodPost, "/transaction", adminKey, transaction(user1, order2, service1, 30, 1)},
+		{"user_limits", http.MethodGet, "/limits/users/" + user1, supportKey, nil},
+		{"user_limits_invalid_user", http.MethodGet, "/limits/users/user", supportKey, nil},
+		{"delete", http.MethodDelete, "/limits?scope=tier&scopeId=basic&operation=deposit&period=day", adminKey, nil},
+		{"deposit_after_delete", http.MethodPost, "/balance", paymentKey, deposit(user1, 60)},
+		{"balance", http.MethodGet, "/balance/" + user1, adminKey, nil},
+	})
+}
+
+func limitRule(scope string, scopeId string, operation string, period string, amount float64) map[string]interface{} {
+	rule := map[string]interface{}{"scope": scope, "operation": operation, "period": period, "amount": amount}
+
+	if scopeId != "" {
+		rule["scopeId"] = scopeId
+	}
+
+	return rule
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/avito-test/internal/dto"
+	"github.com/gorilla/mux"
+)
+
+// HandleCreateReservation
+// @summary Резервация денег под услугу заказа
+// @tags reservation
+// @description Резервирует деньги с основного баланса пользователя. В отличие от POST /transaction результат передается HTTP статусом.
+// @accept json
+// @produce json
+// @param CreateReservationRequest body dto.CreateReservationRequest true "orderId - id заказа (UUID).<br> serviceId - id услуги (UUID).<br> userId - id пользователя (UUID).<br> sum - сумма (больше 0).<br> comment - комментарий (опционально)"
+// @success 201 {object} dto.Reservation "Резервация создана"
+// @failure 400 {object} dto.ApiError "Невалидный запрос"
+// @failure 423 {object} dto.ApiError "Резервация запрещена статусом счета"
+// @security ApiKeyAuth
+// @security BearerAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 403 {object} dto.ApiError "Нет права transaction:write"
+// @failure 404 {object} dto.ApiError "Баланс пользователя не найден"
+// @failure 409 {object} dto.ApiError "Резервация с такими orderId, userId, serviceId уже существует"
+// @failure 422 {object} dto.ApiError "Недостаточно средств на балансе или превышен лимит резерваций (limit-exceeded)"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @failure 499 {object} dto.ApiError "Клиент отменил запрос"
+// @failure 504 {object} dto.ApiError "Истек таймаут запроса в бд"
+// @router /reservations [post]
+func (s *httpServer) HandleCreateReservation(w http.ResponseWriter, r *http.Request) {
+	var request dto.CreateReservationRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendError(w, r, newRequestError("invalid request body"))
+		return
+	}
+
+	if err := validateRequest(s.validator, request); err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	transaction := reservationTransaction(request.UserId, request.OrderId, request.ServiceId, request.Sum, request.Comment)
+
+	if reservation, err := s.transactionService.CreateReservation(r.Context(), transaction); err != nil {
+		s.sendError(w, r, err)
+	} else {
+		s.sendJsonResponse(r.Context(), w, http.StatusCreated, reservationResponse(reservation))
+	}
+}
+
+// HandleCaptureReservation
+// @summary Признание выручки по резервации
+// @tags reservation
+// @description Списывает зарезервированные деньги, выручка попадает в отчет для бухгалтерии.
+// @accept json
+// @produce json
+// @param id path string true "id резервации" Format(uuid)
+// @param ReservationActionRequest body dto.ReservationActionRequest false "comment - комментарий (опционально)"
+// @success 200 {object} dto.Reservation "Выручка признана"
+// @failure 400 {object} dto.ApiError "Невалидный запрос"
+// @failure 423 {object} dto.ApiError "Подтверждение запрещено статусом счета (frozen-all, closed)"
+// @security ApiKeyAuth
+// @security BearerAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 403 {object} dto.ApiError "Нет права transaction:write"
+// @failure 404 {object} dto.ApiError "Резервация не найдена"
+// @failure 409 {object} dto.ApiError "Резервация уже подтверждена или отменена"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @failure 499 {object} dto.ApiError "Клиент отменил запрос"
+// @failure 504 {object} dto.ApiError "Истек таймаут запроса в бд"
+// @router /reservations/{id}/capture [post]
+func (s *httpServer) HandleCaptureReservation(w http.ResponseWriter, r *http.Request) {
+	id, request, ok := s.reservationActionRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if reservation, err := s.transactionService.CaptureReservation(r.Context(), id, request.Comment); err != nil {
+		s.sendError(w, r, err)
+	} else {
+		s.sendJsonResponse(r.Context(), w, http.StatusOK, reservationResponse(reservation))
+	}
+}
+
+// HandleCancelReservation
+// @summary Отмена резервации
+// @tags reservation
+// @description Отменяет резервацию и возвращает деньги на основной баланс.
+// @accept json
+// @produce json
+// @param id path string true "id резервации" Format(uuid)
+// @param ReservationActionRequest body dto.ReservationActionRequest false "comment - комментарий (опционально)"
+// @success 200 {object} dto.Reservation "Резервация отменена"
+// @failure 400 {object} dto.ApiError "Невалидный запрос"
+// @failure 423 {object} dto.ApiError "Отмена запрещена статусом счета (frozen-all, closed)"
+// @security ApiKeyAuth
+// @security BearerAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 403 {object} dto.ApiError "Нет права transaction:write"
+// @failure 404 {object} dto.ApiError "Резервация не найдена"
+// @failure 409 {object} dto.ApiError "Резервация уже подтверждена или отменена"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @failure 499 {object} dto.ApiError "Клиент отменил запрос"
+// @failure 504 {object} dto.ApiError "Истек таймаут запроса в бд"
+// @router /reservations/{id}/cancel [post]
+func (s *httpServer) HandleCancelReservation(w http.ResponseWriter, r *http.Request) {
+	id, request, ok := s.reservationActionRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if reservation, err := s.transactionService.CancelReservation(r.Context(), id, request.Comment); err != nil {
+		s.sendError(w, r, err)
+	} else {
+		s.sendJsonResponse(r.Context(), w, http.StatusOK, reservationResponse(reservation))
+	}
+}
+
+// reservationActionRequest разбирает id из пути и необязательное тело запроса capture/cancel
+func (s *httpServer) reservationActionRequest(w http.ResponseWriter, r *http.Request) (string, dto.ReservationActionRequest, bool) {
+	id := mux.Vars(r)["id"]
+
+	if err := s.validator.Var(id, "uuid"); err != nil {
+		s.sendError(w, r, newRequestError("parameter id should be uuid"))
+		return "", dto.ReservationActionRequest{}, false
+	}
+
+	request, ok := s.actionRequest(w, r)
+
+	return id, request, ok
+}
+
+// actionRequest разбирает необязательное тело запроса capture/cancel
+func (s *httpServer) actionRequest(w http.ResponseWriter, r *http.Request) (dto.ReservationActionRequest, bool) {
+	var request dto.ReservationActionRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		s.sendError(w, r, newRequestError("invalid request body"))
+		return request, false
+	}
+
+	return request, true
+}
@@ -0,0 +1,250 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/avito-test/internal/dto"
+	"github.com/avito-test/internal/model"
+	"github.com/gorilla/mux"
+)
+
+// HandleCreateWebhook
+// @summary Создание подписки webhook
+// @tags webhook
+// @description Создает подписку: события выбранных типов отправляются POST запросом на url. Тело запроса подписывается HMAC-SHA256 секретом подписки, подпись в заголовке X-Webhook-Signature: t=<unix время>,v1=<hex HMAC-SHA256(secret, "<t>.<тело>")>. Секрет возвращается только в ответе на создание
+// @accept json
+// @produce json
+// @param CreateWebhookRequest body dto.CreateWebhookRequest true "url - адрес подписчика (http или https, адреса loopback, частных сетей и link-local запрещены).<br> eventTypes - типы событий: deposit, reserved, captured, cancelled.<br> serviceId - присылать только события по услуге (UUID, опционально, события deposit без услуги не присылаются)"
+// @success 201 {object} dto.Webhook "Подписка создана, в ответе секрет подписи"
+// @failure 400 {object} dto.ApiError "Невалидный запрос"
+// @security ApiKeyAuth
+// @security BearerAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 403 {object} dto.ApiError "Нет права webhook:manage"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @failure 499 {object} dto.ApiError "Клиент отменил запрос"
+// @failure 504 {object} dto.ApiError "Истек таймаут запроса в бд"
+// @router /webhooks [post]
+func (s *httpServer) HandleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var request dto.CreateWebhookRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendError(w, r, newRequestError("invalid request body"))
+		return
+	}
+
+	if err := validateRequest(s.validator, request); err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	subscription, err := webhookRequest(request)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	if subscription, err = s.webhookService.CreateSubscription(r.Context(), subscription); err != nil {
+		s.sendError(w, r, err)
+	} else {
+		response := webhookResponse(subscription)
+		response.Secret = subscription.Secret
+
+		s.sendJsonResponse(r.Context(), w, http.StatusCreated, response)
+	}
+}
+
+// HandleGetWebhooks
+// @summary Получение подписок webhook
+// @tags webhook
+// @description Возвращает все подписки без секретов
+// @accept json
+// @produce json
+// @success 200 {object} dto.GetWebhooksResponse
+// @security ApiKeyAuth
+// @security BearerAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 403 {object} dto.ApiError "Нет права webhook:manage"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @failure 499 {object} dto.ApiError "Клиент отменил запрос"
+// @failure 504 {object} dto.ApiError "Истек таймаут запроса в бд"
+// @router /webhooks [get]
+func (s *httpServer) HandleGetWebhooks(w http.ResponseWriter, r *http.Request) {
+	subscriptions, err := s.webhookService.GetSubscriptions(r.Context())
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	response := dto.GetWebhooksResponse{Webhooks: make([]dto.Webhook, 0, len(subscriptions))}
+	for _, subscription := range subscriptions {
+		response.Webhooks = append(response.Webhooks, webhookResponse(subscription))
+	}
+
+	s.sendJsonResponse(r.Context(), w, http.StatusOK, response)
+}
+
+// HandleGetWebhook
+// @summary Получение подписки webhook
+// @tags webhook
+// @description Возвращает подписку без секрета
+// @accept json
+// @produce json
+// @param id path string true "id подписки" Format(uuid)
+// @success 200 {object} dto.Webhook
+// @failure 400 {object} dto.ApiError "Невалидный id"
+// @failure 404 {object} dto.ApiError "Подписка не найдена"
+// @security ApiKeyAuth
+// @security BearerAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 403 {object} dto.ApiError "Нет права webhook:manage"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @failure 499 {object} dto.ApiError "Клиент отменил запрос"
+// @failure 504 {object} dto.ApiError "Истек таймаут запроса в бд"
+// @router /webhooks/{id} [get]
+func (s *httpServer) HandleGetWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.webhookId(w, r)
+	if !ok {
+		return
+	}
+
+	if subscription, err := s.webhookService.GetSubscription(r.Context(), id); err != nil {
+		s.sendError(w, r, err)
+	} else {
+		s.sendJsonResponse(r.Context(), w, http.StatusOK, webhookResponse(subscription))
+	}
+}
+
+// HandleDeleteWebhook
+// @summary Удаление подписки webhook
+// @tags webhook
+// @description Удаляет подписку вместе с журналом доставок, неотправленные события подписчику не отправляются
+// @accept json
+// @produce json
+// @param id path string true "id подписки" Format(uuid)
+// @success 204 "Подписка удалена"
+// @failure 400 {object} dto.ApiError "Невалидный id"
+// @failure 404 {object} dto.ApiError "Подписка не найдена"
+// @security ApiKeyAuth
+// @security BearerAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 403 {object} dto.ApiError "Нет права webhook:manage"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @failure 499 {object} dto.ApiError "Клиент отменил запрос"
+// @failure 504 {object} dto.ApiError "Истек таймаут запроса в бд"
+// @router /webhooks/{id} [delete]
+func (s *httpServer) HandleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.webhookId(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.webhookService.DeleteSubscription(r.Context(), id); err != nil {
+		s.sendError(w, r, err)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleGetWebhookDeliveries
+// @summary Журнал доставок webhook
+// @tags webhook
+// @description Возвращает последние 100 доставок подписки, новые первыми. pending - ждет отправки или повторной попытки (nextAttemptTime), delivered - подписчик ответил 2xx, dead - попытки исчерпаны
+// @accept json
+// @produce json
+// @param id path string true "id подписки" Format(uuid)
+// @param status query string false "Фильтр по статусу" Enums(pending, delivered, dead)
+// @success 200 {object} dto.GetWebhookDeliveriesResponse
+// @failure 400 {object} dto.ApiError "Невалидный запрос"
+// @failure 404 {object} dto.ApiError "Подписка не найдена"
+// @security ApiKeyAuth
+// @security BearerAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 403 {object} dto.ApiError "Нет права webhook:manage"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @failure 499 {object} dto.ApiError "Клиент отменил запрос"
+// @failure 504 {object} dto.ApiError "Истек таймаут запроса в бд"
+// @router /webhooks/{id}/deliveries [get]
+func (s *httpServer) HandleGetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.webhookId(w, r)
+	if !ok {
+		return
+	}
+
+	var status *model.WebhookDeliveryStatus
+
+	if value := queryString(r.URL.Query(), "status"); value != nil {
+		if err := s.validator.Var(*value, "oneof=pending delivered dead"); err != nil {
+			s.sendError(w, r, newRequestError("parameter status should be in [pending delivered dead]"))
+			return
+		}
+
+		deliveryStatus := model.WebhookDeliveryStatus(*value)
+		status = &deliveryStatus
+	}
+
+	deliveries, err := s.webhookService.GetDeliveries(r.Context(), id, status)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	response := dto.GetWebhookDeliveriesResponse{Deliveries: make([]dto.WebhookDelivery, 0, len(deliveries))}
+	for _, delivery := range deliveries {
+		response.Deliveries = append(response.Deliveries, webhookDeliveryResponse(delivery))
+	}
+
+	s.sendJsonResponse(r.Context(), w, http.StatusOK, response)
+}
+
+// HandleRedeliverWebhook
+// @summary Повторная отправка доставки webhook
+// @tags webhook
+// @description Ставит доставку в очередь на немедленную отправку с новым счетчиком попыток, в том числе уже доставленную или dead
+// @accept json
+// @produce json
+// @param id path string true "id подписки" Format(uuid)
+// @param deliveryId path string true "id доставки" Format(uuid)
+// @success 202 {object} dto.WebhookDelivery "Доставка поставлена в очередь"
+// @failure 400 {object} dto.ApiError "Невалидный id или deliveryId"
+// @failure 404 {object} dto.ApiError "Доставка подписки не найдена"
+// @security ApiKeyAuth
+// @security BearerAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 403 {object} dto.ApiError "Нет права webhook:manage"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @failure 499 {object} dto.ApiError "Клиент отменил запрос"
+// @failure 504 {object} dto.ApiError "Истек таймаут запроса в бд"
+// @router /webhooks/{id}/deliveries/{deliveryId}/redeliver [post]
+func (s *httpServer) HandleRedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.webhookId(w, r)
+	if !ok {
+		return
+	}
+
+	deliveryId := mux.Vars(r)["deliveryId"]
+
+	if err := s.validator.Var(deliveryId, "uuid"); err != nil {
+		s.sendError(w, r, newRequestError("parameter deliveryId should be uuid"))
+		return
+	}
+
+	if delivery, err := s.webhookService.Redeliver(r.Context(), id, deliveryId); err != nil {
+		s.sendError(w, r, err)
+	} else {
+		s.sendJsonResponse(r.Context(), w, http.StatusAccepted, webhookDeliveryResponse(delivery))
+	}
+}
+
+// webhookId разбирает id подписки из пути
+func (s *httpServer) webhookId(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := mux.Vars(r)["id"]
+
+	if err := s.validator.Var(id, "uuid"); err != nil {
+		s.sendError(w, r, newRequestError("parameter id should be uuid"))
+		return "", false
+	}
+
+	return id, true
+}
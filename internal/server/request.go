@@ -0,0 +1,613 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/avito-test/internal/config/auth"
+	"github.com/avito-test/internal/dto"
+	"github.com/avito-test/internal/model"
+	"github.com/avito-test/internal/service"
+	"github.com/avito-test/internal/webhook"
+	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
+)
+
+// общая для http и grpc часть: валидация запросов и преобразование dto в модели сервисов
+
+var internalServerError = errors.New("internal server error")
+
+const reportBaseURL = "http://localhost:8000/report"
+
+// requestError - ошибка запроса клиента (400), message уходит клиенту в detail
+type requestError struct {
+	message string
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+func newRequestError(format string, args ...any) error {
+	return &requestError{message: fmt.Sprintf(format, args...)}
+}
+
+// forbiddenError - у вызывающего нет права permission (403)
+type forbiddenError struct {
+	permission auth.Permission
+}
+
+func (e *forbiddenError) Error() string {
+	return fmt.Sprintf("access denied: permission %s required", e.permission)
+}
+
+// validationError содержит все невалидные поля запроса
+type validationError struct {
+	invalidParams []dto.InvalidParam
+}
+
+func (e *validationError) Error() string {
+	reasons := make([]string, 0, len(e.invalidParams))
+
+	for _, param := range e.invalidParams {
+		reasons = append(reasons, param.Reason)
+	}
+
+	return strings.Join(reasons, "; ")
+}
+
+// validateRequest проверяет запрос по тегам validate и возвращает *validationError со всеми невалидными полями
+func validateRequest(v *validator.Validate, requestBody any) error {
+	err := v.Struct(requestBody)
+	if err == nil {
+		return nil
+	}
+
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return err
+	}
+
+	result := &validationError{invalidParams: make([]dto.InvalidParam, 0, len(validationErrors))}
+
+	for _, fieldErr := range validationErrors {
+		constraint := fieldErr.Tag()
+		if fieldErr.Param() != "" {
+			constraint = fmt.Sprintf("%s=%s", fieldErr.Tag(), fieldErr.Param())
+		}
+
+		// путь поля без имени корневой структуры, например operations[1].orderId
+		name := fieldErr.Namespace()
+		if i := strings.Index(name, "."); i >= 0 {
+			name = name[i+1:]
+		}
+
+		result.invalidParams = append(result.invalidParams, dto.InvalidParam{
+			Name:       name,
+			Reason:     validationReason(name, fieldErr),
+			Constraint: constraint,
+		})
+	}
+
+	return result
+}
+
+func validationReason(name string, err validator.FieldError) string {
+	switch err.Tag() {
+	case "required", "required_unless":
+		return fmt.Sprintf("field %s missing", name)
+	case "gt":
+		return fmt.Sprintf("field %s should be > %s", name, err.Param())
+	case "uuid_rfc4122", "uuid":
+		return fmt.Sprintf("field %s should be uuid", name)
+	case "oneof":
+		return fmt.Sprintf("field %s should be in [%s]", name, err.Param())
+	case "min":
+		return fmt.Sprintf("field %s should be >= %s", name, err.Param())
+	case "max":
+		return fmt.Sprintf("field %s should be <= %s", name, err.Param())
+	case "url":
+		return fmt.Sprintf("field %s should be http(s) url", name)
+	case "datetime":
+		return fmt.Sprintf("field %s should be RFC 3339 date", name)
+	case "unique_field":
+		return fmt.Sprintf("field %s should not repeat %s", name, strings.ToLower(err.Param()[:1])+err.Param()[1:])
+	case "excluded_with":
+		return fmt.Sprintf("field %s cannot be used with %s", name, strings.ToLower(err.Param()))
+	default:
+		return fmt.Sprintf("field %s is invalid (%s)", name, err.Tag())
+	}
+}
+
+func queryString(values url.Values, name string) *string {
+	if _, ok := values[name]; !ok {
+		return nil
+	}
+
+	value := values.Get(name)
+
+	return &value
+}
+
+func queryInt(values url.Values, name string) (*int, error) {
+	value := queryString(values, name)
+	if value == nil {
+		return nil, nil
+	}
+
+	i, err := strconv.Atoi(*value)
+	if err != nil {
+		return nil, newRequestError("parameter %s should be integer", name)
+	}
+
+	return &i, nil
+}
+
+func queryFloat(values url.Values, name string) (*float64, error) {
+	value := queryString(values, name)
+	if value == nil {
+		return nil, nil
+	}
+
+	f, err := strconv.ParseFloat(*value, 64)
+	if err != nil {
+		return nil, newRequestError("parameter %s should be number", name)
+	}
+
+	return &f, nil
+}
+
+func increaseBalanceTransaction(request dto.IncreaseBalanceRequest) model.IncreaseBalanceTransaction {
+	return model.IncreaseBalanceTransaction{
+		UserId:  *request.UserId,
+		Sum:     *request.Sum,
+		Comment: request.Comment,
+	}
+}
+
+func reservationTransaction(userId *string, orderId *string, serviceId *string, sum *float64, comment *string) model.Transaction {
+	return model.Transaction{
+		UserId:    *userId,
+		OrderId:   orderId,
+		ServiceId: serviceId,
+		Sum:       *sum,
+		Comment:   comment,
+	}
+}
+
+func getTransactionsRequest(requestDto dto.GetTransactionsRequest) (model.GetTransactionsRequest, error) {
+	var request model.GetTransactionsRequest
+
+	if requestDto.ItemsPerPage == nil {
+		request.Limit = 10
+	} else {
+		request.Limit = *requestDto.ItemsPerPage
+	}
+
+	request.UserId = *requestDto.UserId
+
+	if requestDto.Page != nil {
+		request.Offset = (*requestDto.Page - 1) * request.Limit
+	}
+
+	if requestDto.SortBy == nil {
+		request.SortBy = "date"
+	} else {
+		request.SortBy = *requestDto.SortBy
+	}
+
+	if requestDto.SortType == nil {
+		request.SortType = "desc"
+	} else {
+		request.SortType = *requestDto.SortType
+	}
+
+	if requestDto.Cursor != nil {
+		cursor, err := decodeCursor(*requestDto.Cursor)
+		if err != nil {
+			return request, err
+		}
+
+		if cursor.SortBy != request.SortBy || cursor.SortType != request.SortType {
+			return request, newRequestError("cursor was issued for another sortBy/sortType")
+		}
+
+		request.Cursor = cursor
+	}
+
+	request.Filter = model.TransactionFilter{
+		TransactionTypeIds: requestDto.TransactionTypes,
+		ServiceId:          requestDto.ServiceId,
+		OrderId:            requestDto.OrderId,
+		SumFrom:            requestDto.SumFrom,
+		SumTo:              requestDto.SumTo,
+		Comment:            requestDto.Comment,
+	}
+
+	// формат дат уже проверен тегом datetime
+	if requestDto.DateFrom != nil {
+		dateFrom, _ := time.Parse(time.RFC3339, *requestDto.DateFrom)
+		request.Filter.DateFrom = &dateFrom
+	}
+
+	if requestDto.DateTo != nil {
+		dateTo, _ := time.Parse(time.RFC3339, *requestDto.DateTo)
+		request.Filter.DateTo = &dateTo
+	}
+
+	return request, nil
+}
+
+// transactionCursor - сериализуемое представление курсора, клиенту он передается непрозрачной base64 строкой
+type transactionCursor struct {
+	SortBy   string    `json:"s"`
+	SortType string    `json:"o"`
+	UpdTime  time.Time `json:"t"`
+	Sum      float64   `json:"v"`
+	Id       string    `json:"id"`
+}
+
+func encodeCursor(cursor *model.TransactionCursor) *string {
+	if cursor == nil {
+		return nil
+	}
+
+	data, _ := json.Marshal(transactionCursor(*cursor))
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+
+	return &encoded
+}
+
+func decodeCursor(encoded string) (*model.TransactionCursor, error) {
+	var cursor transactionCursor
+
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, newRequestError("invalid cursor")
+	}
+
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.Id == "" {
+		return nil, newRequestError("invalid cursor")
+	}
+
+	result := model.TransactionCursor(cursor)
+
+	return &result, nil
+}
+
+func transactionResponse(tr model.Transaction) dto.Transaction {
+	return dto.Transaction{
+		Id:              tr.Id,
+		OrderId:         tr.OrderId,
+		ServiceId:       tr.ServiceId,
+		TransactionType: tr.TransactionType,
+		Sum:             tr.Sum,
+		Comment:         tr.Comment,
+		UpdTime:         tr.UpdTime,
+	}
+}
+
+func transactionDetailsResponse(history model.TransactionHistory) dto.TransactionDetails {
+	tr := history.Transaction
+
+	response := dto.TransactionDetails{
+		Id:              tr.Id,
+		UserId:          tr.UserId,
+		OrderId:         tr.OrderId,
+		ServiceId:       tr.ServiceId,
+		Sum:             tr.Sum,
+		TransactionType: tr.TransactionType,
+		Comment:         tr.Comment,
+		UpdTime:         tr.UpdTime,
+		History:         make([]dto.TransactionState, 0, len(history.States)),
+	}
+
+	for _, state := range history.States {
+		response.History = append(response.History, dto.TransactionState{
+			TransactionTypeId: state.TransactionTypeId,
+			TransactionType:   state.TransactionType,
+			Sum:               state.Sum,
+			Comment:           state.Comment,
+			UpdTime:           state.UpdTime,
+		})
+	}
+
+	return response
+}
+
+const batchDeposit = "deposit"
+
+var batchTransactionTypes = map[string]int{
+	"reserve":    model.TransactionTypeReserve,
+	"capture":    model.TransactionTypeCapture,
+	"cancel":     model.TransactionTypeCancel,
+	batchDeposit: model.TransactionTypeDeposit,
+}
+
+func batchOperationTransaction(operation dto.BatchOperation) model.Transaction {
+	return model.Transaction{
+		UserId:            *operation.UserId,
+		OrderId:           operation.OrderId,
+		ServiceId:         operation.ServiceId,
+		Sum:               *operation.Sum,
+		TransactionTypeId: batchTransactionTypes[*operation.Type],
+		Comment:           operation.Comment,
+	}
+}
+
+func orderRequest(request dto.CreateOrderRequest) model.Order {
+	order := model.Order{
+		Id:     *request.OrderId,
+		UserId: *request.UserId,
+		Lines:  make([]model.Transaction, 0, len(request.Lines)),
+	}
+
+	for _, line := range request.Lines {
+		order.Lines = append(order.Lines, model.Transaction{
+			ServiceId: line.ServiceId,
+			Sum:       *line.Sum,
+			Comment:   line.Comment,
+		})
+	}
+
+	return order
+}
+
+func orderResponse(order model.Order) dto.Order {
+	response := dto.Order{
+		OrderId:    order.Id,
+		UserId:     order.UserId,
+		Status:     string(order.Status()),
+		CreateTime: order.CreateTime,
+		Lines:      make([]dto.OrderLine, 0, len(order.Lines)),
+	}
+
+	for _, line := range order.Lines {
+		response.Sum += line.Sum
+		response.Lines = append(response.Lines, dto.OrderLine{
+			Id:        line.Id,
+			ServiceId: *line.ServiceId,
+			Sum:       line.Sum,
+			Status:    reservationStatuses[line.TransactionTypeId],
+			Comment:   line.Comment,
+			UpdTime:   line.UpdTime,
+		})
+	}
+
+	return response
+}
+
+// webhookRequest проверяет, что адрес подписки - http(s) и не указывает во внутреннюю сеть (ip хоста проверяется еще
+// и при каждой отправке)
+func webhookRequest(request dto.CreateWebhookRequest) (model.WebhookSubscription, error) {
+	u, err := url.Parse(*request.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return model.WebhookSubscription{}, newRequestError("field url should be http(s) url")
+	}
+
+	if err := webhook.CheckHost(u.Hostname()); err != nil {
+		return model.WebhookSubscription{}, newRequestError("field url should not point to private, loopback or link-local address")
+	}
+
+	return model.WebhookSubscription{
+		Url:        *request.Url,
+		EventTypes: request.EventTypes,
+		ServiceId:  request.ServiceId,
+	}, nil
+}
+
+func webhookResponse(subscription model.WebhookSubscription) dto.Webhook {
+	return dto.Webhook{
+		Id:         subscription.Id,
+		Url:        subscription.Url,
+		EventTypes: subscription.EventTypes,
+		ServiceId:  subscription.ServiceId,
+		CreateTime: subscription.CreateTime,
+	}
+}
+
+func webhookDeliveryResponse(delivery model.WebhookDelivery) dto.WebhookDelivery {
+	response := dto.WebhookDelivery{
+		Id:              delivery.Id,
+		EventId:         delivery.Event.Id,
+		EventSequence:   delivery.Event.Sequence,
+		EventType:       delivery.Event.Type,
+		UserId:          delivery.Event.UserId,
+		EventTime:       delivery.Event.CreateTime,
+		Status:          string(delivery.Status),
+		Attempts:        delivery.Attempts,
+		LastAttemptTime: delivery.LastAttemptTime,
+		LastStatusCode:  delivery.LastStatusCode,
+		LastError:       delivery.LastError,
+	}
+
+	// время следующей попытки имеет смысл только для ожидающих доставок
+	if delivery.Status == model.WebhookPending {
+		response.NextAttemptTime = &delivery.NextAttemptTime
+	}
+
+	return response
+}
+
+func reportDate(request dto.CreateReportRequest) time.Time {
+	return service.MonthReportDate(*request.Year, time.Month(*request.Month))
+}
+
+// reportURL - ссылка на файл отчета с id
+func reportURL(id string) string {
+	return fmt.Sprintf("%s/%s.csv", reportBaseURL, id)
+}
+
+// isCanceled - клиент отменил запрос
+func isCanceled(ctx context.Context, err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled)
+}
+
+// isTimeout - истек таймаут запроса в бд
+func isTimeout(err error) bool {
+	var pgErr *pgconn.PgError
+
+	return errors.Is(err, context.DeadlineExceeded) || pgconn.Timeout(err) || errors.As(err, &pgErr) && pgErr.Code == pgerrcode.QueryCanceled
+}
+
+var reservationStatuses = map[int]string{
+	model.TransactionTypeReserve: "reserved",
+	model.TransactionTypeCapture: "captured",
+	model.TransactionTypeCancel:  "cancelled",
+}
+
+func reservationResponse(tr model.Transaction) dto.Reservation {
+	return dto.Reservation{
+		Id:        tr.Id,
+		UserId:    tr.UserId,
+		OrderId:   *tr.OrderId,
+		ServiceId: *tr.ServiceId,
+		Sum:       tr.Sum,
+		Status:    reservationStatuses[tr.TransactionTypeId],
+		Comment:   tr.Comment,
+		UpdTime:   tr.UpdTime,
+	}
+}
+
+func adjustmentRequest(request dto.CreateAdjustmentRequest) model.Adjustment {
+	return model.Adjustment{
+		UserId:    *request.UserId,
+		Direction: *request.Direction,
+		Sum:       *request.Sum,
+		Reason:    *request.Reason,
+		Ticket:    *request.Ticket,
+	}
+}
+
+func adjustmentResponse(adjustment model.Adjustment) dto.Adjustment {
+	return dto.Adjustment{
+		Id:              adjustment.Id,
+		UserId:          adjustment.UserId,
+		Direction:       adjustment.Direction,
+		Sum:             adjustment.Sum,
+		Reason:          adjustment.Reason,
+		Ticket:          adjustment.Ticket,
+		Status:          string(adjustment.Status),
+		ProposedBy:      adjustment.ProposedBy,
+		ProposeTime:     adjustment.ProposeTime,
+		DecidedBy:       adjustment.DecidedBy,
+		DecisionTime:    adjustment.DecisionTime,
+		DecisionComment: adjustment.DecisionComment,
+		TransactionId:   adjustment.TransactionId,
+	}
+}
+
+func adjustmentsResponse(adjustments []model.Adjustment) dto.GetAdjustmentsResponse {
+	response := dto.GetAdjustmentsResponse{Adjustments: make([]dto.Adjustment, 0, len(adjustments))}
+
+	for _, adjustment := range adjustments {
+		response.Adjustments = append(response.Adjustments, adjustmentResponse(adjustment))
+	}
+
+	return response
+}
+
+// accountResponse - статус счета, для счета без заданного статуса причина, автор и время не передаются
+func accountResponse(account model.Account) dto.Account {
+	response := dto.Account{
+		UserId: account.UserId,
+		Status: string(account.Status),
+	}
+
+	if account.UpdatedBy != "" {
+		response.Reason = &account.Reason
+		response.UpdatedBy = &account.UpdatedBy
+		response.UpdateTime = &account.UpdateTime
+	}
+
+	return response
+}
+
+func limitRuleRequest(request dto.SetLimitRuleRequest) model.LimitRule {
+	rule := model.LimitRule{
+		Scope:     model.LimitScope(*request.Scope),
+		Operation: model.LimitOperation(*request.Operation),
+		Period:    model.LimitPeriod(*request.Period),
+		Amount:    *request.Amount,
+	}
+
+	if request.ScopeId != nil {
+		rule.ScopeId = *request.ScopeId
+	}
+
+	return rule
+}
+
+// limitRuleResponse - лимит, у глобального лимита scopeId не передается
+func limitRuleResponse(rule model.LimitRule) dto.LimitRule {
+	response := dto.LimitRule{
+		Scope:      string(rule.Scope),
+		Operation:  string(rule.Operation),
+		Period:     string(rule.Period),
+		Amount:     rule.Amount,
+		UpdatedBy:  rule.UpdatedBy,
+		UpdateTime: rule.UpdateTime,
+	}
+
+	if rule.ScopeId != "" {
+		response.ScopeId = &rule.ScopeId
+	}
+
+	return response
+}
+
+func limitRulesResponse(rules []model.LimitRule) dto.GetLimitRulesResponse {
+	response := dto.GetLimitRulesResponse{Limits: make([]dto.LimitRule, 0, len(rules))}
+
+	for _, rule := range rules {
+		response.Limits = append(response.Limits, limitRuleResponse(rule))
+	}
+
+	return response
+}
+
+func userTierResponse(tier model.UserTier) dto.UserTier {
+	return dto.UserTier{
+		UserId:     tier.UserId,
+		Tier:       tier.Tier,
+		UpdatedBy:  tier.UpdatedBy,
+		UpdateTime: tier.UpdateTime,
+	}
+}
+
+// userLimitsResponse - лимиты пользователя, для лимита одной операции использование и время сброса не передаются
+func userLimitsResponse(limits model.UserLimits) dto.UserLimits {
+	response := dto.UserLimits{
+		UserId: limits.UserId,
+		Tier:   limits.Tier,
+		Limits: make([]dto.LimitUsage, 0, len(limits.Limits)),
+	}
+
+	for _, usage := range limits.Limits {
+		item := dto.LimitUsage{
+			Operation: string(usage.Rule.Operation),
+			Period:    string(usage.Rule.Period),
+			Scope:     string(usage.Rule.Scope),
+			Amount:    usage.Rule.Amount,
+			Remaining: usage.Remaining,
+			ResetTime: usage.ResetTime,
+		}
+
+		if usage.ResetTime != nil {
+			used := usage.Used
+			item.Used = &used
+		}
+
+		response.Limits = append(response.Limits, item)
+	}
+
+	return response
+}
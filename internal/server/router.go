@@ -0,0 +1,160 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/avito-test/internal/config"
+	"github.com/avito-test/internal/config/auth"
+	"github.com/avito-test/internal/config/middleware"
+	"github.com/avito-test/internal/config/ratelimit"
+	"github.com/gorilla/mux"
+)
+
+// httpRoute - маршрут API с правом и лимитом запросов (имя маршрута в RATE_LIMIT_*)
+type httpRoute struct {
+	method  string
+	path    string
+	handler http.HandlerFunc
+	// serviceOnly - маршрут доступен только внутренним сервисам по api ключу, остальные доступны и по JWT
+	serviceOnly bool
+	limit       string
+	permission  auth.Permission
+}
+
+func (s *httpServer) routes() []httpRoute {
+	return []httpRoute{
+		{http.MethodGet, "/balance/{userId}", s.HandleGetBalance, false, "get_balance", auth.PermissionBalanceRead},
+		{http.MethodGet, "/balance/{userId}/stream", s.HandleBalanceStream, false, "balance_stream", auth.PermissionBalanceRead},
+		{http.MethodPost, "/balance", s.HandleIncreaseBalance, true, "increase_balance", auth.PermissionBalanceCredit},
+
+		{http.MethodGet, "/transaction", s.HandleGetTransactions, false, "get_transactions", auth.PermissionTransactionRead},
+		{http.MethodGet, "/transaction/{id}", s.HandleGetTransaction, false, "get_transactions", auth.PermissionTransactionRead},
+		{http.MethodGet, "/orders/{orderId}/transactions", s.HandleGetOrderTransactions, false, "get_transactions", auth.PermissionTransactionRead},
+		{http.MethodPost, "/transaction", s.HandleTransaction, false, "save_transaction", auth.PermissionTransactionWrite},
+
+		{http.MethodPost, "/transaction/batch", s.HandleBatch, false, "batch", auth.PermissionTransactionWrite},
+
+		{http.MethodPost, "/report", s.HandleCreateReport, false, "create_report", auth.PermissionReportCreate},
+
+		{http.MethodPost, "/reservations", s.HandleCreateReservation, false, "save_transaction", auth.PermissionTransactionWrite},
+		{http.MethodPost, "/reservations/{id}/capture", s.HandleCaptureReservation, false, "save_transaction", auth.PermissionTransactionWrite},
+		{http.MethodPost, "/reservations/{id}/cancel", s.HandleCancelReservation, false, "save_transaction", auth.PermissionTransactionWrite},
+
+		{http.MethodPost, "/orders", s.HandleCreateOrder, false, "save_transaction", auth.PermissionTransactionWrite},
+		{http.MethodGet, "/orders/{orderId}", s.HandleGetOrder, false, "get_transactions", auth.PermissionTransactionRead},
+		{http.MethodPost, "/orders/{orderId}/lines/{serviceId}/capture", s.HandleCaptureOrderLine, false, "save_transaction", auth.PermissionTransactionWrite},
+		{http.MethodPost, "/orders/{orderId}/lines/{serviceId}/cancel", s.HandleCancelOrderLine, false, "save_transaction", auth.PermissionTransactionWrite},
+
+		{http.MethodPost, "/webhooks", s.HandleCreateWebhook, false, "webhooks", auth.PermissionWebhookManage},
+		{http.MethodGet, "/webhooks", s.HandleGetWebhooks, false, "webhooks", auth.PermissionWebhookManage},
+		{http.MethodGet, "/webhooks/{id}", s.HandleGetWebhook, false, "webhooks", auth.PermissionWebhookManage},
+		{http.MethodDelete, "/webhooks/{id}", s.HandleDeleteWebhook, false, "webhooks", auth.PermissionWebhookManage},
+		{http.MethodGet, "/webhooks/{id}/deliveries", s.HandleGetWebhookDeliveries, false, "webhooks", auth.PermissionWebhookManage},
+		{http.MethodPost, "/webhooks/{id}/deliveries/{deliveryId}/redeliver", s.HandleRedeliverWebhook, false, "webhooks", auth.PermissionWebhookManage},
+
+		{http.MethodPost, "/adjustments", s.HandleCreateAdjustment, false, "adjustments", auth.PermissionAdjustmentPropose},
+		{http.MethodGet, "/adjustments", s.HandleGetAdjustments, false, "adjustments", auth.PermissionAdjustmentRead},
+		{http.MethodGet, "/adjustments/pending", s.HandleGetPendingAdjustments, false, "adjustments", auth.PermissionAdjustmentRead},
+		{http.MethodGet, "/adjustments/{id}", s.HandleGetAdjustment, false, "adjustments", auth.PermissionAdjustmentRead},
+		{http.MethodPost, "/adjustments/{id}/approve", s.HandleApproveAdjustment, false, "adjustments", auth.PermissionAdjustmentApprove},
+		{http.MethodPost, "/adjustments/{id}/reject", s.HandleRejectAdjustment, false, "adjustments", auth.PermissionAdjustmentApprove},
+
+		{http.MethodGet, "/accounts/{userId}", s.HandleGetAccount, false, "accounts", auth.PermissionAccountRead},
+		{http.MethodPut, "/accounts/{userId}/status", s.HandleSetAccountStatus, false, "accounts", auth.PermissionAccountManage},
+		{http.MethodGet, "/limits", s.HandleGetLimits, false, "limits", auth.PermissionLimitRead},
+		{http.MethodPut, "/limits", s.HandleSetLimit, false, "limits", auth.PermissionLimitManage},
+		{http.MethodDelete, "/limits", s.HandleDeleteLimit, false, "limits", auth.PermissionLimitManage},
+		{http.MethodGet, "/limits/users/{userId}", s.HandleGetUserLimits, false, "limits", auth.PermissionLimitRead},
+		{http.MethodPut, "/limits/users/{userId}/tier", s.HandleSetUserTier, false, "limits", auth.PermissionLimitManage},
+	}
+}
+
+// Router создает роутер со всеми маршрутами API, ошибка - невалидный лимит запросов маршрута в конфиге
+func (s *httpServer) Router() (*mux.Router, error) {
+	serviceAuth := middleware.Authentication(s.authenticator, auth.MethodApiKey)
+	userAuth := middleware.Authentication(s.authenticator, auth.MethodApiKey, auth.MethodJWT)
+
+	router := mux.NewRouter()
+
+	for _, r := range s.routes() {
+		limit, err := s.rateLimit(r.limit)
+		if err != nil {
+			return nil, err
+		}
+
+		authentication := userAuth
+		if r.serviceOnly {
+			authentication = serviceAuth
+		}
+
+		router.Handle(r.path, s.route(r.handler, bodyLimit(r), authentication, limit, middleware.Authorization(s.policy, r.permission))).Methods(r.method)
+	}
+
+	limit, err := s.rateLimit("get_report")
+	if err != nil {
+		return nil, err
+	}
+
+	router.PathPrefix("/report/").Handler(s.reportFiles(userAuth, limit, middleware.Authorization(s.policy, auth.PermissionReportRead)))
+
+	return router, nil
+}
+
+// reportFiles отдает файл отчета <id>.csv из каталога ReportService. Другие имена и сам каталог не отдаются (404),
+// поэтому по ссылке нельзя получить список чужих отчетов
+// @summary Получения файла по ссылке
+// @tags report
+// @description Метод получения файла по ссылке
+// @success 200 "1 колонка - id услуги (так как названия услуги в моем сервисе не предусмотрено, а доступа к другим нет, так как это просто тест), 2 колонка - общая сумма выручки за услугу"
+// @security ApiKeyAuth
+// @security BearerAuth
+// @failure 401 {object} dto.ApiError "Не передан или невалидный api ключ/токен"
+// @failure 403 {object} dto.ApiError "Нет права report:read"
+// @failure 429 {object} dto.ApiError "Превышен лимит запросов, время ожидания в заголовке Retry-After"
+// @failure 404 "Если файл не найден или имя не в формате <id>.csv"
+// @router /report/{fileName} [get]
+func (s *httpServer) reportFiles(authentication func(http.Handler) http.Handler, limit func(http.Handler) http.Handler, authorization func(http.Handler) http.Handler) http.Handler {
+	files := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/report/")
+		id := strings.TrimSuffix(name, ".csv")
+
+		if id == name || s.validator.Var(id, "uuid") != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		http.ServeFile(w, r, s.reportService.FilePath(id))
+	})
+
+	return middleware.Tracing(middleware.RequestID(s.ids)(middleware.ClientIP(middleware.Logging(s.logger, s.clock)(authentication(limit(authorization(files)))))))
+}
+
+// rateLimit - middleware лимита запросов маршрута route из конфига
+func (s *httpServer) rateLimit(route string) (func(http.Handler) http.Handler, error) {
+	limit, err := ratelimit.ParseLimit(config.RateLimit(route))
+	if err != nil {
+		return nil, err
+	}
+
+	return middleware.RateLimit(s.rateLimitBackend, route, limit), nil
+}
+
+// bodyLimit - максимальный размер тела запроса маршрута
+func bodyLimit(r httpRoute) int {
+	if r.path == "/transaction/batch" {
+		return config.BatchMaxBodyBytes
+	}
+
+	return config.HttpMaxBodyBytes
+}
+
+// route оборачивает метод API в общие middleware, routeMiddlewares (аутентификация, права и т.д.) применяются в переданном порядке.
+// Тело ограничивается maxBody байтами до Logging, чтобы большой запрос не читался целиком еще до аутентификации
+func (s *httpServer) route(handler http.Handler, maxBody int, routeMiddlewares ...func(http.Handler) http.Handler) http.Handler {
+	for i := len(routeMiddlewares) - 1; i >= 0; i-- {
+		handler = routeMiddlewares[i](handler)
+	}
+
+	return middleware.Tracing(middleware.ResponseHeaders(middleware.RequestID(s.ids)(middleware.ClientIP(middleware.BodyLimit(maxBody)(middleware.Logging(s.logger, s.clock)(handler))))))
+}
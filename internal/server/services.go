@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+
+	"github.com/avito-test/internal/config"
+	"github.com/avito-test/internal/config/clock"
+	"github.com/avito-test/internal/config/idgen"
+	"github.com/avito-test/internal/publisher"
+	"github.com/avito-test/internal/service"
+	"github.com/avito-test/internal/storage/db"
+	"github.com/avito-test/internal/storage/repo"
+	"github.com/avito-test/internal/webhook"
+)
+
+// Services - сервисы, общие для http и grpc серверов
+type Services struct {
+	Balance     *service.BalanceService
+	Transaction *service.TransactionService
+	Report      *service.ReportService
+	Batch       *service.BatchService
+	Order       *service.OrderService
+	Webhook     *service.WebhookService
+	Adjustment  *service.AdjustmentService
+	Audit       *service.AuditService
+	Account     *service.AccountService
+	Limit       *service.LimitService
+	// Webhooks - отправка доставок webhook
+	Webhooks *service.WebhookDispatcher
+	// Stream - потоки событий баланса пользователей
+	Stream *service.BalanceStream
+	// Outbox - relay событий outbox, nil если публикатор не задан
+	Outbox *service.OutboxRelay
+}
+
+// NewServices подключается к бд и создает сервисы, события outbox публикуются через eventPublisher,
+// время и id операций берутся из clk и ids
+func NewServices(ctx context.Context, eventPublisher publisher.Publisher, clk clock.Clock, ids idgen.Generator) (*Services, error) {
+	if config.AuditHmacKey == "" {
+		return nil, errors.New("AUDIT_HMAC_KEY is required")
+	}
+
+	dbClient, err := db.NewDbPool(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	transactionService := service.NewTransactionService(repo.NewTransactionRepo(dbClient), clk, ids)
+	repos := repo.NewRepos(dbClient)
+	transactor := repo.NewTransactor(dbClient)
+
+	listen := func(ctx context.Context, notify func(userId string), connected func()) {
+		db.Listen(ctx, dbClient, repo.OutboxChannel, notify, connected)
+	}
+
+	balanceService := service.NewBalanceService(repo.NewBalanceRepo(dbClient), clk, ids)
+
+	services := &Services{
+		Balance:     balanceService,
+		Transaction: transactionService,
+		Report:      service.NewReportService(repo.NewReportRepo(dbClient), config.ReportDir, ids),
+		Batch:       service.NewBatchService(transactionService, repos, transactor),
+		Order:       service.NewOrderService(transactionService, repos, transactor, clk),
+		Webhook:     service.NewWebhookService(repos.Webhook, clk, ids, rand.Reader),
+		Adjustment:  service.NewAdjustmentService(repos.Adjustment, transactor, clk, ids),
+		Audit:       service.NewAuditService(repos.Audit, transactor, []byte(config.AuditHmacKey), config.AuditSealInterval, config.AuditSealBatchSize),
+		Account:     service.NewAccountService(repos.Account, clk),
+		Limit:       service.NewLimitService(repos.Limit, clk),
+		Webhooks: service.NewWebhookDispatcher(webhook.NewSender(config.WebhookTimeout, clk, webhook.PublicIP), repos.Webhook, clk, config.WebhookPollInterval, config.WebhookBatchSize,
+			config.WebhookMaxAttempts, config.WebhookBackoffBase, config.WebhookBackoffMax, config.WebhookTimeout),
+		Stream: service.NewBalanceStream(listen, balanceService, repos, clk, config.StreamHeartbeat, config.StreamBatchSize),
+	}
+
+	if eventPublisher != nil {
+		services.Outbox = service.NewOutboxRelay(eventPublisher, repos, transactor, config.OutboxPollInterval, config.OutboxBatchSize, config.OutboxRetention)
+	}
+
+	return services, nil
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/avito-test/internal/config/clock"
+	"github.com/avito-test/internal/config/logger"
+	"github.com/avito-test/internal/config/tracing"
+	"github.com/avito-test/internal/model"
+	"github.com/avito-test/internal/storage/repo"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// AccountService - статусы счетов пользователей. Сами ограничения проверяют функции изменения баланса в бд
+// (account_restriction), сервис только показывает и меняет статус
+type AccountService struct {
+	repo  repo.AccountRepo
+	clock clock.Clock
+}
+
+// NewAccountService создает сервис статусов счетов, время изменения статуса берется из clk
+func NewAccountService(repo repo.AccountRepo, clk clock.Clock) *AccountService {
+	return &AccountService{
+		repo:  repo,
+		clock: clk,
+	}
+}
+
+// GetAccount возвращает статус счета пользователя, если статус не задавался - active без причины
+func (a *AccountService) GetAccount(ctx context.Context, userId string) (model.Account, error) {
+	ctx, span := tracing.Start(ctx, "AccountService.GetAccount")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", userId))
+
+	account, err := a.repo.GetAccount(ctx, userId)
+	if err != nil {
+		tracing.Error(span, err)
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"user_id":       userId,
+			"error_message": err.Error(),
+		}).Error("failed to get account status")
+
+		return model.Account{}, err
+	}
+
+	if account == nil {
+		return model.Account{UserId: userId, Status: model.AccountActive}, nil
+	}
+
+	return *account, nil
+}
+
+// SetStatus задает статус счета пользователя с причиной, задавшим статус считается вызывающий
+func (a *AccountService) SetStatus(ctx context.Context, userId string, status model.AccountStatus, reason string) (model.Account, error) {
+	ctx, span := tracing.Start(ctx, "AccountService.SetStatus")
+	defer span.End()
+
+	ctx = auditContext(ctx, "set_account_status")
+
+	span.SetAttributes(attribute.String("user.id", userId), attribute.String("account.status", string(status)))
+
+	previous, err := a.GetAccount(ctx, userId)
+	if err != nil {
+		return model.Account{}, err
+	}
+
+	account := model.Account{
+		UserId:     userId,
+		Status:     status,
+		Reason:     reason,
+		UpdatedBy:  principal(ctx).Id,
+		UpdateTime: a.clock.Now().UTC().Truncate(time.Microsecond),
+	}
+
+	if err := a.repo.SetAccount(ctx, account); err != nil {
+		tracing.Error(span, err)
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"user_id":       userId,
+			"error_message": err.Error(),
+		}).Error("failed to set account status")
+
+		return model.Account{}, err
+	}
+
+	audit(ctx, "set_account_status", logrus.Fields{
+		"user_id":         userId,
+		"status":          status,
+		"previous_status": previous.Status,
+		"reason":          reason,
+	})
+
+	return account, nil
+}
@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/avito-test/internal/config/clock"
+	"github.com/avito-test/internal/config/idgen"
+	"github.com/avito-test/internal/config/logger"
+	"github.com/avito-test/internal/config/tracing"
+	"github.com/avito-test/internal/model"
+	"github.com/avito-test/internal/storage/repo"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// adjustmentsLimit - сколько корректировок возвращают списки
+const adjustmentsLimit = 100
+
+// AdjustmentService - ручные корректировки баланса по принципу maker-checker: один оператор предлагает зачисление
+// или списание с причиной и номером тикета, другой оператор одобряет или отклоняет. Баланс меняется только
+// при одобрении, транзакцией корректировки
+type AdjustmentService struct {
+	AdjustmentNotFoundErr error
+	AlreadyDecidedErr     error
+	SameOperatorErr       error
+	BalanceNotFoundErr    error
+	InsufficientFundsErr  error
+	AccountFrozenErr      error
+	AccountClosedErr      error
+
+	repo       repo.AdjustmentRepo
+	transactor repo.Transactor
+	clock      clock.Clock
+	ids        idgen.Generator
+}
+
+// NewAdjustmentService создает сервис корректировок, id и время корректировок и их транзакций берутся из ids и clk
+func NewAdjustmentService(repo repo.AdjustmentRepo, transactor repo.Transactor, clk clock.Clock, ids idgen.Generator) *AdjustmentService {
+	return &AdjustmentService{
+		AdjustmentNotFoundErr: errors.New("adjustment not found"),
+		AlreadyDecidedErr:     errors.New("adjustment already decided"),
+		SameOperatorErr:       errors.New("adjustment must be decided by another operator"),
+		BalanceNotFoundErr:    errors.New("balance not found"),
+		InsufficientFundsErr:  errors.New("insufficient funds"),
+		AccountFrozenErr:      errors.New("account is frozen"),
+		AccountClosedErr:      errors.New("account is closed"),
+
+		repo:       repo,
+		transactor: transactor,
+		clock:      clk,
+		ids:        ids,
+	}
+}
+
+// Propose создает корректировку, ожидающую решения, предложившим считается вызывающий
+func (a *AdjustmentService) Propose(ctx context.Context, adjustment model.Adjustment) (model.Adjustment, error) {
+	ctx, span := tracing.Start(ctx, "AdjustmentService.Propose")
+	defer span.End()
+
+	ctx = auditContext(ctx, "propose_adjustment")
+
+	adjustment.Id = a.ids.NewId()
+	adjustment.Status = model.AdjustmentPending
+	adjustment.ProposedBy = principal(ctx).Id
+	adjustment.ProposeTime = a.clock.Now().UTC().Truncate(time.Microsecond)
+
+	if err := a.repo.CreateAdjustment(ctx, adjustment); err != nil {
+		tracing.Error(span, err)
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"error_message": err.Error(),
+		}).Error("failed to create adjustment")
+
+		return model.Adjustment{}, err
+	}
+
+	audit(ctx, "propose_adjustment", logrus.Fields{
+		"adjustment_id": adjustment.Id,
+		"user_id":       adjustment.UserId,
+		"direction":     adjustment.Direction,
+		"sum":           adjustment.Sum,
+		"ticket":        adjustment.Ticket,
+	})
+
+	return adjustment, nil
+}
+
+// Approve одобряет корректировку и проводит ее транзакцией корректировки. Одобрить может только не предложивший ее
+// оператор, если провести не удалось (нет баланса, не хватает средств, счет заморожен) - корректировка остается ожидающей
+func (a *AdjustmentService) Approve(ctx context.Context, id string, comment *string) (model.Adjustment, error) {
+	return a.decide(ctx, id, model.AdjustmentApproved, comment)
+}
+
+// Reject отклоняет корректировку, баланс не меняется. Отклонить может только не предложивший ее оператор
+func (a *AdjustmentService) Reject(ctx context.Context, id string, comment *string) (model.Adjustment, error) {
+	return a.decide(ctx, id, model.AdjustmentRejected, comment)
+}
+
+func (a *AdjustmentService) decide(ctx context.Context, id string, status model.AdjustmentStatus, comment *string) (model.Adjustment, error) {
+	ctx, span := tracing.Start(ctx, "AdjustmentService.decide")
+	defer span.End()
+
+	ctx = auditContext(ctx, string(status)+"_adjustment")
+
+	span.SetAttributes(attribute.String("adjustment.id", id), attribute.String("adjustment.status", string(status)))
+
+	decidedBy := principal(ctx).Id
+
+	var adjustment model.Adjustment
+
+	err := a.transactor.InTx(ctx, func(repos repo.Repos) error {
+		locked, err := repos.Adjustment.LockAdjustment(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if locked == nil {
+			return a.AdjustmentNotFoundErr
+		}
+
+		if locked.Status != model.AdjustmentPending {
+			return a.AlreadyDecidedErr
+		}
+
+		if locked.ProposedBy == decidedBy {
+			return a.SameOperatorErr
+		}
+
+		operation := newOperation(a.clock, a.ids)
+
+		adjustment = *locked
+		adjustment.Status = status
+		adjustment.DecidedBy = &decidedBy
+		adjustment.DecisionTime = &operation.Time
+		adjustment.DecisionComment = comment
+
+		if status == model.AdjustmentApproved {
+			transactionStatus, err := repos.Adjustment.PostAdjustment(ctx, operation, adjustment, adjustmentComment(adjustment))
+			if err != nil {
+				return err
+			}
+
+			if err := a.statusErr(transactionStatus); err != nil {
+				return err
+			}
+
+			adjustment.TransactionId = &operation.Id
+		}
+
+		return repos.Adjustment.SaveDecision(ctx, adjustment)
+	})
+
+	if err != nil {
+		tracing.Error(span, err)
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"error_message": err.Error(),
+		}).Error("failed to decide adjustment")
+
+		return model.Adjustment{}, err
+	}
+
+	audit(ctx, string(status)+"_adjustment", logrus.Fields{
+		"adjustment_id":  adjustment.Id,
+		"user_id":        adjustment.UserId,
+		"direction":      adjustment.Direction,
+		"sum":            adjustment.Sum,
+		"ticket":         adjustment.Ticket,
+		"proposed_by":    adjustment.ProposedBy,
+		"transaction_id": adjustment.TransactionId,
+	})
+
+	return adjustment, nil
+}
+
+// GetAdjustment возвращает корректировку по id
+func (a *AdjustmentService) GetAdjustment(ctx context.Context, id string) (model.Adjustment, error) {
+	ctx, span := tracing.Start(ctx, "AdjustmentService.GetAdjustment")
+	defer span.End()
+
+	adjustment, err := a.repo.GetAdjustment(ctx, id)
+	if err != nil {
+		tracing.Error(span, err)
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"error_message": err.Error(),
+		}).Error("failed to get adjustment")
+
+		return model.Adjustment{}, err
+	}
+
+	if adjustment == nil {
+		return model.Adjustment{}, a.AdjustmentNotFoundErr
+	}
+
+	return *adjustment, nil
+}
+
+// GetPending возвращает первые 100 корректировок, ожидающих решения, в порядке очереди
+func (a *AdjustmentService) GetPending(ctx context.Context) ([]model.Adjustment, error) {
+	pending := model.AdjustmentPending
+
+	return a.getAdjustments(ctx, nil, &pending)
+}
+
+// GetHistory возвращает последние 100 корректировок в любом состоянии, новые первыми. userId и status - необязательные фильтры
+func (a *AdjustmentService) GetHistory(ctx context.Context, userId *string, status *model.AdjustmentStatus) ([]model.Adjustment, error) {
+	return a.getAdjustments(ctx, userId, status)
+}
+
+func (a *AdjustmentService) getAdjustments(ctx context.Context, userId *string, status *model.AdjustmentStatus) ([]model.Adjustment, error) {
+	ctx, span := tracing.Start(ctx, "AdjustmentService.GetAdjustments")
+	defer span.End()
+
+	adjustments, err := a.repo.GetAdjustments(ctx, userId, status, adjustmentsLimit)
+	if err != nil {
+		tracing.Error(span, err)
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"error_message": err.Error(),
+		}).Error("failed to get adjustments")
+
+		return nil, err
+	}
+
+	return adjustments, nil
+}
+
+// statusErr возвращает ошибку сервиса, соответствующую статусу post_adjustment, для успешного статуса - nil
+func (a *AdjustmentService) statusErr(status model.TransactionStatus) error {
+	switch status {
+	case model.TransactionStatusOk:
+		return nil
+	case model.TransactionStatusBalanceNotFound:
+		return a.BalanceNotFoundErr
+	case model.TransactionStatusInsufficientFunds:
+		return a.InsufficientFundsErr
+	case model.TransactionStatusAccountFrozen:
+		return a.AccountFrozenErr
+	case model.TransactionStatusAccountClosed:
+		return a.AccountClosedErr
+	default:
+		return fmt.Errorf("unexpected adjustment status %d", status)
+	}
+}
+
+// adjustmentComment - комментарий транзакции корректировки: тикет и причина
+func adjustmentComment(adjustment model.Adjustment) string {
+	return fmt.Sprintf("%s: %s", adjustment.Ticket, adjustment.Reason)
+}
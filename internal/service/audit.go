@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+
+	"github.com/avito-test/internal/config/auth"
+	"github.com/avito-test/internal/config/clientip"
+	"github.com/avito-test/internal/config/logger"
+	"github.com/avito-test/internal/config/requestid"
+	"github.com/avito-test/internal/storage/db"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// audit пишет запись об операции, меняющей баланс, вместе с вызывающим из контекста
+func audit(ctx context.Context, operation string, fields logrus.Fields) {
+	principal := principal(ctx)
+
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("enduser.id", principal.Id))
+
+	logger.FromContext(ctx).WithFields(fields).WithFields(logrus.Fields{
+		"audit":        true,
+		"operation":    operation,
+		"principal_id": principal.Id,
+		"auth_method":  principal.Method,
+		"roles":        principal.Roles,
+	}).Info("audit")
+}
+
+// auditContext добавляет в ctx контекст аудита операции operation: вызывающий, id запроса и ip клиента.
+// Репозитории передают его в бд, и триггеры пишут его в журнал аудита вместе с каждой измененной строкой
+func auditContext(ctx context.Context, operation string) context.Context {
+	principal := principal(ctx)
+
+	return db.WithAudit(ctx, db.Audit{
+		Actor:      principal.Id,
+		AuthMethod: string(principal.Method),
+		RequestId:  requestid.FromContext(ctx),
+		SourceIp:   clientip.FromContext(ctx),
+		Operation:  operation,
+	})
+}
+
+// principal - вызывающий из контекста, без аутентификации - Anonymous
+func principal(ctx context.Context) auth.Principal {
+	if principal, ok := auth.FromContext(ctx); ok {
+		return principal
+	}
+
+	return auth.Anonymous
+}
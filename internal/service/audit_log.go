@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/avito-test/internal/config/logger"
+	"github.com/avito-test/internal/config/tracing"
+	"github.com/avito-test/internal/model"
+	"github.com/avito-test/internal/storage/repo"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// auditPageSize - сколько записей журнала читается за один запрос при проверке
+const auditPageSize = 1000
+
+// AuditService - журнал аудита public.audit_log: записи добавляют триггеры бд с контекстом вызова из auditContext,
+// сервис запечатывает их по порядку цепочкой HMAC с ключом key (номер без пропусков и хеш предыдущей записи) и
+// проверяет ее. Триггерам не нужна общая блокировка, запечатывает только один инстанс сервиса (advisory блокировка)
+type AuditService struct {
+	repo       repo.AuditRepo
+	transactor repo.Transactor
+	key        []byte
+
+	sealInterval time.Duration
+	batchSize    int
+}
+
+func NewAuditService(repo repo.AuditRepo, transactor repo.Transactor, key []byte, sealInterval time.Duration, batchSize int) *AuditService {
+	return &AuditService{
+		repo:       repo,
+		transactor: transactor,
+		key:        key,
+
+		sealInterval: sealInterval,
+		batchSize:    batchSize,
+	}
+}
+
+// Run запечатывает новые записи раз в sealInterval, пока не отменен ctx
+func (a *AuditService) Run(ctx context.Context) {
+	log := logger.FromContext(ctx)
+
+	ticker := time.NewTicker(a.sealInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			sealed, err := a.SealBatch(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.WithFields(logrus.Fields{
+						"error_message": err.Error(),
+					}).Error("failed to seal audit entries")
+				}
+
+				break
+			}
+
+			// полная пачка - возможно, есть еще записи, запечатываем без ожидания
+			if sealed < a.batchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SealBatch запечатывает до batchSize записей в порядке добавления и возвращает их количество: задает номер следующий
+// за последней запечатанной записью, prev_hash - ее хеш и hash записи. Если запечатывает другой инстанс - возвращает 0
+func (a *AuditService) SealBatch(ctx context.Context) (int, error) {
+	ctx, span := tracing.Start(ctx, "AuditService.SealBatch")
+	defer span.End()
+
+	var sealed int
+
+	err := a.transactor.InTx(ctx, func(repos repo.Repos) error {
+		sealed = 0
+
+		locked, err := repos.Audit.TryLock(ctx)
+		if err != nil || !locked {
+			return err
+		}
+
+		entries, err := repos.Audit.GetUnsealed(ctx, a.batchSize)
+		if err != nil || len(entries) == 0 {
+			return err
+		}
+
+		previous, err := repos.Audit.GetLastSealed(ctx)
+		if err != nil {
+			return err
+		}
+
+		var last model.AuditEntry
+		if previous != nil {
+			last = *previous
+		}
+
+		for i := range entries {
+			entries[i].Sequence = last.Sequence + 1
+			entries[i].PrevHash = last.Hash
+			entries[i].Hash = entries[i].ComputeHash(a.key)
+
+			last = entries[i]
+		}
+
+		if err := repos.Audit.Seal(ctx, entries); err != nil {
+			return err
+		}
+
+		sealed = len(entries)
+
+		return nil
+	})
+
+	span.SetAttributes(attribute.Int("audit.sealed", sealed))
+
+	if err != nil {
+		tracing.Error(span, err)
+		return 0, err
+	}
+
+	return sealed, nil
+}
+
+// Verify проверяет все запечатанные записи: номера идут подряд с 1 (пропуск - удаление), prev_hash совпадает с хешем
+// предыдущей записи, hash совпадает с HMAC от полей записи (иначе запись изменена или цепочка пересчитана без ключа).
+// Если передан anchor - запись с его номером должна существовать и иметь тот же хеш, так обнаруживается удаление
+// записей с конца журнала. Незапечатанные записи только считаются
+func (a *AuditService) Verify(ctx context.Context, anchor *model.AuditAnchor) (model.AuditVerification, error) {
+	ctx, span := tracing.Start(ctx, "AuditService.Verify")
+	defer span.End()
+
+	verification := model.AuditVerification{Problems: make([]model.AuditProblem, 0)}
+
+	problem := func(sequence int64, format string, args ...interface{}) {
+		verification.Problems = append(verification.Problems, model.AuditProblem{Sequence: sequence, Problem: fmt.Sprintf(format, args...)})
+	}
+
+	for {
+		entries, err := a.repo.GetAuditEntries(ctx, verification.LastSequence, auditPageSize)
+		if err != nil {
+			tracing.Error(span, err)
+			logger.FromContext(ctx).WithFields(logrus.Fields{
+				"error_message": err.Error(),
+			}).Error("failed to get audit entries")
+
+			return model.AuditVerification{}, err
+		}
+
+		for _, entry := range entries {
+			if entry.Sequence != verification.LastSequence+1 {
+				problem(entry.Sequence, "entries %d-%d are missing", verification.LastSequence+1, entry.Sequence-1)
+			}
+
+			if entry.PrevHash != verification.LastHash {
+				problem(entry.Sequence, "prev_hash does not match hash of previous entry")
+			}
+
+			if entry.ComputeHash(a.key) != entry.Hash {
+				problem(entry.Sequence, "hash does not match entry contents")
+			}
+
+			if anchor != nil && entry.Sequence == anchor.Sequence && entry.Hash != anchor.Hash {
+				problem(entry.Sequence, "hash does not match anchor %s", anchor.Hash)
+			}
+
+			verification.Entries++
+			verification.LastSequence = entry.Sequence
+			verification.LastHash = entry.Hash
+		}
+
+		if len(entries) < auditPageSize {
+			break
+		}
+	}
+
+	unsealed, err := a.repo.CountUnsealed(ctx)
+	if err != nil {
+		tracing.Error(span, err)
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"error_message": err.Error(),
+		}).Error("failed to count unsealed audit entries")
+
+		return model.AuditVerification{}, err
+	}
+
+	verification.Unsealed = unsealed
+
+	if anchor != nil && verification.LastSequence < anchor.Sequence {
+		problem(anchor.Sequence, "entries %d-%d are missing, log ends before anchor", verification.LastSequence+1, anchor.Sequence)
+	}
+
+	if len(verification.Problems) > 0 {
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"problems": len(verification.Problems),
+		}).Warn("audit log verification failed")
+	}
+
+	return verification, nil
+}
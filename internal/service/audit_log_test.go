@@ -0,0 +1,256 @@
+package service_test
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/avito-test/internal/model"
+	"github.com/avito-test/internal/service"
+	"github.com/avito-test/internal/storage/repo"
+)
+
+var key = []byte("audit-key")
+
+// auditLog - журнал аудита в памяти: записи добавляет тест вместо триггеров бд
+type auditLog struct {
+	entries []model.AuditEntry
+}
+
+func (l *auditLog) add(count int) {
+	for i := 0; i < count; i++ {
+		id := int64(len(l.entries) + 1)
+		after := `{"user_id": "` + strconv.FormatInt(id, 10) + `"}`
+
+		l.entries = append(l.entries, model.AuditEntry{
+			Id:         id,
+			Time:       time.Date(2022, time.November, 1, 10, 0, int(id), 0, time.UTC),
+			Actor:      "operator",
+			DbUser:     "balance",
+			AuthMethod: "cli",
+			Operation:  "add_balance",
+			Entity:     "balance",
+			EntityId:   strconv.FormatInt(id, 10),
+			Action:     "insert",
+			After:      &after,
+		})
+	}
+}
+
+func (l *auditLog) sealed() []model.AuditEntry {
+	sealed := make([]model.AuditEntry, 0)
+
+	for _, entry := range l.entries {
+		if entry.Hash != "" {
+			sealed = append(sealed, entry)
+		}
+	}
+
+	sort.Slice(sealed, func(i, j int) bool {
+		return sealed[i].Sequence < sealed[j].Sequence
+	})
+
+	return sealed
+}
+
+func (l *auditLog) TryLock(context.Context) (bool, error) {
+	return true, nil
+}
+
+func (l *auditLog) GetLastSealed(context.Context) (*model.AuditEntry, error) {
+	sealed := l.sealed()
+	if len(sealed) == 0 {
+		return nil, nil
+	}
+
+	return &sealed[len(sealed)-1], nil
+}
+
+func (l *auditLog) GetUnsealed(_ context.Context, limit int) ([]model.AuditEntry, error) {
+	unsealed := make([]model.AuditEntry, 0)
+
+	for _, entry := range l.entries {
+		if entry.Hash == "" && len(unsealed) < limit {
+			unsealed = append(unsealed, entry)
+		}
+	}
+
+	return unsealed, nil
+}
+
+func (l *auditLog) CountUnsealed(ctx context.Context) (int64, error) {
+	unsealed, err := l.GetUnsealed(ctx, len(l.entries))
+
+	return int64(len(unsealed)), err
+}
+
+func (l *auditLog) Seal(_ context.Context, entries []model.AuditEntry) error {
+	for _, sealed := range entries {
+		for i := range l.entries {
+			if l.entries[i].Id == sealed.Id && l.entries[i].Hash == "" {
+				l.entries[i] = sealed
+			}
+		}
+	}
+
+	return nil
+}
+
+func (l *auditLog) GetAuditEntries(_ context.Context, afterSequence int64, limit int) ([]model.AuditEntry, error) {
+	entries := make([]model.AuditEntry, 0)
+
+	for _, entry := range l.sealed() {
+		if entry.Sequence > afterSequence && len(entries) < limit {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, nil
+}
+
+// auditTransactor выполняет fn без транзакции с журналом log
+type auditTransactor struct {
+	log *auditLog
+}
+
+func (t auditTransactor) InTx(_ context.Context, fn func(repos repo.Repos) error) error {
+	return fn(repo.Repos{Audit: t.log})
+}
+
+func newAuditService(log *auditLog, key []byte) *service.AuditService {
+	return service.NewAuditService(log, auditTransactor{log: log}, key, time.Second, 2)
+}
+
+// TestAuditSeal - записи запечатываются пачками по порядку добавления, номера идут подряд, каждая запись ссылается
+// на хеш предыдущей
+func TestAuditSeal(t *testing.T) {
+	ctx := context.Background()
+
+	log := &auditLog{}
+	log.add(5)
+
+	audit := newAuditService(log, key)
+
+	for _, want := range []int{2, 2, 1, 0} {
+		if sealed, err := audit.SealBatch(ctx); err != nil || sealed != want {
+			t.Fatalf("SealBatch = %d, %v, want %d", sealed, err, want)
+		}
+	}
+
+	for i, entry := range log.entries {
+		if entry.Sequence != int64(i+1) || i > 0 && entry.PrevHash != log.entries[i-1].Hash || entry.Hash != entry.ComputeHash(key) {
+			t.Fatalf("entry %d = %+v, want sequence %d chained to previous", i, entry, i+1)
+		}
+	}
+
+	log.add(1)
+
+	verification, err := audit.Verify(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := model.AuditVerification{Entries: 5, LastSequence: 5, LastHash: log.entries[4].Hash, Unsealed: 1, Problems: []model.AuditProblem{}}
+	if !reflect.DeepEqual(verification, want) {
+		t.Fatalf("Verify = %+v, want %+v", verification, want)
+	}
+}
+
+func TestAuditVerify(t *testing.T) {
+	tests := []struct {
+		name string
+		// tamper меняет запечатанный журнал из 5 записей, как это мог бы сделать владелец бд без ключа
+		tamper func(log *auditLog)
+		anchor *model.AuditAnchor
+		want   []model.AuditProblem
+	}{
+		{
+			name:   "intact",
+			tamper: func(log *auditLog) {},
+			want:   []model.AuditProblem{},
+		},
+		{
+			name: "modified",
+			tamper: func(log *auditLog) {
+				after := `{"user_id": "other"}`
+				log.entries[1].After = &after
+			},
+			want: []model.AuditProblem{{Sequence: 2, Problem: "hash does not match entry contents"}},
+		},
+		{
+			name: "deleted",
+			tamper: func(log *auditLog) {
+				log.entries = append(log.entries[:2], log.entries[3:]...)
+			},
+			want: []model.AuditProblem{
+				{Sequence: 4, Problem: "entries 3-3 are missing"},
+				{Sequence: 4, Problem: "prev_hash does not match hash of previous entry"},
+			},
+		},
+		{
+			// без ключа пересчитанная цепочка сходится сама с собой, но не с HMAC
+			name: "rewritten_without_key",
+			tamper: func(log *auditLog) {
+				for i := range log.entries {
+					log.entries[i].Hash = ""
+				}
+
+				forged := newAuditService(log, []byte("guessed-key"))
+				for sealed := -1; sealed != 0; {
+					sealed, _ = forged.SealBatch(context.Background())
+				}
+			},
+			want: []model.AuditProblem{
+				{Sequence: 1, Problem: "hash does not match entry contents"},
+				{Sequence: 2, Problem: "hash does not match entry contents"},
+				{Sequence: 3, Problem: "hash does not match entry contents"},
+				{Sequence: 4, Problem: "hash does not match entry contents"},
+				{Sequence: 5, Problem: "hash does not match entry contents"},
+			},
+		},
+		{
+			name: "truncated_before_anchor",
+			tamper: func(log *auditLog) {
+				log.entries = log.entries[:3]
+			},
+			anchor: &model.AuditAnchor{Sequence: 5},
+			want:   []model.AuditProblem{{Sequence: 5, Problem: "entries 4-5 are missing, log ends before anchor"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			log := &auditLog{}
+			log.add(5)
+
+			audit := newAuditService(log, key)
+
+			for sealed := -1; sealed != 0; {
+				var err error
+				if sealed, err = audit.SealBatch(ctx); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if tt.anchor != nil {
+				tt.anchor.Hash = log.entries[tt.anchor.Sequence-1].Hash
+			}
+
+			tt.tamper(log)
+
+			verification, err := audit.Verify(ctx, tt.anchor)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(verification.Problems, tt.want) {
+				t.Fatalf("problems = %+v, want %+v", verification.Problems, tt.want)
+			}
+		})
+	}
+}
@@ -5,47 +5,109 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/avito-test/internal/config/clock"
+	"github.com/avito-test/internal/config/idgen"
 	"github.com/avito-test/internal/config/logger"
+	"github.com/avito-test/internal/config/tracing"
 	"github.com/avito-test/internal/model"
 	"github.com/avito-test/internal/storage/repo"
 	"github.com/sirupsen/logrus"
 )
 
 type BalanceService struct {
-	BalanceNotFoundErr error
+	BalanceNotFoundErr   error
+	InsufficientFundsErr error
+	AccountFrozenErr     error
+	AccountClosedErr     error
+	LimitExceededErr     error
 
-	repo repo.BalanceRepo
-	log  *logrus.Logger
+	repo  repo.BalanceRepo
+	clock clock.Clock
+	ids   idgen.Generator
 }
 
-func NewBalanceService(repo repo.BalanceRepo) *BalanceService {
+// NewBalanceService создает сервис балансов, id и время пополнений берутся из ids и clk
+func NewBalanceService(repo repo.BalanceRepo, clk clock.Clock, ids idgen.Generator) *BalanceService {
 	return &BalanceService{
-		BalanceNotFoundErr: errors.New("balance not found"),
+		BalanceNotFoundErr:   errors.New("balance not found"),
+		InsufficientFundsErr: errors.New("insufficient funds"),
+		AccountFrozenErr:     errors.New("account is frozen"),
+		AccountClosedErr:     errors.New("account is closed"),
+		LimitExceededErr:     errors.New("limit exceeded"),
 
-		repo: repo,
-		log:  logger.GetLogger(),
+		repo:  repo,
+		clock: clk,
+		ids:   ids,
 	}
 }
 
+// AddBalance пополняет баланс пользователя, если статус счета запрещает пополнение - AccountFrozenErr или AccountClosedErr,
+// если превышен лимит пополнений - LimitExceededErr
 func (b *BalanceService) AddBalance(ctx context.Context, transaction model.IncreaseBalanceTransaction) error {
-	if err := b.repo.AddBalance(transaction.UserId, transaction.Sum, transaction.Comment); err != nil {
-		b.log.WithFields(logrus.Fields{
+	ctx, span := tracing.Start(ctx, "BalanceService.AddBalance")
+	defer span.End()
+
+	ctx = auditContext(ctx, "add_balance")
+
+	status, err := b.repo.AddBalance(ctx, newOperation(b.clock, b.ids), transaction.UserId, transaction.Sum, transaction.Comment)
+
+	if err != nil {
+		tracing.Error(span, err)
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"error_message": err.Error(),
+		}).Error("failed to add balance")
+
+		return err
+	}
+
+	audit(ctx, "add_balance", logrus.Fields{
+		"user_id": transaction.UserId,
+		"sum":     transaction.Sum,
+		"status":  status,
+	})
+
+	return b.statusErr(status, model.LimitDeposit)
+}
+
+// WithdrawBalance списывает с баланса пользователя, нет баланса - BalanceNotFoundErr, не хватает средств - InsufficientFundsErr,
+// счет заморожен или закрыт - AccountFrozenErr или AccountClosedErr, превышен лимит списаний - LimitExceededErr
+func (b *BalanceService) WithdrawBalance(ctx context.Context, userId string, sum float64, comment *string) error {
+	ctx, span := tracing.Start(ctx, "BalanceService.WithdrawBalance")
+	defer span.End()
+
+	ctx = auditContext(ctx, "withdraw_balance")
+
+	status, err := b.repo.WithdrawBalance(ctx, newOperation(b.clock, b.ids), userId, sum, comment)
+
+	if err != nil {
+		tracing.Error(span, err)
+		logger.FromContext(ctx).WithFields(logrus.Fields{
 			"error_message": err.Error(),
-		}).Error(fmt.Sprintf("%s_ERROR", ctx.Value("requestId")))
+		}).Error("failed to withdraw balance")
 
 		return err
 	}
 
-	return nil
+	audit(ctx, "withdraw_balance", logrus.Fields{
+		"user_id": userId,
+		"sum":     sum,
+		"status":  status,
+	})
+
+	return b.statusErr(status, model.LimitWithdraw)
 }
 
 func (b *BalanceService) GetBalanceByUserID(ctx context.Context, userId string) (float64, error) {
-	balance, err := b.repo.GetBalanceByUserId(userId)
+	ctx, span := tracing.Start(ctx, "BalanceService.GetBalanceByUserID")
+	defer span.End()
+
+	balance, err := b.repo.GetBalanceByUserId(ctx, userId)
 
 	if err != nil {
-		b.log.WithFields(logrus.Fields{
+		tracing.Error(span, err)
+		logger.FromContext(ctx).WithFields(logrus.Fields{
 			"error_message": err.Error(),
-		}).Error(fmt.Sprintf("%s_ERROR", ctx.Value("requestId")))
+		}).Error("failed to get balance")
 
 		return 0, err
 	}
@@ -56,3 +118,51 @@ func (b *BalanceService) GetBalanceByUserID(ctx context.Context, userId string)
 
 	return *balance, nil
 }
+
+// statusErr возвращает ошибку сервиса, соответствующую статусу add_balance или withdraw_balance, для успешного статуса - nil.
+// operation - операция для текста ошибки превышения лимита
+func (b *BalanceService) statusErr(status model.TransactionStatus, operation model.LimitOperation) error {
+	if err := limitErr(b.LimitExceededErr, operation, status); err != nil {
+		return err
+	}
+
+	switch status {
+	case model.TransactionStatusOk:
+		return nil
+	case model.TransactionStatusBalanceNotFound:
+		return b.BalanceNotFoundErr
+	case model.TransactionStatusInsufficientFunds:
+		return b.InsufficientFundsErr
+	case model.TransactionStatusAccountFrozen:
+		return b.AccountFrozenErr
+	case model.TransactionStatusAccountClosed:
+		return b.AccountClosedErr
+	default:
+		return fmt.Errorf("unexpected balance status %d", status)
+	}
+}
+
+// Reconcile сверяет балансы с суммой транзакций пользователей и возвращает расхождения
+func (b *BalanceService) Reconcile(ctx context.Context) ([]model.BalanceMismatch, error) {
+	ctx, span := tracing.Start(ctx, "BalanceService.Reconcile")
+	defer span.End()
+
+	mismatches, err := b.repo.GetBalanceMismatches(ctx)
+
+	if err != nil {
+		tracing.Error(span, err)
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"error_message": err.Error(),
+		}).Error("failed to reconcile balances")
+
+		return nil, err
+	}
+
+	if len(mismatches) > 0 {
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"mismatches": len(mismatches),
+		}).Warn("balances do not match transactions")
+	}
+
+	return mismatches, nil
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/avito-test/internal/config/logger"
+	"github.com/avito-test/internal/config/tracing"
+	"github.com/avito-test/internal/model"
+	"github.com/avito-test/internal/storage/repo"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// errBatchFailed прерывает транзакцию атомарного пакета, причина записана в результат операции
+var errBatchFailed = errors.New("batch failed")
+
+// BatchService выполняет пакеты операций с балансом: пополнение (add_balance), резервацию, подтверждение и отмену (save_transaction)
+type BatchService struct {
+	transactionService *TransactionService
+
+	repos      repo.Repos
+	transactor repo.Transactor
+}
+
+func NewBatchService(transactionService *TransactionService, repos repo.Repos, transactor repo.Transactor) *BatchService {
+	return &BatchService{
+		transactionService: transactionService,
+
+		repos:      repos,
+		transactor: transactor,
+	}
+}
+
+// Execute выполняет операции пакета по порядку. Операция задается транзакцией с типом TransactionTypeId.
+// Неатомарный пакет выполняет каждую операцию отдельно. Атомарный выполняется в одной транзакции бд
+// и останавливается на первой ошибке, тогда выполненные операции откатываются.
+// Ошибка возвращается, только если не удалось открыть или зафиксировать транзакцию бд
+func (b *BatchService) Execute(ctx context.Context, operations []model.Transaction, atomic bool) ([]model.BatchOperationResult, error) {
+	ctx, span := tracing.Start(ctx, "BatchService.Execute")
+	defer span.End()
+
+	ctx = auditContext(ctx, "batch_operation")
+
+	span.SetAttributes(attribute.Int("batch.size", len(operations)), attribute.Bool("batch.atomic", atomic))
+
+	results := make([]model.BatchOperationResult, len(operations))
+
+	if !atomic {
+		for i, operation := range operations {
+			results[i] = b.execute(ctx, b.repos, operation)
+		}
+
+		b.audit(ctx, operations, results, atomic)
+
+		return results, nil
+	}
+
+	err := b.transactor.InTx(ctx, func(repos repo.Repos) error {
+		for i, operation := range operations {
+			results[i] = b.execute(ctx, repos, operation)
+
+			if results[i].Status == model.BatchFailed {
+				for j := 0; j < i; j++ {
+					results[j].Status = model.BatchRolledBack
+				}
+
+				for j := i + 1; j < len(results); j++ {
+					results[j].Status = model.BatchSkipped
+				}
+
+				return errBatchFailed
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil && !errors.Is(err, errBatchFailed) {
+		tracing.Error(span, err)
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"error_message": err.Error(),
+		}).Error("failed to execute batch")
+
+		return nil, err
+	}
+
+	b.audit(ctx, operations, results, atomic)
+
+	return results, nil
+}
+
+func (b *BatchService) execute(ctx context.Context, repos repo.Repos, operation model.Transaction) model.BatchOperationResult {
+	var err error
+	status := model.TransactionStatusOk
+
+	if operation.TransactionTypeId == model.TransactionTypeDeposit {
+		status, err = repos.Balance.AddBalance(ctx, b.transactionService.operation(), operation.UserId, operation.Sum, operation.Comment)
+	} else {
+		status, err = repos.Transaction.SaveTransaction(ctx, b.transactionService.operation(), *operation.OrderId, operation.UserId, *operation.ServiceId, operation.Sum, operation.TransactionTypeId, operation.Comment)
+	}
+
+	if err != nil {
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"error_message": err.Error(),
+		}).Error("failed to execute batch operation")
+
+		return model.BatchOperationResult{Status: model.BatchFailed, Err: err}
+	}
+
+	// пополнение пакета проверяется лимитом пополнений, статусы остальных операций - как у save_transaction
+	if operation.TransactionTypeId == model.TransactionTypeDeposit {
+		err = limitErr(b.transactionService.LimitExceededErr, model.LimitDeposit, status)
+	}
+
+	if err == nil {
+		err = b.transactionService.StatusErr(status)
+	}
+
+	if err != nil {
+		return model.BatchOperationResult{Status: model.BatchFailed, Err: err}
+	}
+
+	return model.BatchOperationResult{Status: model.BatchApplied}
+}
+
+// audit пишет запись по каждой выполнявшейся операции пакета с итоговым результатом
+func (b *BatchService) audit(ctx context.Context, operations []model.Transaction, results []model.BatchOperationResult, atomic bool) {
+	for i, operation := range operations {
+		if results[i].Status == model.BatchSkipped {
+			continue
+		}
+
+		fields := logrus.Fields{
+			"batch_index":         i,
+			"batch_atomic":        atomic,
+			"user_id":             operation.UserId,
+			"order_id":            operation.OrderId,
+			"service_id":          operation.ServiceId,
+			"sum":                 operation.Sum,
+			"transaction_type_id": operation.TransactionTypeId,
+			"batch_status":        results[i].Status,
+		}
+
+		if results[i].Err != nil {
+			fields["error_message"] = results[i].Err.Error()
+		}
+
+		audit(ctx, "batch_operation", fields)
+	}
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/avito-test/internal/config/clock"
+	"github.com/avito-test/internal/config/logger"
+	"github.com/avito-test/internal/config/tracing"
+	"github.com/avito-test/internal/model"
+	"github.com/avito-test/internal/storage/repo"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// limitPeriodNames - названия периодов в тексте ошибки превышения лимита
+var limitPeriodNames = map[model.LimitPeriod]string{
+	model.LimitPerTransaction: "per-transaction",
+	model.LimitDaily:          "daily",
+	model.LimitMonthly:        "monthly",
+}
+
+// limitErr оборачивает err превышения лимита операции operation для статусов 13-15, в тексте - какой лимит превышен.
+// Для остальных статусов - nil
+func limitErr(err error, operation model.LimitOperation, status model.TransactionStatus) error {
+	period, ok := status.LimitPeriod()
+	if !ok {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s %s limit", err, limitPeriodNames[period], operation)
+}
+
+// LimitService - лимиты пополнений, резерваций и списаний. Сами лимиты проверяют функции изменения баланса в бд
+// (check_limits) в той же транзакции, что и операция, сервис задает лимиты и уровни пользователей и показывает остаток
+type LimitService struct {
+	LimitRuleNotFoundErr error
+
+	repo  repo.LimitRepo
+	clock clock.Clock
+}
+
+// NewLimitService создает сервис лимитов, время изменения лимитов и текущий период берутся из clk
+func NewLimitService(repo repo.LimitRepo, clk clock.Clock) *LimitService {
+	return &LimitService{
+		LimitRuleNotFoundErr: errors.New("limit not found"),
+
+		repo:  repo,
+		clock: clk,
+	}
+}
+
+// GetRules возвращает все заданные лимиты
+func (l *LimitService) GetRules(ctx context.Context) ([]model.LimitRule, error) {
+	ctx, span := tracing.Start(ctx, "LimitService.GetRules")
+	defer span.End()
+
+	rules, err := l.repo.GetLimitRules(ctx)
+	if err != nil {
+		tracing.Error(span, err)
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"error_message": err.Error(),
+		}).Error("failed to get limit rules")
+
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// SetRule задает или заменяет лимит, задавшим лимит считается вызывающий
+func (l *LimitService) SetRule(ctx context.Context, rule model.LimitRule) (model.LimitRule, error) {
+	ctx, span := tracing.Start(ctx, "LimitService.SetRule")
+	defer span.End()
+
+	ctx = auditContext(ctx, "set_limit")
+
+	rule.UpdatedBy = principal(ctx).Id
+	rule.UpdateTime = l.clock.Now().UTC().Truncate(time.Microsecond)
+
+	if err := l.repo.SetLimitRule(ctx, rule); err != nil {
+		tracing.Error(span, err)
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"error_message": err.Error(),
+		}).Error("failed to set limit rule")
+
+		return model.LimitRule{}, err
+	}
+
+	audit(ctx, "set_limit", logrus.Fields{
+		"scope":     rule.Scope,
+		"scope_id":  rule.ScopeId,
+		"operation": rule.Operation,
+		"period":    rule.Period,
+		"amount":    rule.Amount,
+	})
+
+	return rule, nil
+}
+
+// DeleteRule удаляет лимит по scope, scopeId, операции и периоду rule, если лимита нет - LimitRuleNotFoundErr
+func (l *LimitService) DeleteRule(ctx context.Context, rule model.LimitRule) error {
+	ctx, span := tracing.Start(ctx, "LimitService.DeleteRule")
+	defer span.End()
+
+	ctx = auditContext(ctx, "delete_limit")
+
+	deleted, err := l.repo.DeleteLimitRule(ctx, rule)
+	if err != nil {
+		tracing.Error(span, err)
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"error_message": err.Error(),
+		}).Error("failed to delete limit rule")
+
+		return err
+	}
+
+	if !deleted {
+		return l.LimitRuleNotFoundErr
+	}
+
+	audit(ctx, "delete_limit", logrus.Fields{
+		"scope":     rule.Scope,
+		"scope_id":  rule.ScopeId,
+		"operation": rule.Operation,
+		"period":    rule.Period,
+	})
+
+	return nil
+}
+
+// SetUserTier задает уровень пользователя, задавшим уровень считается вызывающий
+func (l *LimitService) SetUserTier(ctx context.Context, userId string, tier string) (model.UserTier, error) {
+	ctx, span := tracing.Start(ctx, "LimitService.SetUserTier")
+	defer span.End()
+
+	ctx = auditContext(ctx, "set_user_tier")
+
+	span.SetAttributes(attribute.String("user.id", userId))
+
+	userTier := model.UserTier{
+		UserId:     userId,
+		Tier:       tier,
+		UpdatedBy:  principal(ctx).Id,
+		UpdateTime: l.clock.Now().UTC().Truncate(time.Microsecond),
+	}
+
+	if err := l.repo.SetUserTier(ctx, userTier); err != nil {
+		tracing.Error(span, err)
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"user_id":       userId,
+			"error_message": err.Error(),
+		}).Error("failed to set user tier")
+
+		return model.UserTier{}, err
+	}
+
+	audit(ctx, "set_user_tier", logrus.Fields{
+		"user_id": userId,
+		"tier":    tier,
+	})
+
+	return userTier, nil
+}
+
+// GetUserLimits возвращает уровень пользователя и действующие лимиты с использованием в текущих сутках и месяце.
+// Остаток показывается на момент запроса, лимит проверяется при самой операции
+func (l *LimitService) GetUserLimits(ctx context.Context, userId string) (model.UserLimits, error) {
+	ctx, span := tracing.Start(ctx, "LimitService.GetUserLimits")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", userId))
+
+	limits, err := l.userLimits(ctx, userId)
+	if err != nil {
+		tracing.Error(span, err)
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"user_id":       userId,
+			"error_message": err.Error(),
+		}).Error("failed to get user limits")
+
+		return model.UserLimits{}, err
+	}
+
+	return limits, nil
+}
+
+func (l *LimitService) userLimits(ctx context.Context, userId string) (model.UserLimits, error) {
+	limits := model.UserLimits{UserId: userId, Limits: make([]model.LimitUsage, 0)}
+
+	tier, err := l.repo.GetUserTier(ctx, userId)
+	if err != nil {
+		return limits, err
+	}
+
+	if tier != nil {
+		limits.Tier = &tier.Tier
+	}
+
+	rules, err := l.repo.GetEffectiveLimits(ctx, userId)
+	if err != nil {
+		return limits, err
+	}
+
+	now := l.clock.Now()
+
+	for _, rule := range rules {
+		usage := model.LimitUsage{Rule: rule, Remaining: rule.Amount}
+
+		if from, to, ok := rule.Period.Window(now); ok {
+			used, err := l.repo.GetLimitUsage(ctx, userId, rule.Operation, from, to)
+			if err != nil {
+				return limits, err
+			}
+
+			usage.Used = used
+			usage.Remaining = math.Max(0, math.Round((rule.Amount-used)*10000)/10000)
+			usage.ResetTime = &to
+		}
+
+		limits.Limits = append(limits.Limits, usage)
+	}
+
+	return limits, nil
+}
@@ -0,0 +1,17 @@
+package service
+
+import (
+	"time"
+
+	"github.com/avito-test/internal/config/clock"
+	"github.com/avito-test/internal/config/idgen"
+	"github.com/avito-test/internal/model"
+)
+
+// newOperation выдает id и время очередного изменения баланса, время приводится к timestamp в бд (UTC, микросекунды)
+func newOperation(clk clock.Clock, ids idgen.Generator) model.Operation {
+	return model.Operation{
+		Id:   ids.NewId(),
+		Time: clk.Now().UTC().Truncate(time.Microsecond),
+	}
+}
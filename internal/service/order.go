@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/avito-test/internal/config/clock"
+	"github.com/avito-test/internal/config/logger"
+	"github.com/avito-test/internal/config/tracing"
+	"github.com/avito-test/internal/model"
+	"github.com/avito-test/internal/storage/repo"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// OrderService - заказы из нескольких строк: строки резервируются вместе, подтверждаются и отменяются по одной
+type OrderService struct {
+	OrderExistsErr   error
+	OrderNotFoundErr error
+	LineNotFoundErr  error
+
+	transactionService *TransactionService
+
+	repos      repo.Repos
+	transactor repo.Transactor
+	clock      clock.Clock
+}
+
+// NewOrderService создает сервис заказов, время создания заказа берется из clk
+func NewOrderService(transactionService *TransactionService, repos repo.Repos, transactor repo.Transactor, clk clock.Clock) *OrderService {
+	return &OrderService{
+		OrderExistsErr:   errors.New("order already exists"),
+		OrderNotFoundErr: errors.New("order not found"),
+		LineNotFoundErr:  errors.New("order line not found"),
+
+		transactionService: transactionService,
+
+		repos:      repos,
+		transactor: transactor,
+		clock:      clk,
+	}
+}
+
+// CreateOrder создает заказ и резервирует деньги под все строки в одной транзакции бд:
+// если не удалась резервация хотя бы одной строки, заказ не создается
+func (o *OrderService) CreateOrder(ctx context.Context, order model.Order) (model.Order, error) {
+	ctx, span := tracing.Start(ctx, "OrderService.CreateOrder")
+	defer span.End()
+
+	ctx = auditContext(ctx, "create_order")
+
+	span.SetAttributes(attribute.String("order.id", order.Id), attribute.Int("order.lines", len(order.Lines)))
+
+	serviceIds := make([]string, 0, len(order.Lines))
+	for _, line := range order.Lines {
+		serviceIds = append(serviceIds, *line.ServiceId)
+	}
+
+	err := o.transactor.InTx(ctx, func(repos repo.Repos) error {
+		created, err := repos.Order.CreateOrder(ctx, order.Id, order.UserId, serviceIds, o.clock.Now().UTC().Truncate(time.Microsecond))
+		if err != nil {
+			return err
+		}
+
+		if !created {
+			return o.OrderExistsErr
+		}
+
+		for _, line := range order.Lines {
+			status, err := repos.Transaction.SaveTransaction(ctx, o.transactionService.operation(), order.Id, order.UserId, *line.ServiceId, line.Sum, model.TransactionTypeReserve, line.Comment)
+			if err != nil {
+				return err
+			}
+
+			if err := o.transactionService.StatusErr(status); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		tracing.Error(span, err)
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"error_message": err.Error(),
+		}).Error("failed to create order")
+
+		return model.Order{}, err
+	}
+
+	for _, line := range order.Lines {
+		audit(ctx, "reserve_order_line", logrus.Fields{
+			"user_id":    order.UserId,
+			"order_id":   order.Id,
+			"service_id": *line.ServiceId,
+			"sum":        line.Sum,
+		})
+	}
+
+	return o.GetOrder(ctx, order.Id)
+}
+
+// GetOrder возвращает заказ со строками, созданными заказом
+func (o *OrderService) GetOrder(ctx context.Context, orderId string) (model.Order, error) {
+	ctx, span := tracing.Start(ctx, "OrderService.GetOrder")
+	defer span.End()
+
+	order, err := o.repos.Order.GetOrder(ctx, orderId)
+
+	if err != nil {
+		tracing.Error(span, err)
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"error_message": err.Error(),
+		}).Error("failed to get order")
+
+		return model.Order{}, err
+	}
+
+	if order == nil {
+		return model.Order{}, o.OrderNotFoundErr
+	}
+
+	transactions, err := o.repos.Transaction.GetTransactionsByOrderId(ctx, orderId)
+
+	if err != nil {
+		tracing.Error(span, err)
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"error_message": err.Error(),
+		}).Error("failed to get order lines")
+
+		return model.Order{}, err
+	}
+
+	services := make(map[string]bool, len(order.ServiceIds))
+	for _, serviceId := range order.ServiceIds {
+		services[serviceId] = true
+	}
+
+	for _, tr := range transactions {
+		if tr.UserId == order.UserId && tr.ServiceId != nil && services[*tr.ServiceId] {
+			order.Lines = append(order.Lines, tr)
+		}
+	}
+
+	return *order, nil
+}
+
+// CaptureLine признает выручку по строке заказа с услугой serviceId
+func (o *OrderService) CaptureLine(ctx context.Context, orderId string, serviceId string, comment *string) (model.Order, error) {
+	return o.changeLine(ctx, orderId, serviceId, comment, o.transactionService.Capture)
+}
+
+// CancelLine отменяет резервацию строки заказа с услугой serviceId
+func (o *OrderService) CancelLine(ctx context.Context, orderId string, serviceId string, comment *string) (model.Order, error) {
+	return o.changeLine(ctx, orderId, serviceId, comment, o.transactionService.Cancel)
+}
+
+func (o *OrderService) changeLine(ctx context.Context, orderId string, serviceId string, comment *string, change func(context.Context, model.Transaction) error) (model.Order, error) {
+	order, err := o.GetOrder(ctx, orderId)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	var line *model.Transaction
+
+	for i := range order.Lines {
+		if *order.Lines[i].ServiceId == serviceId {
+			line = &order.Lines[i]
+		}
+	}
+
+	if line == nil {
+		return model.Order{}, o.LineNotFoundErr
+	}
+
+	line.Comment = comment
+
+	if err := change(ctx, *line); err != nil {
+		return model.Order{}, err
+	}
+
+	return o.GetOrder(ctx, orderId)
+}
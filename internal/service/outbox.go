@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/avito-test/internal/config/logger"
+	"github.com/avito-test/internal/config/tracing"
+	"github.com/avito-test/internal/publisher"
+	"github.com/avito-test/internal/storage/repo"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// OutboxRelay публикует события из outbox по порядку записи. Событие отмечается опубликованным только
+// после подтверждения брокера, поэтому при сбое оно будет опубликовано повторно (at-least-once).
+// Публикует только один инстанс сервиса (advisory блокировка), это сохраняет порядок событий пользователя
+type OutboxRelay struct {
+	publisher  publisher.Publisher
+	transactor repo.Transactor
+	repos      repo.Repos
+
+	pollInterval time.Duration
+	batchSize    int
+	retention    time.Duration
+}
+
+func NewOutboxRelay(publisher publisher.Publisher, repos repo.Repos, transactor repo.Transactor, pollInterval time.Duration, batchSize int, retention time.Duration) *OutboxRelay {
+	return &OutboxRelay{
+		publisher:  publisher,
+		transactor: transactor,
+		repos:      repos,
+
+		pollInterval: pollInterval,
+		batchSize:    batchSize,
+		retention:    retention,
+	}
+}
+
+// Run публикует события раз в pollInterval, пока не отменен ctx
+func (o *OutboxRelay) Run(ctx context.Context) {
+	log := logger.FromContext(ctx)
+
+	ticker := time.NewTicker(o.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			published, err := o.RelayBatch(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.WithFields(logrus.Fields{
+						"error_message": err.Error(),
+					}).Error("failed to relay outbox events")
+				}
+
+				break
+			}
+
+			// полная пачка - возможно, есть еще события, публикуем без ожидания
+			if published < o.batchSize {
+				break
+			}
+		}
+
+		if deleted, err := o.repos.Outbox.DeletePublished(ctx, o.retention); err != nil {
+			if ctx.Err() == nil {
+				log.WithFields(logrus.Fields{
+					"error_message": err.Error(),
+				}).Error("failed to delete published outbox events")
+			}
+		} else if deleted > 0 {
+			log.WithFields(logrus.Fields{
+				"deleted": deleted,
+			}).Debug("published outbox events deleted")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayBatch публикует до batchSize неопубликованных событий и возвращает количество опубликованных.
+// Публикация останавливается на первой ошибке, чтобы следующие события пользователя не обогнали неопубликованное
+func (o *OutboxRelay) RelayBatch(ctx context.Context) (int, error) {
+	ctx, span := tracing.Start(ctx, "OutboxRelay.RelayBatch")
+	defer span.End()
+
+	var published []int64
+	var publishErr error
+
+	err := o.transactor.InTx(ctx, func(repos repo.Repos) error {
+		// транзакция повторяется после взаимной блокировки, события публикуются заново
+		published, publishErr = nil, nil
+
+		locked, err := repos.Outbox.TryLock(ctx)
+		if err != nil || !locked {
+			return err
+		}
+
+		events, err := repos.Outbox.GetUnpublished(ctx, o.batchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, event := range events {
+			if publishErr = o.publisher.Publish(ctx, event); publishErr != nil {
+				break
+			}
+
+			published = append(published, event.Sequence)
+		}
+
+		if len(published) == 0 {
+			return nil
+		}
+
+		return repos.Outbox.MarkPublished(ctx, published)
+	})
+
+	if err == nil {
+		err = publishErr
+	}
+
+	span.SetAttributes(attribute.Int("outbox.published", len(published)))
+
+	if err != nil {
+		tracing.Error(span, err)
+		return 0, err
+	}
+
+	return len(published), nil
+}
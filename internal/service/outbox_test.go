@@ -0,0 +1,178 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/avito-test/internal/config/clock"
+	"github.com/avito-test/internal/model"
+	"github.com/avito-test/internal/service"
+	"github.com/avito-test/internal/storage/memory"
+	"github.com/avito-test/internal/storage/repo"
+)
+
+var (
+	errBroker   = errors.New("broker unavailable")
+	errDeadlock = errors.New("deadlock detected")
+)
+
+// outboxPublisher - брокер, который не принимает событие failOn и проверяет, что relay не отметил публикуемое событие
+// опубликованным до подтверждения
+type outboxPublisher struct {
+	t      *testing.T
+	outbox repo.OutboxRepo
+	failOn int64
+
+	published []int64
+}
+
+func (p *outboxPublisher) Publish(ctx context.Context, event model.Event) error {
+	unpublished, err := p.outbox.GetUnpublished(ctx, 100)
+	if err != nil {
+		return err
+	}
+
+	marked := true
+
+	for _, e := range unpublished {
+		if e.Sequence == event.Sequence {
+			marked = false
+		}
+	}
+
+	if marked {
+		p.t.Errorf("event %d marked published before ack", event.Sequence)
+	}
+
+	if event.Sequence == p.failOn {
+		return errBroker
+	}
+
+	p.published = append(p.published, event.Sequence)
+
+	return nil
+}
+
+func (p *outboxPublisher) Close() error {
+	return nil
+}
+
+// deadlockTransactor повторяет транзакцию, как db.InTx после взаимной блокировки: первые deadlocks транзакций
+// откатываются после выполнения fn
+type deadlockTransactor struct {
+	transactor repo.Transactor
+	deadlocks  int
+}
+
+func (d *deadlockTransactor) InTx(ctx context.Context, fn func(repos repo.Repos) error) error {
+	for {
+		err := d.transactor.InTx(ctx, func(repos repo.Repos) error {
+			if err := fn(repos); err != nil {
+				return err
+			}
+
+			if d.deadlocks > 0 {
+				d.deadlocks--
+				return errDeadlock
+			}
+
+			return nil
+		})
+
+		if !errors.Is(err, errDeadlock) {
+			return err
+		}
+	}
+}
+
+func sequences(events []model.Event) []int64 {
+	result := make([]int64, 0, len(events))
+
+	for _, event := range events {
+		result = append(result, event.Sequence)
+	}
+
+	return result
+}
+
+// newOutbox создает хранилище с 5 событиями пополнения двух пользователей
+func newOutbox(t *testing.T) (*memory.Storage, repo.Repos) {
+	ctx := context.Background()
+	now := time.Date(2022, time.November, 1, 10, 0, 0, 0, time.UTC)
+
+	storage := memory.NewStorage()
+	repos := memory.NewRepos(storage, clock.NewManual(now, 0))
+
+	for i, userId := range []string{"user1", "user2", "user1", "user2", "user1"} {
+		if _, err := repos.Balance.AddBalance(ctx, model.Operation{Id: string(rune('a' + i)), Time: now}, userId, 100, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return storage, repos
+}
+
+func unpublished(t *testing.T, repos repo.Repos) []int64 {
+	events, err := repos.Outbox.GetUnpublished(context.Background(), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sequences(events)
+}
+
+// TestOutboxRelayFailure - публикация останавливается на первом событии, которое брокер не принял: следующие события
+// не публикуются, опубликованными отмечаются только подтвержденные, а непринятое публикуется следующей пачкой
+func TestOutboxRelayFailure(t *testing.T) {
+	ctx := context.Background()
+
+	storage, repos := newOutbox(t)
+	publisher := &outboxPublisher{t: t, outbox: repos.Outbox, failOn: 3}
+
+	relay := service.NewOutboxRelay(publisher, repos, memory.NewTransactor(storage, repos), time.Second, 10, time.Hour)
+
+	if _, err := relay.RelayBatch(ctx); !errors.Is(err, errBroker) {
+		t.Fatalf("RelayBatch error = %v, want %v", err, errBroker)
+	}
+
+	if !reflect.DeepEqual(publisher.published, []int64{1, 2}) || !reflect.DeepEqual(unpublished(t, repos), []int64{3, 4, 5}) {
+		t.Fatalf("published %v, unpublished %v, want published 1-2", publisher.published, unpublished(t, repos))
+	}
+
+	publisher.failOn = 0
+
+	if published, err := relay.RelayBatch(ctx); err != nil || published != 3 {
+		t.Fatalf("RelayBatch = %d, %v, want 3", published, err)
+	}
+
+	if !reflect.DeepEqual(publisher.published, []int64{1, 2, 3, 4, 5}) || len(unpublished(t, repos)) != 0 {
+		t.Fatalf("published %v, unpublished %v, want all published in order", publisher.published, unpublished(t, repos))
+	}
+}
+
+// TestOutboxRelayDeadlock - после взаимной блокировки отметка о публикации откатывается, и повтор транзакции публикует
+// события заново (at-least-once)
+func TestOutboxRelayDeadlock(t *testing.T) {
+	ctx := context.Background()
+
+	storage, repos := newOutbox(t)
+	publisher := &outboxPublisher{t: t, outbox: repos.Outbox}
+	transactor := &deadlockTransactor{transactor: memory.NewTransactor(storage, repos), deadlocks: 1}
+
+	relay := service.NewOutboxRelay(publisher, repos, transactor, time.Second, 10, time.Hour)
+
+	if published, err := relay.RelayBatch(ctx); err != nil || published != 5 {
+		t.Fatalf("RelayBatch = %d, %v, want 5", published, err)
+	}
+
+	if want := []int64{1, 2, 3, 4, 5, 1, 2, 3, 4, 5}; !reflect.DeepEqual(publisher.published, want) {
+		t.Fatalf("published %v, want %v", publisher.published, want)
+	}
+
+	if len(unpublished(t, repos)) != 0 {
+		t.Fatalf("unpublished %v, want none", unpublished(t, repos))
+	}
+}
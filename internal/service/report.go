@@ -4,59 +4,94 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"time"
 
+	"github.com/avito-test/internal/config/idgen"
 	"github.com/avito-test/internal/config/logger"
+	"github.com/avito-test/internal/config/tracing"
 	"github.com/avito-test/internal/storage/repo"
 	"github.com/sirupsen/logrus"
 )
 
 type ReportService struct {
 	repo repo.ReportRepo
-	log  *logrus.Logger
+	dir  string
+	ids  idgen.Generator
 }
 
-func NewReportService(repo repo.ReportRepo) *ReportService {
+// NewReportService создает сервис отчетов, файлы отчетов пишутся в dir и называются по id из ids.
+// Ссылка на отчет ведет на файл, поэтому id не должны быть предсказуемыми (в main - idgen.UUID)
+func NewReportService(repo repo.ReportRepo, dir string, ids idgen.Generator) *ReportService {
 	return &ReportService{
 		repo: repo,
-		log:  logger.GetLogger(),
+		dir:  dir,
+		ids:  ids,
 	}
 }
 
-func (r *ReportService) CreateReport(ctx context.Context, dateFrom time.Time) error {
-	rows, err := r.repo.GetReportRows(dateFrom)
+// MonthReportDate - дата начала отчета за месяц month года year, одна для API и balancectl
+func MonthReportDate(year int, month time.Month) time.Time {
+	return time.Date(year, month, 0, 0, 0, 0, 0, time.UTC)
+}
+
+// FilePath - файл отчета с id
+func (r *ReportService) FilePath(id string) string {
+	return filepath.Join(r.dir, id+".csv")
+}
 
-	err = os.MkdirAll(fmt.Sprintf("static%sfile", string(os.PathSeparator)), 0755)
+// CreateReport формирует отчет с dateFrom в новом файле и возвращает id отчета. Id генерирует сервис,
+// а не клиент (как X-Request-ID), поэтому повтор запроса не перезаписывает чужой отчет
+func (r *ReportService) CreateReport(ctx context.Context, dateFrom time.Time) (string, error) {
+	ctx, span := tracing.Start(ctx, "ReportService.CreateReport")
+	defer span.End()
+
+	rows, err := r.repo.GetReportRows(ctx, dateFrom)
 
 	if err != nil {
-		r.log.Fatal(err.Error())
+		tracing.Error(span, err)
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"error_message": err.Error(),
+		}).Error("failed to get report rows")
+
+		return "", err
 	}
 
+	err = os.MkdirAll(r.dir, 0755)
+
 	if err != nil {
-		r.log.WithFields(logrus.Fields{
+		tracing.Error(span, err)
+		logger.FromContext(ctx).WithFields(logrus.Fields{
 			"error_message": err.Error(),
-		}).Error(fmt.Sprintf("%s_ERROR", ctx.Value("requestId")))
+		}).Error("failed to create report directory")
 
-		return err
+		return "", err
 	}
 
-	file, err := os.Create(fmt.Sprintf("static%sfile%s%s.csv", string(os.PathSeparator), string(os.PathSeparator), ctx.Value("requestId")))
+	id := r.ids.NewId()
+
+	// O_EXCL - существующий файл не перезаписывается, даже если id совпал
+	file, err := os.OpenFile(r.FilePath(id), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
 
 	if err != nil {
-		r.log.WithFields(logrus.Fields{
+		tracing.Error(span, err)
+		logger.FromContext(ctx).WithFields(logrus.Fields{
 			"error_message": err.Error(),
-		}).Error(fmt.Sprintf("%s_ERROR", ctx.Value("requestId")))
+		}).Error("failed to create report file")
 
-		return err
+		return "", err
 	}
 
+	defer file.Close()
+
 	for _, row := range rows {
 		_, err := file.WriteString(fmt.Sprintf("%s;%.6f\n", row.ServiceName, row.TotalSum))
 
 		if err != nil {
-			return err
+			tracing.Error(span, err)
+			return "", err
 		}
 	}
 
-	return nil
+	return id, nil
 }
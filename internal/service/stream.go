@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/avito-test/internal/config/clock"
+	"github.com/avito-test/internal/model"
+	"github.com/avito-test/internal/storage/repo"
+)
+
+// ListenFunc подписывается на уведомления о новых событиях пользователя (payload - userId), после каждого
+// подключения вызывает connected. Возвращается после отмены ctx
+type ListenFunc func(ctx context.Context, notify func(userId string), connected func())
+
+// BalanceStream раздает события об изменении баланса открытым потокам пользователей. События читаются из outbox,
+// уведомление о новом событии приходит через LISTEN/NOTIFY, поэтому поток получает события, записанные любым инстансом
+type BalanceStream struct {
+	listen         ListenFunc
+	balanceService *BalanceService
+	repos          repo.Repos
+	clock          clock.Clock
+
+	heartbeat time.Duration
+	batchSize int
+
+	mu          sync.Mutex
+	subscribers map[string]map[chan struct{}]struct{}
+	closed      chan struct{}
+}
+
+func NewBalanceStream(listen ListenFunc, balanceService *BalanceService, repos repo.Repos, clk clock.Clock, heartbeat time.Duration, batchSize int) *BalanceStream {
+	return &BalanceStream{
+		listen:         listen,
+		balanceService: balanceService,
+		repos:          repos,
+		clock:          clk,
+
+		heartbeat: heartbeat,
+		batchSize: batchSize,
+
+		subscribers: make(map[string]map[chan struct{}]struct{}),
+		closed:      make(chan struct{}),
+	}
+}
+
+// Run слушает уведомления о новых событиях, пока не отменен ctx. После отмены все открытые потоки завершаются
+func (b *BalanceStream) Run(ctx context.Context) {
+	defer close(b.closed)
+
+	// после переподключения уведомления могли быть потеряны, все потоки дочитывают события
+	b.listen(ctx, b.wake, b.wakeAll)
+}
+
+// Stream отправляет в send события пользователя после lastSequence, пока не отменен ctx или send не вернет ошибку.
+// Без lastSequence первым отправляется снимок баланса (EventBalance) с sequence последнего события пользователя.
+// Если событий нет дольше heartbeat, вызывается heartbeat
+func (b *BalanceStream) Stream(ctx context.Context, userId string, lastSequence *int64, send func(model.Event) error, heartbeat func() error) error {
+	wake := make(chan struct{}, 1)
+
+	// подписка до чтения последнего события, чтобы не пропустить события между чтением и подпиской
+	b.subscribe(userId, wake)
+	defer b.unsubscribe(userId, wake)
+
+	var after int64
+
+	if lastSequence != nil {
+		after = *lastSequence
+	} else {
+		snapshot, err := b.snapshot(ctx, userId)
+		if err != nil {
+			return err
+		}
+
+		if err := send(snapshot); err != nil {
+			return err
+		}
+
+		after = snapshot.Sequence
+	}
+
+	// события после after могли быть записаны до подписки, дочитываем их сразу
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+
+	ticker := time.NewTicker(b.heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-b.closed:
+			return nil
+		case <-ticker.C:
+			if err := heartbeat(); err != nil {
+				return err
+			}
+		case <-wake:
+			for {
+				events, err := b.repos.Outbox.GetUserEvents(ctx, userId, after, b.batchSize)
+				if err != nil {
+					return err
+				}
+
+				for _, event := range events {
+					if err := send(event); err != nil {
+						return err
+					}
+
+					after = event.Sequence
+				}
+
+				if len(events) < b.batchSize {
+					break
+				}
+			}
+
+			ticker.Reset(b.heartbeat)
+		}
+	}
+}
+
+// snapshot возвращает текущий баланс пользователя, для пользователя без баланса - 0.
+// Последнее событие читается до баланса: баланс в следующих событиях не старее снимка
+func (b *BalanceStream) snapshot(ctx context.Context, userId string) (model.Event, error) {
+	sequence, err := b.repos.Outbox.GetLastUserSequence(ctx, userId)
+	if err != nil {
+		return model.Event{}, err
+	}
+
+	balance, err := b.balanceService.GetBalanceByUserID(ctx, userId)
+	if err != nil && !errors.Is(err, b.balanceService.BalanceNotFoundErr) {
+		return model.Event{}, err
+	}
+
+	payload, err := json.Marshal(map[string]float64{"balance": balance})
+	if err != nil {
+		return model.Event{}, err
+	}
+
+	return model.Event{
+		Sequence:   sequence,
+		Type:       model.EventBalance,
+		UserId:     userId,
+		Payload:    payload,
+		CreateTime: b.clock.Now().UTC(),
+	}, nil
+}
+
+func (b *BalanceStream) subscribe(userId string, wake chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.subscribers[userId] == nil {
+		b.subscribers[userId] = make(map[chan struct{}]struct{})
+	}
+
+	b.subscribers[userId][wake] = struct{}{}
+}
+
+func (b *BalanceStream) unsubscribe(userId string, wake chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.subscribers[userId], wake)
+
+	if len(b.subscribers[userId]) == 0 {
+		delete(b.subscribers, userId)
+	}
+}
+
+// wake будит потоки пользователя. Канал с буфером 1: если поток еще не дочитал события, повторно будить не нужно
+func (b *BalanceStream) wake(userId string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for wake := range b.subscribers[userId] {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (b *BalanceStream) wakeAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, subscribers := range b.subscribers {
+		for wake := range subscribers {
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
@@ -2,50 +2,366 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
+	"github.com/avito-test/internal/config/clock"
+	"github.com/avito-test/internal/config/idgen"
 	"github.com/avito-test/internal/config/logger"
+	"github.com/avito-test/internal/config/tracing"
 	"github.com/avito-test/internal/model"
 	"github.com/avito-test/internal/storage/repo"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type TransactionService struct {
-	repo repo.TransactionRepo
-	log  *logrus.Logger
+	ReservationExistsErr   error
+	InsufficientFundsErr   error
+	TransactionNotFoundErr error
+	AlreadyCapturedErr     error
+	AlreadyCancelledErr    error
+	BalanceNotFoundErr     error
+	UnknownTransactionErr  error
+	AccountFrozenErr       error
+	AccountClosedErr       error
+	LimitExceededErr       error
+
+	repo  repo.TransactionRepo
+	clock clock.Clock
+	ids   idgen.Generator
 }
 
-func NewTransactionService(repo repo.TransactionRepo) *TransactionService {
+// NewTransactionService создает сервис транзакций, id и время операций берутся из ids и clk
+func NewTransactionService(repo repo.TransactionRepo, clk clock.Clock, ids idgen.Generator) *TransactionService {
 	return &TransactionService{
-		repo: repo,
-		log:  logger.GetLogger(),
+		ReservationExistsErr:   errors.New("reservation already exists"),
+		InsufficientFundsErr:   errors.New("insufficient funds"),
+		TransactionNotFoundErr: errors.New("reservation not found"),
+		AlreadyCapturedErr:     errors.New("reservation already captured"),
+		AlreadyCancelledErr:    errors.New("reservation already cancelled"),
+		BalanceNotFoundErr:     errors.New("balance not found"),
+		UnknownTransactionErr:  errors.New("transaction not found"),
+		AccountFrozenErr:       errors.New("account is frozen"),
+		AccountClosedErr:       errors.New("account is closed"),
+		LimitExceededErr:       errors.New("limit exceeded"),
+
+		repo:  repo,
+		clock: clk,
+		ids:   ids,
+	}
+}
+
+// operation - id и время очередной операции с резервацией, в том числе для пакетов и заказов
+func (t *TransactionService) operation() model.Operation {
+	return newOperation(t.clock, t.ids)
+}
+
+// Reserve резервирует деньги под услугу заказа, неуспешный статус save_transaction возвращается ошибкой
+func (t *TransactionService) Reserve(ctx context.Context, transaction model.Transaction) error {
+	transaction.TransactionTypeId = model.TransactionTypeReserve
+
+	return t.saveTransactionErr(ctx, transaction)
+}
+
+// Capture признает выручку по резервации
+func (t *TransactionService) Capture(ctx context.Context, transaction model.Transaction) error {
+	transaction.TransactionTypeId = model.TransactionTypeCapture
+
+	return t.saveTransactionErr(ctx, transaction)
+}
+
+// Cancel отменяет резервацию и возвращает деньги на баланс
+func (t *TransactionService) Cancel(ctx context.Context, transaction model.Transaction) error {
+	transaction.TransactionTypeId = model.TransactionTypeCancel
+
+	return t.saveTransactionErr(ctx, transaction)
+}
+
+// StatusErr возвращает ошибку сервиса, соответствующую статусу save_transaction, для успешного статуса - nil
+func (t *TransactionService) StatusErr(status model.TransactionStatus) error {
+	switch status {
+	case model.TransactionStatusOk:
+		return nil
+	case model.TransactionStatusReservationExists:
+		return t.ReservationExistsErr
+	case model.TransactionStatusInsufficientFunds:
+		return t.InsufficientFundsErr
+	case model.TransactionStatusCaptureNotFound, model.TransactionStatusCancelNotFound:
+		return t.TransactionNotFoundErr
+	case model.TransactionStatusCaptureAlreadyCaptured, model.TransactionStatusCancelAlreadyCaptured:
+		return t.AlreadyCapturedErr
+	case model.TransactionStatusCaptureAlreadyCancelled, model.TransactionStatusCancelAlreadyCancelled:
+		return t.AlreadyCancelledErr
+	case model.TransactionStatusBalanceNotFound:
+		return t.BalanceNotFoundErr
+	case model.TransactionStatusAccountFrozen:
+		return t.AccountFrozenErr
+	case model.TransactionStatusAccountClosed:
+		return t.AccountClosedErr
+	case model.TransactionStatusTransactionLimitExceeded, model.TransactionStatusDailyLimitExceeded, model.TransactionStatusMonthlyLimitExceeded:
+		// лимиты в save_transaction проверяются только у резерваций
+		return limitErr(t.LimitExceededErr, model.LimitReserve, status)
+	default:
+		return fmt.Errorf("unexpected transaction status %d", status)
+	}
+}
+
+func (t *TransactionService) saveTransactionErr(ctx context.Context, transaction model.Transaction) error {
+	status, err := t.SaveTransaction(ctx, transaction)
+	if err != nil {
+		return err
 	}
+
+	return t.StatusErr(status)
 }
 
-func (t *TransactionService) SaveTransaction(ctx context.Context, transaction model.Transaction) (int, error) {
-	status, err := t.repo.SaveTransaction(*transaction.OrderId, transaction.UserId, *transaction.ServiceId, transaction.Sum, transaction.TransactionTypeId, transaction.Comment)
+func (t *TransactionService) SaveTransaction(ctx context.Context, transaction model.Transaction) (model.TransactionStatus, error) {
+	ctx, span := tracing.Start(ctx, "TransactionService.SaveTransaction")
+	defer span.End()
+
+	ctx = auditContext(ctx, "save_transaction")
+
+	status, err := t.repo.SaveTransaction(ctx, t.operation(), *transaction.OrderId, transaction.UserId, *transaction.ServiceId, transaction.Sum, transaction.TransactionTypeId, transaction.Comment)
 
 	if err != nil {
-		t.log.WithFields(logrus.Fields{
+		tracing.Error(span, err)
+		logger.FromContext(ctx).WithFields(logrus.Fields{
 			"error_message": err.Error(),
-		}).Error(fmt.Sprintf("%s_ERROR", ctx.Value("requestId")))
+		}).Error("failed to save transaction")
 
 		return 0, err
 	}
 
+	span.SetAttributes(attribute.Int("transaction.status", int(status)))
+
+	audit(ctx, "save_transaction", logrus.Fields{
+		"user_id":             transaction.UserId,
+		"order_id":            *transaction.OrderId,
+		"service_id":          *transaction.ServiceId,
+		"sum":                 transaction.Sum,
+		"transaction_type_id": transaction.TransactionTypeId,
+		"status":              status,
+	})
+
+	// ограничения счета и лимиты возвращаются ошибкой, а не статусом: статусы 1-10 - результат самой операции
+	if status > model.TransactionStatusBalanceNotFound {
+		return 0, t.StatusErr(status)
+	}
+
 	return status, nil
 }
 
-func (t *TransactionService) GetTransactions(ctx context.Context, request model.GetTransactionsRequest) ([]model.Transaction, error) {
-	transactions, err := t.repo.GetTransactionListByUserId(request.UserId, request.Offset, request.Limit, request.SortBy, request.SortType)
+// GetTransactions возвращает страницу транзакций, общее количество по фильтру и курсор следующей страницы
+func (t *TransactionService) GetTransactions(ctx context.Context, request model.GetTransactionsRequest) (model.TransactionPage, error) {
+	ctx, span := tracing.Start(ctx, "TransactionService.GetTransactions")
+	defer span.End()
+
+	limit := request.Limit
+	request.Limit++
+
+	transactions, err := t.repo.GetTransactionListByUserId(ctx, request)
+
+	if err != nil {
+		tracing.Error(span, err)
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"error_message": err.Error(),
+		}).Error("failed to get transactions")
+
+		return model.TransactionPage{}, err
+	}
+
+	total, err := t.repo.CountTransactionsByUserId(ctx, request.UserId, request.Filter)
+
+	if err != nil {
+		tracing.Error(span, err)
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"error_message": err.Error(),
+		}).Error("failed to count transactions")
+
+		return model.TransactionPage{}, err
+	}
+
+	page := model.TransactionPage{Transactions: transactions, Total: total}
+
+	// лишняя запись означает, что есть следующая страница
+	if len(transactions) > limit {
+		page.Transactions = transactions[:limit]
+		page.HasMore = true
+
+		last := page.Transactions[limit-1]
+		page.NextCursor = &model.TransactionCursor{
+			SortBy:   request.SortBy,
+			SortType: request.SortType,
+			UpdTime:  last.UpdTime,
+			Sum:      last.Sum,
+			Id:       last.Id,
+		}
+	}
+
+	return page, nil
+}
+
+// GetReservation возвращает резервацию (транзакцию по заказу) по id
+func (t *TransactionService) GetReservation(ctx context.Context, id string) (model.Transaction, error) {
+	ctx, span := tracing.Start(ctx, "TransactionService.GetReservation")
+	defer span.End()
+
+	tr, err := t.repo.GetTransactionById(ctx, id)
+
+	if err != nil {
+		tracing.Error(span, err)
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"error_message": err.Error(),
+		}).Error("failed to get reservation")
+
+		return model.Transaction{}, err
+	}
+
+	if tr == nil || tr.OrderId == nil {
+		return model.Transaction{}, t.TransactionNotFoundErr
+	}
+
+	return *tr, nil
+}
+
+// GetTransactionHistory возвращает транзакцию с id и все ее состояния
+func (t *TransactionService) GetTransactionHistory(ctx context.Context, id string) (model.TransactionHistory, error) {
+	ctx, span := tracing.Start(ctx, "TransactionService.GetTransactionHistory")
+	defer span.End()
+
+	tr, err := t.repo.GetTransactionById(ctx, id)
 
 	if err != nil {
-		t.log.WithFields(logrus.Fields{
+		tracing.Error(span, err)
+		logger.FromContext(ctx).WithFields(logrus.Fields{
 			"error_message": err.Error(),
-		}).Error(fmt.Sprintf("%s_ERROR", ctx.Value("requestId")))
+		}).Error("failed to get transaction")
+
+		return model.TransactionHistory{}, err
+	}
+
+	if tr == nil {
+		return model.TransactionHistory{}, t.UnknownTransactionErr
+	}
+
+	histories, err := t.transactionHistories(ctx, []model.Transaction{*tr})
+	if err != nil {
+		tracing.Error(span, err)
+		return model.TransactionHistory{}, err
+	}
+
+	return histories[0], nil
+}
+
+// GetOrderTransactionHistory возвращает все транзакции заказа с их состояниями
+func (t *TransactionService) GetOrderTransactionHistory(ctx context.Context, orderId string) ([]model.TransactionHistory, error) {
+	ctx, span := tracing.Start(ctx, "TransactionService.GetOrderTransactionHistory")
+	defer span.End()
+
+	transactions, err := t.repo.GetTransactionsByOrderId(ctx, orderId)
+
+	if err != nil {
+		tracing.Error(span, err)
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"error_message": err.Error(),
+		}).Error("failed to get order transactions")
+
+		return nil, err
+	}
+
+	histories, err := t.transactionHistories(ctx, transactions)
+	if err != nil {
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	return histories, nil
+}
+
+// transactionHistories дополняет транзакции прошлыми состояниями из transaction_upd и текущим состоянием
+func (t *TransactionService) transactionHistories(ctx context.Context, transactions []model.Transaction) ([]model.TransactionHistory, error) {
+	histories := make([]model.TransactionHistory, 0, len(transactions))
+
+	if len(transactions) == 0 {
+		return histories, nil
+	}
+
+	ids := make([]string, 0, len(transactions))
+	for _, tr := range transactions {
+		ids = append(ids, tr.Id)
+	}
+
+	states, err := t.repo.GetTransactionStates(ctx, ids)
+
+	if err != nil {
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"error_message": err.Error(),
+		}).Error("failed to get transaction states")
 
 		return nil, err
 	}
 
-	return transactions, nil
+	for _, tr := range transactions {
+		histories = append(histories, model.TransactionHistory{
+			Transaction: tr,
+			States: append(states[tr.Id], model.TransactionState{
+				TransactionTypeId: tr.TransactionTypeId,
+				TransactionType:   tr.TransactionType,
+				Sum:               tr.Sum,
+				Comment:           tr.Comment,
+				UpdTime:           tr.UpdTime,
+			}),
+		})
+	}
+
+	return histories, nil
+}
+
+// CreateReservation резервирует деньги и возвращает созданную резервацию
+func (t *TransactionService) CreateReservation(ctx context.Context, transaction model.Transaction) (model.Transaction, error) {
+	if err := t.Reserve(ctx, transaction); err != nil {
+		return model.Transaction{}, err
+	}
+
+	tr, err := t.repo.GetTransactionByKey(ctx, *transaction.OrderId, transaction.UserId, *transaction.ServiceId)
+
+	if err != nil {
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"error_message": err.Error(),
+		}).Error("failed to get reservation")
+
+		return model.Transaction{}, err
+	}
+
+	if tr == nil {
+		return model.Transaction{}, t.TransactionNotFoundErr
+	}
+
+	return *tr, nil
+}
+
+// CaptureReservation признает выручку по резервации с id
+func (t *TransactionService) CaptureReservation(ctx context.Context, id string, comment *string) (model.Transaction, error) {
+	return t.changeReservation(ctx, id, comment, t.Capture)
+}
+
+// CancelReservation отменяет резервацию с id
+func (t *TransactionService) CancelReservation(ctx context.Context, id string, comment *string) (model.Transaction, error) {
+	return t.changeReservation(ctx, id, comment, t.Cancel)
+}
+
+func (t *TransactionService) changeReservation(ctx context.Context, id string, comment *string, change func(context.Context, model.Transaction) error) (model.Transaction, error) {
+	tr, err := t.GetReservation(ctx, id)
+	if err != nil {
+		return model.Transaction{}, err
+	}
+
+	tr.Comment = comment
+
+	if err := change(ctx, tr); err != nil {
+		return model.Transaction{}, err
+	}
+
+	return t.GetReservation(ctx, id)
 }
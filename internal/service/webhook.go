@@ -0,0 +1,367 @@
+package service
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/avito-test/internal/config/clock"
+	"github.com/avito-test/internal/config/idgen"
+	"github.com/avito-test/internal/config/logger"
+	"github.com/avito-test/internal/config/tracing"
+	"github.com/avito-test/internal/model"
+	"github.com/avito-test/internal/storage/repo"
+	"github.com/avito-test/internal/webhook"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// webhookDeliveriesLimit - сколько последних доставок возвращает журнал
+const webhookDeliveriesLimit = 100
+
+type WebhookService struct {
+	WebhookNotFoundErr  error
+	DeliveryNotFoundErr error
+
+	repo   repo.WebhookRepo
+	clock  clock.Clock
+	ids    idgen.Generator
+	random io.Reader
+}
+
+// NewWebhookService создает сервис подписок, id и время создания подписок берутся из ids и clk,
+// секреты подписи - из random (в main - crypto/rand.Reader)
+func NewWebhookService(repo repo.WebhookRepo, clk clock.Clock, ids idgen.Generator, random io.Reader) *WebhookService {
+	return &WebhookService{
+		WebhookNotFoundErr:  errors.New("webhook not found"),
+		DeliveryNotFoundErr: errors.New("webhook delivery not found"),
+
+		repo:   repo,
+		clock:  clk,
+		ids:    ids,
+		random: random,
+	}
+}
+
+// CreateSubscription создает подписку со случайным секретом подписи, секрет возвращается в подписке
+func (w *WebhookService) CreateSubscription(ctx context.Context, subscription model.WebhookSubscription) (model.WebhookSubscription, error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.CreateSubscription")
+	defer span.End()
+
+	ctx = auditContext(ctx, "create_webhook")
+
+	secret := make([]byte, 32)
+	if _, err := io.ReadFull(w.random, secret); err != nil {
+		tracing.Error(span, err)
+		return model.WebhookSubscription{}, err
+	}
+
+	subscription.Id = w.ids.NewId()
+	subscription.Secret = "whsec_" + hex.EncodeToString(secret)
+	subscription.CreateTime = w.clock.Now().UTC().Truncate(time.Microsecond)
+
+	subscription, err := w.repo.CreateSubscription(ctx, subscription)
+	if err != nil {
+		tracing.Error(span, err)
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"error_message": err.Error(),
+		}).Error("failed to create webhook subscription")
+
+		return model.WebhookSubscription{}, err
+	}
+
+	audit(ctx, "create_webhook", logrus.Fields{
+		"webhook_id":  subscription.Id,
+		"url":         subscription.Url,
+		"event_types": subscription.EventTypes,
+	})
+
+	return subscription, nil
+}
+
+func (w *WebhookService) GetSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.GetSubscriptions")
+	defer span.End()
+
+	subscriptions, err := w.repo.GetSubscriptions(ctx)
+	if err != nil {
+		tracing.Error(span, err)
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"error_message": err.Error(),
+		}).Error("failed to get webhook subscriptions")
+
+		return nil, err
+	}
+
+	return subscriptions, nil
+}
+
+func (w *WebhookService) GetSubscription(ctx context.Context, id string) (model.WebhookSubscription, error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.GetSubscription")
+	defer span.End()
+
+	subscription, err := w.repo.GetSubscription(ctx, id)
+	if err != nil {
+		tracing.Error(span, err)
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"error_message": err.Error(),
+		}).Error("failed to get webhook subscription")
+
+		return model.WebhookSubscription{}, err
+	}
+
+	if subscription == nil {
+		return model.WebhookSubscription{}, w.WebhookNotFoundErr
+	}
+
+	return *subscription, nil
+}
+
+// DeleteSubscription удаляет подписку, неотправленные доставки удаляются вместе с ней
+func (w *WebhookService) DeleteSubscription(ctx context.Context, id string) error {
+	ctx, span := tracing.Start(ctx, "WebhookService.DeleteSubscription")
+	defer span.End()
+
+	ctx = auditContext(ctx, "delete_webhook")
+
+	deleted, err := w.repo.DeleteSubscription(ctx, id)
+	if err != nil {
+		tracing.Error(span, err)
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"error_message": err.Error(),
+		}).Error("failed to delete webhook subscription")
+
+		return err
+	}
+
+	if !deleted {
+		return w.WebhookNotFoundErr
+	}
+
+	audit(ctx, "delete_webhook", logrus.Fields{
+		"webhook_id": id,
+	})
+
+	return nil
+}
+
+// GetDeliveries возвращает последние доставки подписки, новые первыми
+func (w *WebhookService) GetDeliveries(ctx context.Context, subscriptionId string, status *model.WebhookDeliveryStatus) ([]model.WebhookDelivery, error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.GetDeliveries")
+	defer span.End()
+
+	if _, err := w.GetSubscription(ctx, subscriptionId); err != nil {
+		return nil, err
+	}
+
+	deliveries, err := w.repo.GetDeliveries(ctx, subscriptionId, status, webhookDeliveriesLimit)
+	if err != nil {
+		tracing.Error(span, err)
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"error_message": err.Error(),
+		}).Error("failed to get webhook deliveries")
+
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// Redeliver ставит доставку в очередь на немедленную отправку, в том числе доставленную или dead
+func (w *WebhookService) Redeliver(ctx context.Context, subscriptionId string, id string) (model.WebhookDelivery, error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.Redeliver")
+	defer span.End()
+
+	ctx = auditContext(ctx, "redeliver_webhook")
+
+	delivery, err := w.repo.Redeliver(ctx, subscriptionId, id)
+	if err != nil {
+		tracing.Error(span, err)
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"error_message": err.Error(),
+		}).Error("failed to redeliver webhook")
+
+		return model.WebhookDelivery{}, err
+	}
+
+	if delivery == nil {
+		return model.WebhookDelivery{}, w.DeliveryNotFoundErr
+	}
+
+	audit(ctx, "redeliver_webhook", logrus.Fields{
+		"webhook_id":  subscriptionId,
+		"delivery_id": id,
+	})
+
+	return *delivery, nil
+}
+
+// WebhookDispatcher отправляет доставки webhook, время отправки которых пришло. Неудачная попытка
+// повторяется с экспоненциальной задержкой, после maxAttempts доставка переходит в dead.
+// Доставки отправляются параллельно и могут прийти подписчику не по порядку, порядок задает sequence события
+type WebhookDispatcher struct {
+	sender *webhook.Sender
+	repo   repo.WebhookRepo
+	clock  clock.Clock
+
+	pollInterval time.Duration
+	batchSize    int
+	maxAttempts  int
+	backoffBase  time.Duration
+	backoffMax   time.Duration
+	timeout      time.Duration
+}
+
+// NewWebhookDispatcher создает отправителя доставок через sender, timeout - таймаут запроса sender к подписчику
+func NewWebhookDispatcher(sender *webhook.Sender, repo repo.WebhookRepo, clk clock.Clock, pollInterval time.Duration, batchSize int, maxAttempts int, backoffBase time.Duration, backoffMax time.Duration, timeout time.Duration) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		sender: sender,
+		repo:   repo,
+		clock:  clk,
+
+		pollInterval: pollInterval,
+		batchSize:    batchSize,
+		maxAttempts:  maxAttempts,
+		backoffBase:  backoffBase,
+		backoffMax:   backoffMax,
+		timeout:      timeout,
+	}
+}
+
+// Run отправляет доставки раз в pollInterval, пока не отменен ctx
+func (w *WebhookDispatcher) Run(ctx context.Context) {
+	log := logger.FromContext(ctx)
+
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			dispatched, err := w.DispatchBatch(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.WithFields(logrus.Fields{
+						"error_message": err.Error(),
+					}).Error("failed to dispatch webhooks")
+				}
+
+				break
+			}
+
+			// полная пачка - возможно, есть еще доставки, отправляем без ожидания
+			if dispatched < w.batchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchBatch отправляет до batchSize доставок и возвращает количество отправленных
+func (w *WebhookDispatcher) DispatchBatch(ctx context.Context) (int, error) {
+	ctx, span := tracing.Start(ctx, "WebhookDispatcher.DispatchBatch")
+	defer span.End()
+
+	// доставки откладываются на время отправки, чтобы их не взял другой инстанс
+	deliveries, err := w.repo.ClaimDue(ctx, w.batchSize, 2*w.timeout)
+	if err != nil {
+		tracing.Error(span, err)
+		return 0, err
+	}
+
+	span.SetAttributes(attribute.Int("webhook.deliveries", len(deliveries)))
+
+	var wg sync.WaitGroup
+
+	for _, delivery := range deliveries {
+		wg.Add(1)
+
+		go func(delivery model.WebhookDelivery) {
+			defer wg.Done()
+			w.deliver(ctx, delivery)
+		}(delivery)
+	}
+
+	wg.Wait()
+
+	return len(deliveries), nil
+}
+
+func (w *WebhookDispatcher) deliver(ctx context.Context, delivery model.WebhookDelivery) {
+	log := logger.FromContext(ctx).WithFields(logrus.Fields{
+		"delivery_id": delivery.Id,
+		"webhook_id":  delivery.SubscriptionId,
+		"event_id":    delivery.Event.Id,
+	})
+
+	statusCode, err := w.sender.Send(ctx, delivery.Url, delivery.Secret, delivery.Event)
+
+	now := w.clock.Now().UTC()
+	delivery.Attempts++
+	delivery.LastAttemptTime = &now
+	delivery.LastStatusCode = nil
+	delivery.LastError = nil
+
+	if statusCode != 0 {
+		delivery.LastStatusCode = &statusCode
+	}
+
+	switch {
+	case err == nil && statusCode >= 200 && statusCode < 300:
+		delivery.Status = model.WebhookDelivered
+	case err == nil:
+		err = fmt.Errorf("unexpected status code %d", statusCode)
+		fallthrough
+	default:
+		lastError := err.Error()
+		delivery.LastError = &lastError
+
+		if delivery.Attempts >= w.maxAttempts {
+			delivery.Status = model.WebhookDead
+		} else {
+			delivery.Status = model.WebhookPending
+			delivery.NextAttemptTime = now.Add(w.backoff(delivery.Attempts))
+		}
+	}
+
+	if err := w.repo.SaveAttempt(ctx, delivery); err != nil {
+		if ctx.Err() == nil {
+			log.WithFields(logrus.Fields{
+				"error_message": err.Error(),
+			}).Error("failed to save webhook attempt")
+		}
+
+		return
+	}
+
+	if delivery.Status == model.WebhookDead {
+		log.WithFields(logrus.Fields{
+			"attempts":      delivery.Attempts,
+			"error_message": *delivery.LastError,
+		}).Warn("webhook delivery is dead")
+	}
+}
+
+// backoff возвращает задержку после attempts неудачных попыток: base, 2*base, 4*base... но не больше backoffMax
+func (w *WebhookDispatcher) backoff(attempts int) time.Duration {
+	delay := w.backoffBase
+
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+
+		if delay >= w.backoffMax {
+			return w.backoffMax
+		}
+	}
+
+	return delay
+}
@@ -0,0 +1,179 @@
+package service_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/avito-test/internal/config/clock"
+	"github.com/avito-test/internal/model"
+	"github.com/avito-test/internal/service"
+	"github.com/avito-test/internal/storage/memory"
+	"github.com/avito-test/internal/storage/repo"
+	"github.com/avito-test/internal/webhook"
+)
+
+const (
+	backoffBase = 30 * time.Second
+	backoffMax  = 45 * time.Second
+	maxAttempts = 3
+)
+
+// subscriber - подписчик webhook на httptest.Server, отвечает status и проверяет подпись со временем clk
+type subscriber struct {
+	server   *httptest.Server
+	status   int32
+	requests int32
+}
+
+func newSubscriber(t *testing.T, clk clock.Clock) *subscriber {
+	s := &subscriber{status: http.StatusNoContent}
+
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.requests, 1)
+
+		body, _ := io.ReadAll(r.Body)
+
+		if r.Header.Get(webhook.HeaderSignature) != webhook.Signature("secret", clk.Now().Unix(), body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.WriteHeader(int(atomic.LoadInt32(&s.status)))
+	}))
+	t.Cleanup(s.server.Close)
+
+	return s
+}
+
+// newDispatcher создает подписку на пополнения с адресом url и одну доставку пополнения
+func newDispatcher(t *testing.T, clk *clock.Manual, url string, allowed func(ip net.IP) bool) (*service.WebhookDispatcher, repo.Repos) {
+	ctx := context.Background()
+	now := clk.Now()
+
+	repos := memory.NewRepos(memory.NewStorage(), clk)
+
+	_, err := repos.Webhook.CreateSubscription(ctx, model.WebhookSubscription{
+		Id:         "a0000000-0000-4000-8000-000000000001",
+		Url:        url,
+		EventTypes: []string{"deposit"},
+		Secret:     "secret",
+		CreateTime: now,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := repos.Balance.AddBalance(ctx, model.Operation{Id: "b0000000-0000-4000-8000-000000000001", Time: now}, "user", 100, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	sender := webhook.NewSender(time.Second, clk, allowed)
+
+	return service.NewWebhookDispatcher(sender, repos.Webhook, clk, time.Second, 10, maxAttempts, backoffBase, backoffMax, time.Second), repos
+}
+
+func allowAll(net.IP) bool {
+	return true
+}
+
+func delivery(t *testing.T, repos repo.Repos) model.WebhookDelivery {
+	deliveries, err := repos.Webhook.GetDeliveries(context.Background(), "a0000000-0000-4000-8000-000000000001", nil, 10)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("GetDeliveries = %+v, %v, want 1 delivery", deliveries, err)
+	}
+
+	return deliveries[0]
+}
+
+func dispatch(t *testing.T, dispatcher *service.WebhookDispatcher, want int) {
+	if dispatched, err := dispatcher.DispatchBatch(context.Background()); err != nil || dispatched != want {
+		t.Fatalf("DispatchBatch = %d, %v, want %d", dispatched, err, want)
+	}
+}
+
+func TestWebhookDispatcherDelivered(t *testing.T) {
+	now := time.Date(2022, time.November, 1, 10, 0, 0, 0, time.UTC)
+	clk := clock.NewManual(now, 0)
+
+	s := newSubscriber(t, clk)
+	dispatcher, repos := newDispatcher(t, clk, s.server.URL, allowAll)
+
+	dispatch(t, dispatcher, 1)
+
+	d := delivery(t, repos)
+	if d.Status != model.WebhookDelivered || d.Attempts != 1 || d.LastStatusCode == nil || *d.LastStatusCode != http.StatusNoContent || d.LastError != nil {
+		t.Fatalf("delivery = %+v, want delivered with 1 attempt", d)
+	}
+
+	// доставленное событие больше не отправляется
+	dispatch(t, dispatcher, 0)
+}
+
+// TestWebhookDispatcherBackoff - неудачная попытка повторяется через backoffBase, затем через удвоенную задержку, но не
+// больше backoffMax, после maxAttempts попыток доставка переходит в dead
+func TestWebhookDispatcherBackoff(t *testing.T) {
+	now := time.Date(2022, time.November, 1, 10, 0, 0, 0, time.UTC)
+	clk := clock.NewManual(now, 0)
+
+	s := newSubscriber(t, clk)
+	s.status = http.StatusInternalServerError
+
+	dispatcher, repos := newDispatcher(t, clk, s.server.URL, allowAll)
+
+	for attempt, delay := range []time.Duration{backoffBase, backoffMax} {
+		dispatch(t, dispatcher, 1)
+
+		d := delivery(t, repos)
+		if d.Status != model.WebhookPending || d.Attempts != attempt+1 || !d.NextAttemptTime.Equal(clk.Now().Add(delay)) ||
+			d.LastError == nil || *d.LastError != "unexpected status code 500" {
+			t.Fatalf("delivery after attempt %d = %+v, want pending after %s", attempt+1, d, delay)
+		}
+
+		// до времени следующей попытки доставка не отправляется
+		clk.Advance(delay - time.Second)
+		dispatch(t, dispatcher, 0)
+		clk.Advance(time.Second)
+	}
+
+	dispatch(t, dispatcher, 1)
+
+	if d := delivery(t, repos); d.Status != model.WebhookDead || d.Attempts != maxAttempts {
+		t.Fatalf("delivery = %+v, want dead after %d attempts", d, maxAttempts)
+	}
+
+	clk.Advance(time.Hour)
+	dispatch(t, dispatcher, 0)
+
+	if requests := atomic.LoadInt32(&s.requests); requests != maxAttempts {
+		t.Fatalf("subscriber got %d requests, want %d", requests, maxAttempts)
+	}
+}
+
+// TestWebhookDispatcherPrivateAddress - httptest слушает loopback, поэтому с PublicIP запрос не отправляется,
+// а попытка считается неудачной
+func TestWebhookDispatcherPrivateAddress(t *testing.T) {
+	now := time.Date(2022, time.November, 1, 10, 0, 0, 0, time.UTC)
+	clk := clock.NewManual(now, 0)
+
+	s := newSubscriber(t, clk)
+	dispatcher, repos := newDispatcher(t, clk, s.server.URL, webhook.PublicIP)
+
+	dispatch(t, dispatcher, 1)
+
+	d := delivery(t, repos)
+	if d.Status != model.WebhookPending || d.Attempts != 1 || d.LastStatusCode != nil || d.LastError == nil ||
+		!strings.Contains(*d.LastError, webhook.ErrForbiddenAddress.Error()) {
+		t.Fatalf("delivery = %+v, want failed attempt with forbidden address", d)
+	}
+
+	if atomic.LoadInt32(&s.requests) != 0 {
+		t.Fatal("request reached private address")
+	}
+}
@@ -0,0 +1,43 @@
+package db
+
+import "context"
+
+// Audit - кто, откуда и какой операцией меняет данные. Триггеры бд пишут его в public.audit_log вместе с каждой
+// измененной строкой
+type Audit struct {
+	Actor      string
+	AuthMethod string
+	RequestId  string
+	SourceIp   string
+	Operation  string
+}
+
+type auditKey struct{}
+
+func WithAudit(ctx context.Context, audit Audit) context.Context {
+	return context.WithValue(ctx, auditKey{}, audit)
+}
+
+// Audited выполняет изменение данных fn с контекстом аудита из ctx: в транзакции бд (внутри уже открытой - в точке
+// сохранения) задаются настройки audit.*, которые читают триггеры журнала. Без контекста аудита fn выполняется
+// как есть, триггеры тогда записывают пользователя и адрес соединения бд
+func Audited(ctx context.Context, client Client, fn func(client Client) error) error {
+	audit, ok := ctx.Value(auditKey{}).(Audit)
+	if !ok {
+		return fn(client)
+	}
+
+	return InTx(ctx, client, func(tx Client) error {
+		if _, err := tx.Exec(ctx, `
+SELECT set_config('audit.actor', $1, true),
+    set_config('audit.auth_method', $2, true),
+    set_config('audit.request_id', $3, true),
+    set_config('audit.source_ip', $4, true),
+    set_config('audit.operation', $5, true)`,
+			audit.Actor, audit.AuthMethod, audit.RequestId, audit.SourceIp, audit.Operation); err != nil {
+			return err
+		}
+
+		return fn(tx)
+	})
+}
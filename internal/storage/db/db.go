@@ -2,11 +2,13 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/avito-test/internal/config"
 	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
@@ -35,3 +37,48 @@ func NewDbPool(ctx context.Context) (*pgxpool.Pool, error) {
 
 	return pool, nil
 }
+
+// WithTimeout ограничивает время выполнения запроса statement таймаутом из конфига
+func WithTimeout(ctx context.Context, statement string) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, config.DbTimeout(statement))
+}
+
+// deadlockRetries - сколько раз транзакция повторяется после взаимной блокировки (40P01): бд откатывает одну из
+// транзакций, и повтор обычно проходит
+const deadlockRetries = 3
+
+// InTx выполняет fn в транзакции бд: если fn вернула ошибку, транзакция откатывается, иначе фиксируется.
+// Внутри открытой транзакции (client - pgx.Tx) fn выполняется в точке сохранения. Транзакция верхнего уровня
+// при взаимной блокировке повторяется целиком, поэтому fn должна быть готова к повторному вызову
+func InTx(ctx context.Context, client Client, fn func(tx Client) error) error {
+	_, nested := client.(pgx.Tx)
+
+	for attempt := 0; ; attempt++ {
+		err := inTx(ctx, client, fn)
+
+		var pgErr *pgconn.PgError
+		if nested || attempt == deadlockRetries || !errors.As(err, &pgErr) || pgErr.Code != pgerrcode.DeadlockDetected {
+			return err
+		}
+	}
+}
+
+func inTx(ctx context.Context, client Client, fn func(tx Client) error) (err error) {
+	tx, err := client.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			// контекст запроса может быть уже отменен, откат выполняется в любом случае
+			_ = tx.Rollback(context.Background())
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
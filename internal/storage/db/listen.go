@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/avito-test/internal/config/logger"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/sirupsen/logrus"
+)
+
+// listenRetryInterval - пауза перед переподключением после ошибки соединения
+const listenRetryInterval = time.Second
+
+// Listen подписывается на уведомления NOTIFY канала channel на отдельном соединении и вызывает notify с payload
+// каждого уведомления, пока не отменен ctx. Уведомления, отправленные во время разрыва соединения, теряются,
+// поэтому после каждого подключения вызывается connected
+func Listen(ctx context.Context, pool *pgxpool.Pool, channel string, notify func(payload string), connected func()) {
+	log := logger.FromContext(ctx).WithField("channel", channel)
+
+	for {
+		err := listen(ctx, pool, channel, notify, connected)
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.WithFields(logrus.Fields{
+			"error_message": err.Error(),
+		}).Error("listen connection lost")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(listenRetryInterval):
+		}
+	}
+}
+
+func listen(ctx context.Context, pool *pgxpool.Pool, channel string, notify func(payload string), connected func()) error {
+	pooled, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	// соединение с LISTEN не возвращается в пул
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		return err
+	}
+
+	connected()
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		notify(notification.Payload)
+	}
+}
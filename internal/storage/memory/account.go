@@ -0,0 +1,50 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/avito-test/internal/model"
+	"github.com/avito-test/internal/storage/repo"
+)
+
+type accountRepo struct {
+	storage *Storage
+}
+
+func NewAccountRepo(storage *Storage) repo.AccountRepo {
+	return &accountRepo{storage: storage}
+}
+
+func (r *accountRepo) GetAccount(ctx context.Context, userId string) (*model.Account, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s := r.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account, ok := s.accounts[userId]
+	if !ok {
+		return nil, nil
+	}
+
+	return &account, nil
+}
+
+func (r *accountRepo) SetAccount(ctx context.Context, account model.Account) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s := r.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account.UpdateTime = timestamp(account.UpdateTime)
+	s.accounts[account.UserId] = account
+
+	return nil
+}
@@ -0,0 +1,196 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/avito-test/internal/model"
+	"github.com/avito-test/internal/storage/repo"
+)
+
+type adjustmentRepo struct {
+	storage *Storage
+}
+
+func NewAdjustmentRepo(storage *Storage) repo.AdjustmentRepo {
+	return &adjustmentRepo{storage: storage}
+}
+
+func (r *adjustmentRepo) CreateAdjustment(ctx context.Context, adjustment model.Adjustment) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s := r.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.adjustments[adjustment.Id] = copyAdjustment(adjustment)
+
+	return nil
+}
+
+func (r *adjustmentRepo) GetAdjustment(ctx context.Context, id string) (*model.Adjustment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s := r.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	adjustment, ok := s.adjustments[id]
+	if !ok {
+		return nil, nil
+	}
+
+	adjustment = copyAdjustment(adjustment)
+
+	return &adjustment, nil
+}
+
+// LockAdjustment - то же, что GetAdjustment: транзакции Transactor в памяти выполняются по одной
+func (r *adjustmentRepo) LockAdjustment(ctx context.Context, id string) (*model.Adjustment, error) {
+	return r.GetAdjustment(ctx, id)
+}
+
+func (r *adjustmentRepo) GetAdjustments(ctx context.Context, userId *string, status *model.AdjustmentStatus, limit int) ([]model.Adjustment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s := r.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	adjustments := make([]model.Adjustment, 0)
+
+	for _, adjustment := range s.adjustments {
+		if userId != nil && adjustment.UserId != *userId || status != nil && adjustment.Status != *status {
+			continue
+		}
+
+		adjustments = append(adjustments, copyAdjustment(adjustment))
+	}
+
+	ascending := status != nil && *status == model.AdjustmentPending
+
+	sort.Slice(adjustments, func(i, j int) bool {
+		a, b := adjustments[i], adjustments[j]
+		if !ascending {
+			a, b = b, a
+		}
+
+		if !a.ProposeTime.Equal(b.ProposeTime) {
+			return a.ProposeTime.Before(b.ProposeTime)
+		}
+
+		return a.Id < b.Id
+	})
+
+	if len(adjustments) > limit {
+		adjustments = adjustments[:limit]
+	}
+
+	return adjustments, nil
+}
+
+func (r *adjustmentRepo) SaveDecision(ctx context.Context, adjustment model.Adjustment) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s := r.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved, ok := s.adjustments[adjustment.Id]
+	if !ok {
+		return nil
+	}
+
+	saved.Status = adjustment.Status
+	saved.DecidedBy = copyString(adjustment.DecidedBy)
+	saved.DecisionComment = copyString(adjustment.DecisionComment)
+	saved.TransactionId = copyString(adjustment.TransactionId)
+	saved.DecisionTime = nil
+
+	if adjustment.DecisionTime != nil {
+		decisionTime := timestamp(*adjustment.DecisionTime)
+		saved.DecisionTime = &decisionTime
+	}
+
+	s.adjustments[adjustment.Id] = saved
+
+	return nil
+}
+
+// PostAdjustment повторяет post_adjustment: меняет баланс на сумму корректировки со знаком, если баланс есть, это разрешает
+// статус счета и баланс не уходит в минус, и записывает транзакцию корректировки
+func (r *adjustmentRepo) PostAdjustment(ctx context.Context, operation model.Operation, adjustment model.Adjustment, comment string) (model.TransactionStatus, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s := r.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sum := adjustment.SignedSum()
+
+	balance, ok := s.balances[adjustment.UserId]
+	if !ok {
+		return model.TransactionStatusBalanceNotFound, nil
+	}
+
+	if status := s.restriction(adjustment.UserId, sum < 0); status != model.TransactionStatusOk {
+		return status, nil
+	}
+
+	if balance+sum < 0 {
+		return model.TransactionStatusInsufficientFunds, nil
+	}
+
+	s.balances[adjustment.UserId] = round(balance+sum, 6)
+
+	s.transactions[operation.Id] = &model.Transaction{
+		Id:                operation.Id,
+		UserId:            adjustment.UserId,
+		Sum:               round(sum, 4),
+		TransactionTypeId: model.TransactionTypeAdjustment,
+		TransactionType:   transactionTypes[model.TransactionTypeAdjustment],
+		Comment:           &comment,
+		UpdTime:           timestamp(operation.Time),
+	}
+
+	s.addEvent("adjustment", adjustment.UserId, nil, map[string]interface{}{
+		"transactionId": operation.Id,
+		"adjustmentId":  adjustment.Id,
+		"sum":           round(sum, 4),
+		"comment":       comment,
+		"balance":       s.balances[adjustment.UserId],
+	}, operation)
+
+	return model.TransactionStatusOk, nil
+}
+
+// copyAdjustment копирует корректировку, чтобы вызывающий не менял данные хранилища
+func copyAdjustment(adjustment model.Adjustment) model.Adjustment {
+	c := adjustment
+
+	c.DecidedBy = copyString(adjustment.DecidedBy)
+	c.DecisionComment = copyString(adjustment.DecisionComment)
+	c.TransactionId = copyString(adjustment.TransactionId)
+
+	if adjustment.DecisionTime != nil {
+		decisionTime := *adjustment.DecisionTime
+		c.DecisionTime = &decisionTime
+	}
+
+	return c
+}
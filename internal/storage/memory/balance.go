@@ -0,0 +1,180 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/avito-test/internal/model"
+	"github.com/avito-test/internal/storage/repo"
+)
+
+type balanceRepo struct {
+	storage *Storage
+}
+
+func NewBalanceRepo(storage *Storage) repo.BalanceRepo {
+	return &balanceRepo{storage: storage}
+}
+
+// AddBalance повторяет add_balance: пополняет или создает баланс и записывает транзакцию пополнения, если это разрешают
+// статус счета и лимиты
+func (r *balanceRepo) AddBalance(ctx context.Context, operation model.Operation, userId string, sum float64, comment *string) (model.TransactionStatus, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s := r.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if status := s.restriction(userId, false); status != model.TransactionStatusOk {
+		return status, nil
+	}
+
+	if status := s.checkLimits(userId, model.LimitDeposit, sum, timestamp(operation.Time)); status != model.TransactionStatusOk {
+		return status, nil
+	}
+
+	s.balances[userId] = round(s.balances[userId]+sum, 6)
+
+	s.transactions[operation.Id] = &model.Transaction{
+		Id:                operation.Id,
+		UserId:            userId,
+		Sum:               round(sum, 4),
+		TransactionTypeId: model.TransactionTypeDeposit,
+		TransactionType:   transactionTypes[model.TransactionTypeDeposit],
+		Comment:           copyString(comment),
+		UpdTime:           timestamp(operation.Time),
+	}
+
+	s.addEvent("deposit", userId, nil, map[string]interface{}{
+		"transactionId": operation.Id,
+		"sum":           round(sum, 4),
+		"comment":       comment,
+		"balance":       s.balances[userId],
+	}, operation)
+
+	return model.TransactionStatusOk, nil
+}
+
+// WithdrawBalance повторяет withdraw_balance: списывает с баланса, если на нем достаточно средств, и записывает транзакцию списания
+func (r *balanceRepo) WithdrawBalance(ctx context.Context, operation model.Operation, userId string, sum float64, comment *string) (model.TransactionStatus, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s := r.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	balance, ok := s.balances[userId]
+	if !ok {
+		return model.TransactionStatusBalanceNotFound, nil
+	}
+
+	if status := s.restriction(userId, true); status != model.TransactionStatusOk {
+		return status, nil
+	}
+
+	if status := s.checkLimits(userId, model.LimitWithdraw, sum, timestamp(operation.Time)); status != model.TransactionStatusOk {
+		return status, nil
+	}
+
+	if balance < sum {
+		return model.TransactionStatusInsufficientFunds, nil
+	}
+
+	s.balances[userId] = round(balance-sum, 6)
+
+	s.transactions[operation.Id] = &model.Transaction{
+		Id:                operation.Id,
+		UserId:            userId,
+		Sum:               round(sum, 4),
+		TransactionTypeId: model.TransactionTypeWithdrawal,
+		TransactionType:   transactionTypes[model.TransactionTypeWithdrawal],
+		Comment:           copyString(comment),
+		UpdTime:           timestamp(operation.Time),
+	}
+
+	s.addEvent("withdrawal", userId, nil, map[string]interface{}{
+		"transactionId": operation.Id,
+		"sum":           round(sum, 4),
+		"comment":       comment,
+		"balance":       s.balances[userId],
+	}, operation)
+
+	return model.TransactionStatusOk, nil
+}
+
+func (r *balanceRepo) GetBalanceByUserId(ctx context.Context, userId string) (*float64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s := r.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	balance, ok := s.balances[userId]
+	if !ok {
+		return nil, nil
+	}
+
+	return &balance, nil
+}
+
+// GetBalanceMismatches повторяет сверку в Postgres: пополнения и корректировки минус списания, действующие и подтвержденные резервации
+func (r *balanceRepo) GetBalanceMismatches(ctx context.Context) ([]model.BalanceMismatch, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s := r.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expected := make(map[string]float64, len(s.balances))
+
+	for _, tr := range s.transactions {
+		sum := expected[tr.UserId]
+
+		switch tr.TransactionTypeId {
+		case model.TransactionTypeDeposit, model.TransactionTypeAdjustment:
+			// сумма корректировки со знаком
+			sum += tr.Sum
+		case model.TransactionTypeCancel:
+			// отмененная резервация баланс не меняет
+		default:
+			sum -= tr.Sum
+		}
+
+		expected[tr.UserId] = sum
+	}
+
+	for userId := range s.balances {
+		if _, ok := expected[userId]; !ok {
+			expected[userId] = 0
+		}
+	}
+
+	mismatches := make([]model.BalanceMismatch, 0)
+
+	for userId, sum := range expected {
+		balance := s.balances[userId]
+		sum = round(sum, 4)
+
+		if round(balance, 4) != sum {
+			mismatches = append(mismatches, model.BalanceMismatch{UserId: userId, Balance: balance, Expected: sum})
+		}
+	}
+
+	sort.Slice(mismatches, func(i, j int) bool {
+		return mismatches[i].UserId < mismatches[j].UserId
+	})
+
+	return mismatches, nil
+}
@@ -0,0 +1,162 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/avito-test/internal/model"
+	"github.com/avito-test/internal/storage/repo"
+)
+
+type limitRepo struct {
+	storage *Storage
+}
+
+func NewLimitRepo(storage *Storage) repo.LimitRepo {
+	return &limitRepo{storage: storage}
+}
+
+func (r *limitRepo) GetLimitRules(ctx context.Context) ([]model.LimitRule, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s := r.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rules := make([]model.LimitRule, 0, len(s.limits))
+	for _, rule := range s.limits {
+		rules = append(rules, rule)
+	}
+
+	sort.Slice(rules, func(i, j int) bool {
+		a, b := rules[i], rules[j]
+
+		if a.Scope != b.Scope {
+			return a.Scope < b.Scope
+		}
+
+		if a.ScopeId != b.ScopeId {
+			return a.ScopeId < b.ScopeId
+		}
+
+		if a.Operation != b.Operation {
+			return a.Operation < b.Operation
+		}
+
+		return a.Period < b.Period
+	})
+
+	return rules, nil
+}
+
+func (r *limitRepo) SetLimitRule(ctx context.Context, rule model.LimitRule) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s := r.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rule.Amount = round(rule.Amount, 4)
+	rule.UpdateTime = timestamp(rule.UpdateTime)
+	s.limits[keyOf(rule)] = rule
+
+	return nil
+}
+
+func (r *limitRepo) DeleteLimitRule(ctx context.Context, rule model.LimitRule) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	s := r.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := keyOf(rule)
+
+	if _, ok := s.limits[key]; !ok {
+		return false, nil
+	}
+
+	delete(s.limits, key)
+
+	return true, nil
+}
+
+func (r *limitRepo) GetUserTier(ctx context.Context, userId string) (*model.UserTier, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s := r.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tier, ok := s.tiers[userId]
+	if !ok {
+		return nil, nil
+	}
+
+	return &tier, nil
+}
+
+func (r *limitRepo) SetUserTier(ctx context.Context, tier model.UserTier) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s := r.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tier.UpdateTime = timestamp(tier.UpdateTime)
+	s.tiers[tier.UserId] = tier
+
+	return nil
+}
+
+func (r *limitRepo) GetEffectiveLimits(ctx context.Context, userId string) ([]model.LimitRule, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s := r.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rules := make([]model.LimitRule, 0)
+
+	for _, operation := range model.LimitOperations {
+		for _, period := range model.LimitPeriods {
+			if rule := s.limitRule(userId, operation, period); rule != nil {
+				rules = append(rules, *rule)
+			}
+		}
+	}
+
+	return rules, nil
+}
+
+func (r *limitRepo) GetLimitUsage(ctx context.Context, userId string, operation model.LimitOperation, from time.Time, to time.Time) (float64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s := r.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.limitUsage(userId, operation, from, to), nil
+}
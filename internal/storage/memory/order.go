@@ -0,0 +1,61 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/avito-test/internal/model"
+	"github.com/avito-test/internal/storage/repo"
+)
+
+type orderRepo struct {
+	storage *Storage
+}
+
+func NewOrderRepo(storage *Storage) repo.OrderRepo {
+	return &orderRepo{storage: storage}
+}
+
+func (r *orderRepo) CreateOrder(ctx context.Context, orderId string, userId string, serviceIds []string, createTime time.Time) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	s := r.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.orders[orderId]; ok {
+		return false, nil
+	}
+
+	s.orders[orderId] = model.Order{
+		Id:         orderId,
+		UserId:     userId,
+		ServiceIds: append([]string(nil), serviceIds...),
+		CreateTime: timestamp(createTime),
+	}
+
+	return true, nil
+}
+
+func (r *orderRepo) GetOrder(ctx context.Context, orderId string) (*model.Order, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s := r.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order, ok := s.orders[orderId]
+	if !ok {
+		return nil, nil
+	}
+
+	order.ServiceIds = append([]string(nil), order.ServiceIds...)
+
+	return &order, nil
+}
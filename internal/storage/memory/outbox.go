@@ -0,0 +1,141 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/avito-test/internal/config/clock"
+	"github.com/avito-test/internal/model"
+	"github.com/avito-test/internal/storage/repo"
+)
+
+// outboxRepo - события outbox, их добавляют операции с балансом, как add_outbox_event.
+// Время бд (CURRENT_TIMESTAMP при публикации и очистке) берется из clock
+type outboxRepo struct {
+	storage *Storage
+	clock   clock.Clock
+}
+
+func NewOutboxRepo(storage *Storage, clk clock.Clock) repo.OutboxRepo {
+	return &outboxRepo{storage: storage, clock: clk}
+}
+
+// TryLock всегда берет блокировку: relay в памяти один
+func (r *outboxRepo) TryLock(ctx context.Context) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *outboxRepo) GetUnpublished(ctx context.Context, limit int) ([]model.Event, error) {
+	return r.events(ctx, limit, func(e outboxEvent) bool {
+		return e.publishTime == nil
+	})
+}
+
+func (r *outboxRepo) GetUserEvents(ctx context.Context, userId string, afterSequence int64, limit int) ([]model.Event, error) {
+	return r.events(ctx, limit, func(e outboxEvent) bool {
+		return e.event.UserId == userId && e.event.Sequence > afterSequence
+	})
+}
+
+func (r *outboxRepo) GetLastUserSequence(ctx context.Context, userId string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s := r.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var sequence int64
+
+	for _, e := range s.outbox {
+		if e.event.UserId == userId {
+			sequence = e.event.Sequence
+		}
+	}
+
+	return sequence, nil
+}
+
+func (r *outboxRepo) MarkPublished(ctx context.Context, sequences []int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s := r.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	published := make(map[int64]bool, len(sequences))
+	for _, sequence := range sequences {
+		published[sequence] = true
+	}
+
+	now := timestamp(r.clock.Now())
+
+	for i := range s.outbox {
+		if published[s.outbox[i].event.Sequence] {
+			s.outbox[i].publishTime = &now
+		}
+	}
+
+	return nil
+}
+
+func (r *outboxRepo) DeletePublished(ctx context.Context, retention time.Duration) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s := r.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before := timestamp(r.clock.Now()).Add(-retention)
+
+	kept := make([]outboxEvent, 0, len(s.outbox))
+
+	for _, e := range s.outbox {
+		if e.publishTime == nil || !e.publishTime.Before(before) {
+			kept = append(kept, e)
+		}
+	}
+
+	deleted := int64(len(s.outbox) - len(kept))
+	s.outbox = kept
+
+	return deleted, nil
+}
+
+// events возвращает первые limit событий по возрастанию номера, для которых match возвращает true
+func (r *outboxRepo) events(ctx context.Context, limit int, match func(e outboxEvent) bool) ([]model.Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s := r.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := make([]model.Event, 0)
+
+	for _, e := range s.outbox {
+		if len(events) == limit {
+			break
+		}
+
+		if match(e) {
+			events = append(events, e.event)
+		}
+	}
+
+	return events, nil
+}
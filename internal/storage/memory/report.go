@@ -0,0 +1,53 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/avito-test/internal/model"
+	"github.com/avito-test/internal/storage/repo"
+)
+
+type reportRepo struct {
+	storage *Storage
+}
+
+func NewReportRepo(storage *Storage) repo.ReportRepo {
+	return &reportRepo{storage: storage}
+}
+
+func (r *reportRepo) GetReportRows(ctx context.Context, dateFrom time.Time) ([]model.ReportRow, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s := r.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dateTo := dateFrom.AddDate(0, 1, 0)
+	totals := make(map[string]float64)
+
+	for _, tr := range s.transactions {
+		if tr.TransactionTypeId != model.TransactionTypeCapture || tr.UpdTime.Before(dateFrom) || !tr.UpdTime.Before(dateTo) {
+			continue
+		}
+
+		totals[*tr.ServiceId] += tr.Sum
+	}
+
+	reportRows := make([]model.ReportRow, 0, len(totals))
+
+	for serviceId, total := range totals {
+		reportRows = append(reportRows, model.ReportRow{ServiceName: serviceId, TotalSum: round(total, 4)})
+	}
+
+	// в бд порядок групп не определен, здесь для воспроизводимости сортируем по услуге
+	sort.Slice(reportRows, func(i, j int) bool {
+		return reportRows[i].ServiceName < reportRows[j].ServiceName
+	})
+
+	return reportRows, nil
+}
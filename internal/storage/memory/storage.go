@@ -0,0 +1,335 @@
+// Package memory - хранилище в памяти процесса с той же семантикой, что у функций add_balance, withdraw_balance и save_transaction
+// в Postgres (включая ограничения статуса счета, лимиты и доставки webhook событий). Нужно для тестов сервисов без бд
+package memory
+
+import (
+	"encoding/json"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/avito-test/internal/model"
+	"github.com/google/uuid"
+)
+
+// transactionTypes - названия типов транзакций, как в таблице transaction_type
+var transactionTypes = map[int]string{
+	model.TransactionTypeReserve:    "Деньги зарезервированы с основного баланса",
+	model.TransactionTypeCapture:    "Резервация подтверждена, средства списаны, оплата прошла",
+	model.TransactionTypeCancel:     "Резервация отменена, средства возвращены на основной счет баланса",
+	model.TransactionTypeDeposit:    "Добавление средств к балансу",
+	model.TransactionTypeWithdrawal: "Списание средств с баланса",
+	model.TransactionTypeAdjustment: "Корректировка баланса",
+}
+
+// Storage - общие данные репозиториев в памяти. Операция выполняется под одной блокировкой, как транзакция бд
+type Storage struct {
+	mu sync.Mutex
+	// txMu упорядочивает транзакции Transactor
+	txMu sync.Mutex
+
+	balances     map[string]float64
+	transactions map[string]*model.Transaction
+	// states - прошлые состояния транзакций (transaction_upd) по id транзакции
+	states map[string][]model.TransactionState
+	// accounts - заданные статусы счетов (account_status), нет записи - счет активен
+	accounts map[string]model.Account
+	// limits - лимиты (limit_rule) по scope, scopeId, операции и периоду, tiers - уровни пользователей (user_tier)
+	limits map[limitKey]model.LimitRule
+	tiers  map[string]model.UserTier
+	// orders - заказы без строк (orders)
+	orders map[string]model.Order
+	// subscriptions и deliveries - подписки и доставки webhook, events - последний номер события (outbox.id)
+	subscriptions map[string]model.WebhookSubscription
+	deliveries    map[string]*model.WebhookDelivery
+	events        int64
+	// outbox - события по возрастанию номера (outbox)
+	outbox []outboxEvent
+	// adjustments - ручные корректировки (adjustment)
+	adjustments map[string]model.Adjustment
+}
+
+type limitKey struct {
+	scope     model.LimitScope
+	scopeId   string
+	operation model.LimitOperation
+	period    model.LimitPeriod
+}
+
+// outboxEvent - событие outbox, publishTime - время публикации, у неопубликованного - nil
+type outboxEvent struct {
+	event       model.Event
+	publishTime *time.Time
+}
+
+func keyOf(rule model.LimitRule) limitKey {
+	return limitKey{scope: rule.Scope, scopeId: rule.ScopeId, operation: rule.Operation, period: rule.Period}
+}
+
+func NewStorage() *Storage {
+	return &Storage{
+		balances:      make(map[string]float64),
+		transactions:  make(map[string]*model.Transaction),
+		states:        make(map[string][]model.TransactionState),
+		accounts:      make(map[string]model.Account),
+		limits:        make(map[limitKey]model.LimitRule),
+		tiers:         make(map[string]model.UserTier),
+		orders:        make(map[string]model.Order),
+		subscriptions: make(map[string]model.WebhookSubscription),
+		deliveries:    make(map[string]*model.WebhookDelivery),
+		adjustments:   make(map[string]model.Adjustment),
+	}
+}
+
+// snapshot копирует данные хранилища для отката транзакции, вызывается под блокировкой
+func (s *Storage) snapshot() *Storage {
+	c := NewStorage()
+
+	for userId, balance := range s.balances {
+		c.balances[userId] = balance
+	}
+
+	for id, tr := range s.transactions {
+		copied := copyTransaction(tr)
+		c.transactions[id] = &copied
+	}
+
+	for id, states := range s.states {
+		c.states[id] = append([]model.TransactionState(nil), states...)
+	}
+
+	for userId, account := range s.accounts {
+		c.accounts[userId] = account
+	}
+
+	for key, rule := range s.limits {
+		c.limits[key] = rule
+	}
+
+	for userId, tier := range s.tiers {
+		c.tiers[userId] = tier
+	}
+
+	for id, order := range s.orders {
+		c.orders[id] = order
+	}
+
+	for id, subscription := range s.subscriptions {
+		c.subscriptions[id] = subscription
+	}
+
+	for id, delivery := range s.deliveries {
+		copied := *delivery
+		c.deliveries[id] = &copied
+	}
+
+	c.events = s.events
+	c.outbox = append([]outboxEvent(nil), s.outbox...)
+
+	for id, adjustment := range s.adjustments {
+		c.adjustments[id] = copyAdjustment(adjustment)
+	}
+
+	return c
+}
+
+// restore возвращает данные из snapshot, вызывается под блокировкой
+func (s *Storage) restore(c *Storage) {
+	s.balances = c.balances
+	s.transactions = c.transactions
+	s.states = c.states
+	s.accounts = c.accounts
+	s.limits = c.limits
+	s.tiers = c.tiers
+	s.orders = c.orders
+	s.subscriptions = c.subscriptions
+	s.deliveries = c.deliveries
+	s.events = c.events
+	s.outbox = c.outbox
+	s.adjustments = c.adjustments
+}
+
+// addEvent повторяет add_outbox_event: добавляет событие в outbox и создает доставки события подписчикам, чьи типы событий
+// и услуга подходят. Время первой попытки - время события, вызывается под блокировкой
+func (s *Storage) addEvent(eventType string, userId string, serviceId *string, payload map[string]interface{}, operation model.Operation) {
+	s.events++
+
+	// ошибки быть не может: в payload только строки, числа и nil
+	body, _ := json.Marshal(payload)
+
+	s.outbox = append(s.outbox, outboxEvent{event: model.Event{
+		Id:         operation.Id,
+		Sequence:   s.events,
+		Type:       eventType,
+		UserId:     userId,
+		Payload:    body,
+		CreateTime: timestamp(operation.Time),
+	}})
+
+	for _, subscription := range s.subscriptions {
+		if !contains(subscription.EventTypes, eventType) || subscription.ServiceId != nil && (serviceId == nil || *subscription.ServiceId != *serviceId) {
+			continue
+		}
+
+		// id доставки в бд случайный, здесь выводится из подписки и события, чтобы не зависеть от порядка обхода подписок
+		id := uuid.NewSHA1(uuid.NameSpaceOID, []byte(subscription.Id+operation.Id)).String()
+
+		s.deliveries[id] = &model.WebhookDelivery{
+			Id:             id,
+			SubscriptionId: subscription.Id,
+			Event: model.Event{
+				Id:         operation.Id,
+				Sequence:   s.events,
+				Type:       eventType,
+				UserId:     userId,
+				Payload:    body,
+				CreateTime: timestamp(operation.Time),
+			},
+			Status:          model.WebhookPending,
+			NextAttemptTime: timestamp(operation.Time),
+		}
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// timestamp приводит время операции к timestamp в Postgres: UTC с точностью до микросекунд
+func timestamp(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Microsecond)
+}
+
+// findByKey возвращает транзакцию по заказу, пользователю и услуге (уникальный индекс в бд), вызывается под блокировкой
+func (s *Storage) findByKey(orderId string, userId string, serviceId string) *model.Transaction {
+	for _, tr := range s.transactions {
+		if tr.OrderId != nil && *tr.OrderId == orderId && tr.UserId == userId && tr.ServiceId != nil && *tr.ServiceId == serviceId {
+			return tr
+		}
+	}
+
+	return nil
+}
+
+// restriction повторяет account_restriction: ограничение операции статусом счета, вызывается под блокировкой
+func (s *Storage) restriction(userId string, debit bool) model.TransactionStatus {
+	account, ok := s.accounts[userId]
+	if !ok {
+		return model.TransactionStatusOk
+	}
+
+	return account.Status.Restriction(debit)
+}
+
+// limitRule повторяет limit_rule_for: лимит пользователя, затем его уровня, затем глобальный, нет лимита - nil.
+// Вызывается под блокировкой
+func (s *Storage) limitRule(userId string, operation model.LimitOperation, period model.LimitPeriod) *model.LimitRule {
+	keys := []limitKey{{model.LimitUser, userId, operation, period}}
+
+	if tier, ok := s.tiers[userId]; ok {
+		keys = append(keys, limitKey{model.LimitTier, tier.Tier, operation, period})
+	}
+
+	keys = append(keys, limitKey{model.LimitGlobal, "", operation, period})
+
+	for _, key := range keys {
+		if rule, ok := s.limits[key]; ok {
+			return &rule
+		}
+	}
+
+	return nil
+}
+
+// limitUsage повторяет limit_usage: сумма пополнений, списаний или неотмененных резерваций (по времени резервации)
+// пользователя за [from, to), вызывается под блокировкой
+func (s *Storage) limitUsage(userId string, operation model.LimitOperation, from time.Time, to time.Time) float64 {
+	within := func(t time.Time) bool {
+		return !t.Before(from) && t.Before(to)
+	}
+
+	var used float64
+
+	for _, tr := range s.transactions {
+		if tr.UserId != userId {
+			continue
+		}
+
+		switch {
+		case operation == model.LimitDeposit && tr.TransactionTypeId == model.TransactionTypeDeposit && within(tr.UpdTime),
+			operation == model.LimitWithdraw && tr.TransactionTypeId == model.TransactionTypeWithdrawal && within(tr.UpdTime),
+			operation == model.LimitReserve && tr.TransactionTypeId == model.TransactionTypeReserve && within(tr.UpdTime):
+			used += tr.Sum
+		case operation == model.LimitReserve && tr.TransactionTypeId == model.TransactionTypeCapture:
+			for _, state := range s.states[tr.Id] {
+				if state.TransactionTypeId == model.TransactionTypeReserve && within(state.UpdTime) {
+					used += tr.Sum
+					break
+				}
+			}
+		}
+	}
+
+	return round(used, 4)
+}
+
+// checkLimits повторяет check_limits: лимит одной операции, затем суточный и месячный, вызывается под блокировкой
+func (s *Storage) checkLimits(userId string, operation model.LimitOperation, sum float64, at time.Time) model.TransactionStatus {
+	statuses := map[model.LimitPeriod]model.TransactionStatus{
+		model.LimitPerTransaction: model.TransactionStatusTransactionLimitExceeded,
+		model.LimitDaily:          model.TransactionStatusDailyLimitExceeded,
+		model.LimitMonthly:        model.TransactionStatusMonthlyLimitExceeded,
+	}
+
+	for _, period := range model.LimitPeriods {
+		rule := s.limitRule(userId, operation, period)
+		if rule == nil {
+			continue
+		}
+
+		used := 0.0
+		if from, to, ok := period.Window(at); ok {
+			used = s.limitUsage(userId, operation, from, to)
+		}
+
+		if used+sum > rule.Amount {
+			return statuses[period]
+		}
+	}
+
+	return model.TransactionStatusOk
+}
+
+// round округляет до places знаков, как numeric с заданной точностью
+func round(value float64, places int) float64 {
+	scale := math.Pow10(places)
+
+	return math.Round(value*scale) / scale
+}
+
+// copyTransaction копирует транзакцию, чтобы вызывающий не менял данные хранилища
+func copyTransaction(tr *model.Transaction) model.Transaction {
+	c := *tr
+
+	c.OrderId = copyString(tr.OrderId)
+	c.ServiceId = copyString(tr.ServiceId)
+	c.Comment = copyString(tr.Comment)
+
+	return c
+}
+
+func copyString(s *string) *string {
+	if s == nil {
+		return nil
+	}
+
+	c := *s
+
+	return &c
+}
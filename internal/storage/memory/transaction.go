@@ -0,0 +1,377 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/avito-test/internal/model"
+	"github.com/avito-test/internal/storage/repo"
+)
+
+type transactionRepo struct {
+	storage *Storage
+}
+
+func NewTransactionRepo(storage *Storage) repo.TransactionRepo {
+	return &transactionRepo{storage: storage}
+}
+
+// SaveTransaction повторяет save_transaction: проверки выполняются в том же порядке и возвращают те же статусы
+func (t *transactionRepo) SaveTransaction(ctx context.Context, operation model.Operation, orderId string, userId string, serviceId string, sum float64, transactionType int, comment *string) (model.TransactionStatus, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s := t.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing := s.findByKey(orderId, userId, serviceId)
+
+	balance, ok := s.balances[userId]
+	if !ok {
+		return model.TransactionStatusBalanceNotFound, nil
+	}
+
+	if status := s.restriction(userId, transactionType == model.TransactionTypeReserve); status != model.TransactionStatusOk {
+		return status, nil
+	}
+
+	switch transactionType {
+	case model.TransactionTypeReserve:
+		if existing != nil {
+			return model.TransactionStatusReservationExists, nil
+		}
+
+		if status := s.checkLimits(userId, model.LimitReserve, sum, timestamp(operation.Time)); status != model.TransactionStatusOk {
+			return status, nil
+		}
+
+		if balance < sum {
+			return model.TransactionStatusInsufficientFunds, nil
+		}
+	case model.TransactionTypeCapture:
+		if existing == nil {
+			return model.TransactionStatusCaptureNotFound, nil
+		} else if existing.TransactionTypeId == model.TransactionTypeCapture {
+			return model.TransactionStatusCaptureAlreadyCaptured, nil
+		} else if existing.TransactionTypeId == model.TransactionTypeCancel {
+			return model.TransactionStatusCaptureAlreadyCancelled, nil
+		}
+	case model.TransactionTypeCancel:
+		if existing == nil {
+			return model.TransactionStatusCancelNotFound, nil
+		} else if existing.TransactionTypeId == model.TransactionTypeCancel {
+			return model.TransactionStatusCancelAlreadyCancelled, nil
+		} else if existing.TransactionTypeId == model.TransactionTypeCapture {
+			return model.TransactionStatusCancelAlreadyCaptured, nil
+		}
+	}
+
+	if transactionType == model.TransactionTypeReserve {
+		s.transactions[operation.Id] = &model.Transaction{
+			Id:                operation.Id,
+			UserId:            userId,
+			OrderId:           &orderId,
+			ServiceId:         &serviceId,
+			Sum:               round(sum, 4),
+			TransactionTypeId: transactionType,
+			TransactionType:   transactionTypes[transactionType],
+			Comment:           copyString(comment),
+			UpdTime:           timestamp(operation.Time),
+		}
+
+		s.balances[userId] = round(balance-sum, 6)
+
+		s.addTransactionEvent(s.transactions[operation.Id], comment, operation)
+
+		return model.TransactionStatusOk, nil
+	}
+
+	if existing == nil {
+		// save_transaction с другими типами падает на вставке в transaction_upd
+		return 0, errors.New("transaction not found")
+	}
+
+	s.states[existing.Id] = append(s.states[existing.Id], model.TransactionState{
+		TransactionTypeId: existing.TransactionTypeId,
+		TransactionType:   existing.TransactionType,
+		Sum:               existing.Sum,
+		Comment:           existing.Comment,
+		UpdTime:           existing.UpdTime,
+	})
+
+	existing.TransactionTypeId = transactionType
+	existing.TransactionType = transactionTypes[transactionType]
+	existing.Comment = copyString(comment)
+	existing.UpdTime = timestamp(operation.Time)
+
+	if transactionType == model.TransactionTypeCancel {
+		s.balances[userId] = round(balance+existing.Sum, 6)
+	}
+
+	s.addTransactionEvent(existing, comment, operation)
+
+	return model.TransactionStatusOk, nil
+}
+
+// addTransactionEvent добавляет событие reserved, captured или cancelled о транзакции после изменения, как save_transaction
+func (s *Storage) addTransactionEvent(tr *model.Transaction, comment *string, operation model.Operation) {
+	eventTypes := map[int]string{
+		model.TransactionTypeReserve: "reserved",
+		model.TransactionTypeCapture: "captured",
+		model.TransactionTypeCancel:  "cancelled",
+	}
+
+	s.addEvent(eventTypes[tr.TransactionTypeId], tr.UserId, tr.ServiceId, map[string]interface{}{
+		"transactionId": tr.Id,
+		"orderId":       *tr.OrderId,
+		"serviceId":     *tr.ServiceId,
+		"sum":           tr.Sum,
+		"comment":       comment,
+		"balance":       s.balances[tr.UserId],
+	}, operation)
+}
+
+// GetTransactionListByUserId сортирует по полю сортировки и id, с курсором выбирает транзакции после курсора
+func (t *transactionRepo) GetTransactionListByUserId(ctx context.Context, request model.GetTransactionsRequest) ([]model.Transaction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if request.SortBy != "sum" && request.SortBy != "date" {
+		return nil, errors.New("invalid sortBy")
+	}
+
+	s := t.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	desc := request.SortType == "desc"
+
+	// compare сравнивает транзакцию с ключом (значение поля сортировки, id) в порядке возрастания
+	compare := func(tr *model.Transaction, key *model.Transaction) int {
+		switch {
+		case request.SortBy == "sum" && tr.Sum != key.Sum:
+			if tr.Sum < key.Sum {
+				return -1
+			}
+
+			return 1
+		case request.SortBy == "date" && !tr.UpdTime.Equal(key.UpdTime):
+			if tr.UpdTime.Before(key.UpdTime) {
+				return -1
+			}
+
+			return 1
+		default:
+			return strings.Compare(tr.Id, key.Id)
+		}
+	}
+
+	var cursor *model.Transaction
+	if request.Cursor != nil {
+		cursor = &model.Transaction{Id: request.Cursor.Id, Sum: request.Cursor.Sum, UpdTime: request.Cursor.UpdTime}
+	}
+
+	transactions := make([]*model.Transaction, 0)
+
+	for _, tr := range s.transactions {
+		if !matches(tr, request.UserId, request.Filter) {
+			continue
+		}
+
+		if cursor != nil {
+			c := compare(tr, cursor)
+			if (desc && c >= 0) || (!desc && c <= 0) {
+				continue
+			}
+		}
+
+		transactions = append(transactions, tr)
+	}
+
+	sort.Slice(transactions, func(i, j int) bool {
+		c := compare(transactions[i], transactions[j])
+		if desc {
+			return c > 0
+		}
+
+		return c < 0
+	})
+
+	if request.Cursor == nil && request.Offset > 0 {
+		if request.Offset >= len(transactions) {
+			transactions = nil
+		} else {
+			transactions = transactions[request.Offset:]
+		}
+	}
+
+	if len(transactions) > request.Limit {
+		transactions = transactions[:request.Limit]
+	}
+
+	result := make([]model.Transaction, 0, len(transactions))
+	for _, tr := range transactions {
+		result = append(result, copyTransaction(tr))
+	}
+
+	return result, nil
+}
+
+func (t *transactionRepo) CountTransactionsByUserId(ctx context.Context, userId string, filter model.TransactionFilter) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s := t.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+
+	for _, tr := range s.transactions {
+		if matches(tr, userId, filter) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// matches проверяет транзакцию теми же условиями, что transactionFilter в Postgres
+func matches(tr *model.Transaction, userId string, filter model.TransactionFilter) bool {
+	if tr.UserId != userId {
+		return false
+	}
+
+	if len(filter.TransactionTypeIds) > 0 {
+		found := false
+
+		for _, id := range filter.TransactionTypeIds {
+			if tr.TransactionTypeId == id {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	switch {
+	case filter.DateFrom != nil && tr.UpdTime.Before(*filter.DateFrom):
+		return false
+	case filter.DateTo != nil && !tr.UpdTime.Before(*filter.DateTo):
+		return false
+	case filter.ServiceId != nil && (tr.ServiceId == nil || *tr.ServiceId != *filter.ServiceId):
+		return false
+	case filter.OrderId != nil && (tr.OrderId == nil || *tr.OrderId != *filter.OrderId):
+		return false
+	case filter.SumFrom != nil && tr.Sum < *filter.SumFrom:
+		return false
+	case filter.SumTo != nil && tr.Sum > *filter.SumTo:
+		return false
+	case filter.Comment != nil && (tr.Comment == nil || !strings.Contains(strings.ToLower(*tr.Comment), strings.ToLower(*filter.Comment))):
+		return false
+	}
+
+	return true
+}
+
+func (t *transactionRepo) GetTransactionById(ctx context.Context, id string) (*model.Transaction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s := t.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tr, ok := s.transactions[id]
+	if !ok {
+		return nil, nil
+	}
+
+	c := copyTransaction(tr)
+
+	return &c, nil
+}
+
+func (t *transactionRepo) GetTransactionByKey(ctx context.Context, orderId string, userId string, serviceId string) (*model.Transaction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s := t.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tr := s.findByKey(orderId, userId, serviceId)
+	if tr == nil {
+		return nil, nil
+	}
+
+	c := copyTransaction(tr)
+
+	return &c, nil
+}
+
+func (t *transactionRepo) GetTransactionsByOrderId(ctx context.Context, orderId string) ([]model.Transaction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s := t.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	transactions := make([]model.Transaction, 0)
+
+	for _, tr := range s.transactions {
+		if tr.OrderId != nil && *tr.OrderId == orderId {
+			transactions = append(transactions, copyTransaction(tr))
+		}
+	}
+
+	sort.Slice(transactions, func(i, j int) bool {
+		if !transactions[i].UpdTime.Equal(transactions[j].UpdTime) {
+			return transactions[i].UpdTime.Before(transactions[j].UpdTime)
+		}
+
+		return transactions[i].Id < transactions[j].Id
+	})
+
+	return transactions, nil
+}
+
+func (t *transactionRepo) GetTransactionStates(ctx context.Context, ids []string) (map[string][]model.TransactionState, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s := t.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	states := make(map[string][]model.TransactionState, len(ids))
+
+	for _, id := range ids {
+		if history, ok := s.states[id]; ok {
+			states[id] = append([]model.TransactionState(nil), history...)
+		}
+	}
+
+	return states, nil
+}
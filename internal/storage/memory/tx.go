@@ -0,0 +1,59 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/avito-test/internal/config/clock"
+	"github.com/avito-test/internal/storage/repo"
+)
+
+// NewRepos создает репозитории в памяти поверх storage. Журнал аудита есть только в Postgres, его репозиторий
+// остается пустым. Время бд для webhook и outbox берется из clk
+func NewRepos(storage *Storage, clk clock.Clock) repo.Repos {
+	return repo.Repos{
+		Balance:     NewBalanceRepo(storage),
+		Transaction: NewTransactionRepo(storage),
+		Account:     NewAccountRepo(storage),
+		Limit:       NewLimitRepo(storage),
+		Order:       NewOrderRepo(storage),
+		Webhook:     NewWebhookRepo(storage, clk),
+		Outbox:      NewOutboxRepo(storage, clk),
+		Adjustment:  NewAdjustmentRepo(storage),
+	}
+}
+
+type transactor struct {
+	storage *Storage
+	repos   repo.Repos
+}
+
+// NewTransactor создает Transactor в памяти: транзакции выполняются по одной с репозиториями repos, при ошибке fn данные
+// хранилища возвращаются к началу транзакции. Операции вне транзакций от нее не изолированы и при откате теряются
+func NewTransactor(storage *Storage, repos repo.Repos) repo.Transactor {
+	return &transactor{storage: storage, repos: repos}
+}
+
+func (t *transactor) InTx(ctx context.Context, fn func(repos repo.Repos) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s := t.storage
+
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	s.mu.Lock()
+	snapshot := s.snapshot()
+	s.mu.Unlock()
+
+	if err := fn(t.repos); err != nil {
+		s.mu.Lock()
+		s.restore(snapshot)
+		s.mu.Unlock()
+
+		return err
+	}
+
+	return nil
+}
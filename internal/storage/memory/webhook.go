@@ -0,0 +1,241 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/avito-test/internal/config/clock"
+	"github.com/avito-test/internal/model"
+	"github.com/avito-test/internal/storage/repo"
+)
+
+// webhookRepo - подписки и доставки webhook, доставки создаются операциями с балансом, как add_outbox_event.
+// Время бд (CURRENT_TIMESTAMP при повторной отправке и выборке на отправку) берется из clock
+type webhookRepo struct {
+	storage *Storage
+	clock   clock.Clock
+}
+
+func NewWebhookRepo(storage *Storage, clk clock.Clock) repo.WebhookRepo {
+	return &webhookRepo{storage: storage, clock: clk}
+}
+
+func (r *webhookRepo) CreateSubscription(ctx context.Context, subscription model.WebhookSubscription) (model.WebhookSubscription, error) {
+	if err := ctx.Err(); err != nil {
+		return model.WebhookSubscription{}, err
+	}
+
+	s := r.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.subscriptions[subscription.Id] = copySubscription(subscription)
+
+	return subscription, nil
+}
+
+func (r *webhookRepo) GetSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s := r.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subscriptions := make([]model.WebhookSubscription, 0, len(s.subscriptions))
+
+	for _, subscription := range s.subscriptions {
+		subscriptions = append(subscriptions, copySubscription(subscription))
+	}
+
+	sort.Slice(subscriptions, func(i, j int) bool {
+		if !subscriptions[i].CreateTime.Equal(subscriptions[j].CreateTime) {
+			return subscriptions[i].CreateTime.Before(subscriptions[j].CreateTime)
+		}
+
+		return subscriptions[i].Id < subscriptions[j].Id
+	})
+
+	return subscriptions, nil
+}
+
+func (r *webhookRepo) GetSubscription(ctx context.Context, id string) (*model.WebhookSubscription, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s := r.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subscription, ok := s.subscriptions[id]
+	if !ok {
+		return nil, nil
+	}
+
+	subscription = copySubscription(subscription)
+
+	return &subscription, nil
+}
+
+// DeleteSubscription удаляет подписку и ее доставки, как on delete cascade
+func (r *webhookRepo) DeleteSubscription(ctx context.Context, id string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	s := r.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.subscriptions[id]; !ok {
+		return false, nil
+	}
+
+	delete(s.subscriptions, id)
+
+	for deliveryId, delivery := range s.deliveries {
+		if delivery.SubscriptionId == id {
+			delete(s.deliveries, deliveryId)
+		}
+	}
+
+	return true, nil
+}
+
+func (r *webhookRepo) GetDeliveries(ctx context.Context, subscriptionId string, status *model.WebhookDeliveryStatus, limit int) ([]model.WebhookDelivery, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s := r.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deliveries := make([]model.WebhookDelivery, 0)
+
+	for _, delivery := range s.deliveries {
+		if delivery.SubscriptionId == subscriptionId && (status == nil || delivery.Status == *status) {
+			deliveries = append(deliveries, *delivery)
+		}
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].Event.Sequence > deliveries[j].Event.Sequence
+	})
+
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+
+	return deliveries, nil
+}
+
+func (r *webhookRepo) Redeliver(ctx context.Context, subscriptionId string, id string) (*model.WebhookDelivery, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s := r.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delivery, ok := s.deliveries[id]
+	if !ok || delivery.SubscriptionId != subscriptionId {
+		return nil, nil
+	}
+
+	delivery.Status = model.WebhookPending
+	delivery.Attempts = 0
+	delivery.NextAttemptTime = timestamp(r.clock.Now())
+
+	redelivered := *delivery
+
+	return &redelivered, nil
+}
+
+func (r *webhookRepo) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]model.WebhookDelivery, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s := r.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := timestamp(r.clock.Now())
+
+	due := make([]*model.WebhookDelivery, 0)
+
+	for _, delivery := range s.deliveries {
+		if delivery.Status == model.WebhookPending && !delivery.NextAttemptTime.After(now) {
+			due = append(due, delivery)
+		}
+	}
+
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].NextAttemptTime.Before(due[j].NextAttemptTime)
+	})
+
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	deliveries := make([]model.WebhookDelivery, 0, len(due))
+
+	for _, delivery := range due {
+		delivery.NextAttemptTime = now.Add(lease)
+
+		claimed := *delivery
+		claimed.Url = s.subscriptions[delivery.SubscriptionId].Url
+		claimed.Secret = s.subscriptions[delivery.SubscriptionId].Secret
+
+		deliveries = append(deliveries, claimed)
+	}
+
+	return deliveries, nil
+}
+
+func (r *webhookRepo) SaveAttempt(ctx context.Context, delivery model.WebhookDelivery) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s := r.storage
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved, ok := s.deliveries[delivery.Id]
+	if !ok {
+		return nil
+	}
+
+	saved.Status = delivery.Status
+	saved.Attempts = delivery.Attempts
+	saved.NextAttemptTime = timestamp(delivery.NextAttemptTime)
+	saved.LastAttemptTime = delivery.LastAttemptTime
+	saved.LastStatusCode = delivery.LastStatusCode
+	saved.LastError = copyString(delivery.LastError)
+
+	return nil
+}
+
+// copySubscription копирует подписку, чтобы вызывающий не менял данные хранилища
+func copySubscription(subscription model.WebhookSubscription) model.WebhookSubscription {
+	c := subscription
+
+	c.EventTypes = append([]string(nil), subscription.EventTypes...)
+	c.ServiceId = copyString(subscription.ServiceId)
+
+	return c
+}
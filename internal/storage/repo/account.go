@@ -0,0 +1,84 @@
+package repo
+
+import (
+	"context"
+	"errors"
+
+	"github.com/avito-test/internal/config/tracing"
+	"github.com/avito-test/internal/model"
+	"github.com/avito-test/internal/storage/db"
+	"github.com/jackc/pgx/v4"
+)
+
+// AccountRepo - хранилище статусов счетов пользователей. Статус проверяют функции изменения баланса
+// (account_restriction), репозиторий только читает и задает его
+type AccountRepo interface {
+	// GetAccount возвращает статус счета пользователя, если статус не задавался - nil (счет активен)
+	GetAccount(ctx context.Context, userId string) (*model.Account, error)
+	// SetAccount задает статус счета пользователя
+	SetAccount(ctx context.Context, account model.Account) error
+}
+
+type accountRepo struct {
+	dbClient db.Client
+}
+
+func NewAccountRepo(dbClient db.Client) AccountRepo {
+	return &accountRepo{dbClient: dbClient}
+}
+
+func (a *accountRepo) GetAccount(ctx context.Context, userId string) (*model.Account, error) {
+	ctx, span := tracing.StartDb(ctx, "get_account")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "get_account")
+	defer cancel()
+
+	account := model.Account{UserId: userId}
+
+	if err := a.dbClient.QueryRow(ctx, `
+SELECT a.status, a.reason, a.updated_by, a.update_time
+FROM public.account_status a
+WHERE a.user_id = $1`, userId).Scan(&account.Status, &account.Reason, &account.UpdatedBy, &account.UpdateTime); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	return &account, nil
+}
+
+func (a *accountRepo) SetAccount(ctx context.Context, account model.Account) error {
+	ctx, span := tracing.StartDb(ctx, "set_account")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "set_account")
+	defer cancel()
+
+	err := db.Audited(ctx, a.dbClient, func(client db.Client) error {
+		_, err := client.Exec(ctx, `
+INSERT INTO public.account_status(user_id, status, reason, updated_by, update_time)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (user_id) DO UPDATE SET
+    status = excluded.status,
+    reason = excluded.reason,
+    updated_by = excluded.updated_by,
+    update_time = excluded.update_time`,
+			account.UserId,
+			account.Status,
+			account.Reason,
+			account.UpdatedBy,
+			account.UpdateTime)
+
+		return err
+	})
+	if err != nil {
+		tracing.Error(span, err)
+		return err
+	}
+
+	return nil
+}
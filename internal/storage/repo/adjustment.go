@@ -0,0 +1,242 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/avito-test/internal/config/tracing"
+	"github.com/avito-test/internal/model"
+	"github.com/avito-test/internal/storage/db"
+	"github.com/jackc/pgx/v4"
+)
+
+// AdjustmentRepo - хранилище ручных корректировок баланса
+type AdjustmentRepo interface {
+	// CreateAdjustment добавляет предложенную корректировку, id и время задает сервис
+	CreateAdjustment(ctx context.Context, adjustment model.Adjustment) error
+	// GetAdjustment возвращает корректировку по id, если не найдена - nil
+	GetAdjustment(ctx context.Context, id string) (*model.Adjustment, error)
+	// LockAdjustment возвращает корректировку по id и блокирует ее до конца транзакции, чтобы решение по ней
+	// принималось один раз. Если не найдена - nil
+	LockAdjustment(ctx context.Context, id string) (*model.Adjustment, error)
+	// GetAdjustments возвращает последние limit корректировок, новые первыми. userId и status - необязательные фильтры,
+	// ожидающие решения возвращаются старыми первыми, в порядке очереди
+	GetAdjustments(ctx context.Context, userId *string, status *model.AdjustmentStatus, limit int) ([]model.Adjustment, error)
+	// SaveDecision записывает решение по корректировке: статус, кто и когда решил, комментарий и транзакцию корректировки
+	SaveDecision(ctx context.Context, adjustment model.Adjustment) error
+	// PostAdjustment проводит корректировку транзакцией с id и временем операции, статусы как у save_transaction:
+	// TransactionStatusOk, TransactionStatusInsufficientFunds, TransactionStatusBalanceNotFound, TransactionStatusAccountFrozen,
+	// TransactionStatusAccountClosed
+	PostAdjustment(ctx context.Context, operation model.Operation, adjustment model.Adjustment, comment string) (model.TransactionStatus, error)
+}
+
+type adjustmentRepo struct {
+	dbClient db.Client
+}
+
+func NewAdjustmentRepo(dbClient db.Client) AdjustmentRepo {
+	return &adjustmentRepo{dbClient: dbClient}
+}
+
+const selectAdjustment = `
+SELECT a.id, a.user_id, a.direction, a.sum, a.reason, a.ticket, a.status, a.proposed_by, a.propose_time,
+    a.decided_by, a.decision_time, a.decision_comment, a.transaction_id
+FROM public.adjustment a`
+
+func (a *adjustmentRepo) CreateAdjustment(ctx context.Context, adjustment model.Adjustment) error {
+	ctx, span := tracing.StartDb(ctx, "create_adjustment")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "create_adjustment")
+	defer cancel()
+
+	err := db.Audited(ctx, a.dbClient, func(client db.Client) error {
+		_, err := client.Exec(ctx, `
+INSERT INTO public.adjustment(id, user_id, direction, sum, reason, ticket, status, proposed_by, propose_time)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+			adjustment.Id,
+			adjustment.UserId,
+			adjustment.Direction,
+			adjustment.Sum,
+			adjustment.Reason,
+			adjustment.Ticket,
+			adjustment.Status,
+			adjustment.ProposedBy,
+			adjustment.ProposeTime)
+
+		return err
+	})
+	if err != nil {
+		tracing.Error(span, err)
+		return err
+	}
+
+	return nil
+}
+
+func (a *adjustmentRepo) GetAdjustment(ctx context.Context, id string) (*model.Adjustment, error) {
+	ctx, span := tracing.StartDb(ctx, "get_adjustment")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "get_adjustment")
+	defer cancel()
+
+	adjustment, err := scanAdjustment(a.dbClient.QueryRow(ctx, selectAdjustment+`
+WHERE a.id = $1`, id))
+	if err != nil {
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	return adjustment, nil
+}
+
+func (a *adjustmentRepo) LockAdjustment(ctx context.Context, id string) (*model.Adjustment, error) {
+	ctx, span := tracing.StartDb(ctx, "lock_adjustment")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "lock_adjustment")
+	defer cancel()
+
+	adjustment, err := scanAdjustment(a.dbClient.QueryRow(ctx, selectAdjustment+`
+WHERE a.id = $1
+FOR UPDATE`, id))
+	if err != nil {
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	return adjustment, nil
+}
+
+func (a *adjustmentRepo) GetAdjustments(ctx context.Context, userId *string, status *model.AdjustmentStatus, limit int) ([]model.Adjustment, error) {
+	ctx, span := tracing.StartDb(ctx, "get_adjustments")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "get_adjustments")
+	defer cancel()
+
+	order := "DESC"
+	if status != nil && *status == model.AdjustmentPending {
+		order = "ASC"
+	}
+
+	rows, err := a.dbClient.Query(ctx, selectAdjustment+`
+WHERE ($1::uuid IS NULL OR a.user_id = $1) AND ($2::varchar IS NULL OR a.status = $2)
+ORDER BY a.propose_time `+order+`, a.id `+order+`
+LIMIT $3`, userId, status, limit)
+	if err != nil {
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	adjustments := make([]model.Adjustment, 0)
+
+	for rows.Next() {
+		adjustment, err := scanAdjustment(rows)
+		if err != nil {
+			tracing.Error(span, err)
+			return nil, err
+		}
+
+		adjustments = append(adjustments, *adjustment)
+	}
+
+	if err = rows.Err(); err != nil {
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	return adjustments, nil
+}
+
+func (a *adjustmentRepo) SaveDecision(ctx context.Context, adjustment model.Adjustment) error {
+	ctx, span := tracing.StartDb(ctx, "save_adjustment_decision")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "save_adjustment_decision")
+	defer cancel()
+
+	err := db.Audited(ctx, a.dbClient, func(client db.Client) error {
+		_, err := client.Exec(ctx, `
+UPDATE public.adjustment SET
+    status = $2,
+    decided_by = $3,
+    decision_time = $4,
+    decision_comment = $5,
+    transaction_id = $6
+WHERE id = $1`,
+			adjustment.Id,
+			adjustment.Status,
+			adjustment.DecidedBy,
+			adjustment.DecisionTime,
+			adjustment.DecisionComment,
+			adjustment.TransactionId)
+
+		return err
+	})
+	if err != nil {
+		tracing.Error(span, err)
+		return err
+	}
+
+	return nil
+}
+
+func (a *adjustmentRepo) PostAdjustment(ctx context.Context, operation model.Operation, adjustment model.Adjustment, comment string) (model.TransactionStatus, error) {
+	ctx, span := tracing.StartDb(ctx, "post_adjustment")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "post_adjustment")
+	defer cancel()
+
+	var status model.TransactionStatus
+
+	err := db.Audited(ctx, a.dbClient, func(client db.Client) error {
+		return client.QueryRow(ctx, "SELECT public.\"post_adjustment\"($1, $2, $3, $4, $5, $6)",
+			adjustment.Id, adjustment.UserId, adjustment.SignedSum(), comment, operation.Id, operation.Time).Scan(&status)
+	})
+	if err != nil {
+		tracing.Error(span, err)
+		return 0, err
+	}
+
+	return status, nil
+}
+
+func scanAdjustment(row pgx.Row) (*model.Adjustment, error) {
+	var adjustment model.Adjustment
+	var decidedBy, decisionComment, transactionId sql.NullString
+	var decisionTime sql.NullTime
+
+	if err := row.Scan(&adjustment.Id, &adjustment.UserId, &adjustment.Direction, &adjustment.Sum, &adjustment.Reason, &adjustment.Ticket,
+		&adjustment.Status, &adjustment.ProposedBy, &adjustment.ProposeTime,
+		&decidedBy, &decisionTime, &decisionComment, &transactionId); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	if decidedBy.Valid {
+		adjustment.DecidedBy = &decidedBy.String
+	}
+
+	if decisionTime.Valid {
+		adjustment.DecisionTime = &decisionTime.Time
+	}
+
+	if decisionComment.Valid {
+		adjustment.DecisionComment = &decisionComment.String
+	}
+
+	if transactionId.Valid {
+		adjustment.TransactionId = &transactionId.String
+	}
+
+	return &adjustment, nil
+}
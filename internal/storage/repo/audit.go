@@ -0,0 +1,215 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/avito-test/internal/config/tracing"
+	"github.com/avito-test/internal/model"
+	"github.com/avito-test/internal/storage/db"
+	"github.com/jackc/pgx/v4"
+)
+
+// auditLockKey - ключ advisory блокировки запечатывания журнала аудита, записи запечатывает только один инстанс сервиса
+const auditLockKey = 7_040_002
+
+// AuditRepo - журнал аудита: записи добавляют триггеры бд, сервис запечатывает их цепочкой хешей и проверяет
+type AuditRepo interface {
+	// TryLock берет advisory блокировку запечатывания до конца транзакции бд, если ее держит другой инстанс - возвращает false
+	TryLock(ctx context.Context) (bool, error)
+	// GetLastSealed возвращает последнюю запечатанную запись, если таких нет - nil
+	GetLastSealed(ctx context.Context) (*model.AuditEntry, error)
+	// GetUnsealed возвращает первые limit незапечатанных записей в порядке добавления
+	GetUnsealed(ctx context.Context, limit int) ([]model.AuditEntry, error)
+	// CountUnsealed возвращает количество незапечатанных записей
+	CountUnsealed(ctx context.Context) (int64, error)
+	// Seal записывает номер, prev_hash и hash записей по их Id, уже запечатанные записи не меняются
+	Seal(ctx context.Context, entries []model.AuditEntry) error
+	// GetAuditEntries возвращает до limit запечатанных записей после записи afterSequence по возрастанию номера
+	GetAuditEntries(ctx context.Context, afterSequence int64, limit int) ([]model.AuditEntry, error)
+}
+
+type auditRepo struct {
+	dbClient db.Client
+}
+
+func NewAuditRepo(dbClient db.Client) AuditRepo {
+	return &auditRepo{dbClient: dbClient}
+}
+
+// before и after читаются текстом бд: хеш считается от него, а не от json после разбора
+const selectAuditEntry = `
+SELECT l.id, l.sequence, l.time, l.actor, l.db_user, l.auth_method, l.request_id, l.source_ip, l.operation, l.entity, l.entity_id, l.action,
+    l.before::text, l.after::text, l.prev_hash, l.hash
+FROM public.audit_log l`
+
+func (a *auditRepo) TryLock(ctx context.Context) (bool, error) {
+	ctx, span := tracing.StartDb(ctx, "lock_audit_log")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "lock_audit_log")
+	defer cancel()
+
+	var locked bool
+
+	if err := a.dbClient.QueryRow(ctx, "SELECT pg_try_advisory_xact_lock($1)", auditLockKey).Scan(&locked); err != nil {
+		tracing.Error(span, err)
+		return false, err
+	}
+
+	return locked, nil
+}
+
+func (a *auditRepo) GetLastSealed(ctx context.Context) (*model.AuditEntry, error) {
+	ctx, span := tracing.StartDb(ctx, "get_last_sealed_audit_entry")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "get_last_sealed_audit_entry")
+	defer cancel()
+
+	entries, err := a.queryEntries(ctx, selectAuditEntry+`
+WHERE l.sequence IS NOT NULL
+ORDER BY l.sequence DESC
+LIMIT 1`)
+	if err != nil {
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	return &entries[0], nil
+}
+
+func (a *auditRepo) GetUnsealed(ctx context.Context, limit int) ([]model.AuditEntry, error) {
+	ctx, span := tracing.StartDb(ctx, "get_unsealed_audit_entries")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "get_unsealed_audit_entries")
+	defer cancel()
+
+	entries, err := a.queryEntries(ctx, selectAuditEntry+`
+WHERE l.hash IS NULL
+ORDER BY l.id
+LIMIT $1`, limit)
+	if err != nil {
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func (a *auditRepo) CountUnsealed(ctx context.Context) (int64, error) {
+	ctx, span := tracing.StartDb(ctx, "count_unsealed_audit_entries")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "count_unsealed_audit_entries")
+	defer cancel()
+
+	var count int64
+
+	if err := a.dbClient.QueryRow(ctx, "SELECT count(*) FROM public.audit_log WHERE hash IS NULL").Scan(&count); err != nil {
+		tracing.Error(span, err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (a *auditRepo) Seal(ctx context.Context, entries []model.AuditEntry) error {
+	ctx, span := tracing.StartDb(ctx, "seal_audit_entries")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "seal_audit_entries")
+	defer cancel()
+
+	ids := make([]int64, 0, len(entries))
+	sequences := make([]int64, 0, len(entries))
+	prevHashes := make([]string, 0, len(entries))
+	hashes := make([]string, 0, len(entries))
+
+	for _, entry := range entries {
+		ids = append(ids, entry.Id)
+		sequences = append(sequences, entry.Sequence)
+		prevHashes = append(prevHashes, entry.PrevHash)
+		hashes = append(hashes, entry.Hash)
+	}
+
+	if _, err := a.dbClient.Exec(ctx, `
+UPDATE public.audit_log l SET
+    sequence = s.sequence,
+    prev_hash = s.prev_hash,
+    hash = s.hash
+FROM unnest($1::bigint[], $2::bigint[], $3::varchar[], $4::varchar[]) AS s(id, sequence, prev_hash, hash)
+WHERE l.id = s.id AND l.hash IS NULL`, ids, sequences, prevHashes, hashes); err != nil {
+		tracing.Error(span, err)
+		return err
+	}
+
+	return nil
+}
+
+func (a *auditRepo) GetAuditEntries(ctx context.Context, afterSequence int64, limit int) ([]model.AuditEntry, error) {
+	ctx, span := tracing.StartDb(ctx, "get_audit_entries")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "get_audit_entries")
+	defer cancel()
+
+	entries, err := a.queryEntries(ctx, selectAuditEntry+`
+WHERE l.sequence > $1
+ORDER BY l.sequence
+LIMIT $2`, afterSequence, limit)
+	if err != nil {
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func (a *auditRepo) queryEntries(ctx context.Context, query string, args ...interface{}) ([]model.AuditEntry, error) {
+	rows, err := a.dbClient.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	entries := make([]model.AuditEntry, 0)
+
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func scanAuditEntry(row pgx.Row) (model.AuditEntry, error) {
+	var entry model.AuditEntry
+	var sequence sql.NullInt64
+	var prevHash, hash sql.NullString
+
+	if err := row.Scan(&entry.Id, &sequence, &entry.Time, &entry.Actor, &entry.DbUser, &entry.AuthMethod, &entry.RequestId, &entry.SourceIp,
+		&entry.Operation, &entry.Entity, &entry.EntityId, &entry.Action, &entry.Before, &entry.After, &prevHash, &hash); err != nil {
+		return model.AuditEntry{}, err
+	}
+
+	entry.Sequence = sequence.Int64
+	entry.PrevHash = prevHash.String
+	entry.Hash = hash.String
+
+	return entry, nil
+}
@@ -4,41 +4,146 @@ import (
 	"context"
 	"errors"
 
+	"github.com/avito-test/internal/config/tracing"
+	"github.com/avito-test/internal/model"
 	"github.com/avito-test/internal/storage/db"
 	"github.com/jackc/pgx/v4"
 )
 
-type BalanceRepo struct {
+// BalanceRepo - хранилище балансов пользователей
+type BalanceRepo interface {
+	// AddBalance пополняет баланс пользователя (создает, если его нет) и записывает транзакцию пополнения
+	// с id и временем операции. Статусы: TransactionStatusOk, TransactionStatusAccountFrozen, TransactionStatusAccountClosed
+	AddBalance(ctx context.Context, operation model.Operation, userId string, sum float64, comment *string) (model.TransactionStatus, error)
+	// WithdrawBalance списывает с баланса пользователя и записывает транзакцию списания, статусы как у save_transaction:
+	// TransactionStatusOk, TransactionStatusInsufficientFunds, TransactionStatusBalanceNotFound, TransactionStatusAccountFrozen,
+	// TransactionStatusAccountClosed
+	WithdrawBalance(ctx context.Context, operation model.Operation, userId string, sum float64, comment *string) (model.TransactionStatus, error)
+	// GetBalanceByUserId возвращает баланс пользователя, если баланса нет - nil
+	GetBalanceByUserId(ctx context.Context, userId string) (*float64, error)
+	// GetBalanceMismatches возвращает балансы, не совпадающие с суммой транзакций пользователя, по возрастанию userId
+	GetBalanceMismatches(ctx context.Context) ([]model.BalanceMismatch, error)
+}
+
+type balanceRepo struct {
 	dbClient db.Client
 }
 
 func NewBalanceRepo(dbClient db.Client) BalanceRepo {
-	return BalanceRepo{dbClient: dbClient}
+	return &balanceRepo{dbClient: dbClient}
+}
+
+func (r *balanceRepo) AddBalance(ctx context.Context, operation model.Operation, userId string, sum float64, comment *string) (model.TransactionStatus, error) {
+	ctx, span := tracing.StartDb(ctx, "add_balance")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "add_balance")
+	defer cancel()
+
+	sql := "SELECT public.\"add_balance\"($1, $2, $3, $4, $5)"
+
+	var status model.TransactionStatus
+
+	err := db.Audited(ctx, r.dbClient, func(client db.Client) error {
+		return client.QueryRow(ctx, sql, userId, sum, comment, operation.Id, operation.Time).Scan(&status)
+	})
+	if err != nil {
+		tracing.Error(span, err)
+		return 0, err
+	}
+
+	return status, nil
 }
 
-func (r *BalanceRepo) AddBalance(userId string, sum float64, comment *string) error {
-	sql := "SELECT public.\"add_balance\"($1, $2, $3)"
+func (r *balanceRepo) WithdrawBalance(ctx context.Context, operation model.Operation, userId string, sum float64, comment *string) (model.TransactionStatus, error) {
+	ctx, span := tracing.StartDb(ctx, "withdraw_balance")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "withdraw_balance")
+	defer cancel()
+
+	sql := "SELECT public.\"withdraw_balance\"($1, $2, $3, $4, $5)"
+
+	var status model.TransactionStatus
 
-	_, err := r.dbClient.Exec(context.TODO(), sql, userId, sum, comment)
+	err := db.Audited(ctx, r.dbClient, func(client db.Client) error {
+		return client.QueryRow(ctx, sql, userId, sum, comment, operation.Id, operation.Time).Scan(&status)
+	})
 	if err != nil {
-		return err
+		tracing.Error(span, err)
+		return 0, err
 	}
 
-	return nil
+	return status, nil
 }
 
-func (r *BalanceRepo) GetBalanceByUserId(userId string) (*float64, error) {
+func (r *balanceRepo) GetBalanceByUserId(ctx context.Context, userId string) (*float64, error) {
+	ctx, span := tracing.StartDb(ctx, "get_balance_by_user_id")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "get_balance_by_user_id")
+	defer cancel()
+
 	sql := "SELECT balance FROM public.balance WHERE user_id = $1"
 
 	var balance *float64
 
-	if err := r.dbClient.QueryRow(context.TODO(), sql, userId).Scan(&balance); err != nil {
+	if err := r.dbClient.QueryRow(ctx, sql, userId).Scan(&balance); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, nil
 		}
 
+		tracing.Error(span, err)
 		return nil, err
 	}
 
 	return balance, nil
 }
+
+func (r *balanceRepo) GetBalanceMismatches(ctx context.Context) ([]model.BalanceMismatch, error) {
+	ctx, span := tracing.StartDb(ctx, "get_balance_mismatches")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "get_balance_mismatches")
+	defer cancel()
+
+	// сумма транзакции хранится с 4 знаками, поэтому баланс сравнивается с той же точностью
+	sql := `
+SELECT COALESCE(b.user_id, t.user_id), COALESCE(b.balance, 0), COALESCE(t.expected, 0)
+FROM public.balance b
+FULL JOIN (
+    SELECT user_id, SUM(CASE transaction_type_id WHEN 4 THEN sum WHEN 6 THEN sum WHEN 3 THEN 0 ELSE -sum END) AS expected
+    FROM public.transaction
+    GROUP BY user_id
+) t ON t.user_id = b.user_id
+WHERE ROUND(COALESCE(b.balance, 0), 4) <> COALESCE(t.expected, 0)
+ORDER BY 1`
+
+	rows, err := r.dbClient.Query(ctx, sql)
+	if err != nil {
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	mismatches := make([]model.BalanceMismatch, 0)
+
+	for rows.Next() {
+		var mismatch model.BalanceMismatch
+
+		if err := rows.Scan(&mismatch.UserId, &mismatch.Balance, &mismatch.Expected); err != nil {
+			tracing.Error(span, err)
+			return nil, err
+		}
+
+		mismatches = append(mismatches, mismatch)
+	}
+
+	if err := rows.Err(); err != nil {
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	return mismatches, nil
+}
@@ -0,0 +1,1091 @@
+package repo_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/avito-test/internal/config/clock"
+	"github.com/avito-test/internal/model"
+	"github.com/avito-test/internal/storage/db"
+	"github.com/avito-test/internal/storage/memory"
+	"github.com/avito-test/internal/storage/repo"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Контрактные тесты репозиториев: одни и те же проверки выполняются для хранилища в памяти и для Postgres.
+// Postgres проверяется, если задан TEST_DATABASE_URL (бд с примененным init_db.sql в часовом поясе UTC).
+// Каждый тест работает со своими случайными пользователями, заказами и услугами, поэтому бд не очищается
+
+type storage struct {
+	balance     repo.BalanceRepo
+	transaction repo.TransactionRepo
+	report      repo.ReportRepo
+	account     repo.AccountRepo
+	limit       repo.LimitRepo
+	outbox      repo.OutboxRepo
+}
+
+func forEachStorage(t *testing.T, test func(t *testing.T, s storage)) {
+	t.Run("memory", func(t *testing.T) {
+		s := memory.NewStorage()
+
+		test(t, storage{
+			balance:     memory.NewBalanceRepo(s),
+			transaction: memory.NewTransactionRepo(s),
+			report:      memory.NewReportRepo(s),
+			account:     memory.NewAccountRepo(s),
+			limit:       memory.NewLimitRepo(s),
+			outbox:      memory.NewOutboxRepo(s, clock.Real{}),
+		})
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		pool := connectPostgres(t)
+
+		test(t, storage{
+			balance:     repo.NewBalanceRepo(pool),
+			transaction: repo.NewTransactionRepo(pool),
+			report:      repo.NewReportRepo(pool),
+			account:     repo.NewAccountRepo(pool),
+			limit:       repo.NewLimitRepo(pool),
+			outbox:      repo.NewOutboxRepo(pool),
+		})
+	})
+}
+
+// connectPostgres подключается к TEST_DATABASE_URL, если он не задан - тест пропускается
+func connectPostgres(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	pool, err := pgxpool.Connect(context.Background(), url)
+	if err != nil {
+		t.Fatalf("connect to postgres: %v", err)
+	}
+
+	t.Cleanup(pool.Close)
+
+	return pool
+}
+
+func newId() string {
+	return uuid.New().String()
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestBalanceRepo(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s storage) {
+		ctx := context.Background()
+		userId := newId()
+
+		balance, err := s.balance.GetBalanceByUserId(ctx, userId)
+		if err != nil {
+			t.Fatalf("GetBalanceByUserId: %v", err)
+		}
+
+		if balance != nil {
+			t.Fatalf("balance of unknown user = %v, want nil", *balance)
+		}
+
+		for _, sum := range []float64{100, 50.5} {
+			if _, err := s.balance.AddBalance(ctx, operation(), userId, sum, ptr("top-up")); err != nil {
+				t.Fatalf("AddBalance: %v", err)
+			}
+		}
+
+		assertBalance(t, s, userId, ptr(150.5))
+
+		deposits, err := s.transaction.CountTransactionsByUserId(ctx, userId, model.TransactionFilter{TransactionTypeIds: []int{model.TransactionTypeDeposit}})
+		if err != nil {
+			t.Fatalf("CountTransactionsByUserId: %v", err)
+		}
+
+		if deposits != 2 {
+			t.Fatalf("deposit transactions = %d, want 2", deposits)
+		}
+	})
+}
+
+func TestWithdrawBalance(t *testing.T) {
+	tests := []struct {
+		name        string
+		deposit     float64
+		sum         float64
+		want        model.TransactionStatus
+		wantBalance *float64
+	}{
+		{"withdraw", 500, 120, model.TransactionStatusOk, ptr(380.0)},
+		{"withdraw whole balance", 100, 100, model.TransactionStatusOk, ptr(0.0)},
+		{"withdraw more than balance", 50, 100, model.TransactionStatusInsufficientFunds, ptr(50.0)},
+		{"withdraw without balance", 0, 100, model.TransactionStatusBalanceNotFound, nil},
+	}
+
+	forEachStorage(t, func(t *testing.T, s storage) {
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				ctx := context.Background()
+				userId := newId()
+
+				if tt.deposit > 0 {
+					if _, err := s.balance.AddBalance(ctx, operation(), userId, tt.deposit, nil); err != nil {
+						t.Fatalf("AddBalance: %v", err)
+					}
+				}
+
+				status, err := s.balance.WithdrawBalance(ctx, operation(), userId, tt.sum, ptr("correction"))
+				if err != nil {
+					t.Fatalf("WithdrawBalance: %v", err)
+				}
+
+				if status != tt.want {
+					t.Fatalf("status = %d, want %d", status, tt.want)
+				}
+
+				assertBalance(t, s, userId, tt.wantBalance)
+
+				withdrawals := list(t, s, model.GetTransactionsRequest{
+					UserId:   userId,
+					Filter:   model.TransactionFilter{TransactionTypeIds: []int{model.TransactionTypeWithdrawal}},
+					Limit:    10,
+					SortBy:   "date",
+					SortType: "desc",
+				})
+
+				if status == model.TransactionStatusOk && (len(withdrawals) != 1 || withdrawals[0].Sum != tt.sum) {
+					t.Fatalf("withdrawals = %+v, want one of %v", withdrawals, tt.sum)
+				}
+
+				if status != model.TransactionStatusOk && len(withdrawals) != 0 {
+					t.Fatalf("withdrawals = %+v, want none", withdrawals)
+				}
+			})
+		}
+	})
+}
+
+func TestBalanceMismatches(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s storage) {
+		ctx := context.Background()
+		userId := newId()
+
+		if _, err := s.balance.AddBalance(ctx, operation(), userId, 1000, nil); err != nil {
+			t.Fatalf("AddBalance: %v", err)
+		}
+
+		captured, cancelled, reserved := newId(), newId(), newId()
+		orderId := newId()
+
+		saveOk(t, s, orderId, userId, captured, 100, model.TransactionTypeReserve, nil)
+		saveOk(t, s, orderId, userId, captured, 100, model.TransactionTypeCapture, nil)
+		saveOk(t, s, orderId, userId, cancelled, 200, model.TransactionTypeReserve, nil)
+		saveOk(t, s, orderId, userId, cancelled, 200, model.TransactionTypeCancel, nil)
+		saveOk(t, s, orderId, userId, reserved, 300, model.TransactionTypeReserve, nil)
+
+		if status, err := s.balance.WithdrawBalance(ctx, operation(), userId, 50.25, nil); err != nil || status != model.TransactionStatusOk {
+			t.Fatalf("WithdrawBalance = %d, %v", status, err)
+		}
+
+		assertBalance(t, s, userId, ptr(549.75))
+
+		mismatches, err := s.balance.GetBalanceMismatches(ctx)
+		if err != nil {
+			t.Fatalf("GetBalanceMismatches: %v", err)
+		}
+
+		// в общей бд могут быть расхождения других пользователей, проверяем только своего
+		for _, mismatch := range mismatches {
+			if mismatch.UserId == userId {
+				t.Fatalf("mismatch %+v, balance matches transactions", mismatch)
+			}
+		}
+	})
+}
+
+func TestSaveTransactionStatuses(t *testing.T) {
+	const (
+		reserve = model.TransactionTypeReserve
+		capture = model.TransactionTypeCapture
+		cancel  = model.TransactionTypeCancel
+	)
+
+	tests := []struct {
+		name string
+		// deposit - начальный баланс, 0 - баланса нет
+		deposit float64
+		// before - операции с суммой 100 по тому же ключу до проверяемой
+		before          []int
+		transactionType int
+		sum             float64
+		want            model.TransactionStatus
+		wantBalance     *float64
+	}{
+		{"reserve", 500, nil, reserve, 100, model.TransactionStatusOk, ptr(400.0)},
+		{"reserve twice", 500, []int{reserve}, reserve, 100, model.TransactionStatusReservationExists, ptr(400.0)},
+		{"reserve more than balance", 50, nil, reserve, 100, model.TransactionStatusInsufficientFunds, ptr(50.0)},
+		{"reserve whole balance", 100, nil, reserve, 100, model.TransactionStatusOk, ptr(0.0)},
+		{"capture without reservation", 500, nil, capture, 100, model.TransactionStatusCaptureNotFound, ptr(500.0)},
+		{"capture", 500, []int{reserve}, capture, 100, model.TransactionStatusOk, ptr(400.0)},
+		{"capture twice", 500, []int{reserve, capture}, capture, 100, model.TransactionStatusCaptureAlreadyCaptured, ptr(400.0)},
+		{"capture cancelled", 500, []int{reserve, cancel}, capture, 100, model.TransactionStatusCaptureAlreadyCancelled, ptr(500.0)},
+		{"cancel without reservation", 500, nil, cancel, 100, model.TransactionStatusCancelNotFound, ptr(500.0)},
+		{"cancel", 500, []int{reserve}, cancel, 100, model.TransactionStatusOk, ptr(500.0)},
+		{"cancel twice", 500, []int{reserve, cancel}, cancel, 100, model.TransactionStatusCancelAlreadyCancelled, ptr(500.0)},
+		{"cancel captured", 500, []int{reserve, capture}, cancel, 100, model.TransactionStatusCancelAlreadyCaptured, ptr(400.0)},
+		{"reserve without balance", 0, nil, reserve, 100, model.TransactionStatusBalanceNotFound, nil},
+		{"capture without balance", 0, nil, capture, 100, model.TransactionStatusBalanceNotFound, nil},
+	}
+
+	forEachStorage(t, func(t *testing.T, s storage) {
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				ctx := context.Background()
+				userId, orderId, serviceId := newId(), newId(), newId()
+
+				if tt.deposit > 0 {
+					if _, err := s.balance.AddBalance(ctx, operation(), userId, tt.deposit, nil); err != nil {
+						t.Fatalf("AddBalance: %v", err)
+					}
+				}
+
+				for _, transactionType := range tt.before {
+					status, err := s.transaction.SaveTransaction(ctx, operation(), orderId, userId, serviceId, 100, transactionType, nil)
+					if err != nil || status != model.TransactionStatusOk {
+						t.Fatalf("SaveTransaction(%d) = %d, %v", transactionType, status, err)
+					}
+				}
+
+				status, err := s.transaction.SaveTransaction(ctx, operation(), orderId, userId, serviceId, tt.sum, tt.transactionType, ptr("checked"))
+				if err != nil {
+					t.Fatalf("SaveTransaction: %v", err)
+				}
+
+				if status != tt.want {
+					t.Fatalf("status = %d, want %d", status, tt.want)
+				}
+
+				assertBalance(t, s, userId, tt.wantBalance)
+			})
+		}
+	})
+}
+
+// TestConcurrentChanges - из параллельных подтверждений и отмен одной резервации проходит ровно одно:
+// деньги возвращаются не больше одного раза, а прошлое состояние сохраняется один раз
+func TestConcurrentChanges(t *testing.T) {
+	const workers = 8
+
+	tests := []struct {
+		name  string
+		types []int
+	}{
+		{"cancels", []int{model.TransactionTypeCancel}},
+		{"capture and cancels", []int{model.TransactionTypeCapture, model.TransactionTypeCancel}},
+	}
+
+	forEachStorage(t, func(t *testing.T, s storage) {
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				ctx := context.Background()
+				userId, orderId, serviceId := newId(), newId(), newId()
+
+				if _, err := s.balance.AddBalance(ctx, operation(), userId, 500, nil); err != nil {
+					t.Fatalf("AddBalance: %v", err)
+				}
+
+				saveOk(t, s, orderId, userId, serviceId, 100, model.TransactionTypeReserve, nil)
+
+				statuses := make([]model.TransactionStatus, workers)
+				errs := make([]error, workers)
+
+				var wg sync.WaitGroup
+
+				for i := 0; i < workers; i++ {
+					wg.Add(1)
+
+					go func(i int) {
+						defer wg.Done()
+
+						statuses[i], errs[i] = s.transaction.SaveTransaction(ctx, operation(), orderId, userId, serviceId, 100, tt.types[i%len(tt.types)], nil)
+					}(i)
+				}
+
+				wg.Wait()
+
+				ok := 0
+				for i := range statuses {
+					if errs[i] != nil {
+						t.Fatalf("SaveTransaction: %v", errs[i])
+					}
+
+					if statuses[i] == model.TransactionStatusOk {
+						ok++
+					}
+				}
+
+				if ok != 1 {
+					t.Fatalf("statuses = %v, want exactly one ok", statuses)
+				}
+
+				tr, err := s.transaction.GetTransactionByKey(ctx, orderId, userId, serviceId)
+				if err != nil || tr == nil {
+					t.Fatalf("GetTransactionByKey = %v, %v", tr, err)
+				}
+
+				want := 400.0
+				if tr.TransactionTypeId == model.TransactionTypeCancel {
+					want = 500
+				}
+
+				assertBalance(t, s, userId, &want)
+
+				states, err := s.transaction.GetTransactionStates(ctx, []string{tr.Id})
+				if err != nil || len(states[tr.Id]) != 1 {
+					t.Fatalf("GetTransactionStates = %+v, %v, want 1 previous state", states[tr.Id], err)
+				}
+			})
+		}
+	})
+}
+
+func TestTransactionHistory(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s storage) {
+		ctx := context.Background()
+		userId, orderId, serviceId := newId(), newId(), newId()
+
+		if _, err := s.balance.AddBalance(ctx, operation(), userId, 500, nil); err != nil {
+			t.Fatalf("AddBalance: %v", err)
+		}
+
+		saveOk(t, s, orderId, userId, serviceId, 120, model.TransactionTypeReserve, ptr("reserved"))
+		saveOk(t, s, orderId, userId, serviceId, 120, model.TransactionTypeCapture, ptr("captured"))
+
+		tr, err := s.transaction.GetTransactionByKey(ctx, orderId, userId, serviceId)
+		if err != nil || tr == nil {
+			t.Fatalf("GetTransactionByKey = %v, %v", tr, err)
+		}
+
+		if tr.TransactionTypeId != model.TransactionTypeCapture || tr.Sum != 120 || tr.Comment == nil || *tr.Comment != "captured" {
+			t.Fatalf("transaction = %+v, want captured 120 with comment", tr)
+		}
+
+		if tr.TransactionType == "" {
+			t.Fatal("transaction type name is empty")
+		}
+
+		byId, err := s.transaction.GetTransactionById(ctx, tr.Id)
+		if err != nil || byId == nil || byId.Id != tr.Id || byId.TransactionTypeId != tr.TransactionTypeId {
+			t.Fatalf("GetTransactionById = %+v, %v, want %+v", byId, err, tr)
+		}
+
+		missing, err := s.transaction.GetTransactionById(ctx, newId())
+		if err != nil || missing != nil {
+			t.Fatalf("GetTransactionById(unknown) = %+v, %v, want nil", missing, err)
+		}
+
+		byOrder, err := s.transaction.GetTransactionsByOrderId(ctx, orderId)
+		if err != nil || len(byOrder) != 1 || byOrder[0].Id != tr.Id {
+			t.Fatalf("GetTransactionsByOrderId = %+v, %v", byOrder, err)
+		}
+
+		states, err := s.transaction.GetTransactionStates(ctx, []string{tr.Id})
+		if err != nil {
+			t.Fatalf("GetTransactionStates: %v", err)
+		}
+
+		history := states[tr.Id]
+		if len(history) != 1 {
+			t.Fatalf("states = %+v, want 1 previous state", history)
+		}
+
+		if history[0].TransactionTypeId != model.TransactionTypeReserve || history[0].Comment == nil || *history[0].Comment != "reserved" {
+			t.Fatalf("previous state = %+v, want reservation", history[0])
+		}
+
+		if history[0].UpdTime.After(tr.UpdTime) {
+			t.Fatalf("previous state time %v is after current %v", history[0].UpdTime, tr.UpdTime)
+		}
+	})
+}
+
+func TestTransactionList(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s storage) {
+		ctx := context.Background()
+		userId, serviceId, orderId := newId(), newId(), newId()
+
+		for i, sum := range []float64{40, 10, 30, 10, 50} {
+			if _, err := s.balance.AddBalance(ctx, operation(), userId, sum, ptr([]string{"Top-up", "bonus", "TOP-UP 100%", "refund", "top_up"}[i])); err != nil {
+				t.Fatalf("AddBalance: %v", err)
+			}
+		}
+
+		saveOk(t, s, orderId, userId, serviceId, 25, model.TransactionTypeReserve, nil)
+		saveOk(t, s, newId(), userId, newId(), 15, model.TransactionTypeReserve, nil)
+
+		// транзакция другого пользователя не должна попадать в выборку
+		otherUser := newId()
+		if _, err := s.balance.AddBalance(ctx, operation(), otherUser, 1000, nil); err != nil {
+			t.Fatalf("AddBalance: %v", err)
+		}
+
+		const total = 7
+
+		for _, sortBy := range []string{"date", "sum"} {
+			for _, sortType := range []string{"asc", "desc"} {
+				t.Run(sortBy+" "+sortType, func(t *testing.T) {
+					request := model.GetTransactionsRequest{UserId: userId, SortBy: sortBy, SortType: sortType, Limit: 100}
+
+					all := list(t, s, request)
+					if len(all) != total {
+						t.Fatalf("transactions = %d, want %d", len(all), total)
+					}
+
+					if !sort.SliceIsSorted(all, func(i, j int) bool { return less(all[i], all[j], sortBy, sortType) }) {
+						t.Fatalf("transactions are not sorted by %s %s and id: %+v", sortBy, sortType, all)
+					}
+
+					// постраничная выборка по курсору и по offset возвращает тот же список
+					var byCursor, byOffset []model.Transaction
+
+					page := request
+					page.Limit = 3
+
+					for {
+						transactions := list(t, s, page)
+						byCursor = append(byCursor, transactions...)
+
+						if len(transactions) < page.Limit {
+							break
+						}
+
+						last := transactions[len(transactions)-1]
+						page.Cursor = &model.TransactionCursor{SortBy: sortBy, SortType: sortType, UpdTime: last.UpdTime, Sum: last.Sum, Id: last.Id}
+					}
+
+					page = request
+					page.Limit = 3
+
+					for page.Offset = 0; page.Offset < total+page.Limit; page.Offset += page.Limit {
+						byOffset = append(byOffset, list(t, s, page)...)
+					}
+
+					assertSameOrder(t, "cursor", byCursor, all)
+					assertSameOrder(t, "offset", byOffset, all)
+				})
+			}
+		}
+
+		hourAgo := time.Now().UTC().Add(-time.Hour)
+		inHour := time.Now().UTC().Add(time.Hour)
+
+		filters := []struct {
+			name   string
+			filter model.TransactionFilter
+			want   int
+		}{
+			{"no filter", model.TransactionFilter{}, 7},
+			{"deposits", model.TransactionFilter{TransactionTypeIds: []int{model.TransactionTypeDeposit}}, 5},
+			{"reservations and captures", model.TransactionFilter{TransactionTypeIds: []int{model.TransactionTypeReserve, model.TransactionTypeCapture}}, 2},
+			{"sum range", model.TransactionFilter{SumFrom: ptr(15.0), SumTo: ptr(40.0)}, 4},
+			{"service", model.TransactionFilter{ServiceId: &serviceId}, 1},
+			{"order", model.TransactionFilter{OrderId: &orderId}, 1},
+			{"comment is case insensitive", model.TransactionFilter{Comment: ptr("top-up")}, 2},
+			{"comment escapes wildcards", model.TransactionFilter{Comment: ptr("_")}, 1},
+			{"comment percent", model.TransactionFilter{Comment: ptr("100%")}, 1},
+			{"date range", model.TransactionFilter{DateFrom: &hourAgo, DateTo: &inHour}, 7},
+			{"date in future", model.TransactionFilter{DateFrom: &inHour}, 0},
+		}
+
+		for _, tt := range filters {
+			t.Run(tt.name, func(t *testing.T) {
+				count, err := s.transaction.CountTransactionsByUserId(ctx, userId, tt.filter)
+				if err != nil {
+					t.Fatalf("CountTransactionsByUserId: %v", err)
+				}
+
+				transactions := list(t, s, model.GetTransactionsRequest{UserId: userId, Filter: tt.filter, SortBy: "date", SortType: "desc", Limit: 100})
+
+				if count != tt.want || len(transactions) != tt.want {
+					t.Fatalf("count = %d, transactions = %d, want %d", count, len(transactions), tt.want)
+				}
+			})
+		}
+	})
+}
+
+func TestReportRows(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s storage) {
+		ctx := context.Background()
+		userId, captured, reserved := newId(), newId(), newId()
+
+		if _, err := s.balance.AddBalance(ctx, operation(), userId, 1000, nil); err != nil {
+			t.Fatalf("AddBalance: %v", err)
+		}
+
+		for _, sum := range []float64{100, 50.25} {
+			orderId := newId()
+			saveOk(t, s, orderId, userId, captured, sum, model.TransactionTypeReserve, nil)
+			saveOk(t, s, orderId, userId, captured, sum, model.TransactionTypeCapture, nil)
+		}
+
+		saveOk(t, s, newId(), userId, reserved, 70, model.TransactionTypeReserve, nil)
+
+		now := time.Now().UTC()
+		month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+		rows, err := s.report.GetReportRows(ctx, month)
+		if err != nil {
+			t.Fatalf("GetReportRows: %v", err)
+		}
+
+		totals := make(map[string]float64)
+		for _, row := range rows {
+			totals[row.ServiceName] = row.TotalSum
+		}
+
+		if totals[captured] != 150.25 {
+			t.Fatalf("captured service total = %v, want 150.25", totals[captured])
+		}
+
+		if _, ok := totals[reserved]; ok {
+			t.Fatal("service without captures is in report")
+		}
+
+		rows, err = s.report.GetReportRows(ctx, month.AddDate(0, -1, 0))
+		if err != nil {
+			t.Fatalf("GetReportRows: %v", err)
+		}
+
+		for _, row := range rows {
+			if row.ServiceName == captured {
+				t.Fatal("captures of this month are in previous month report")
+			}
+		}
+	})
+}
+
+func TestAccountRestrictions(t *testing.T) {
+	const (
+		frozen = model.TransactionStatusAccountFrozen
+		closed = model.TransactionStatusAccountClosed
+		ok     = model.TransactionStatusOk
+	)
+
+	tests := []struct {
+		status  model.AccountStatus
+		deposit model.TransactionStatus
+		reserve model.TransactionStatus
+		capture model.TransactionStatus
+		// withdraw - списание, дебетовая корректировка проверяется тем же account_restriction
+		withdraw model.TransactionStatus
+	}{
+		{model.AccountActive, ok, ok, ok, ok},
+		{model.AccountFrozenDebit, ok, frozen, ok, frozen},
+		{model.AccountFrozenAll, frozen, frozen, frozen, frozen},
+		{model.AccountClosed, closed, closed, closed, closed},
+	}
+
+	forEachStorage(t, func(t *testing.T, s storage) {
+		for _, tt := range tests {
+			t.Run(string(tt.status), func(t *testing.T) {
+				ctx := context.Background()
+				userId, orderId, serviceId := newId(), newId(), newId()
+
+				if _, err := s.balance.AddBalance(ctx, operation(), userId, 500, nil); err != nil {
+					t.Fatalf("AddBalance: %v", err)
+				}
+
+				saveOk(t, s, orderId, userId, serviceId, 100, model.TransactionTypeReserve, nil)
+
+				account := model.Account{UserId: userId, Status: tt.status, Reason: "fraud check", UpdatedBy: "risk-carol", UpdateTime: time.Now().UTC()}
+				if err := s.account.SetAccount(ctx, account); err != nil {
+					t.Fatalf("SetAccount: %v", err)
+				}
+
+				got, err := s.account.GetAccount(ctx, userId)
+				if err != nil || got == nil || got.Status != tt.status || got.Reason != account.Reason || got.UpdatedBy != account.UpdatedBy {
+					t.Fatalf("GetAccount = %+v, %v, want %+v", got, err, account)
+				}
+
+				if status, err := s.balance.AddBalance(ctx, operation(), userId, 50, nil); err != nil || status != tt.deposit {
+					t.Fatalf("AddBalance = %d, %v, want %d", status, err, tt.deposit)
+				}
+
+				if status, err := s.transaction.SaveTransaction(ctx, operation(), newId(), userId, serviceId, 10, model.TransactionTypeReserve, nil); err != nil || status != tt.reserve {
+					t.Fatalf("reserve = %d, %v, want %d", status, err, tt.reserve)
+				}
+
+				if status, err := s.transaction.SaveTransaction(ctx, operation(), orderId, userId, serviceId, 100, model.TransactionTypeCapture, nil); err != nil || status != tt.capture {
+					t.Fatalf("capture = %d, %v, want %d", status, err, tt.capture)
+				}
+
+				if status, err := s.balance.WithdrawBalance(ctx, operation(), userId, 10, nil); err != nil || status != tt.withdraw {
+					t.Fatalf("WithdrawBalance = %d, %v, want %d", status, err, tt.withdraw)
+				}
+			})
+		}
+
+		t.Run("unset", func(t *testing.T) {
+			account, err := s.account.GetAccount(context.Background(), newId())
+			if err != nil || account != nil {
+				t.Fatalf("GetAccount = %+v, %v, want nil", account, err)
+			}
+		})
+	})
+}
+
+// TestLimits проверяет лимиты пользователя и его уровня. Глобальные лимиты не задаются: бд общая для всех тестов
+func TestLimits(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s storage) {
+		ctx := context.Background()
+		userId, orderId, serviceId := newId(), newId(), newId()
+		tier := "tier-" + newId()
+		from := time.Now().UTC().Add(-time.Hour)
+
+		setRule := func(scope model.LimitScope, scopeId string, operation model.LimitOperation, period model.LimitPeriod, amount float64) model.LimitRule {
+			t.Helper()
+
+			rule := model.LimitRule{
+				Scope: scope, ScopeId: scopeId, Operation: operation, Period: period, Amount: amount,
+				UpdatedBy: "risk-carol", UpdateTime: time.Now().UTC(),
+			}
+
+			if err := s.limit.SetLimitRule(ctx, rule); err != nil {
+				t.Fatalf("SetLimitRule: %v", err)
+			}
+
+			return rule
+		}
+
+		deposit := func(sum float64, want model.TransactionStatus) {
+			t.Helper()
+
+			if status, err := s.balance.AddBalance(ctx, operation(), userId, sum, nil); err != nil || status != want {
+				t.Fatalf("AddBalance(%v) = %d, %v, want %d", sum, status, err, want)
+			}
+		}
+
+		if got, err := s.limit.GetUserTier(ctx, userId); err != nil || got != nil {
+			t.Fatalf("GetUserTier = %+v, %v, want nil", got, err)
+		}
+
+		if err := s.limit.SetUserTier(ctx, model.UserTier{UserId: userId, Tier: tier, UpdatedBy: "risk-carol", UpdateTime: time.Now().UTC()}); err != nil {
+			t.Fatalf("SetUserTier: %v", err)
+		}
+
+		if got, err := s.limit.GetUserTier(ctx, userId); err != nil || got == nil || got.Tier != tier {
+			t.Fatalf("GetUserTier = %+v, %v, want %s", got, err, tier)
+		}
+
+		setRule(model.LimitTier, tier, model.LimitDeposit, model.LimitDaily, 300)
+		setRule(model.LimitUser, userId, model.LimitDeposit, model.LimitPerTransaction, 200)
+
+		deposit(250, model.TransactionStatusTransactionLimitExceeded)
+		deposit(200, model.TransactionStatusOk)
+		deposit(150, model.TransactionStatusDailyLimitExceeded)
+		deposit(100, model.TransactionStatusOk)
+		assertBalance(t, s, userId, ptr(300.0))
+
+		// лимит пользователя важнее лимита уровня
+		userDaily := setRule(model.LimitUser, userId, model.LimitDeposit, model.LimitDaily, 1000)
+		deposit(150, model.TransactionStatusOk)
+
+		// отмененная резервация не расходует лимит
+		setRule(model.LimitUser, userId, model.LimitReserve, model.LimitDaily, 100)
+		saveOk(t, s, orderId, userId, serviceId, 80, model.TransactionTypeReserve, nil)
+
+		if status, err := s.transaction.SaveTransaction(ctx, operation(), newId(), userId, serviceId, 30, model.TransactionTypeReserve, nil); err != nil || status != model.TransactionStatusDailyLimitExceeded {
+			t.Fatalf("reserve = %d, %v, want %d", status, err, model.TransactionStatusDailyLimitExceeded)
+		}
+
+		saveOk(t, s, orderId, userId, serviceId, 80, model.TransactionTypeCancel, nil)
+		saveOk(t, s, newId(), userId, serviceId, 30, model.TransactionTypeReserve, nil)
+
+		setRule(model.LimitUser, userId, model.LimitWithdraw, model.LimitMonthly, 50)
+
+		if status, err := s.balance.WithdrawBalance(ctx, operation(), userId, 60, nil); err != nil || status != model.TransactionStatusMonthlyLimitExceeded {
+			t.Fatalf("WithdrawBalance = %d, %v, want %d", status, err, model.TransactionStatusMonthlyLimitExceeded)
+		}
+
+		assertBalance(t, s, userId, ptr(420.0))
+
+		to := time.Now().UTC().Add(time.Hour)
+
+		for operation, want := range map[model.LimitOperation]float64{model.LimitDeposit: 450, model.LimitReserve: 30, model.LimitWithdraw: 0} {
+			if used, err := s.limit.GetLimitUsage(ctx, userId, operation, from, to); err != nil || used != want {
+				t.Fatalf("GetLimitUsage(%s) = %v, %v, want %v", operation, used, err, want)
+			}
+		}
+
+		effective := func() []string {
+			t.Helper()
+
+			rules, err := s.limit.GetEffectiveLimits(ctx, userId)
+			if err != nil {
+				t.Fatalf("GetEffectiveLimits: %v", err)
+			}
+
+			keys := make([]string, 0, len(rules))
+			for _, rule := range rules {
+				keys = append(keys, fmt.Sprintf("%s/%s/%s/%v", rule.Operation, rule.Period, rule.Scope, rule.Amount))
+			}
+
+			return keys
+		}
+
+		want := []string{"deposit/transaction/user/200", "deposit/day/user/1000", "reserve/day/user/100", "withdraw/month/user/50"}
+		if got := effective(); !reflect.DeepEqual(got, want) {
+			t.Fatalf("GetEffectiveLimits = %v, want %v", got, want)
+		}
+
+		if deleted, err := s.limit.DeleteLimitRule(ctx, userDaily); err != nil || !deleted {
+			t.Fatalf("DeleteLimitRule = %v, %v, want true", deleted, err)
+		}
+
+		if deleted, err := s.limit.DeleteLimitRule(ctx, userDaily); err != nil || deleted {
+			t.Fatalf("second DeleteLimitRule = %v, %v, want false", deleted, err)
+		}
+
+		want[1] = "deposit/day/tier/300"
+		if got := effective(); !reflect.DeepEqual(got, want) {
+			t.Fatalf("GetEffectiveLimits after delete = %v, want %v", got, want)
+		}
+
+		rules, err := s.limit.GetLimitRules(ctx)
+		if err != nil {
+			t.Fatalf("GetLimitRules: %v", err)
+		}
+
+		var own int
+		for _, rule := range rules {
+			if rule.ScopeId == userId || rule.ScopeId == tier {
+				own++
+			}
+		}
+
+		if own != 4 {
+			t.Fatalf("GetLimitRules returned %d rules of the user and tier, want 4", own)
+		}
+	})
+}
+
+// TestOutboxRepo - операции с балансом добавляют события пользователя по порядку, опубликованные события
+// не возвращаются relay повторно
+func TestOutboxRepo(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s storage) {
+		ctx := context.Background()
+		userId := newId()
+
+		if sequence, err := s.outbox.GetLastUserSequence(ctx, userId); err != nil || sequence != 0 {
+			t.Fatalf("GetLastUserSequence of unknown user = %d, %v, want 0", sequence, err)
+		}
+
+		deposit, withdrawal := operation(), operation()
+
+		if _, err := s.balance.AddBalance(ctx, deposit, userId, 100, nil); err != nil {
+			t.Fatalf("AddBalance: %v", err)
+		}
+
+		if _, err := s.balance.WithdrawBalance(ctx, withdrawal, userId, 30, nil); err != nil {
+			t.Fatalf("WithdrawBalance: %v", err)
+		}
+
+		events, err := s.outbox.GetUserEvents(ctx, userId, 0, 10)
+		if err != nil {
+			t.Fatalf("GetUserEvents: %v", err)
+		}
+
+		if len(events) != 2 || events[0].Id != deposit.Id || events[0].Type != "deposit" || events[1].Id != withdrawal.Id || events[1].Type != "withdrawal" ||
+			events[0].Sequence >= events[1].Sequence || !events[0].CreateTime.Equal(deposit.Time) {
+			t.Fatalf("events = %+v, want deposit and withdrawal", events)
+		}
+
+		if sequence, err := s.outbox.GetLastUserSequence(ctx, userId); err != nil || sequence != events[1].Sequence {
+			t.Fatalf("GetLastUserSequence = %d, %v, want %d", sequence, err, events[1].Sequence)
+		}
+
+		if after, err := s.outbox.GetUserEvents(ctx, userId, events[0].Sequence, 10); err != nil || len(after) != 1 || after[0].Id != withdrawal.Id {
+			t.Fatalf("GetUserEvents after deposit = %+v, %v, want withdrawal", after, err)
+		}
+
+		if err := s.outbox.MarkPublished(ctx, []int64{events[0].Sequence, events[1].Sequence}); err != nil {
+			t.Fatalf("MarkPublished: %v", err)
+		}
+
+		unpublished, err := s.outbox.GetUnpublished(ctx, 100_000)
+		if err != nil {
+			t.Fatalf("GetUnpublished: %v", err)
+		}
+
+		for _, event := range unpublished {
+			if event.UserId == userId {
+				t.Fatalf("published event %+v is unpublished", event)
+			}
+		}
+
+		// события пользователя остаются доступны потоку баланса, пока не истек срок хранения
+		if after, err := s.outbox.GetUserEvents(ctx, userId, 0, 10); err != nil || len(after) != 2 {
+			t.Fatalf("GetUserEvents after publish = %+v, %v, want 2 events", after, err)
+		}
+	})
+}
+
+// TestAuditLog - журнал аудита ведут триггеры бд, поэтому он проверяется только на Postgres: изменение баланса пишет
+// незапечатанные записи с контекстом вызова, Seal задает им номер и хеши, после чего записи нельзя изменить или удалить
+func TestAuditLog(t *testing.T) {
+	key := []byte("audit-key")
+
+	pool := connectPostgres(t)
+
+	balance := repo.NewBalanceRepo(pool)
+	audit := repo.NewAuditRepo(pool)
+	transactor := repo.NewTransactor(pool)
+
+	ctx := context.Background()
+	userId := newId()
+	requestId := newId()
+
+	var dbUser string
+	if err := pool.QueryRow(ctx, "SELECT session_user").Scan(&dbUser); err != nil {
+		t.Fatalf("session_user: %v", err)
+	}
+
+	auditCtx := db.WithAudit(ctx, db.Audit{Actor: "operator", AuthMethod: "cli", RequestId: requestId, SourceIp: "10.0.0.1", Operation: "add_balance"})
+
+	if _, err := balance.AddBalance(auditCtx, operation(), userId, 100, ptr("ticket: «возврат»")); err != nil {
+		t.Fatalf("AddBalance: %v", err)
+	}
+
+	unsealed, err := audit.GetUnsealed(ctx, 100_000)
+	if err != nil {
+		t.Fatalf("GetUnsealed: %v", err)
+	}
+
+	var own []model.AuditEntry
+
+	for _, entry := range unsealed {
+		if entry.RequestId == requestId {
+			own = append(own, entry)
+		}
+	}
+
+	// строка баланса и транзакция пополнения
+	if len(own) != 2 {
+		t.Fatalf("unsealed entries of request = %+v, want 2", own)
+	}
+
+	for _, entry := range own {
+		if entry.Actor != "operator" || entry.DbUser != dbUser || entry.AuthMethod != "cli" || entry.SourceIp != "10.0.0.1" || entry.Operation != "add_balance" ||
+			entry.Action != "insert" || entry.Before != nil || entry.After == nil || entry.Sequence != 0 || entry.Hash != "" {
+			t.Fatalf("entry = %+v, want unsealed insert by operator", entry)
+		}
+	}
+
+	// содержимое незапечатанной записи тоже нельзя изменить, только запечатать
+	if _, err := pool.Exec(ctx, "UPDATE public.audit_log SET actor = 'other' WHERE id = $1", own[0].Id); err == nil {
+		t.Fatal("unsealed audit_log entry updated, want append-only")
+	}
+
+	var last int64
+
+	err = transactor.InTx(ctx, func(repos repo.Repos) error {
+		if locked, err := repos.Audit.TryLock(ctx); err != nil || !locked {
+			return fmt.Errorf("TryLock = %v, %v", locked, err)
+		}
+
+		previous, err := repos.Audit.GetLastSealed(ctx)
+		if err != nil {
+			return err
+		}
+
+		var prevHash string
+		if previous != nil {
+			last, prevHash = previous.Sequence, previous.Hash
+		}
+
+		for i := range unsealed {
+			unsealed[i].Sequence = last + int64(i) + 1
+			unsealed[i].PrevHash = prevHash
+			unsealed[i].Hash = unsealed[i].ComputeHash(key)
+			prevHash = unsealed[i].Hash
+		}
+
+		return repos.Audit.Seal(ctx, unsealed)
+	})
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+
+	entries, err := audit.GetAuditEntries(ctx, last, 100_000)
+	if err != nil {
+		t.Fatalf("GetAuditEntries: %v", err)
+	}
+
+	// хеш считается от текста бд, поэтому совпадает с пересчитанным по прочитанной записи
+	if !reflect.DeepEqual(entries[:len(unsealed)], unsealed) {
+		t.Fatalf("sealed entries = %+v, want %+v", entries, unsealed)
+	}
+
+	for _, entry := range entries {
+		if got := entry.ComputeHash(key); got != entry.Hash {
+			t.Fatalf("entry %d hash = %s, computed %s", entry.Sequence, entry.Hash, got)
+		}
+	}
+
+	if _, err := pool.Exec(ctx, "UPDATE public.audit_log SET hash = 'forged' WHERE id = $1", own[0].Id); err == nil {
+		t.Fatal("sealed audit_log entry updated, want append-only")
+	}
+
+	if _, err := pool.Exec(ctx, "DELETE FROM public.audit_log WHERE id = $1", own[0].Id); err == nil {
+		t.Fatal("audit_log entry deleted, want append-only")
+	}
+}
+
+// TestAuditLockOrder - транзакции с операциями нескольких пользователей в разном порядке (как атомарные пакеты)
+// завершаются: запись в журнал аудита не берет общей блокировки, а взаимоблокировки строк балансов повторяются
+func TestAuditLockOrder(t *testing.T) {
+	const workers = 8
+
+	pool := connectPostgres(t)
+
+	balance := repo.NewBalanceRepo(pool)
+	transactor := repo.NewTransactor(pool)
+
+	ctx := db.WithAudit(context.Background(), db.Audit{Actor: "operator", AuthMethod: "cli", RequestId: newId(), SourceIp: "10.0.0.1", Operation: "batch_operation"})
+	users := []string{newId(), newId()}
+
+	for _, userId := range users {
+		if _, err := balance.AddBalance(ctx, operation(), userId, 100, nil); err != nil {
+			t.Fatalf("AddBalance: %v", err)
+		}
+	}
+
+	errs := make([]error, workers)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			errs[i] = transactor.InTx(ctx, func(repos repo.Repos) error {
+				for _, userId := range []string{users[i%2], users[(i+1)%2]} {
+					status, err := repos.Balance.AddBalance(ctx, operation(), userId, 10, nil)
+					if err != nil {
+						return err
+					}
+
+					if status != model.TransactionStatusOk {
+						return fmt.Errorf("AddBalance status %d", status)
+					}
+
+					// вторая блокировка строки берется после паузы, чтобы транзакции успели пересечься
+					time.Sleep(10 * time.Millisecond)
+				}
+
+				return nil
+			})
+		}(i)
+	}
+
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("transaction %d: %v", i, err)
+		}
+	}
+
+	want := 100.0 + workers*10
+	for _, userId := range users {
+		assertBalance(t, storage{balance: balance}, userId, &want)
+	}
+}
+
+// operation - новая операция с текущим временем, как ее задают сервисы
+func operation() model.Operation {
+	return model.Operation{Id: uuid.New().String(), Time: time.Now().UTC().Truncate(time.Microsecond)}
+}
+
+func saveOk(t *testing.T, s storage, orderId string, userId string, serviceId string, sum float64, transactionType int, comment *string) {
+	t.Helper()
+
+	status, err := s.transaction.SaveTransaction(context.Background(), operation(), orderId, userId, serviceId, sum, transactionType, comment)
+	if err != nil || status != model.TransactionStatusOk {
+		t.Fatalf("SaveTransaction(%d) = %d, %v", transactionType, status, err)
+	}
+}
+
+func assertBalance(t *testing.T, s storage, userId string, want *float64) {
+	t.Helper()
+
+	balance, err := s.balance.GetBalanceByUserId(context.Background(), userId)
+	if err != nil {
+		t.Fatalf("GetBalanceByUserId: %v", err)
+	}
+
+	switch {
+	case want == nil && balance != nil:
+		t.Fatalf("balance = %v, want nil", *balance)
+	case want != nil && balance == nil:
+		t.Fatalf("balance = nil, want %v", *want)
+	case want != nil && *balance != *want:
+		t.Fatalf("balance = %v, want %v", *balance, *want)
+	}
+}
+
+func list(t *testing.T, s storage, request model.GetTransactionsRequest) []model.Transaction {
+	t.Helper()
+
+	transactions, err := s.transaction.GetTransactionListByUserId(context.Background(), request)
+	if err != nil {
+		t.Fatalf("GetTransactionListByUserId: %v", err)
+	}
+
+	return transactions
+}
+
+// less - порядок выдачи списка транзакций: поле сортировки, затем id в том же направлении
+func less(a model.Transaction, b model.Transaction, sortBy string, sortType string) bool {
+	if sortType == "desc" {
+		a, b = b, a
+	}
+
+	switch {
+	case sortBy == "sum" && a.Sum != b.Sum:
+		return a.Sum < b.Sum
+	case sortBy == "date" && !a.UpdTime.Equal(b.UpdTime):
+		return a.UpdTime.Before(b.UpdTime)
+	default:
+		return a.Id < b.Id
+	}
+}
+
+func assertSameOrder(t *testing.T, name string, got []model.Transaction, want []model.Transaction) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("%s pagination returned %d transactions, want %d", name, len(got), len(want))
+	}
+
+	for i := range want {
+		if got[i].Id != want[i].Id {
+			t.Fatalf("%s pagination: transaction %d = %s, want %s", name, i, got[i].Id, want[i].Id)
+		}
+	}
+}
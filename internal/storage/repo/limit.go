@@ -0,0 +1,255 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/avito-test/internal/config/tracing"
+	"github.com/avito-test/internal/model"
+	"github.com/avito-test/internal/storage/db"
+	"github.com/jackc/pgx/v4"
+)
+
+// LimitRepo - хранилище лимитов операций и уровней пользователей. Лимиты проверяют функции изменения баланса
+// (check_limits), репозиторий задает их и считает использование для вывода
+type LimitRepo interface {
+	// GetLimitRules возвращает все заданные лимиты по scope, scopeId, операции и периоду
+	GetLimitRules(ctx context.Context) ([]model.LimitRule, error)
+	// SetLimitRule задает лимит, существующий лимит с теми же scope, scopeId, операцией и периодом заменяется
+	SetLimitRule(ctx context.Context, rule model.LimitRule) error
+	// DeleteLimitRule удаляет лимит по scope, scopeId, операции и периоду rule, false - лимита не было
+	DeleteLimitRule(ctx context.Context, rule model.LimitRule) (bool, error)
+	// GetUserTier возвращает уровень пользователя, если уровень не задавался - nil
+	GetUserTier(ctx context.Context, userId string) (*model.UserTier, error)
+	// SetUserTier задает уровень пользователя
+	SetUserTier(ctx context.Context, tier model.UserTier) error
+	// GetEffectiveLimits возвращает действующие лимиты пользователя (самые частные) в порядке model.LimitOperations
+	// и model.LimitPeriods, операции и периоды без лимита пропускаются
+	GetEffectiveLimits(ctx context.Context, userId string) ([]model.LimitRule, error)
+	// GetLimitUsage возвращает сумму операций пользователя за [from, to), как ее считает check_limits
+	GetLimitUsage(ctx context.Context, userId string, operation model.LimitOperation, from time.Time, to time.Time) (float64, error)
+}
+
+type limitRepo struct {
+	dbClient db.Client
+}
+
+func NewLimitRepo(dbClient db.Client) LimitRepo {
+	return &limitRepo{dbClient: dbClient}
+}
+
+func (l *limitRepo) GetLimitRules(ctx context.Context) ([]model.LimitRule, error) {
+	ctx, span := tracing.StartDb(ctx, "get_limit_rules")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "get_limit_rules")
+	defer cancel()
+
+	rows, err := l.dbClient.Query(ctx, `
+SELECT r.scope, r.scope_id, r.operation, r.period, r.amount, r.updated_by, r.update_time
+FROM public.limit_rule r
+ORDER BY r.scope, r.scope_id, r.operation, r.period`)
+	if err != nil {
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	rules, err := scanLimitRules(rows)
+	if err != nil {
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+func (l *limitRepo) SetLimitRule(ctx context.Context, rule model.LimitRule) error {
+	ctx, span := tracing.StartDb(ctx, "set_limit_rule")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "set_limit_rule")
+	defer cancel()
+
+	err := db.Audited(ctx, l.dbClient, func(client db.Client) error {
+		_, err := client.Exec(ctx, `
+INSERT INTO public.limit_rule(scope, scope_id, operation, period, amount, updated_by, update_time)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (scope, scope_id, operation, period) DO UPDATE SET
+    amount = excluded.amount,
+    updated_by = excluded.updated_by,
+    update_time = excluded.update_time`,
+			rule.Scope,
+			rule.ScopeId,
+			rule.Operation,
+			rule.Period,
+			rule.Amount,
+			rule.UpdatedBy,
+			rule.UpdateTime)
+
+		return err
+	})
+	if err != nil {
+		tracing.Error(span, err)
+		return err
+	}
+
+	return nil
+}
+
+func (l *limitRepo) DeleteLimitRule(ctx context.Context, rule model.LimitRule) (bool, error) {
+	ctx, span := tracing.StartDb(ctx, "delete_limit_rule")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "delete_limit_rule")
+	defer cancel()
+
+	var deleted bool
+
+	err := db.Audited(ctx, l.dbClient, func(client db.Client) error {
+		tag, err := client.Exec(ctx, `
+DELETE FROM public.limit_rule
+WHERE scope = $1 AND scope_id = $2 AND operation = $3 AND period = $4`,
+			rule.Scope, rule.ScopeId, rule.Operation, rule.Period)
+
+		deleted = tag.RowsAffected() == 1
+
+		return err
+	})
+	if err != nil {
+		tracing.Error(span, err)
+		return false, err
+	}
+
+	return deleted, nil
+}
+
+func (l *limitRepo) GetUserTier(ctx context.Context, userId string) (*model.UserTier, error) {
+	ctx, span := tracing.StartDb(ctx, "get_user_tier")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "get_user_tier")
+	defer cancel()
+
+	tier := model.UserTier{UserId: userId}
+
+	if err := l.dbClient.QueryRow(ctx, `
+SELECT t.tier, t.updated_by, t.update_time
+FROM public.user_tier t
+WHERE t.user_id = $1`, userId).Scan(&tier.Tier, &tier.UpdatedBy, &tier.UpdateTime); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	return &tier, nil
+}
+
+func (l *limitRepo) SetUserTier(ctx context.Context, tier model.UserTier) error {
+	ctx, span := tracing.StartDb(ctx, "set_user_tier")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "set_user_tier")
+	defer cancel()
+
+	err := db.Audited(ctx, l.dbClient, func(client db.Client) error {
+		_, err := client.Exec(ctx, `
+INSERT INTO public.user_tier(user_id, tier, updated_by, update_time)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id) DO UPDATE SET
+    tier = excluded.tier,
+    updated_by = excluded.updated_by,
+    update_time = excluded.update_time`,
+			tier.UserId,
+			tier.Tier,
+			tier.UpdatedBy,
+			tier.UpdateTime)
+
+		return err
+	})
+	if err != nil {
+		tracing.Error(span, err)
+		return err
+	}
+
+	return nil
+}
+
+func (l *limitRepo) GetEffectiveLimits(ctx context.Context, userId string) ([]model.LimitRule, error) {
+	ctx, span := tracing.StartDb(ctx, "get_effective_limits")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "get_effective_limits")
+	defer cancel()
+
+	operations := make([]string, 0, len(model.LimitOperations))
+	for _, operation := range model.LimitOperations {
+		operations = append(operations, string(operation))
+	}
+
+	periods := make([]string, 0, len(model.LimitPeriods))
+	for _, period := range model.LimitPeriods {
+		periods = append(periods, string(period))
+	}
+
+	rows, err := l.dbClient.Query(ctx, `
+SELECT r.scope, r.scope_id, r.operation, r.period, r.amount, r.updated_by, r.update_time
+FROM unnest($2::varchar[]) WITH ORDINALITY o(operation, n)
+CROSS JOIN unnest($3::varchar[]) WITH ORDINALITY p(period, n)
+CROSS JOIN LATERAL public.limit_rule_for($1, o.operation, p.period) r
+ORDER BY o.n, p.n`, userId, operations, periods)
+	if err != nil {
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	rules, err := scanLimitRules(rows)
+	if err != nil {
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+func (l *limitRepo) GetLimitUsage(ctx context.Context, userId string, operation model.LimitOperation, from time.Time, to time.Time) (float64, error) {
+	ctx, span := tracing.StartDb(ctx, "get_limit_usage")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "get_limit_usage")
+	defer cancel()
+
+	var used float64
+
+	if err := l.dbClient.QueryRow(ctx, "SELECT public.limit_usage($1, $2, $3, $4)", userId, operation, from, to).Scan(&used); err != nil {
+		tracing.Error(span, err)
+		return 0, err
+	}
+
+	return used, nil
+}
+
+func scanLimitRules(rows pgx.Rows) ([]model.LimitRule, error) {
+	defer rows.Close()
+
+	rules := make([]model.LimitRule, 0)
+
+	for rows.Next() {
+		var rule model.LimitRule
+
+		if err := rows.Scan(&rule.Scope, &rule.ScopeId, &rule.Operation, &rule.Period, &rule.Amount, &rule.UpdatedBy, &rule.UpdateTime); err != nil {
+			return nil, err
+		}
+
+		rules = append(rules, rule)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
@@ -0,0 +1,79 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/avito-test/internal/config/tracing"
+	"github.com/avito-test/internal/model"
+	"github.com/avito-test/internal/storage/db"
+	"github.com/jackc/pgx/v4"
+)
+
+// OrderRepo - хранилище заказов, строки заказов хранятся как транзакции в TransactionRepo
+type OrderRepo interface {
+	// CreateOrder добавляет заказ с услугами строк serviceIds и временем создания createTime,
+	// если заказ с таким id уже есть - возвращает false
+	CreateOrder(ctx context.Context, orderId string, userId string, serviceIds []string, createTime time.Time) (bool, error)
+	// GetOrder возвращает заказ без строк, но с услугами строк, если не найден - nil
+	GetOrder(ctx context.Context, orderId string) (*model.Order, error)
+}
+
+type orderRepo struct {
+	dbClient db.Client
+}
+
+func NewOrderRepo(dbClient db.Client) OrderRepo {
+	return &orderRepo{dbClient: dbClient}
+}
+
+func (o *orderRepo) CreateOrder(ctx context.Context, orderId string, userId string, serviceIds []string, createTime time.Time) (bool, error) {
+	ctx, span := tracing.StartDb(ctx, "create_order")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "create_order")
+	defer cancel()
+
+	var created bool
+
+	err := db.Audited(ctx, o.dbClient, func(client db.Client) error {
+		tag, err := client.Exec(ctx, `
+INSERT INTO public.orders(order_id, user_id, service_ids, create_time)
+VALUES ($1, $2, $3::uuid[], $4)
+ON CONFLICT (order_id) DO NOTHING`, orderId, userId, serviceIds, createTime)
+		created = tag.RowsAffected() == 1
+
+		return err
+	})
+	if err != nil {
+		tracing.Error(span, err)
+		return false, err
+	}
+
+	return created, nil
+}
+
+func (o *orderRepo) GetOrder(ctx context.Context, orderId string) (*model.Order, error) {
+	ctx, span := tracing.StartDb(ctx, "get_order")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "get_order")
+	defer cancel()
+
+	var order model.Order
+
+	if err := o.dbClient.QueryRow(ctx, `
+SELECT o.order_id, o.user_id, o.service_ids::text[], o.create_time
+FROM public.orders o
+WHERE o.order_id = $1`, orderId).Scan(&order.Id, &order.UserId, &order.ServiceIds, &order.CreateTime); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	return &order, nil
+}
@@ -0,0 +1,190 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/avito-test/internal/config/tracing"
+	"github.com/avito-test/internal/model"
+	"github.com/avito-test/internal/storage/db"
+	"github.com/jackc/pgx/v4"
+)
+
+// OutboxChannel - канал NOTIFY, в который add_outbox_event передает userId нового события
+const OutboxChannel = "balance_events"
+
+// outboxLockKey - ключ advisory блокировки relay, события публикует только один инстанс сервиса
+const outboxLockKey = 7_040_001
+
+// OutboxRepo - события outbox: их добавляет add_outbox_event в транзакции изменения баланса, relay публикует их в брокер,
+// поток баланса читает события пользователя
+type OutboxRepo interface {
+	// TryLock берет advisory блокировку relay до конца транзакции бд, если ее держит другой инстанс - возвращает false
+	TryLock(ctx context.Context) (bool, error)
+	// GetUnpublished возвращает первые limit неопубликованных событий в порядке записи
+	GetUnpublished(ctx context.Context, limit int) ([]model.Event, error)
+	// GetUserEvents возвращает первые limit событий пользователя после события afterSequence
+	GetUserEvents(ctx context.Context, userId string, afterSequence int64, limit int) ([]model.Event, error)
+	// GetLastUserSequence возвращает sequence последнего события пользователя, если событий нет - 0
+	GetLastUserSequence(ctx context.Context, userId string) (int64, error)
+	// MarkPublished отмечает события опубликованными
+	MarkPublished(ctx context.Context, sequences []int64) error
+	// DeletePublished удаляет события, опубликованные больше retention назад, и возвращает их количество
+	DeletePublished(ctx context.Context, retention time.Duration) (int64, error)
+}
+
+type outboxRepo struct {
+	dbClient db.Client
+}
+
+func NewOutboxRepo(dbClient db.Client) OutboxRepo {
+	return &outboxRepo{dbClient: dbClient}
+}
+
+func (o *outboxRepo) TryLock(ctx context.Context) (bool, error) {
+	ctx, span := tracing.StartDb(ctx, "lock_outbox")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "lock_outbox")
+	defer cancel()
+
+	var locked bool
+
+	if err := o.dbClient.QueryRow(ctx, "SELECT pg_try_advisory_xact_lock($1)", outboxLockKey).Scan(&locked); err != nil {
+		tracing.Error(span, err)
+		return false, err
+	}
+
+	return locked, nil
+}
+
+func (o *outboxRepo) GetUnpublished(ctx context.Context, limit int) ([]model.Event, error) {
+	ctx, span := tracing.StartDb(ctx, "get_unpublished_events")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "get_unpublished_events")
+	defer cancel()
+
+	rows, err := o.dbClient.Query(ctx, `
+SELECT o.id, o.event_id, o.event_type, o.user_id, o.payload, o.create_time
+FROM public.outbox o
+WHERE o.publish_time IS NULL
+ORDER BY o.id
+LIMIT $1`, limit)
+	if err != nil {
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	events, err := scanEvents(rows)
+	if err != nil {
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func (o *outboxRepo) GetUserEvents(ctx context.Context, userId string, afterSequence int64, limit int) ([]model.Event, error) {
+	ctx, span := tracing.StartDb(ctx, "get_user_events")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "get_user_events")
+	defer cancel()
+
+	rows, err := o.dbClient.Query(ctx, `
+SELECT o.id, o.event_id, o.event_type, o.user_id, o.payload, o.create_time
+FROM public.outbox o
+WHERE o.user_id = $1 AND o.id > $2
+ORDER BY o.id
+LIMIT $3`, userId, afterSequence, limit)
+	if err != nil {
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	events, err := scanEvents(rows)
+	if err != nil {
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func (o *outboxRepo) GetLastUserSequence(ctx context.Context, userId string) (int64, error) {
+	ctx, span := tracing.StartDb(ctx, "get_last_user_sequence")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "get_last_user_sequence")
+	defer cancel()
+
+	var sequence int64
+
+	if err := o.dbClient.QueryRow(ctx, `
+SELECT COALESCE(MAX(o.id), 0)
+FROM public.outbox o
+WHERE o.user_id = $1`, userId).Scan(&sequence); err != nil {
+		tracing.Error(span, err)
+		return 0, err
+	}
+
+	return sequence, nil
+}
+
+func (o *outboxRepo) MarkPublished(ctx context.Context, sequences []int64) error {
+	ctx, span := tracing.StartDb(ctx, "mark_events_published")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "mark_events_published")
+	defer cancel()
+
+	if _, err := o.dbClient.Exec(ctx, `
+UPDATE public.outbox SET publish_time = CURRENT_TIMESTAMP
+WHERE id = ANY($1)`, sequences); err != nil {
+		tracing.Error(span, err)
+		return err
+	}
+
+	return nil
+}
+
+func (o *outboxRepo) DeletePublished(ctx context.Context, retention time.Duration) (int64, error) {
+	ctx, span := tracing.StartDb(ctx, "delete_published_events")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "delete_published_events")
+	defer cancel()
+
+	tag, err := o.dbClient.Exec(ctx, `
+DELETE FROM public.outbox
+WHERE publish_time IS NOT NULL AND publish_time < CURRENT_TIMESTAMP - $1::interval`, retention)
+	if err != nil {
+		tracing.Error(span, err)
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+func scanEvents(rows pgx.Rows) ([]model.Event, error) {
+	defer rows.Close()
+
+	events := make([]model.Event, 0)
+
+	for rows.Next() {
+		var event model.Event
+
+		if err := rows.Scan(&event.Sequence, &event.Id, &event.Type, &event.UserId, &event.Payload, &event.CreateTime); err != nil {
+			return nil, err
+		}
+
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
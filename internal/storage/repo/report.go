@@ -4,19 +4,31 @@ import (
 	"context"
 	"time"
 
+	"github.com/avito-test/internal/config/tracing"
 	"github.com/avito-test/internal/model"
 	"github.com/avito-test/internal/storage/db"
 )
 
-type ReportRepo struct {
+// ReportRepo - данные для отчетов
+type ReportRepo interface {
+	// GetReportRows возвращает выручку (подтвержденные резервации) по услугам за месяц, начинающийся с dateFrom
+	GetReportRows(ctx context.Context, dateFrom time.Time) ([]model.ReportRow, error)
+}
+
+type reportRepo struct {
 	dbClient db.Client
 }
 
 func NewReportRepo(dbClient db.Client) ReportRepo {
-	return ReportRepo{dbClient: dbClient}
+	return &reportRepo{dbClient: dbClient}
 }
 
-func (r *ReportRepo) GetReportRows(dateFrom time.Time) ([]model.ReportRow, error) {
+func (r *reportRepo) GetReportRows(ctx context.Context, dateFrom time.Time) ([]model.ReportRow, error) {
+	ctx, span := tracing.StartDb(ctx, "get_report_rows")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "get_report_rows")
+	defer cancel()
 
 	sqlRow := `
 SELECT t.service_id, SUM(t.sum) as "total_sum"
@@ -24,12 +36,15 @@ FROM public.transaction t
 WHERE t.transaction_type_id = 2 AND t.upd_time >= $1 AND t.upd_time < $2
 GROUP BY t.service_id`
 
-	rows, err := r.dbClient.Query(context.TODO(), sqlRow, dateFrom, dateFrom.AddDate(0, 1, 0))
+	rows, err := r.dbClient.Query(ctx, sqlRow, dateFrom, dateFrom.AddDate(0, 1, 0))
 
 	if err != nil {
+		tracing.Error(span, err)
 		return nil, err
 	}
 
+	defer rows.Close()
+
 	reportRows := make([]model.ReportRow, 0)
 
 	for rows.Next() {
@@ -38,11 +53,17 @@ GROUP BY t.service_id`
 		err = rows.Scan(&row.ServiceName, &row.TotalSum)
 
 		if err != nil {
+			tracing.Error(span, err)
 			return nil, err
 		}
 
 		reportRows = append(reportRows, row)
 	}
 
+	if err = rows.Err(); err != nil {
+		tracing.Error(span, err)
+		return nil, err
+	}
+
 	return reportRows, nil
 }
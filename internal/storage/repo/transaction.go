@@ -5,106 +5,366 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 
+	"github.com/avito-test/internal/config/tracing"
 	"github.com/avito-test/internal/model"
 	"github.com/avito-test/internal/storage/db"
+	"github.com/jackc/pgx/v4"
 )
 
-type TransactionRepo struct {
+// TransactionRepo - хранилище транзакций с историей состояний
+type TransactionRepo interface {
+	// SaveTransaction резервирует, подтверждает или отменяет резервацию по заказу, пользователю и услуге
+	// и возвращает статус операции (model.TransactionStatus*). Неуспешный статус не является ошибкой.
+	// Время изменения транзакции - время операции, id операции - id новой резервации и события
+	SaveTransaction(ctx context.Context, operation model.Operation, orderId string, userId string, serviceId string, sum float64, transactionType int, comment *string) (model.TransactionStatus, error)
+	GetTransactionListByUserId(ctx context.Context, request model.GetTransactionsRequest) ([]model.Transaction, error)
+	CountTransactionsByUserId(ctx context.Context, userId string, filter model.TransactionFilter) (int, error)
+	GetTransactionById(ctx context.Context, id string) (*model.Transaction, error)
+	GetTransactionByKey(ctx context.Context, orderId string, userId string, serviceId string) (*model.Transaction, error)
+	GetTransactionsByOrderId(ctx context.Context, orderId string) ([]model.Transaction, error)
+	GetTransactionStates(ctx context.Context, ids []string) (map[string][]model.TransactionState, error)
+}
+
+type transactionRepo struct {
 	dbClient db.Client
 }
 
 func NewTransactionRepo(dbClient db.Client) TransactionRepo {
-	return TransactionRepo{dbClient: dbClient}
+	return &transactionRepo{dbClient: dbClient}
 }
 
-func (t *TransactionRepo) SaveTransaction(orderId string, userId string, serviceId string, sum float64, transactionType int, comment *string) (int, error) {
-	sqlRow := "SELECT  public.\"save_transaction\"($1,$2,$3,$4,$5::smallint,$6) as \"status\""
+func (t *transactionRepo) SaveTransaction(ctx context.Context, operation model.Operation, orderId string, userId string, serviceId string, sum float64, transactionType int, comment *string) (model.TransactionStatus, error) {
+	ctx, span := tracing.StartDb(ctx, "save_transaction")
+	defer span.End()
 
-	var status int
+	ctx, cancel := db.WithTimeout(ctx, "save_transaction")
+	defer cancel()
+
+	sqlRow := "SELECT  public.\"save_transaction\"($1,$2,$3,$4,$5::smallint,$6,$7,$8) as \"status\""
 
-	if err := t.dbClient.QueryRow(
-		context.TODO(),
-		sqlRow,
-		orderId,
-		userId,
-		serviceId,
-		sum,
-		transactionType,
-		comment).Scan(&status); err != nil {
+	var status int
 
+	err := db.Audited(ctx, t.dbClient, func(client db.Client) error {
+		return client.QueryRow(
+			ctx,
+			sqlRow,
+			orderId,
+			userId,
+			serviceId,
+			sum,
+			transactionType,
+			comment,
+			operation.Id,
+			operation.Time).Scan(&status)
+	})
+	if err != nil {
+		tracing.Error(span, err)
 		return 0, err
 	}
 
-	return status, nil
+	return model.TransactionStatus(status), nil
 }
 
-func (t *TransactionRepo) GetTransactionListByUserId(userId string, offset int, limit int, sortBy string, sortType string) ([]model.Transaction, error) {
-	sortStr := "ORDER BY "
+// GetTransactionListByUserId возвращает страницу транзакций пользователя. Сортировка всегда дополняется id,
+// поэтому с курсором страница выбирается по ключу (keyset) без OFFSET
+func (t *transactionRepo) GetTransactionListByUserId(ctx context.Context, request model.GetTransactionsRequest) ([]model.Transaction, error) {
+	ctx, span := tracing.StartDb(ctx, "get_transaction_list_by_user_id")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "get_transaction_list_by_user_id")
+	defer cancel()
+
+	var sortColumn string
 
-	switch sortBy {
+	switch request.SortBy {
 	case "sum":
-		sortStr = sortStr + "t.sum"
+		sortColumn = "t.sum"
 	case "date":
-		sortStr = sortStr + "t.upd_time"
+		sortColumn = "t.upd_time"
 	default:
 		return nil, errors.New("invalid sortBy")
 	}
 
-	if sortType == "desc" {
-		sortStr = sortStr + " DESC"
+	sortDirection, compare := "ASC", ">"
+	if request.SortType == "desc" {
+		sortDirection, compare = "DESC", "<"
 	}
 
-	sqlRow := fmt.Sprintf(`
-SELECT t.order_id, t.service_id, t.sum, tt.type as "transaction_type", t.comment, t.upd_time
-FROM public.transaction t
-    LEFT JOIN public.transaction_type tt ON t.transaction_type_id = tt.id
-WHERE t.user_id = $1
-%s
-OFFSET %d
-LIMIT %d`, sortStr, offset, limit)
+	where, args := transactionFilter(request.UserId, request.Filter)
+
+	if request.Cursor != nil {
+		var cursorValue any = request.Cursor.UpdTime
+		if request.SortBy == "sum" {
+			cursorValue = request.Cursor.Sum
+		}
+
+		args = append(args, cursorValue, request.Cursor.Id)
+		where = fmt.Sprintf("%s AND (%s, t.id) %s ($%d, $%d::uuid)", where, sortColumn, compare, len(args)-1, len(args))
+	}
+
+	args = append(args, request.Limit)
+	sqlRow := fmt.Sprintf(`%s
+WHERE %s
+ORDER BY %s %s, t.id %s
+LIMIT $%d`, selectTransaction, where, sortColumn, sortDirection, sortDirection, len(args))
+
+	if request.Cursor == nil && request.Offset > 0 {
+		args = append(args, request.Offset)
+		sqlRow = fmt.Sprintf("%s\nOFFSET $%d", sqlRow, len(args))
+	}
 
-	rows, err := t.dbClient.Query(context.TODO(), sqlRow, userId)
+	rows, err := t.dbClient.Query(ctx, sqlRow, args...)
 
 	if err != nil {
+		tracing.Error(span, err)
 		return nil, err
 	}
 
+	defer rows.Close()
+
 	transactions := make([]model.Transaction, 0)
 
 	for rows.Next() {
-		var tr model.Transaction
+		tr, err := scanTransaction(rows)
 
-		var orderId sql.NullString
-		var serviceId sql.NullString
-		var comment sql.NullString
+		if err != nil {
+			tracing.Error(span, err)
+			return nil, err
+		}
+
+		transactions = append(transactions, *tr)
+	}
+
+	if err = rows.Err(); err != nil {
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	return transactions, nil
+}
+
+// CountTransactionsByUserId возвращает количество транзакций пользователя, подходящих под фильтр
+func (t *transactionRepo) CountTransactionsByUserId(ctx context.Context, userId string, filter model.TransactionFilter) (int, error) {
+	ctx, span := tracing.StartDb(ctx, "count_transactions_by_user_id")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "count_transactions_by_user_id")
+	defer cancel()
+
+	where, args := transactionFilter(userId, filter)
+
+	var count int
+
+	if err := t.dbClient.QueryRow(ctx, "SELECT count(*) FROM public.transaction t WHERE "+where, args...).Scan(&count); err != nil {
+		tracing.Error(span, err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// transactionFilter собирает условие WHERE по фильтру, значения передаются параметрами запроса
+func transactionFilter(userId string, filter model.TransactionFilter) (string, []any) {
+	args := []any{userId}
+	conditions := []string{"t.user_id = $1"}
+
+	add := func(condition string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if len(filter.TransactionTypeIds) > 0 {
+		add("t.transaction_type_id = ANY($%d)", filter.TransactionTypeIds)
+	}
+
+	if filter.DateFrom != nil {
+		add("t.upd_time >= $%d", filter.DateFrom.UTC())
+	}
+
+	if filter.DateTo != nil {
+		add("t.upd_time < $%d", filter.DateTo.UTC())
+	}
+
+	if filter.ServiceId != nil {
+		add("t.service_id = $%d", *filter.ServiceId)
+	}
+
+	if filter.OrderId != nil {
+		add("t.order_id = $%d", *filter.OrderId)
+	}
+
+	if filter.SumFrom != nil {
+		add("t.sum >= $%d", *filter.SumFrom)
+	}
+
+	if filter.SumTo != nil {
+		add("t.sum <= $%d", *filter.SumTo)
+	}
+
+	if filter.Comment != nil {
+		add("t.comment ILIKE $%d", "%"+likeEscaper.Replace(*filter.Comment)+"%")
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+const selectTransaction = `
+SELECT t.id, t.order_id, t.user_id, t.service_id, t.sum, t.transaction_type_id, tt.type as "transaction_type", t.comment, t.upd_time
+FROM public.transaction t
+    LEFT JOIN public.transaction_type tt ON t.transaction_type_id = tt.id`
+
+// GetTransactionById возвращает транзакцию по id, если не найдена - nil
+func (t *transactionRepo) GetTransactionById(ctx context.Context, id string) (*model.Transaction, error) {
+	ctx, span := tracing.StartDb(ctx, "get_transaction_by_id")
+	defer span.End()
 
-		err = rows.Scan(&orderId, &serviceId, &tr.Sum, &tr.TransactionType, &comment, &tr.UpdTime)
+	ctx, cancel := db.WithTimeout(ctx, "get_transaction_by_id")
+	defer cancel()
 
+	tr, err := scanTransaction(t.dbClient.QueryRow(ctx, selectTransaction+`
+WHERE t.id = $1`, id))
+	if err != nil {
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	return tr, nil
+}
+
+// GetTransactionByKey возвращает транзакцию по заказу, пользователю и услуге, если не найдена - nil
+func (t *transactionRepo) GetTransactionByKey(ctx context.Context, orderId string, userId string, serviceId string) (*model.Transaction, error) {
+	ctx, span := tracing.StartDb(ctx, "get_transaction_by_key")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "get_transaction_by_key")
+	defer cancel()
+
+	tr, err := scanTransaction(t.dbClient.QueryRow(ctx, selectTransaction+`
+WHERE t.order_id = $1 AND t.user_id = $2 AND t.service_id = $3`, orderId, userId, serviceId))
+	if err != nil {
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	return tr, nil
+}
+
+// GetTransactionsByOrderId возвращает все транзакции заказа
+func (t *transactionRepo) GetTransactionsByOrderId(ctx context.Context, orderId string) ([]model.Transaction, error) {
+	ctx, span := tracing.StartDb(ctx, "get_transactions_by_order_id")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "get_transactions_by_order_id")
+	defer cancel()
+
+	rows, err := t.dbClient.Query(ctx, selectTransaction+`
+WHERE t.order_id = $1
+ORDER BY t.upd_time, t.id`, orderId)
+	if err != nil {
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	transactions := make([]model.Transaction, 0)
+
+	for rows.Next() {
+		tr, err := scanTransaction(rows)
 		if err != nil {
+			tracing.Error(span, err)
 			return nil, err
 		}
 
-		if orderId.Valid {
-			tr.OrderId = &orderId.String
-		} else {
-			tr.OrderId = nil
-		}
+		transactions = append(transactions, *tr)
+	}
+
+	if err = rows.Err(); err != nil {
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	return transactions, nil
+}
 
-		if serviceId.Valid {
-			tr.ServiceId = &serviceId.String
-		} else {
-			tr.ServiceId = nil
+// GetTransactionStates возвращает прошлые состояния транзакций из transaction_upd по id транзакций, по времени
+func (t *transactionRepo) GetTransactionStates(ctx context.Context, ids []string) (map[string][]model.TransactionState, error) {
+	ctx, span := tracing.StartDb(ctx, "get_transaction_states")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "get_transaction_states")
+	defer cancel()
+
+	rows, err := t.dbClient.Query(ctx, `
+SELECT u.id, u.transaction_type_id, tt.type as "transaction_type", u.sum, u.comment, u.upd_time
+FROM public.transaction_upd u
+    LEFT JOIN public.transaction_type tt ON u.transaction_type_id = tt.id
+WHERE u.id = ANY($1::uuid[])
+ORDER BY u.upd_time`, ids)
+	if err != nil {
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	states := make(map[string][]model.TransactionState, len(ids))
+
+	for rows.Next() {
+		var id string
+		var state model.TransactionState
+		var comment sql.NullString
+
+		if err = rows.Scan(&id, &state.TransactionTypeId, &state.TransactionType, &state.Sum, &comment, &state.UpdTime); err != nil {
+			tracing.Error(span, err)
+			return nil, err
 		}
 
 		if comment.Valid {
-			tr.Comment = &comment.String
-		} else {
-			tr.Comment = nil
+			state.Comment = &comment.String
 		}
 
-		transactions = append(transactions, tr)
+		states[id] = append(states[id], state)
 	}
 
-	return transactions, nil
+	if err = rows.Err(); err != nil {
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	return states, nil
+}
+
+func scanTransaction(row pgx.Row) (*model.Transaction, error) {
+	var tr model.Transaction
+
+	var orderId sql.NullString
+	var serviceId sql.NullString
+	var comment sql.NullString
+
+	if err := row.Scan(&tr.Id, &orderId, &tr.UserId, &serviceId, &tr.Sum, &tr.TransactionTypeId, &tr.TransactionType, &comment, &tr.UpdTime); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	if orderId.Valid {
+		tr.OrderId = &orderId.String
+	}
+
+	if serviceId.Valid {
+		tr.ServiceId = &serviceId.String
+	}
+
+	if comment.Valid {
+		tr.Comment = &comment.String
+	}
+
+	return &tr, nil
 }
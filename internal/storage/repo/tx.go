@@ -0,0 +1,54 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/avito-test/internal/storage/db"
+)
+
+// Repos - репозитории поверх одного клиента бд (пула или транзакции)
+type Repos struct {
+	Balance     BalanceRepo
+	Transaction TransactionRepo
+	Account     AccountRepo
+	Limit       LimitRepo
+	Order       OrderRepo
+	Outbox      OutboxRepo
+	Webhook     WebhookRepo
+	Adjustment  AdjustmentRepo
+	Audit       AuditRepo
+}
+
+func NewRepos(dbClient db.Client) Repos {
+	return Repos{
+		Balance:     NewBalanceRepo(dbClient),
+		Transaction: NewTransactionRepo(dbClient),
+		Account:     NewAccountRepo(dbClient),
+		Limit:       NewLimitRepo(dbClient),
+		Order:       NewOrderRepo(dbClient),
+		Outbox:      NewOutboxRepo(dbClient),
+		Webhook:     NewWebhookRepo(dbClient),
+		Adjustment:  NewAdjustmentRepo(dbClient),
+		Audit:       NewAuditRepo(dbClient),
+	}
+}
+
+// Transactor выполняет несколько операций репозиториев в одной транзакции бд
+type Transactor interface {
+	// InTx выполняет fn с репозиториями поверх новой транзакции бд, при ошибке fn все изменения откатываются
+	InTx(ctx context.Context, fn func(repos Repos) error) error
+}
+
+type transactor struct {
+	dbClient db.Client
+}
+
+func NewTransactor(dbClient db.Client) Transactor {
+	return &transactor{dbClient: dbClient}
+}
+
+func (t *transactor) InTx(ctx context.Context, fn func(repos Repos) error) error {
+	return db.InTx(ctx, t.dbClient, func(tx db.Client) error {
+		return fn(NewRepos(tx))
+	})
+}
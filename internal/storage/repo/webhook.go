@@ -0,0 +1,360 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/avito-test/internal/config/tracing"
+	"github.com/avito-test/internal/model"
+	"github.com/avito-test/internal/storage/db"
+	"github.com/jackc/pgx/v4"
+)
+
+// WebhookRepo - хранилище подписок webhook и доставок событий подписчикам
+type WebhookRepo interface {
+	// CreateSubscription добавляет подписку, id и время создания задает сервис
+	CreateSubscription(ctx context.Context, subscription model.WebhookSubscription) (model.WebhookSubscription, error)
+	// GetSubscriptions возвращает подписки по времени создания
+	GetSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error)
+	// GetSubscription возвращает подписку по id, если не найдена - nil
+	GetSubscription(ctx context.Context, id string) (*model.WebhookSubscription, error)
+	// DeleteSubscription удаляет подписку вместе с доставками, если подписка не найдена - возвращает false
+	DeleteSubscription(ctx context.Context, id string) (bool, error)
+	// GetDeliveries возвращает последние limit доставок подписки, status - необязательный фильтр
+	GetDeliveries(ctx context.Context, subscriptionId string, status *model.WebhookDeliveryStatus, limit int) ([]model.WebhookDelivery, error)
+	// Redeliver ставит доставку подписки в очередь на немедленную отправку с новым счетчиком попыток, если не найдена - nil
+	Redeliver(ctx context.Context, subscriptionId string, id string) (*model.WebhookDelivery, error)
+	// ClaimDue выбирает до limit доставок, время отправки которых пришло, и откладывает их на lease,
+	// чтобы другие инстансы не отправили их одновременно. Если отправка не будет записана, доставка повторится после lease
+	ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]model.WebhookDelivery, error)
+	// SaveAttempt записывает результат попытки отправки: статус, счетчик попыток, время следующей попытки и ответ подписчика
+	SaveAttempt(ctx context.Context, delivery model.WebhookDelivery) error
+}
+
+type webhookRepo struct {
+	dbClient db.Client
+}
+
+func NewWebhookRepo(dbClient db.Client) WebhookRepo {
+	return &webhookRepo{dbClient: dbClient}
+}
+
+const selectSubscription = `
+SELECT s.id, s.url, s.event_types, s.service_id, s.secret, s.create_time
+FROM public.webhook_subscription s`
+
+func (w *webhookRepo) CreateSubscription(ctx context.Context, subscription model.WebhookSubscription) (model.WebhookSubscription, error) {
+	ctx, span := tracing.StartDb(ctx, "create_webhook_subscription")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "create_webhook_subscription")
+	defer cancel()
+
+	err := db.Audited(ctx, w.dbClient, func(client db.Client) error {
+		_, err := client.Exec(ctx, `
+INSERT INTO public.webhook_subscription(id, url, event_types, service_id, secret, create_time)
+VALUES ($1, $2, $3, $4, $5, $6)`,
+			subscription.Id,
+			subscription.Url,
+			subscription.EventTypes,
+			subscription.ServiceId,
+			subscription.Secret,
+			subscription.CreateTime)
+
+		return err
+	})
+	if err != nil {
+		tracing.Error(span, err)
+		return model.WebhookSubscription{}, err
+	}
+
+	return subscription, nil
+}
+
+func (w *webhookRepo) GetSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error) {
+	ctx, span := tracing.StartDb(ctx, "get_webhook_subscriptions")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "get_webhook_subscriptions")
+	defer cancel()
+
+	rows, err := w.dbClient.Query(ctx, selectSubscription+`
+ORDER BY s.create_time`)
+	if err != nil {
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	subscriptions := make([]model.WebhookSubscription, 0)
+
+	for rows.Next() {
+		subscription, err := scanSubscription(rows)
+		if err != nil {
+			tracing.Error(span, err)
+			return nil, err
+		}
+
+		subscriptions = append(subscriptions, *subscription)
+	}
+
+	if err = rows.Err(); err != nil {
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	return subscriptions, nil
+}
+
+func (w *webhookRepo) GetSubscription(ctx context.Context, id string) (*model.WebhookSubscription, error) {
+	ctx, span := tracing.StartDb(ctx, "get_webhook_subscription")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "get_webhook_subscription")
+	defer cancel()
+
+	subscription, err := scanSubscription(w.dbClient.QueryRow(ctx, selectSubscription+`
+WHERE s.id = $1`, id))
+	if err != nil {
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	return subscription, nil
+}
+
+func (w *webhookRepo) DeleteSubscription(ctx context.Context, id string) (bool, error) {
+	ctx, span := tracing.StartDb(ctx, "delete_webhook_subscription")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "delete_webhook_subscription")
+	defer cancel()
+
+	var deleted bool
+
+	err := db.Audited(ctx, w.dbClient, func(client db.Client) error {
+		tag, err := client.Exec(ctx, "DELETE FROM public.webhook_subscription WHERE id = $1", id)
+		deleted = tag.RowsAffected() == 1
+
+		return err
+	})
+	if err != nil {
+		tracing.Error(span, err)
+		return false, err
+	}
+
+	return deleted, nil
+}
+
+const deliveryColumns = `d.id, d.subscription_id, d.event_id, d.event_sequence, d.event_type, d.user_id, d.payload, d.event_time,
+    d.status, d.attempts, d.next_attempt_time, d.last_attempt_time, d.last_status_code, d.last_error`
+
+func (w *webhookRepo) GetDeliveries(ctx context.Context, subscriptionId string, status *model.WebhookDeliveryStatus, limit int) ([]model.WebhookDelivery, error) {
+	ctx, span := tracing.StartDb(ctx, "get_webhook_deliveries")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "get_webhook_deliveries")
+	defer cancel()
+
+	rows, err := w.dbClient.Query(ctx, `
+SELECT `+deliveryColumns+`
+FROM public.webhook_delivery d
+WHERE d.subscription_id = $1 AND ($2::varchar IS NULL OR d.status = $2)
+ORDER BY d.event_sequence DESC
+LIMIT $3`, subscriptionId, status, limit)
+	if err != nil {
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	deliveries := make([]model.WebhookDelivery, 0)
+
+	for rows.Next() {
+		delivery, err := scanDelivery(rows, false)
+		if err != nil {
+			tracing.Error(span, err)
+			return nil, err
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err = rows.Err(); err != nil {
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+func (w *webhookRepo) Redeliver(ctx context.Context, subscriptionId string, id string) (*model.WebhookDelivery, error) {
+	ctx, span := tracing.StartDb(ctx, "redeliver_webhook")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "redeliver_webhook")
+	defer cancel()
+
+	var delivery model.WebhookDelivery
+
+	err := db.Audited(ctx, w.dbClient, func(client db.Client) error {
+		var err error
+
+		delivery, err = scanDelivery(client.QueryRow(ctx, `
+UPDATE public.webhook_delivery d SET
+    status = 'pending',
+    attempts = 0,
+    next_attempt_time = CURRENT_TIMESTAMP
+WHERE d.id = $1 AND d.subscription_id = $2
+RETURNING `+deliveryColumns, id, subscriptionId), false)
+
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	return &delivery, nil
+}
+
+func (w *webhookRepo) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]model.WebhookDelivery, error) {
+	ctx, span := tracing.StartDb(ctx, "claim_webhook_deliveries")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "claim_webhook_deliveries")
+	defer cancel()
+
+	rows, err := w.dbClient.Query(ctx, `
+UPDATE public.webhook_delivery d SET
+    next_attempt_time = CURRENT_TIMESTAMP + $2::interval
+FROM public.webhook_subscription s
+WHERE s.id = d.subscription_id AND d.id IN (
+    SELECT p.id
+    FROM public.webhook_delivery p
+    WHERE p.status = 'pending' AND p.next_attempt_time <= CURRENT_TIMESTAMP
+    ORDER BY p.next_attempt_time
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED)
+RETURNING `+deliveryColumns+`, s.url, s.secret`, limit, lease)
+	if err != nil {
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	deliveries := make([]model.WebhookDelivery, 0)
+
+	for rows.Next() {
+		delivery, err := scanDelivery(rows, true)
+		if err != nil {
+			tracing.Error(span, err)
+			return nil, err
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err = rows.Err(); err != nil {
+		tracing.Error(span, err)
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+func (w *webhookRepo) SaveAttempt(ctx context.Context, delivery model.WebhookDelivery) error {
+	ctx, span := tracing.StartDb(ctx, "save_webhook_attempt")
+	defer span.End()
+
+	ctx, cancel := db.WithTimeout(ctx, "save_webhook_attempt")
+	defer cancel()
+
+	if _, err := w.dbClient.Exec(ctx, `
+UPDATE public.webhook_delivery SET
+    status = $2,
+    attempts = $3,
+    next_attempt_time = $4,
+    last_attempt_time = $5,
+    last_status_code = $6,
+    last_error = $7
+WHERE id = $1`,
+		delivery.Id,
+		delivery.Status,
+		delivery.Attempts,
+		delivery.NextAttemptTime,
+		delivery.LastAttemptTime,
+		delivery.LastStatusCode,
+		delivery.LastError); err != nil {
+
+		tracing.Error(span, err)
+		return err
+	}
+
+	return nil
+}
+
+func scanSubscription(row pgx.Row) (*model.WebhookSubscription, error) {
+	var subscription model.WebhookSubscription
+	var serviceId sql.NullString
+
+	if err := row.Scan(&subscription.Id, &subscription.Url, &subscription.EventTypes, &serviceId, &subscription.Secret, &subscription.CreateTime); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	if serviceId.Valid {
+		subscription.ServiceId = &serviceId.String
+	}
+
+	return &subscription, nil
+}
+
+// scanDelivery читает колонки deliveryColumns, с withSubscription - еще url и secret подписки
+func scanDelivery(row pgx.Row, withSubscription bool) (model.WebhookDelivery, error) {
+	var delivery model.WebhookDelivery
+	var lastAttemptTime sql.NullTime
+	var lastStatusCode sql.NullInt32
+	var lastError sql.NullString
+
+	dest := []any{
+		&delivery.Id, &delivery.SubscriptionId,
+		&delivery.Event.Id, &delivery.Event.Sequence, &delivery.Event.Type, &delivery.Event.UserId, &delivery.Event.Payload, &delivery.Event.CreateTime,
+		&delivery.Status, &delivery.Attempts, &delivery.NextAttemptTime, &lastAttemptTime, &lastStatusCode, &lastError,
+	}
+
+	if withSubscription {
+		dest = append(dest, &delivery.Url, &delivery.Secret)
+	}
+
+	if err := row.Scan(dest...); err != nil {
+		return model.WebhookDelivery{}, err
+	}
+
+	if lastAttemptTime.Valid {
+		delivery.LastAttemptTime = &lastAttemptTime.Time
+	}
+
+	if lastStatusCode.Valid {
+		code := int(lastStatusCode.Int32)
+		delivery.LastStatusCode = &code
+	}
+
+	if lastError.Valid {
+		delivery.LastError = &lastError.String
+	}
+
+	return delivery, nil
+}
@@ -0,0 +1,32 @@
+package webhook
+
+import (
+	"errors"
+	"net"
+	"strings"
+)
+
+// ErrForbiddenAddress - адрес подписчика во внутренней сети сервиса
+var ErrForbiddenAddress = errors.New("address is private, loopback or link-local")
+
+// PublicIP возвращает false для адресов, через которые подписка могла бы обратиться к внутренним сервисам (SSRF):
+// loopback, частных сетей, link-local (в том числе метаданных облака 169.254.169.254) и неуказанного адреса
+func PublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified())
+}
+
+// CheckHost проверяет хост адреса подписки без обращения к DNS: ip должен быть публичным, имя - не localhost.
+// Адрес имени хоста может измениться после создания подписки, поэтому Sender проверяет его при каждом соединении
+func CheckHost(host string) error {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrForbiddenAddress
+	}
+
+	if ip := net.ParseIP(host); ip != nil && !PublicIP(ip) {
+		return ErrForbiddenAddress
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/avito-test/internal/config/clock"
+	"github.com/avito-test/internal/model"
+	"github.com/avito-test/internal/publisher"
+)
+
+const (
+	HeaderId        = "X-Webhook-Id"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Sender отправляет события подписчикам webhook
+type Sender struct {
+	client *http.Client
+	clock  clock.Clock
+}
+
+// NewSender создает отправителя с таймаутом запроса timeout, время подписи берется из clk. Соединение открывается только
+// с ip, для которого allowed возвращает true (в сервисе - PublicIP): ip проверяется после разрешения имени хоста, поэтому
+// имя, которое после создания подписки стало указывать во внутреннюю сеть, тоже отклоняется. Прокси из окружения не
+// используется, редиректы не выполняются - ответ 3xx считается неудачной попыткой
+func NewSender(timeout time.Duration, clk clock.Clock, allowed func(ip net.IP) bool) *Sender {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			if ip := net.ParseIP(host); ip == nil || !allowed(ip) {
+				return ErrForbiddenAddress
+			}
+
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &Sender{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		clock: clk,
+	}
+}
+
+// Send отправляет событие POST запросом на url и возвращает код ответа.
+// Ошибка возвращается, только если ответ не получен
+func (s *Sender) Send(ctx context.Context, url string, secret string, event model.Event) (int, error) {
+	body, err := publisher.Encode(event)
+	if err != nil {
+		return 0, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(HeaderId, event.Id)
+	request.Header.Set(HeaderEvent, event.Type)
+	request.Header.Set(HeaderSignature, Signature(secret, s.clock.Now().Unix(), body))
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+
+	defer response.Body.Close()
+
+	// дочитываем ответ, чтобы соединение вернулось в пул
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	return response.StatusCode, nil
+}
+
+// Signature возвращает заголовок подписи "t=<unix время>,v1=<hex HMAC-SHA256(secret, "<t>.<body>")>".
+// Время входит в подпись, чтобы подписчик мог отклонять повторно отправленные старые запросы
+func Signature(secret string, timestamp int64, body []byte) string {
+	t := strconv.FormatInt(timestamp, 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,143 @@
+package webhook_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/avito-test/internal/config/clock"
+	"github.com/avito-test/internal/model"
+	"github.com/avito-test/internal/webhook"
+)
+
+var now = time.Date(2022, time.November, 1, 10, 0, 0, 0, time.UTC)
+
+func TestSignature(t *testing.T) {
+	const want = "t=1667296800,v1=b6c33c0bc0a6c44ba018dacfe43f8dfcea38576980f9a3328002644ceaea9cbe"
+
+	if got := webhook.Signature("whsec_test", now.Unix(), []byte(`{"id":"e1"}`)); got != want {
+		t.Fatalf("Signature = %s, want %s", got, want)
+	}
+
+	// время входит в подпись: старый запрос нельзя отправить повторно с новым временем
+	for _, other := range []string{
+		webhook.Signature("whsec_other", now.Unix(), []byte(`{"id":"e1"}`)),
+		webhook.Signature("whsec_test", now.Unix()+1, []byte(`{"id":"e1"}`)),
+		webhook.Signature("whsec_test", now.Unix(), []byte(`{"id":"e2"}`)),
+	} {
+		if other[len("t=1667296800,"):] == want[len("t=1667296800,"):] {
+			t.Fatalf("Signature %s has the same mac as %s", other, want)
+		}
+	}
+}
+
+func TestCheckHost(t *testing.T) {
+	tests := []struct {
+		host    string
+		allowed bool
+	}{
+		{"partner.example.com", true},
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"localhost", false},
+		{"api.localhost", false},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.0.0.5", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"fd00::1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"0.0.0.0", false},
+		{"::ffff:127.0.0.1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			err := webhook.CheckHost(tt.host)
+			if allowed := err == nil; allowed != tt.allowed {
+				t.Fatalf("CheckHost(%s) = %v, want allowed %v", tt.host, err, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestSend(t *testing.T) {
+	allowAll := func(net.IP) bool { return true }
+
+	event := model.Event{Sequence: 1, Id: "e1", Type: "deposit", UserId: "u1", Payload: []byte(`{"sum":100}`), CreateTime: now}
+
+	t.Run("signed", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+
+			if r.Header.Get(webhook.HeaderSignature) != webhook.Signature("secret", now.Unix(), body) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			if r.Header.Get(webhook.HeaderId) != event.Id || r.Header.Get(webhook.HeaderEvent) != event.Type {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		sender := webhook.NewSender(time.Second, clock.NewManual(now, 0), allowAll)
+
+		if status, err := sender.Send(context.Background(), server.URL, "secret", event); err != nil || status != http.StatusNoContent {
+			t.Fatalf("Send = %d, %v, want %d", status, err, http.StatusNoContent)
+		}
+	})
+
+	// httptest слушает loopback: с PublicIP соединение не открывается, даже если имя хоста не похоже на внутреннее
+	t.Run("private", func(t *testing.T) {
+		var requests int32
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+		}))
+		defer server.Close()
+
+		sender := webhook.NewSender(time.Second, clock.NewManual(now, 0), webhook.PublicIP)
+
+		if _, err := sender.Send(context.Background(), server.URL, "secret", event); !errors.Is(err, webhook.ErrForbiddenAddress) {
+			t.Fatalf("Send error = %v, want %v", err, webhook.ErrForbiddenAddress)
+		}
+
+		if atomic.LoadInt32(&requests) != 0 {
+			t.Fatal("request reached private address")
+		}
+	})
+
+	t.Run("redirect", func(t *testing.T) {
+		var redirected int32
+
+		target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&redirected, 1)
+		}))
+		defer target.Close()
+
+		server := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+		defer server.Close()
+
+		sender := webhook.NewSender(time.Second, clock.NewManual(now, 0), allowAll)
+
+		if status, err := sender.Send(context.Background(), server.URL, "secret", event); err != nil || status != http.StatusTemporaryRedirect {
+			t.Fatalf("Send = %d, %v, want %d", status, err, http.StatusTemporaryRedirect)
+		}
+
+		if atomic.LoadInt32(&redirected) != 0 {
+			t.Fatal("redirect followed")
+		}
+	})
+}